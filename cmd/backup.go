@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/backends"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/boltbackend"
+)
+
+// Write a consistent copy of the embedded database to a new file. The database file
+// is locked while the server is running, so this is run with the server stopped.
+func backup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	configFile := flags.String("config", "test.cfg", "path to the config file")
+	out := flags.String("out", "", "path of the backup file to create")
+	flags.Parse(args)
+
+	if *out == "" {
+		log.Fatal("-out is required")
+	}
+
+	cfg := config.GetConfig(*configFile)
+	if cfg.Backend != backends.BackendBolt {
+		log.Fatalf("backup is only supported for the %s backend", backends.BackendBolt)
+	}
+
+	db, err := boltbackend.Open(cfg.DataFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.BackupFile(*out)
+	if err != nil {
+		log.Fatalf("backup failed: %v", err)
+	}
+	log.Printf("Backed up %s to %s", cfg.DataFile, *out)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/backends"
+)
+
+// Actor recorded in the audit log for changes made by the bootstrap command
+const bootstrapActor = "bootstrap"
+
+// Create an organization and its first admin key directly in the configured backend, for the
+// initial setup of a server before anyone can call its API. The secret of the key is printed
+// on stdout and cannot be retrieved again.
+func bootstrap(args []string) {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	configFile := flags.String("config", "test.cfg", "path to the config file")
+	orgName := flags.String("org", "", "name of the organization to create")
+	keyName := flags.String("key-name", "admin", "name of the admin key to create")
+	flags.Parse(args)
+
+	if *orgName == "" {
+		log.Fatal("-org is required")
+	}
+
+	cfg := config.GetConfig(*configFile)
+	providers, err := backends.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer providers.Close()
+
+	created, err := services.BootstrapOrganization(providers, *orgName, *keyName)
+	if err != nil {
+		log.Fatalf("bootstrap failed: %v", err)
+	}
+
+	org, key := created.Organization, created.ApiKey
+	redacted := key.WithoutSecret()
+	redacted.Salt, redacted.Hash = "", ""
+	recordBootstrap(providers, org.Id, services.AuditResourceOrganization, org.Id, org)
+	recordBootstrap(providers, org.Id, services.AuditResourceApiKey, key.Id, redacted)
+	recordBootstrap(providers, org.Id, services.AuditResourceRoleBinding, created.RoleBinding.Id, created.RoleBinding)
+	if err = providers.History.RecordSnapshot(services.NewOrganizationSnapshot(org)); err != nil {
+		log.Printf("failed to snapshot variables of organization %s: %v", org.Id, err)
+	}
+
+	log.Printf("Created organization %s (%s) with admin key %s", org.Name, org.Id, key.Id)
+	fmt.Println(key.Key)
+}
+
+// Records the creation of a resource in the audit log. A failure is logged as the resource has
+// already been created.
+func recordBootstrap(providers *services.Providers, orgId string, resourceType string, resourceId string, after interface{}) {
+	snapshot, err := json.Marshal(after)
+	if err == nil {
+		err = providers.Audit.RecordEvent(services.NewAuditEvent(services.AuditEvent{
+			OrganizationId: orgId,
+			Actor:          bootstrapActor,
+			Action:         services.AuditActionCreate,
+			ResourceType:   resourceType,
+			ResourceId:     resourceId,
+			After:          snapshot,
+		}))
+	}
+	if err != nil {
+		log.Printf("failed to record audit event for %s %s: %v", resourceType, resourceId, err)
+	}
+}
@@ -1,12 +1,63 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"github.com/MrWestbury/terraxen-naming-service/internals/apis"
 	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/backends"
 )
 
 func main() {
-	cfg := config.GetConfig("test.cfg")
-	api := apis.NewApi(cfg)
-	api.Run(":7070")
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "backup":
+		backup(args)
+	case "migrate":
+		migrate(args)
+	case "bootstrap":
+		bootstrap(args)
+	default:
+		log.Fatalf("unknown command: %s", command)
+	}
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFile := flags.String("config", "test.cfg", "path to the config file")
+	listen := flags.String("listen", ":7070", "address to listen on")
+	flags.Parse(args)
+
+	cfg := config.GetConfig(*configFile)
+	providers, err := backends.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer providers.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	api, err := apis.NewApi(cfg, providers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = api.Run(ctx, *listen)
+	if err != nil {
+		log.Printf("server stopped: %v", err)
+	}
 }
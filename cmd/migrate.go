@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/backends"
+)
+
+// Apply the pending data migrations of the configured backend, or report them with -dry-run.
+// -status lists the applied migrations as well.
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFile := flags.String("config", "test.cfg", "path to the config file")
+	dryRun := flags.Bool("dry-run", false, "report the pending migrations without applying them")
+	status := flags.Bool("status", false, "list the applied and pending migrations")
+	flags.Parse(args)
+
+	cfg := config.GetConfig(*configFile)
+	providers, err := backends.Open(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer providers.Close()
+
+	if providers.Migrator == nil {
+		log.Printf("The %s backend has no migrations", cfg.Backend)
+		return
+	}
+
+	if *status {
+		applied, err := providers.Migrator.AppliedMigrations()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d: %s (%s)", m.Version, m.Description, m.AppliedAt.Format(time.RFC3339))
+		}
+		*dryRun = true
+	}
+
+	pending, err := services.RunMigrations(providers.Migrator, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case len(pending) == 0:
+		log.Printf("The database is up to date")
+	case *dryRun:
+		log.Printf("%d migrations are pending", len(pending))
+	default:
+		log.Printf("Applied %d migrations", len(pending))
+	}
+}
@@ -1,86 +1,202 @@
 package apis
 
 import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
 	"github.com/MrWestbury/terraxen-naming-service/internals/config"
-	"github.com/MrWestbury/terraxen-naming-service/internals/services/mongobackend"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/gin-gonic/gin"
 )
 
 type Api struct {
-	router *gin.Engine
+	router        *gin.Engine
+	providers     *services.Providers
+	purgeInterval time.Duration
 }
 
-func NewApi(config *config.Config) *Api {
-	orgService := mongobackend.NewOrganizationService(config)
-	nsService := mongobackend.NewNamespaceService(config)
-	schemaService := mongobackend.NewSchemaService(config)
-	apiKeyService := mongobackend.NewApiKeyService(config)
+func NewApi(config *config.Config, providers *services.Providers) (*Api, error) {
+	orgService := providers.Organizations
+	nsService := providers.Namespaces
+	schemaService := providers.Schemas
+	apiKeyService := providers.ApiKeys
+	auditor := NewAuditor(providers.Audit)
+	history := NewVariableHistory(providers.History, orgService, nsService, schemaService)
+
+	jwtVerifier, err := NewJWTVerifier(config.Auth.JWT)
+	if err != nil {
+		return nil, err
+	}
+	oidcVerifier, err := NewOIDCVerifier(config.Auth.OIDC, &http.Client{Timeout: oidcRequestTimeout})
+	if err != nil {
+		return nil, err
+	}
 
+	purgeInterval := time.Duration(config.Organizations.PurgeIntervalSeconds) * time.Second
+	if purgeInterval <= 0 {
+		purgeInterval = defaultPurgeInterval
+	}
 	api := &Api{
-		router: gin.Default(),
+		router:        gin.Default(),
+		providers:     providers,
+		purgeInterval: purgeInterval,
 	}
 
-	middleware := NewMiddlewares(apiKeyService)
+	middleware := NewMiddlewares(apiKeyService, orgService, config.Admin.Token, jwtVerifier, oidcVerifier)
+	api.router.Use(middleware.RequestId)
 
 	apiGroup := api.router.Group("/api")
 	apiGroup.Use(middleware.ValidateRequest)
 	v1Group := apiGroup.Group("/v1")
 
+	authz := NewAuthorizer(providers.RoleBindings, nsService)
+
 	// Organization API
-	orgHandler := NewOrganizationHandler(orgService)
+	orgHandler := NewOrganizationHandler(providers, authz, auditor, history,
+		time.Duration(config.Organizations.RestoreWindowSeconds)*time.Second)
 	orgGroup := v1Group.Group("/organizations")
-	orgGroup.GET("/", orgHandler.GetListOfOrganizations)
-	orgGroup.POST("/", orgHandler.CreateOrganization)
-	orgGroup.GET("/:orgId", orgHandler.GetOrganization)
-	orgGroup.PUT("/:orgId", orgHandler.UpdateOrganization)
-	orgGroup.DELETE("/:orgId")
+	orgGroup.GET("/", authz.RequireSuperAdmin(services.PermissionTenantRead), orgHandler.GetListOfOrganizations)
+	orgGroup.POST("/", authz.RequireSuperAdmin(services.PermissionTenantWrite), orgHandler.CreateOrganization)
+	orgGroup.GET("/:orgId", authz.Require(services.PermissionOrganizationRead), orgHandler.GetOrganization)
+	orgGroup.PUT("/:orgId", authz.Require(services.PermissionOrganizationWrite), orgHandler.UpdateOrganization)
+	orgGroup.DELETE("/:orgId", authz.RequireSuperAdmin(services.PermissionTenantWrite), orgHandler.DeleteOrganization)
+	orgGroup.POST("/:orgId/restore", authz.RequireSuperAdmin(services.PermissionTenantWrite), orgHandler.RestoreOrganization)
+	orgGroup.PUT("/:orgId/suspension", authz.RequireSuperAdmin(services.PermissionTenantWrite), orgHandler.SuspendOrganization)
+	orgGroup.DELETE("/:orgId/suspension", authz.RequireSuperAdmin(services.PermissionTenantWrite), orgHandler.ReactivateOrganization)
+	orgGroup.GET("/:orgId/freeze-windows", authz.Require(services.PermissionOrganizationRead), orgHandler.GetFreezeWindows)
+	orgGroup.PUT("/:orgId/freeze-windows", authz.Require(services.PermissionOrganizationWrite), orgHandler.PutFreezeWindows)
+	orgGroup.GET("/:orgId/history", authz.Require(services.PermissionOrganizationRead), orgHandler.GetVariableHistory)
 
 	// Namespace API
-	nsHandler := NewNamespaceHandler(nsService, orgService, schemaService)
+	nsRead := authz.RequireNamespace(services.PermissionNamespaceRead)
+	nsWrite := authz.RequireNamespace(services.PermissionNamespaceWrite)
+	nsHandler := NewNamespaceHandler(nsService, orgService, schemaService, authz, auditor, history)
 	nsGroup := v1Group.Group("/namespaces")
-	nsGroup.GET("/", nsHandler.ListNamespaces)
-	nsGroup.POST("/", nsHandler.CreateNamespace)
-	nsGroup.GET("/:ns", nsHandler.GetNamespace)
-	nsGroup.PUT("/:ns", nsHandler.UpdateNamespace)
-	nsGroup.DELETE("/:ns", nsHandler.DeleteNamespace)
-	nsGroup.GET("/:ns/variables", nsHandler.ListNamespaceVariables)
-	nsGroup.POST("/:ns/variables", nsHandler.PostNamespaceVariable)
-	nsGroup.GET("/:ns/variables/:var", nsHandler.GetNamespaceVariable)
-	nsGroup.PUT("/:ns/variables/:var", nsHandler.PutNamespaceVariable)
-	nsGroup.DELETE("/:ns/variables/:var", nsHandler.DeleteNamespaceVariable)
+	nsGroup.GET("/", authz.Require(services.PermissionNamespaceRead), nsHandler.ListNamespaces)
+	nsGroup.POST("/", authz.Require(services.PermissionNamespaceWrite), nsHandler.CreateNamespace)
+	nsGroup.GET("/:ns", nsRead, nsHandler.GetNamespace)
+	nsGroup.PUT("/:ns", nsWrite, nsHandler.UpdateNamespace)
+	nsGroup.DELETE("/:ns", nsWrite, nsHandler.DeleteNamespace)
+	nsGroup.POST("/:ns/clone", authz.Require(services.PermissionNamespaceWrite), nsHandler.CloneNamespace)
+	nsGroup.PUT("/:ns/lock", nsWrite, nsHandler.LockNamespace)
+	nsGroup.DELETE("/:ns/lock", nsWrite, nsHandler.UnlockNamespace)
+	nsGroup.GET("/:ns/children", nsRead, nsHandler.ListChildNamespaces)
+	nsGroup.GET("/:ns/effective-variables", nsRead, nsHandler.GetEffectiveVariables)
+	nsGroup.GET("/:ns/history", nsRead, nsHandler.GetVariableHistory)
+	nsGroup.GET("/:ns/variables", nsRead, nsHandler.ListNamespaceVariables)
+	nsGroup.POST("/:ns/variables", nsWrite, nsHandler.PostNamespaceVariable)
+	nsGroup.PUT("/:ns/variables", nsWrite, nsHandler.PutNamespaceVariables)
+	nsGroup.PATCH("/:ns/variables", nsWrite, nsHandler.PatchNamespaceVariables)
+	nsGroup.GET("/:ns/variables/:var", nsRead, nsHandler.GetNamespaceVariable)
+	nsGroup.PUT("/:ns/variables/:var", nsWrite, nsHandler.PutNamespaceVariable)
+	nsGroup.DELETE("/:ns/variables/:var", nsWrite, nsHandler.DeleteNamespaceVariable)
 	// Resolve a name
-	nsGroup.GET("/:ns/resolve/:resource", nsHandler.Resolve)
+	nsGroup.GET("/:ns/resolve/:resource", authz.RequireNamespace(services.PermissionNamespaceResolve), nsHandler.Resolve)
+
+	// Namespace template API
+	templateHandler := NewNamespaceTemplateHandler(orgService, nsService, schemaService, auditor, history)
+	templateGroup := v1Group.Group("/namespace-templates")
+	templateGroup.GET("/", authz.Require(services.PermissionTemplateRead), templateHandler.ListTemplates)
+	templateGroup.POST("/", authz.Require(services.PermissionTemplateWrite), templateHandler.CreateTemplate)
+	templateGroup.GET("/:template", authz.Require(services.PermissionTemplateRead), templateHandler.GetTemplate)
+	templateGroup.DELETE("/:template", authz.Require(services.PermissionTemplateWrite), templateHandler.DeleteTemplate)
+	templateGroup.POST("/:template/namespaces", authz.Require(services.PermissionNamespaceWrite), templateHandler.CreateNamespaceFromTemplate)
 
 	// Schema API
-	schemaApiHandler := NewSchemaApiHandler(schemaService)
+	schemaRead := authz.RequireSchema(services.PermissionSchemaRead)
+	schemaWrite := authz.RequireSchema(services.PermissionSchemaWrite)
+	schemaApiHandler := NewSchemaApiHandler(schemaService, auditor, history)
 	schGroup := v1Group.Group("/schemas")
-	schGroup.GET("/", schemaApiHandler.ListSchemas)
-	schGroup.POST("/", schemaApiHandler.CreateSchema)
+	schGroup.GET("/", authz.Require(services.PermissionSchemaRead), schemaApiHandler.ListSchemas)
+	schGroup.POST("/", authz.Require(services.PermissionSchemaWrite), schemaApiHandler.CreateSchema)
 
-	schGroup.GET("/:schema", schemaApiHandler.GetSchema) // Schema details
-	schGroup.PUT("/:schema", schemaApiHandler.UpdateSchema)
-	schGroup.DELETE("/:schema", schemaApiHandler.DeleteSchema)
+	schGroup.GET("/:schema", schemaRead, schemaApiHandler.GetSchema) // Schema details
+	schGroup.PUT("/:schema", schemaWrite, schemaApiHandler.UpdateSchema)
+	schGroup.DELETE("/:schema", schemaWrite, schemaApiHandler.DeleteSchema)
 
-	schGroup.GET("/:schema/versions", schemaApiHandler.ListSchemaVersions)
-	schGroup.POST("/:schema/versions", schemaApiHandler.CreateSchemaVersion)
-	schGroup.GET("/:schema/versions/:version", schemaApiHandler.GetSchemaVersion)
-	schGroup.PUT("/:schema/versions/:version", schemaApiHandler.UpdateSchemaVersion)
-	schGroup.DELETE("/:schema/versions/:version", schemaApiHandler.DeleteSchemaVersion)
-	schGroup.POST("/:schema/versions/:version/resolve", schemaApiHandler.ResolveResourceName)
+	schGroup.GET("/:schema/versions", schemaRead, schemaApiHandler.ListSchemaVersions)
+	schGroup.POST("/:schema/versions", schemaWrite, schemaApiHandler.CreateSchemaVersion)
+	schGroup.GET("/:schema/versions/:version", schemaRead, schemaApiHandler.GetSchemaVersion)
+	schGroup.PUT("/:schema/versions/:version", schemaWrite, schemaApiHandler.UpdateSchemaVersion)
+	schGroup.DELETE("/:schema/versions/:version", schemaWrite, schemaApiHandler.DeleteSchemaVersion)
+	schGroup.POST("/:schema/versions/:version/resolve", schemaRead, schemaApiHandler.ResolveResourceName)
 
 	// API Key API
-	apiKeyHandler := NewApiKeyHandler(apiKeyService)
+	apiKeyHandler := NewApiKeyHandler(apiKeyService, providers.RoleBindings, nsService, schemaService, authz, auditor,
+		time.Duration(config.ApiKeys.RotationGraceSeconds)*time.Second)
 	apiKeysGroup := v1Group.Group("/apikeys")
-	apiKeysGroup.GET("/", apiKeyHandler.ListApiKeys)
-	apiKeysGroup.POST("/", apiKeyHandler.CreateKey)
+	apiKeysGroup.GET("/", authz.Require(services.PermissionApiKeyRead), apiKeyHandler.ListApiKeys)
+	apiKeysGroup.POST("/", authz.Require(services.PermissionApiKeyWrite), apiKeyHandler.CreateKey)
+
+	apiKeysGroup.GET("/:apiId", authz.Require(services.PermissionApiKeyRead), apiKeyHandler.GetKey)
+	apiKeysGroup.DELETE("/:apiId", authz.Require(services.PermissionApiKeyWrite), apiKeyHandler.DeleteKey)
+	apiKeysGroup.POST("/:apiId/rotate", authz.Require(services.PermissionApiKeyWrite), apiKeyHandler.RotateKey)
+
+	// Role binding API
+	roleBindingHandler := NewRoleBindingHandler(providers.RoleBindings, nsService, schemaService, auditor)
+	roleBindingsGroup := v1Group.Group("/rolebindings")
+	roleBindingsGroup.GET("/", authz.Require(services.PermissionRoleBindingRead), roleBindingHandler.ListRoleBindings)
+	roleBindingsGroup.POST("/", authz.Require(services.PermissionRoleBindingWrite), roleBindingHandler.CreateRoleBinding)
+	roleBindingsGroup.DELETE("/:binding", authz.Require(services.PermissionRoleBindingWrite), roleBindingHandler.DeleteRoleBinding)
 
-	apiKeysGroup.GET("/:apiId", apiKeyHandler.GetKey)
-	apiKeysGroup.DELETE("/:apiId", apiKeyHandler.DeleteKey)
+	// Audit API
+	auditHandler := NewAuditHandler(providers.Audit)
+	v1Group.GET("/audit", authz.Require(services.PermissionAuditRead), auditHandler.ListEvents)
 
-	return api
+	return api, nil
 }
 
-func (api *Api) Run(listener string) error {
-	err := api.router.Run(listener)
-	return err
+const (
+	shutdownTimeout      = 10 * time.Second
+	defaultPurgeInterval = time.Hour
+)
+
+// Run serves the API until ctx is cancelled, then waits for in flight requests to finish.
+// Deleted organizations are purged in the background while it runs.
+func (api *Api) Run(ctx context.Context, listener string) error {
+	srv := &http.Server{
+		Addr:    listener,
+		Handler: api.router,
+	}
+
+	go api.purgeDeletedOrganizations(ctx)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Purges the deleted organizations whose restore window has ended every purgeInterval until
+// ctx is cancelled
+func (api *Api) purgeDeletedOrganizations(ctx context.Context) {
+	ticker := time.NewTicker(api.purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := services.PurgeDeletedOrganizations(api.providers, time.Now())
+		if err != nil {
+			log.Printf("failed to purge deleted organizations: %v", err)
+		}
+		for _, orgId := range purged {
+			log.Printf("purged deleted organization %s", orgId)
+		}
+	}
 }
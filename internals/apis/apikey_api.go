@@ -1,19 +1,41 @@
 package apis
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/gin-gonic/gin"
 )
 
+const defaultRotationGracePeriod = 24 * time.Hour
+
 type ApiKeyHandler struct {
-	akSvc services.ApiKeyProvider
+	akSvc         services.ApiKeyProvider
+	bindingSvc    services.RoleBindingProvider
+	nsSvc         services.NamespaceServiceProvider
+	schemaSvc     services.SchemaServiceProvider
+	authz         *Authorizer
+	auditor       *Auditor
+	rotationGrace time.Duration
 }
 
-func NewApiKeyHandler(apiKeySvc services.ApiKeyProvider) *ApiKeyHandler {
+// NewApiKeyHandler returns the API key handler. Rotated keys keep working for rotationGrace
+// unless the rotation says otherwise, or for a day when it is zero.
+func NewApiKeyHandler(apiKeySvc services.ApiKeyProvider, bindingSvc services.RoleBindingProvider, nsSvc services.NamespaceServiceProvider, schemaSvc services.SchemaServiceProvider, authz *Authorizer, auditor *Auditor, rotationGrace time.Duration) *ApiKeyHandler {
+	if rotationGrace <= 0 {
+		rotationGrace = defaultRotationGracePeriod
+	}
 	akApi := &ApiKeyHandler{
-		akSvc: apiKeySvc,
+		akSvc:         apiKeySvc,
+		bindingSvc:    bindingSvc,
+		nsSvc:         nsSvc,
+		schemaSvc:     schemaSvc,
+		authz:         authz,
+		auditor:       auditor,
+		rotationGrace: rotationGrace,
 	}
 
 	return akApi
@@ -29,18 +51,88 @@ func (aka *ApiKeyHandler) ListApiKeys(c *gin.Context) {
 	keys, err := aka.akSvc.ListKeys(orgId)
 	if err != nil {
 		responseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := make([]*services.ApiKey, len(keys))
+	for i, ak := range keys {
+		result[i] = publicApiKey(ak)
 	}
-	responseSingleItem(c, keys)
+	responseSingleItem(c, result)
 }
 
 func (aka *ApiKeyHandler) CreateKey(c *gin.Context) {
-	orgId := "a3dd56d4-c470-4f12-b47f-9f29a0380fc5"
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	var akReq NewApiKeyRequest
+	if err := DecodeBody(c, &akReq); err != nil {
+		return
+	}
+	expires, ok := apiKeyExpiry(c, akReq.Expires)
+	if !ok {
+		return
+	}
+	if !aka.validateScope(c, orgId, akReq.Scopes) {
+		return
+	}
+
+	var binding *services.RoleBinding
+	if akReq.Role != "" {
+		var ok bool
+		if binding, ok = aka.newKeyRoleBinding(c, orgId, akReq); !ok {
+			return
+		}
+	}
 
-	key, err := aka.akSvc.GenerateNewApiKey(orgId)
+	key, err := aka.akSvc.GenerateNewApiKey(orgId, akReq.Name, expires, akReq.Scopes)
 	if err != nil {
 		responseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if binding != nil {
+		binding.Subject = services.ApiKeySubject(key.Id)
+		if err := aka.bindingSvc.CreateRoleBinding(binding); err != nil {
+			// A key without the role it was asked for is of no use, so remove it again
+			if err := aka.akSvc.DeleteKey(key.Id); err != nil {
+				log.Printf("failed to remove API key %s whose role could not be bound: %v", key.Id, err)
+			}
+			responseRoleBindingError(c, err, "Failed to bind the role of the API key")
+			return
+		}
 	}
-	responseSingleItem(c, key)
+
+	aka.auditor.Record(c, key.OrganizationId, services.AuditActionCreate, services.AuditResourceApiKey, key.Id, nil, auditApiKey(key))
+	if binding != nil {
+		aka.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceRoleBinding, binding.Id, nil, binding)
+	}
+	// The only time the secret is returned, as only its hash is stored
+	responseSingleItem(c, publicApiKey(key))
+}
+
+// Validates the role requested for a new key, which needs the permission to create role
+// bindings. Writes the error response and returns false if it cannot be granted. The subject
+// is filled in once the key exists.
+func (aka *ApiKeyHandler) newKeyRoleBinding(c *gin.Context, orgId string, akReq NewApiKeyRequest) (*services.RoleBinding, bool) {
+	allowed, err := aka.authz.Permits(c, services.PermissionRoleBindingWrite)
+	if err != nil {
+		log.Printf("failed to check permission %s: %v", services.PermissionRoleBindingWrite, err)
+		responseError(c, http.StatusInternalServerError, "Failed to check permissions")
+		return nil, false
+	}
+	if !allowed {
+		responseError(c, http.StatusForbidden, fmt.Sprintf("Missing permission %s", services.PermissionRoleBindingWrite))
+		return nil, false
+	}
+
+	binding, err := services.NewRoleBinding(orgId, services.ApiKeySubject(""), akReq.Role, akReq.ResourceType, akReq.ResourceId)
+	if err != nil {
+		responseRoleBindingError(c, err, "Invalid role binding")
+		return nil, false
+	}
+	if !roleBindingResourceExists(c, aka.nsSvc, aka.schemaSvc, binding) {
+		return nil, false
+	}
+	return binding, true
 }
 
 func (aka *ApiKeyHandler) DeleteKey(c *gin.Context) {
@@ -50,28 +142,142 @@ func (aka *ApiKeyHandler) DeleteKey(c *gin.Context) {
 		return
 	}
 
-	apiId := c.Param("apidId")
+	apiId := c.Param("apiId")
 	if apiId == "" {
 		responseError(c, http.StatusBadRequest, "Invalid API ID")
 		return
 	}
 
-	apikey := aka.akSvc.GetKey(apiId)
-	if apikey == nil {
+	apikey := aka.akSvc.GetKeyById(apiId)
+	if apikey == nil || apikey.OrganizationId != orgId {
 		responseError(c, http.StatusNotFound, "API key not found")
 		return
 	}
 
-	aka.akSvc.DeleteKey(apiId)
+	if err := aka.akSvc.DeleteKey(apiId); err != nil {
+		responseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := aka.bindingSvc.DeleteSubjectRoleBindings(orgId, services.ApiKeySubject(apikey.Id)); err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to remove the roles of the API key")
+		return
+	}
+
+	aka.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceApiKey, apikey.Id, auditApiKey(apikey), nil)
 	c.Status(http.StatusNoContent)
 }
 
+// Issue a key replacing the one in the path, with its name, scope and roles. The old key keeps
+// working for the grace period so that its users can move to the new one.
+func (aka *ApiKeyHandler) RotateKey(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	apikey := aka.akSvc.GetKeyById(c.Param("apiId"))
+	if apikey == nil || apikey.OrganizationId != orgId {
+		responseError(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if apikey.ReplacedBy != "" {
+		responseError(c, http.StatusConflict, "API key has already been rotated")
+		return
+	}
+
+	// The body is optional
+	var rotateReq RotateApiKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := DecodeBody(c, &rotateReq); err != nil {
+			return
+		}
+	}
+	grace := aka.rotationGrace
+	if rotateReq.GracePeriodSeconds != nil {
+		if *rotateReq.GracePeriodSeconds < 0 {
+			responseError(c, http.StatusBadRequest, "Grace period cannot be negative")
+			return
+		}
+		grace = time.Duration(*rotateReq.GracePeriodSeconds) * time.Second
+	}
+	expires, ok := apiKeyExpiry(c, rotateReq.Expires)
+	if !ok {
+		return
+	}
+
+	before := auditApiKey(apikey)
+	successor := services.RotateApiKey(apikey, expires, time.Now().UTC().Add(grace))
+
+	// The new key gets the roles of the old one before it exists, so it works straight away
+	bindings, err := aka.bindingSvc.ListSubjectRoleBindings(orgId, services.ApiKeySubject(apikey.Id))
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to get the roles of the API key")
+		return
+	}
+	for _, b := range bindings {
+		binding, err := services.NewRoleBinding(orgId, services.ApiKeySubject(successor.Id), b.Role, b.ResourceType, b.ResourceId)
+		if err == nil {
+			err = aka.bindingSvc.CreateRoleBinding(binding)
+		}
+		if err != nil {
+			aka.removeRoles(orgId, successor)
+			responseError(c, http.StatusInternalServerError, "Failed to copy the roles of the API key")
+			return
+		}
+	}
+
+	if err := aka.akSvc.RotateKey(apikey, successor); err != nil {
+		aka.removeRoles(orgId, successor)
+		switch err {
+		case services.ErrApiKeyNotFound:
+			responseError(c, http.StatusNotFound, "API key not found")
+		case services.ErrApiKeyRotated:
+			responseError(c, http.StatusConflict, "API key has already been rotated")
+		default:
+			responseError(c, http.StatusInternalServerError, "Failed to rotate API key")
+		}
+		return
+	}
+
+	aka.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceApiKey, apikey.Id, before, auditApiKey(apikey))
+	aka.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceApiKey, successor.Id, nil, auditApiKey(successor))
+	responseSingleItemStatus(c, http.StatusCreated, RotateApiKeyResponse{
+		Key:      publicApiKey(successor),
+		Previous: publicApiKey(apikey),
+	})
+}
+
+// Removes the roles given to a key that was not stored
+func (aka *ApiKeyHandler) removeRoles(orgId string, ak *services.ApiKey) {
+	if err := aka.bindingSvc.DeleteSubjectRoleBindings(orgId, services.ApiKeySubject(ak.Id)); err != nil {
+		log.Printf("failed to remove the roles of API key %s: %v", ak.Id, err)
+	}
+}
+
 func (aka *ApiKeyHandler) GetKey(c *gin.Context) {
-	apiId := c.Param("apidId")
-	apikey := aka.akSvc.GetKey(apiId)
-	if apikey == nil {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	apiId := c.Param("apiId")
+	apikey := aka.akSvc.GetKeyById(apiId)
+	if apikey == nil || apikey.OrganizationId != orgId {
 		responseError(c, http.StatusNotFound, "API key not found")
 		return
 	}
-	responseSingleItem(c, apikey)
+	responseSingleItem(c, publicApiKey(apikey))
+}
+
+// Returns a copy of the API key without the salt and hash of its secret
+func publicApiKey(ak *services.ApiKey) *services.ApiKey {
+	public := *ak
+	public.Salt = ""
+	public.Hash = ""
+	return &public
+}
+
+// Returns the requested expiry of a new key, or zero for a key that never expires. Responds
+// with an error if it is not in the future.
+func apiKeyExpiry(c *gin.Context, requested *time.Time) (time.Time, bool) {
+	if requested == nil {
+		return time.Time{}, true
+	}
+	if !requested.After(time.Now()) {
+		responseError(c, http.StatusBadRequest, "API key expiry must be in the future")
+		return time.Time{}, false
+	}
+	return requested.UTC(), true
 }
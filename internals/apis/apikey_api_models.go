@@ -1,6 +1,33 @@
 package apis
 
+import (
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+// NewApiKeyRequest creates a key. Without an expiry the key never expires.
+// NewApiKeyRequest creates a key. A key is only allowed what its role bindings grant, so Role,
+// when set, is bound to the new key across the organization or on the resource named by
+// ResourceType and ResourceId. Without it the key has no roles until a binding is created.
 type NewApiKeyRequest struct {
-	Name   string            `json:"name"`
-	Scopes map[string]string `json:"scopes"`
+	Name         string            `json:"name"`
+	Expires      *time.Time        `json:"expires"`
+	Scopes       map[string]string `json:"scopes"`
+	Role         string            `json:"role"`
+	ResourceType string            `json:"resource_type"`
+	ResourceId   string            `json:"resource_id"`
+}
+
+// RotateApiKeyRequest rotates a key. The old key keeps working for GracePeriodSeconds, or the
+// configured grace period when omitted. The new key expires at Expires, or never.
+type RotateApiKeyRequest struct {
+	GracePeriodSeconds *int       `json:"grace_period_seconds"`
+	Expires            *time.Time `json:"expires"`
+}
+
+// RotateApiKeyResponse holds the new key, with its secret, and the key it replaces
+type RotateApiKeyResponse struct {
+	Key      *services.ApiKey `json:"key"`
+	Previous *services.ApiKey `json:"previous"`
 }
@@ -0,0 +1,271 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeyScopesAreEnforced(t *testing.T) {
+	ta := newTestApi(t)
+	prod := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	payments, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "payments-prod", prod.Id, prod.SchemaId, prod.SchemaVersion, nil)
+	require.NoError(t, err)
+	dev, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "dev", "", prod.SchemaId, prod.SchemaVersion, map[string]string{"env": "dev"})
+	require.NoError(t, err)
+
+	// A CI key that can only resolve names in payments-prod and the namespaces beneath it
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "scopes": {"namespaces": "`+payments.Id+`", "operations": "namespace:resolve"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	ci := &body.Data
+	assert.Equal(t, payments.Id, ci.Scope[SCOPE_NAMESPACES])
+
+	// Scopes narrow the roles of the key, they do not grant anything
+	rec = ta.requestAs(ci, http.MethodGet, "/api/v1/namespaces/"+payments.Id+"/resolve/vm", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission namespace:resolve")
+
+	admin, err := services.NewRoleBinding(ta.org.Id, services.ApiKeySubject(ci.Id), services.RoleOrgAdmin, "", "")
+	require.NoError(t, err)
+	require.NoError(t, ta.providers.RoleBindings.CreateRoleBinding(admin))
+
+	rec = ta.requestAs(ci, http.MethodGet, "/api/v1/namespaces/"+payments.Id+"/resolve/vm", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rejected := map[string]string{
+		"other namespace":  "/api/v1/namespaces/" + dev.Id + "/resolve/vm",
+		"parent namespace": "/api/v1/namespaces/" + prod.Id + "/resolve/vm",
+		"other operation":  "/api/v1/namespaces/" + payments.Id,
+		"list namespaces":  "/api/v1/namespaces/",
+		"other resource":   "/api/v1/apikeys/",
+	}
+	for name, path := range rejected {
+		rec = ta.requestAs(ci, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusForbidden, rec.Code, name)
+		assert.Contains(t, rec.Body.String(), "API key scope does not allow", name)
+	}
+}
+
+func TestApiKeyScopesAreValidated(t *testing.T) {
+	ta := newTestApi(t)
+
+	tests := map[string]struct {
+		body string
+		code int
+	}{
+		"unknown scope":     {`{"scopes": {"owner": "true"}}`, http.StatusBadRequest},
+		"unknown operation": {`{"scopes": {"operations": "namespace:resolve,namespace:delete"}}`, http.StatusBadRequest},
+		"missing namespace": {`{"scopes": {"namespaces": "missing"}}`, http.StatusNotFound},
+		"missing schema":    {`{"scopes": {"schemas": "missing"}}`, http.StatusNotFound},
+		"lock override":     {`{"scopes": {"lock_override": "true"}}`, http.StatusBadRequest},
+		"unscoped":          {`{"name": "admin"}`, http.StatusOK},
+	}
+	for name, tt := range tests {
+		rec := ta.request(http.MethodPost, "/api/v1/apikeys/", tt.body)
+		assert.Equal(t, tt.code, rec.Code, name)
+	}
+}
+
+func TestApiKeySecretIsOnlyShownOnCreation(t *testing.T) {
+	ta := newTestApi(t)
+
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Data.Key)
+	assert.Equal(t, services.ApiKeyPrefix(created.Data.Key), created.Data.Prefix)
+	assert.NotContains(t, rec.Body.String(), `"hash"`)
+
+	for _, path := range []string{"/api/v1/apikeys/", "/api/v1/apikeys/" + created.Data.Id} {
+		rec = ta.request(http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.NotContains(t, rec.Body.String(), created.Data.Key, path)
+		assert.NotContains(t, rec.Body.String(), `"hash"`, path)
+		assert.Contains(t, rec.Body.String(), created.Data.Prefix, path)
+	}
+
+	// The key authenticates with its secret, never with its ID or prefix
+	key := &services.ApiKey{Key: created.Data.Key}
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission", "the key is accepted but has no roles")
+	for _, wrong := range []string{created.Data.Id, created.Data.Prefix} {
+		rec = ta.requestAs(&services.ApiKey{Key: wrong}, http.MethodGet, "/api/v1/namespaces/", "")
+		assert.Contains(t, rec.Body.String(), "Api key rejected")
+	}
+
+	rec = ta.request(http.MethodDelete, "/api/v1/apikeys/"+created.Data.Id, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Contains(t, rec.Body.String(), "Api key rejected")
+}
+
+func TestApiKeyIsCreatedWithRole(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	countKeys := func() int {
+		keys, err := ta.providers.ApiKeys.ListKeys(ta.org.Id)
+		require.NoError(t, err)
+		return len(keys)
+	}
+	keys := countKeys()
+
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "role": "resolver", "resource_type": "namespace", "resource_id": "`+ns.Id+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	key := &services.ApiKey{Key: created.Data.Key}
+
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/resolve/vm", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/schemas/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code, "the role is only bound on the namespace")
+
+	bindings, err := ta.providers.RoleBindings.ListSubjectRoleBindings(ta.org.Id, services.ApiKeySubject(created.Data.Id))
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, services.RoleResolver, bindings[0].Role)
+
+	// Nothing is created when the role cannot be granted
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "role": "org_admin", "resource_type": "namespace", "resource_id": "`+ns.Id+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "role": "resolver", "resource_type": "namespace", "resource_id": "missing"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	keyWriter := ta.keyWithRole(t, services.RoleOrgAdmin, map[string]string{SCOPE_OPERATIONS: "apikey:write"})
+	rec = ta.requestAs(keyWriter, http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "role": "org_admin"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission rolebinding:write")
+	assert.Equal(t, keys+2, countKeys(), "only the key with a role and the key writer were added")
+}
+
+// unbindableRoles fails to create every role binding
+type unbindableRoles struct {
+	services.RoleBindingProvider
+}
+
+func (unbindableRoles) CreateRoleBinding(binding *services.RoleBinding) error {
+	return errors.New("role binding store unavailable")
+}
+
+func TestApiKeyIsRemovedWhenItsRoleCannotBeBound(t *testing.T) {
+	ta := newTestApi(t)
+	ta.providers.RoleBindings = unbindableRoles{ta.providers.RoleBindings}
+	api, err := NewApi(&config.Config{}, ta.providers)
+	require.NoError(t, err)
+	ta.api = api
+
+	keys, err := ta.providers.ApiKeys.ListKeys(ta.org.Id)
+	require.NoError(t, err)
+
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "role": "resolver"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	after, err := ta.providers.ApiKeys.ListKeys(ta.org.Id)
+	require.NoError(t, err)
+	assert.Len(t, after, len(keys))
+}
+
+func TestApiKeyExpiry(t *testing.T) {
+	ta := newTestApi(t)
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "release", "expires": "`+expires.Format(time.RFC3339)+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "release", created.Data.Name)
+	assert.True(t, expires.Equal(created.Data.Expires))
+
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/", `{"expires": "2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	expired, err := ta.providers.ApiKeys.GenerateNewApiKey(ta.org.Id, "old", time.Now().Add(-time.Minute), nil)
+	require.NoError(t, err)
+	rec = ta.requestAs(expired, http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Api key expired")
+}
+
+func TestApiKeyRotation(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+
+	rec := ta.request(http.MethodPost, "/api/v1/apikeys/", `{"name": "ci", "scopes": {"operations": "namespace:resolve"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	old := &created.Data
+	rec = ta.request(http.MethodPost, "/api/v1/rolebindings/", `{"subject": "apikey:`+old.Id+`", "role": "resolver"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	resolve := "/api/v1/namespaces/" + ns.Id + "/resolve/vm"
+	rec = ta.requestAs(old, http.MethodGet, resolve, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, ta.providers.ApiKeys.GetKeyById(old.Id).LastUsedAt.IsZero(), "use of the key is recorded")
+
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/"+old.Id+"/rotate", `{"grace_period_seconds": 3600}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var rotated struct {
+		Data RotateApiKeyResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rotated))
+	successor, previous := rotated.Data.Key, rotated.Data.Previous
+	assert.NotEmpty(t, successor.Key)
+	assert.Equal(t, old.Id, successor.RotatedFrom)
+	assert.Equal(t, old.Scope, successor.Scope)
+	assert.Equal(t, successor.Id, previous.ReplacedBy)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), previous.Expires, time.Minute)
+
+	// Both keys work during the grace period, with the same roles and scope
+	for _, ak := range []*services.ApiKey{old, successor} {
+		rec = ta.requestAs(ak, http.MethodGet, resolve, "")
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		rec = ta.requestAs(ak, http.MethodGet, "/api/v1/namespaces/"+ns.Id, "")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	}
+
+	rec = ta.request(http.MethodGet, "/api/v1/apikeys/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listed struct {
+		Data []services.ApiKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	pairs := map[string]string{}
+	for _, ak := range listed.Data {
+		if ak.ReplacedBy != "" {
+			pairs[ak.Id] = ak.ReplacedBy
+		}
+	}
+	assert.Equal(t, map[string]string{old.Id: successor.Id}, pairs)
+
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/"+old.Id+"/rotate", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Without a grace period the old key stops working straight away
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/"+successor.Id+"/rotate", `{"grace_period_seconds": 0}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = ta.requestAs(successor, http.MethodGet, resolve, "")
+	assert.Contains(t, rec.Body.String(), "Api key expired")
+
+	rec = ta.request(http.MethodPost, "/api/v1/apikeys/missing/rotate", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
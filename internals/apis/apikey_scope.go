@@ -0,0 +1,105 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Scope entries restricting what an API key can do, on top of its roles. Each holds a comma
+// separated list.
+const (
+	SCOPE_NAMESPACES = "namespaces"
+	SCOPE_SCHEMAS    = "schemas"
+	SCOPE_OPERATIONS = "operations"
+)
+
+// Returns the values of a comma separated scope entry of the API key
+func scopeValues(ak *services.ApiKey, name string) []string {
+	values := []string{}
+	for _, v := range strings.Split(ak.Scope[name], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// apiKeyScopeAllows reports whether the scope of the API key lets it use the permission on the
+// resource of the route. Keys restricted to operations can only use those permissions. Keys
+// restricted to namespaces or schemas can only use routes for one of them, or for a namespace
+// beneath one of the namespaces; resource holds the resource and its parents.
+func apiKeyScopeAllows(ak *services.ApiKey, permission string, resourceType string, resource func() ([]string, error)) (bool, error) {
+	if operations := scopeValues(ak, SCOPE_OPERATIONS); len(operations) > 0 && !services.Contains(operations, permission) {
+		return false, nil
+	}
+
+	namespaces := scopeValues(ak, SCOPE_NAMESPACES)
+	schemas := scopeValues(ak, SCOPE_SCHEMAS)
+	if len(namespaces) == 0 && len(schemas) == 0 {
+		return true, nil
+	}
+
+	var allowed []string
+	switch resourceType {
+	case services.RoleBindingResourceNamespace:
+		allowed = namespaces
+	case services.RoleBindingResourceSchema:
+		allowed = schemas
+	default:
+		return false, nil
+	}
+
+	ids, err := resource()
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if services.Contains(allowed, id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Checks the scope requested for a new key, responding with an error if it is invalid
+func (aka *ApiKeyHandler) validateScope(c *gin.Context, orgId string, scope map[string]string) bool {
+	ak := &services.ApiKey{Scope: scope}
+	for name := range scope {
+		switch name {
+		case SCOPE_OPERATIONS:
+			for _, permission := range scopeValues(ak, name) {
+				if !services.IsPermission(permission) {
+					responseError(c, http.StatusBadRequest, fmt.Sprintf("Invalid scope %s: unknown operation %s", name, permission))
+					return false
+				}
+			}
+		case SCOPE_NAMESPACES:
+			for _, nsId := range scopeValues(ak, name) {
+				if _, err := aka.nsSvc.GetNamespaceById(orgId, nsId); err != nil {
+					responseNamespaceError(c, err, "Failed to get namespace")
+					return false
+				}
+			}
+		case SCOPE_SCHEMAS:
+			for _, schemaId := range scopeValues(ak, name) {
+				schema, err := aka.schemaSvc.GetSchemaById(orgId, schemaId)
+				if err != nil {
+					responseError(c, http.StatusInternalServerError, "Failed to get schema")
+					return false
+				}
+				if schema == nil {
+					responseError(c, http.StatusNotFound, "Schema not found")
+					return false
+				}
+			}
+		default:
+			responseError(c, http.StatusBadRequest, fmt.Sprintf("Unknown scope %s", name))
+			return false
+		}
+	}
+	return true
+}
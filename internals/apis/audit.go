@@ -0,0 +1,83 @@
+package apis
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Auditor appends an event to the audit log for every change made through the API
+type Auditor struct {
+	auditSvc services.AuditProvider
+}
+
+func NewAuditor(auditSvc services.AuditProvider) *Auditor {
+	return &Auditor{
+		auditSvc: auditSvc,
+	}
+}
+
+// Record stores an event for a change that has been made. before and after are the resource
+// either side of the change, or nil when it did not exist. The change has already been made
+// by the time it is recorded, so a failure is logged rather than failing the request.
+func (a *Auditor) Record(c *gin.Context, orgId string, action string, resourceType string, resourceId string, before interface{}, after interface{}) {
+	if a == nil || a.auditSvc == nil {
+		return
+	}
+
+	event := services.AuditEvent{
+		OrganizationId: orgId,
+		Actor:          requestActor(c),
+		RequestId:      c.GetString(REQUEST_ID_CONTEXT_NAME),
+		Action:         action,
+		ResourceType:   resourceType,
+		ResourceId:     resourceId,
+	}
+
+	var err error
+	if event.Before, err = auditSnapshot(before); err == nil {
+		event.After, err = auditSnapshot(after)
+	}
+	if err == nil {
+		err = a.auditSvc.RecordEvent(services.NewAuditEvent(event))
+	}
+	if err != nil {
+		log.Printf("failed to record audit event for %s %s %s: %v", action, resourceType, resourceId, err)
+	}
+}
+
+// RecordVariables stores an event for each variable of the namespace that differs between
+// before and after
+func (a *Auditor) RecordVariables(c *gin.Context, orgId string, nsId string, before map[string]string, after map[string]string) {
+	summary := services.DiffVariables(before, after)
+	for _, k := range summary.Created {
+		a.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespaceVariable, variableResourceId(nsId, k), nil, after[k])
+	}
+	for _, k := range summary.Updated {
+		a.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceNamespaceVariable, variableResourceId(nsId, k), before[k], after[k])
+	}
+	for _, k := range summary.Deleted {
+		a.Record(c, orgId, services.AuditActionDelete, services.AuditResourceNamespaceVariable, variableResourceId(nsId, k), before[k], nil)
+	}
+}
+
+// Namespace variables are identified in the audit log by their namespace and key
+func variableResourceId(nsId string, key string) string {
+	return nsId + "/" + key
+}
+
+func auditSnapshot(resource interface{}) (json.RawMessage, error) {
+	if resource == nil {
+		return nil, nil
+	}
+	return json.Marshal(resource)
+}
+
+// Returns a copy of the API key that is safe to keep in the audit log
+func auditApiKey(ak *services.ApiKey) services.ApiKey {
+	redacted := *publicApiKey(ak)
+	redacted.Key = ""
+	return redacted
+}
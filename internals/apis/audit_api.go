@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditSvc services.AuditProvider
+}
+
+func NewAuditHandler(auditSvc services.AuditProvider) *AuditHandler {
+	auditApi := &AuditHandler{
+		auditSvc: auditSvc,
+	}
+	return auditApi
+}
+
+// List the audit events of the organization, newest first, filtered by the query parameters
+func (auditApi *AuditHandler) ListEvents(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	if orgId == "" {
+		responseError(c, http.StatusForbidden, "Valid API key for an organization required")
+		return
+	}
+
+	lm := ProcessListMetadata(c)
+	filter := services.AuditFilter{
+		Actor:        c.Query("actor"),
+		RequestId:    c.Query("request_id"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceId:   c.Query("resource_id"),
+		Offset:       lm.Offset,
+		Limit:        lm.Limit,
+	}
+
+	var ok bool
+	if filter.Since, ok = queryTime(c, "since"); !ok {
+		return
+	}
+	if filter.Until, ok = queryTime(c, "until"); !ok {
+		return
+	}
+
+	events, err := auditApi.auditSvc.ListEvents(orgId, filter)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to list audit events")
+		return
+	}
+
+	responseSingleItem(c, events)
+}
+
+// Returns the RFC 3339 time in the query parameter, or the zero time if it is not set. Writes
+// the error response and returns false if it cannot be parsed.
+func queryTime(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		responseError(c, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 time", name))
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
@@ -0,0 +1,120 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariableChangesAreAudited(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}-{region}"}, map[string]string{"env": "prod"})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/namespaces/"+ns.Id+"/variables/env", strings.NewReader(`{"value": "dev"}`))
+	req.Header.Set("X-Terraxen-API", ta.key.Key)
+	req.Header.Set("If-Match", "*")
+	req.Header.Set("X-Request-Id", "change-42")
+	rec := httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "change-42", rec.Header().Get("X-Request-Id"))
+
+	rec = ta.request(http.MethodPatch, "/api/v1/namespaces/"+ns.Id+"/variables", `{"upsert": {"region": "uksouth"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotEmpty(t, rec.Header().Get("X-Request-Id"))
+
+	rec = ta.request(http.MethodGet, "/api/v1/audit?resource_type=namespace_variable", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body struct {
+		Data []services.AuditEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Data, 2)
+
+	created, updated := body.Data[0], body.Data[1]
+	assert.Equal(t, services.AuditActionCreate, created.Action)
+	assert.Equal(t, ns.Id+"/region", created.ResourceId)
+	assert.Empty(t, created.Before)
+	assert.JSONEq(t, `"uksouth"`, string(created.After))
+
+	assert.Equal(t, services.AuditActionUpdate, updated.Action)
+	assert.Equal(t, ns.Id+"/env", updated.ResourceId)
+	assert.Equal(t, "apikey:"+ta.key.Id, updated.Actor)
+	assert.Equal(t, "change-42", updated.RequestId)
+	assert.JSONEq(t, `"prod"`, string(updated.Before))
+	assert.JSONEq(t, `"dev"`, string(updated.After))
+
+	rec = ta.request(http.MethodGet, "/api/v1/audit?request_id=change-42", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 1)
+
+	rec = ta.request(http.MethodGet, "/api/v1/audit?since=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuditPagesIgnoreNegativeOffsets(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	rec := ta.request(http.MethodPatch, "/api/v1/namespaces/"+ns.Id+"/variables", `{"upsert": {"env": "dev", "region": "uksouth"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body struct {
+		Data []services.AuditEvent `json:"data"`
+	}
+	rec = ta.request(http.MethodGet, "/api/v1/audit", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	all := len(body.Data)
+	require.NotZero(t, all)
+
+	for _, query := range []string{"offset=-1", "limit=-1", "offset=-5&limit=-5"} {
+		rec = ta.request(http.MethodGet, "/api/v1/audit?"+query, "")
+		require.Equal(t, http.StatusOK, rec.Code, "%s: %s", query, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Len(t, body.Data, all, query)
+	}
+}
+
+func TestRoleBindingDeletionIsAudited(t *testing.T) {
+	ta := newTestApi(t)
+
+	rec := ta.request(http.MethodPost, "/api/v1/rolebindings/", `{"subject": "user:dana", "role": "resolver"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.RoleBinding `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	rec = ta.request(http.MethodDelete, "/api/v1/rolebindings/"+created.Data.Id, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = ta.request(http.MethodDelete, "/api/v1/rolebindings/"+created.Data.Id, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = ta.request(http.MethodGet, "/api/v1/audit?resource_type=role_binding", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data []services.AuditEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+	var deleted *services.AuditEvent
+	for i := range body.Data {
+		if body.Data[i].Action == services.AuditActionDelete {
+			deleted = &body.Data[i]
+		}
+	}
+	require.NotNil(t, deleted, "the deletion is audited")
+	assert.Equal(t, created.Data.Id, deleted.ResourceId)
+	assert.Empty(t, deleted.After)
+	var before services.RoleBinding
+	require.NoError(t, json.Unmarshal(deleted.Before, &before))
+	assert.Equal(t, created.Data, before)
+}
@@ -0,0 +1,174 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// resourceIds returns the IDs a role bound to the resource of a route may be bound to
+type resourceIds func(c *gin.Context, orgId string) ([]string, error)
+
+// Authorizer checks that the caller of a route has the permission it needs, from the roles
+// bound to them in the organization or the roles in their token
+type Authorizer struct {
+	bindingSvc services.RoleBindingProvider
+	nsSvc      services.NamespaceServiceProvider
+}
+
+func NewAuthorizer(bindingSvc services.RoleBindingProvider, nsSvc services.NamespaceServiceProvider) *Authorizer {
+	return &Authorizer{
+		bindingSvc: bindingSvc,
+		nsSvc:      nsSvc,
+	}
+}
+
+// Require checks that the caller has the permission across the organization
+func (a *Authorizer) Require(permission string) gin.HandlerFunc {
+	return a.require(permission, "", nil)
+}
+
+// RequireNamespace checks that the caller has the permission on the namespace in the ns
+// parameter, through a role bound to the organization, the namespace or one of its parents
+func (a *Authorizer) RequireNamespace(permission string) gin.HandlerFunc {
+	return a.require(permission, services.RoleBindingResourceNamespace, func(c *gin.Context, orgId string) ([]string, error) {
+		nsId := c.Param("ns")
+		chain, err := a.nsSvc.GetNamespaceAncestors(orgId, nsId)
+		if err == services.ErrNamespaceNotFound {
+			return []string{nsId}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		ids := make([]string, len(chain))
+		for i, ns := range chain {
+			ids[i] = ns.Id
+		}
+		return ids, nil
+	})
+}
+
+// RequireSchema checks that the caller has the permission on the schema in the schema
+// parameter, through a role bound to the organization or the schema
+func (a *Authorizer) RequireSchema(permission string) gin.HandlerFunc {
+	return a.require(permission, services.RoleBindingResourceSchema, func(c *gin.Context, orgId string) ([]string, error) {
+		return []string{c.Param("schema")}, nil
+	})
+}
+
+// RequireSuperAdmin checks that the caller has a permission over every organization, which
+// only the roles in a token, or the administrator credential, can give
+func (a *Authorizer) RequireSuperAdmin(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, role := range requestRoles(c) {
+			if services.RolePermits(role, permission) {
+				c.Next()
+				return
+			}
+		}
+		responseError(c, http.StatusForbidden, fmt.Sprintf("Missing permission %s", permission))
+	}
+}
+
+// Permits reports whether the caller has the permission across the organization, for a
+// handler that only needs it for some requests
+func (a *Authorizer) Permits(c *gin.Context, permission string) (bool, error) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	if orgId == "" {
+		return false, nil
+	}
+
+	noResource := func() ([]string, error) {
+		return nil, nil
+	}
+	if ak := requestApiKey(c); ak != nil {
+		inScope, err := apiKeyScopeAllows(ak, permission, "", noResource)
+		if err != nil || !inScope {
+			return false, err
+		}
+	}
+	return a.allowed(c, orgId, permission, "", noResource)
+}
+
+func (a *Authorizer) require(permission string, resourceType string, ids resourceIds) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgId := c.GetString(ORG_CONTEXT_NAME)
+		if orgId == "" {
+			responseError(c, http.StatusForbidden, "Valid API key for an organization required")
+			return
+		}
+
+		// The resource is only looked up once something needs it
+		var resource []string
+		looked := false
+		lookup := func() ([]string, error) {
+			if !looked && ids != nil {
+				var err error
+				if resource, err = ids(c, orgId); err != nil {
+					return nil, err
+				}
+				looked = true
+			}
+			return resource, nil
+		}
+
+		if ak := requestApiKey(c); ak != nil {
+			inScope, err := apiKeyScopeAllows(ak, permission, resourceType, lookup)
+			if err != nil {
+				log.Printf("failed to check the scope of API key %s: %v", ak.Id, err)
+				responseError(c, http.StatusInternalServerError, "Failed to check permissions")
+				return
+			}
+			if !inScope {
+				responseError(c, http.StatusForbidden, fmt.Sprintf("API key scope does not allow %s", permission))
+				return
+			}
+		}
+
+		allowed, err := a.allowed(c, orgId, permission, resourceType, lookup)
+		if err != nil {
+			log.Printf("failed to check permission %s: %v", permission, err)
+			responseError(c, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		if !allowed {
+			responseError(c, http.StatusForbidden, fmt.Sprintf("Missing permission %s", permission))
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Authorizer) allowed(c *gin.Context, orgId string, permission string, resourceType string, resource func() ([]string, error)) (bool, error) {
+	// Roles in a token apply across the organization
+	for _, role := range requestRoles(c) {
+		if services.RolePermits(role, permission) {
+			return true, nil
+		}
+	}
+
+	subject := requestActor(c)
+	if subject == "" {
+		return false, nil
+	}
+	bindings, err := a.bindingSvc.ListSubjectRoleBindings(orgId, subject)
+	if err != nil {
+		return false, err
+	}
+
+	for _, b := range bindings {
+		var ids []string
+		if b.ResourceType != services.RoleBindingResourceOrganization {
+			if ids, err = resource(); err != nil {
+				return false, err
+			}
+		}
+		if b.Grants(permission, resourceType, ids) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
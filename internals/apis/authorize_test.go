@@ -0,0 +1,111 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requestAs sends a request with another API key than the admin key of the test API
+func (ta *testApi) requestAs(key *services.ApiKey, method string, path string, body string) *httptest.ResponseRecorder {
+	return ta.requestAsIfMatch(key, method, path, body, "")
+}
+
+// requestAsIfMatch sends a request with another API key and the If-Match header set, unless
+// ifMatch is empty
+func (ta *testApi) requestAsIfMatch(key *services.ApiKey, method string, path string, body string, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Terraxen-API", key.Key)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// keyWithRole creates an API key holding the role across the organization, restricted to
+// the scope if one is given
+func (ta *testApi) keyWithRole(t *testing.T, role string, scope map[string]string) *services.ApiKey {
+	key, err := ta.providers.ApiKeys.GenerateNewApiKey(ta.org.Id, role, time.Time{}, scope)
+	require.NoError(t, err)
+	binding, err := services.NewRoleBinding(ta.org.Id, services.ApiKeySubject(key.Id), role, "", "")
+	require.NoError(t, err)
+	require.NoError(t, ta.providers.RoleBindings.CreateRoleBinding(binding))
+	return key
+}
+
+func TestRoutesRequirePermissions(t *testing.T) {
+	ta := newTestApi(t)
+	parent := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	child, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "payments", parent.Id, parent.SchemaId, parent.SchemaVersion, map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	other, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "dev", "", parent.SchemaId, parent.SchemaVersion, map[string]string{"env": "dev"})
+	require.NoError(t, err)
+
+	key, err := ta.providers.ApiKeys.GenerateNewApiKey(ta.org.Id, "", time.Time{}, nil)
+	require.NoError(t, err)
+	subject := services.ApiKeySubject(key.Id)
+
+	// A key without roles can do nothing
+	rec := ta.requestAs(key, http.MethodGet, "/api/v1/namespaces/"+child.Id+"/resolve/vm", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission namespace:resolve")
+
+	rec = ta.request(http.MethodPost, "/api/v1/rolebindings/", `{"subject": "`+subject+`", "role": "resolver"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/namespaces/"+child.Id+"/resolve/vm", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.requestAsIfMatch(key, http.MethodPut, "/api/v1/namespaces/"+child.Id+"/variables/env", `{"value": "dev"}`, "*")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission namespace:write")
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/audit", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Owning a namespace allows changing it and the namespaces beneath it
+	rec = ta.request(http.MethodPost, "/api/v1/rolebindings/", `{"subject": "`+subject+`", "role": "namespace_owner", "resource_type": "namespace", "resource_id": "`+parent.Id+`"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var body struct {
+		Data services.RoleBinding `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+	rec = ta.requestAsIfMatch(key, http.MethodPut, "/api/v1/namespaces/"+child.Id+"/variables/env", `{"value": "dev"}`, "*")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.requestAsIfMatch(key, http.MethodPut, "/api/v1/namespaces/"+other.Id+"/variables/env", `{"value": "dev"}`, "*")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = ta.request(http.MethodDelete, "/api/v1/rolebindings/"+body.Data.Id, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = ta.requestAsIfMatch(key, http.MethodPut, "/api/v1/namespaces/"+child.Id+"/variables/env", `{"value": "test"}`, "*")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestRoleBindingsAreValidated(t *testing.T) {
+	ta := newTestApi(t)
+	subject := services.ApiKeySubject(ta.key.Id)
+
+	tests := map[string]struct {
+		body string
+		code int
+	}{
+		"unknown role":         {`{"subject": "` + subject + `", "role": "owner"}`, http.StatusBadRequest},
+		"admin of a namespace": {`{"subject": "` + subject + `", "role": "org_admin", "resource_type": "namespace", "resource_id": "ns"}`, http.StatusBadRequest},
+		"missing namespace":    {`{"subject": "` + subject + `", "role": "namespace_owner", "resource_type": "namespace", "resource_id": "ns"}`, http.StatusNotFound},
+		"missing schema":       {`{"subject": "` + subject + `", "role": "schema_author", "resource_type": "schema", "resource_id": "schema"}`, http.StatusNotFound},
+		"already an admin":     {`{"subject": "` + subject + `", "role": "org_admin"}`, http.StatusConflict},
+		"no subject":           {`{"role": "resolver"}`, http.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		rec := ta.request(http.MethodPost, "/api/v1/rolebindings/", tt.body)
+		assert.Equal(t, tt.code, rec.Code, name)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/MrWestbury/terraxen-naming-service/internals/engine"
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,6 +27,8 @@ func DecodeBody(c *gin.Context, result interface{}) error {
 	return nil
 }
 
+// ProcessListMetadata reads the offset and limit of a list request. Values that are not
+// numbers, or are negative, are ignored.
 func ProcessListMetadata(c *gin.Context) *ListMeta {
 	lm := &ListMeta{
 		Offset: 0,
@@ -34,19 +37,54 @@ func ProcessListMetadata(c *gin.Context) *ListMeta {
 
 	offsetStr := c.Query("offset")
 	offset, err := strconv.Atoi(offsetStr)
-	if err == nil {
+	if err == nil && offset >= 0 {
 		lm.Offset = offset
 	}
 
 	limitStr := c.Query("limit")
 	limit, err := strconv.Atoi(limitStr)
-	if err == nil {
+	if err == nil && limit >= 0 {
 		lm.Limit = limit
 	}
 
 	return lm
 }
 
+// Query parameters on the resolve endpoints that are not passed through as variables
+var reservedResolveParams = map[string]bool{
+	"at":      true,
+	"explain": true,
+}
+
+// Returns true when the caller asked for the resolution to be explained
+func explainRequested(c *gin.Context) bool {
+	explain, err := strconv.ParseBool(c.Query("explain"))
+	return err == nil && explain
+}
+
+// Returns the query parameters on a resolve request as pattern variables
+func requestVariables(c *gin.Context) map[string]string {
+	vars := make(map[string]string)
+	for k, v := range c.Request.URL.Query() {
+		if reservedResolveParams[k] || len(v) == 0 {
+			continue
+		}
+		vars[k] = v[0]
+	}
+	return vars
+}
+
+// Responds with the error of a failed resolution. Variables referencing each other in a
+// cycle are a mistake of the caller.
+func responseResolveError(c *gin.Context, err error) {
+	if cycle, ok := err.(*engine.ErrVariableCycle); ok {
+		responseError(c, http.StatusUnprocessableEntity, cycle.Error())
+		return
+	}
+	log.Printf("failed to resolve resource: %v", err)
+	responseError(c, http.StatusInternalServerError, "Failed to resolve resource")
+}
+
 // Temp
 func NotImplemented(c *gin.Context) {
 	responseError(c, http.StatusNotImplemented, "Not yet implemented")
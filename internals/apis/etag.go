@@ -0,0 +1,41 @@
+package apis
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sets the revision of the returned resource as its entity tag
+func setETag(c *gin.Context, revision int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(revision)))
+}
+
+// Returns the revision the caller expects to change, taken from the If-Match header. A
+// wildcard matches any revision and is returned as 0. Writes the error response and
+// returns false if the header is missing or does not name a revision.
+func requiredRevision(c *gin.Context) (int, bool) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" {
+		responseError(c, http.StatusPreconditionRequired, "If-Match header with the ETag of the resource is required")
+		return 0, false
+	}
+
+	if ifMatch == "*" {
+		return 0, true
+	}
+
+	// Revisions are strong validators, so weak tags never match
+	unquoted, err := strconv.Unquote(ifMatch)
+	if err == nil {
+		revision, err := strconv.Atoi(unquoted)
+		if err == nil && revision > 0 {
+			return revision, true
+		}
+	}
+
+	responseError(c, http.StatusPreconditionFailed, "Resource has been modified since it was read")
+	return 0, false
+}
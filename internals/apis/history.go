@@ -0,0 +1,216 @@
+package apis
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// VariableHistory snapshots organization and namespace variables after every change made
+// through the API, and reconstructs them as they were at a point in time
+type VariableHistory struct {
+	historySvc services.VariableHistoryProvider
+	orgSvc     services.OrganizationServiceProvider
+	nsSvc      services.NamespaceServiceProvider
+	schemaSvc  services.SchemaServiceProvider
+}
+
+func NewVariableHistory(historySvc services.VariableHistoryProvider, orgSvc services.OrganizationServiceProvider, nsSvc services.NamespaceServiceProvider, schemaSvc services.SchemaServiceProvider) *VariableHistory {
+	return &VariableHistory{
+		historySvc: historySvc,
+		orgSvc:     orgSvc,
+		nsSvc:      nsSvc,
+		schemaSvc:  schemaSvc,
+	}
+}
+
+// namespaceState is what a namespace resolves against: its schema pin and the variables of
+// the organization and of each namespace from the root down to it. schemaVersion is the
+// version the pin resolved to, when it is known from the history, and otherwise nil.
+type namespaceState struct {
+	namespace     *services.Namespace
+	schemaVersion *services.SchemaVersion
+	orgVars       map[string]string
+	chain         []*services.Namespace
+	ownVars       map[string]map[string]string
+}
+
+// RecordOrganization snapshots the variables of the organization. Like the audit log, a
+// failure is logged as the change has already been made.
+func (h *VariableHistory) RecordOrganization(org *services.Organization) {
+	h.record(services.NewOrganizationSnapshot(org))
+}
+
+// RecordNamespace snapshots the namespace as it is now. If the schema version its pin
+// resolves to cannot be read, the snapshot is still recorded without it, and resolving at
+// that time falls back to the schema version as it is now.
+func (h *VariableHistory) RecordNamespace(orgId string, nsId string) {
+	if h == nil || h.historySvc == nil {
+		return
+	}
+
+	ns, err := h.nsSvc.GetNamespaceById(orgId, nsId)
+	if err == nil {
+		var vars map[string]string
+		vars, err = ownVariables(h.nsSvc, orgId, nsId)
+		if err == nil {
+			sv, svErr := h.schemaSvc.GetSchemaVersion(orgId, ns.SchemaId, ns.SchemaVersion)
+			if svErr != nil {
+				log.Printf("failed to get schema version for snapshot of namespace %s: %v", nsId, svErr)
+				sv = nil
+			}
+			h.record(services.NewNamespaceSnapshot(ns, vars, sv))
+		}
+	}
+	if err != nil {
+		log.Printf("failed to snapshot variables of namespace %s: %v", nsId, err)
+	}
+}
+
+// RecordSchemaVersion snapshots the namespaces whose pin resolves to the schema version
+// after it was created or changed: those pinned to it and, as it may now be the latest, those
+// pinned to the latest version of its schema
+func (h *VariableHistory) RecordSchemaVersion(orgId string, sv *services.SchemaVersion) {
+	if h == nil || h.historySvc == nil {
+		return
+	}
+
+	namespaces, err := h.nsSvc.ListNamespaces(orgId)
+	if err != nil {
+		log.Printf("failed to snapshot namespaces of schema %s: %v", sv.SchemaId, err)
+		return
+	}
+	version := strconv.Itoa(sv.Id)
+	for _, ns := range namespaces {
+		if ns.SchemaId == sv.SchemaId && (ns.SchemaVersion == version || ns.SchemaVersion == "latest") {
+			h.RecordNamespace(orgId, ns.Id)
+		}
+	}
+}
+
+// RecordNamespaceDeleted records that the namespace no longer exists
+func (h *VariableHistory) RecordNamespaceDeleted(ns *services.Namespace) {
+	h.record(services.NewDeletedNamespaceSnapshot(ns))
+}
+
+func (h *VariableHistory) record(snapshot *services.VariableSnapshot) {
+	if h == nil || h.historySvc == nil {
+		return
+	}
+	if err := h.historySvc.RecordSnapshot(snapshot); err != nil {
+		log.Printf("failed to record variable snapshot of organization %s namespace %s: %v", snapshot.OrganizationId, snapshot.NamespaceId, err)
+	}
+}
+
+// snapshotAt returns the snapshot of the organization or namespace in force at the given time.
+// Those that have not changed since history was kept have no snapshots and are returned as
+// nil, meaning they are as they are now. Fails with ErrNoVariableHistory if snapshots only
+// start after at.
+func (h *VariableHistory) snapshotAt(orgId string, nsId string, at time.Time) (*services.VariableSnapshot, error) {
+	snapshot, err := h.historySvc.SnapshotAt(orgId, nsId, at)
+	if err != nil || snapshot != nil {
+		return snapshot, err
+	}
+
+	later, err := h.historySvc.ListSnapshots(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	if len(later) > 0 {
+		return nil, services.ErrNoVariableHistory
+	}
+	return nil, nil
+}
+
+// stateAt reconstructs the namespace, its parents and the variables of each as they were at
+// the given time
+func (h *VariableHistory) stateAt(orgId string, nsId string, at time.Time) (*namespaceState, error) {
+	state := &namespaceState{
+		ownVars: map[string]map[string]string{},
+	}
+
+	orgSnapshot, err := h.snapshotAt(orgId, "", at)
+	if err != nil {
+		return nil, err
+	}
+	if orgSnapshot != nil {
+		state.orgVars = orgSnapshot.Variables
+	} else {
+		org, err := h.orgSvc.GetOrganizationById(orgId)
+		if err != nil {
+			return nil, err
+		}
+		if org == nil {
+			return nil, services.ErrOrganizationNotFound
+		}
+		state.orgVars = org.OrgVars
+	}
+
+	targetId := nsId
+	getAt := func(orgId string, nsId string) (*services.Namespace, error) {
+		snapshot, err := h.snapshotAt(orgId, nsId, at)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			ns, err := h.nsSvc.GetNamespaceById(orgId, nsId)
+			if err != nil {
+				return nil, err
+			}
+			state.ownVars[nsId], err = ownVariables(h.nsSvc, orgId, nsId)
+			return ns, err
+		}
+		if snapshot.Deleted {
+			return nil, services.ErrNamespaceNotFound
+		}
+		if nsId == targetId {
+			state.schemaVersion = snapshot.ResolvedSchemaVersion
+		}
+		state.ownVars[nsId] = snapshot.Variables
+		return snapshot.Namespace(), nil
+	}
+
+	state.chain, err = services.WalkNamespaceAncestors(getAt, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	state.namespace = state.chain[len(state.chain)-1]
+	return state, nil
+}
+
+// List the snapshots of the organization variables, newest first
+func (orgApi *OrganizationHandler) GetVariableHistory(c *gin.Context) {
+	orgUrlId := c.Param("orgId")
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	if orgUrlId != orgId {
+		responseError(c, http.StatusInternalServerError, "Organization ID mismatch")
+		return
+	}
+
+	snapshots, err := orgApi.history.historySvc.ListSnapshots(orgId, "")
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to get variable history")
+		return
+	}
+
+	responseSingleItem(c, snapshots)
+}
+
+// List the snapshots of the namespace, newest first. The history of a deleted namespace is kept.
+func (nsApi *NamespaceHandler) GetVariableHistory(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	snapshots, err := nsApi.history.historySvc.ListSnapshots(orgId, nsId)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to get variable history")
+		return
+	}
+
+	responseSingleItem(c, snapshots)
+}
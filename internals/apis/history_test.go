@@ -0,0 +1,34 @@
+package apis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreadableSchemaVersions fails every schema version lookup
+type unreadableSchemaVersions struct {
+	services.SchemaServiceProvider
+}
+
+func (unreadableSchemaVersions) GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	return nil, errors.New("schema store unavailable")
+}
+
+func TestNamespaceSnapshotIsRecordedWithoutSchemaVersion(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+
+	p := ta.providers
+	history := NewVariableHistory(p.History, p.Organizations, p.Namespaces, unreadableSchemaVersions{p.Schemas})
+	history.RecordNamespace(ta.org.Id, ns.Id)
+
+	snapshots, err := p.History.ListSnapshots(ta.org.Id, ns.Id)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, map[string]string{"env": "prod"}, snapshots[0].Variables)
+	assert.Nil(t, snapshots[0].ResolvedSchemaVersion)
+}
@@ -0,0 +1,229 @@
+package apis
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/dgrijalva/jwt-go/v4"
+)
+
+const (
+	defaultOrganizationClaim = "OrganizationId"
+	defaultUserClaim         = "UserId"
+	defaultRolesClaim        = "roles"
+)
+
+// TerraxenClaims is who a verified token says the caller is. OrganizationId is set when the
+// caller is a member of exactly one organization.
+type TerraxenClaims struct {
+	jwt.StandardClaims
+	OrganizationId string
+	UserId         string
+	Organizations  []string
+	Roles          []string
+}
+
+// JWTVerifier checks bearer tokens against the key, issuer and audience in the config and
+// maps their claims to the organizations, user and roles of the caller
+type JWTVerifier struct {
+	parser   *jwt.Parser
+	keyFunc  jwt.Keyfunc
+	audience string
+	claims   config.ClaimsConfig
+	jwks     *jwksCache
+}
+
+// NewJWTVerifier returns a verifier for the config, or nil when JWT authentication is not
+// configured. Fails if the key cannot be loaded.
+func NewJWTVerifier(cfg config.JWTConfig) (*JWTVerifier, error) {
+	if cfg.Algorithm == "" {
+		return nil, nil
+	}
+
+	method := jwt.GetSigningMethod(cfg.Algorithm)
+	key, err := loadJWTKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	options := parserOptions([]string{cfg.Algorithm}, cfg.Issuer, cfg.Audience, cfg.LeewaySeconds)
+
+	return &JWTVerifier{
+		parser:   jwt.NewParser(options...),
+		keyFunc:  jwt.KnownKeyfunc(method, key),
+		audience: cfg.Audience,
+		claims:   cfg.ClaimsConfig,
+	}, nil
+}
+
+func parserOptions(methods []string, issuer string, audience string, leewaySeconds int) []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(time.Duration(leewaySeconds) * time.Second),
+	}
+	if issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	} else {
+		options = append(options, jwt.WithoutAudienceValidation())
+	}
+	return options
+}
+
+// Verify checks the signature, expiry, issuer and audience of the token and returns its claims
+func (v *JWTVerifier) Verify(tokenString string) (*TerraxenClaims, error) {
+	claims := &tokenClaims{}
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	// The parser only checks the audience of tokens that have one
+	if v.audience != "" && len(claims.Audience) == 0 {
+		return nil, &jwt.InvalidAudienceError{Message: "token has no audience"}
+	}
+
+	result := &TerraxenClaims{
+		StandardClaims: claims.StandardClaims,
+		UserId:         claims.userId(claimName(v.claims.UserClaim, defaultUserClaim)),
+		Organizations:  claims.stringsClaim(claimName(v.claims.OrganizationClaim, defaultOrganizationClaim)),
+		Roles:          mapRoles(claims.stringsClaim(claimName(v.claims.RolesClaim, defaultRolesClaim)), v.claims.RoleMapping),
+	}
+	if len(result.Organizations) == 1 {
+		result.OrganizationId = result.Organizations[0]
+	}
+	return result, nil
+}
+
+func claimName(name string, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// Maps the roles in the token to Terraxen roles, dropping those the mapping does not list.
+// A role, super_admin above all, is never taken from a token as it is: without a mapping the
+// token grants no roles.
+func mapRoles(roles []string, mapping map[string]string) []string {
+	mapped := []string{}
+	for _, role := range roles {
+		if r, found := mapping[role]; found {
+			mapped = append(mapped, r)
+		}
+	}
+	return mapped
+}
+
+// tokenClaims keeps every claim of the token so the organizations, user and roles can be read from
+// the claims named in the config
+type tokenClaims struct {
+	jwt.StandardClaims
+	all map[string]interface{}
+}
+
+func (tc *tokenClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &tc.StandardClaims); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &tc.all)
+}
+
+// Valid also requires the token to expire, which the standard claims leave optional
+func (tc *tokenClaims) Valid(h *jwt.ValidationHelper) error {
+	if tc.ExpiresAt == nil {
+		return &jwt.InvalidClaimsError{Message: "token has no expiry"}
+	}
+	return tc.StandardClaims.Valid(h)
+}
+
+func (tc *tokenClaims) stringClaim(name string) string {
+	value, _ := tc.all[name].(string)
+	return value
+}
+
+// Returns the claim as a list of strings. A single string is a list of one.
+func (tc *tokenClaims) stringsClaim(name string) []string {
+	switch value := tc.all[name].(type) {
+	case string:
+		if value != "" {
+			return []string{value}
+		}
+	case []interface{}:
+		result := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return []string{}
+}
+
+// The user is the subject of tokens without the user claim
+func (tc *tokenClaims) userId(name string) string {
+	if userId := tc.stringClaim(name); userId != "" {
+		return userId
+	}
+	return tc.Subject
+}
+
+func loadJWTKey(cfg config.JWTConfig) (interface{}, error) {
+	switch cfg.Algorithm {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("jwt: HS256 needs a secret")
+		}
+		return []byte(cfg.Secret), nil
+	case "RS256":
+		pem, err := publicKeyPEM(cfg)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: failed to parse RS256 public key: %w", err)
+		}
+		return key, nil
+	case "ES256":
+		pem, err := publicKeyPEM(cfg)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: failed to parse ES256 public key: %w", err)
+		}
+		if !isP256(key) {
+			return nil, errors.New("jwt: ES256 needs a P-256 public key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %q", cfg.Algorithm)
+	}
+}
+
+func publicKeyPEM(cfg config.JWTConfig) ([]byte, error) {
+	if cfg.PublicKey != "" {
+		return []byte(cfg.PublicKey), nil
+	}
+	if cfg.PublicKeyFile == "" {
+		return nil, fmt.Errorf("jwt: %s needs a public key or public key file", cfg.Algorithm)
+	}
+	pem, err := ioutil.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to read public key file: %w", err)
+	}
+	return pem, nil
+}
+
+func isP256(key *ecdsa.PublicKey) bool {
+	return key.Curve.Params().Name == "P-256"
+}
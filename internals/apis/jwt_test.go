@@ -0,0 +1,174 @@
+package apis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJWTSecret = "test-secret"
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims(orgId string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://issuer.test",
+		"aud":            "terraxen",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"OrganizationId": orgId,
+		"UserId":         "user-1",
+		"roles":          []string{"org_admin"},
+	}
+}
+
+func publicKeyPEMString(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func (ta *testApi) bearerRequest(method string, path string, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", authorization)
+	rec := httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerTokensAreVerified(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{
+		Auth: config.AuthConfig{
+			JWT: config.JWTConfig{
+				Algorithm: "HS256",
+				Secret:    testJWTSecret,
+				Issuer:    "https://issuer.test",
+				Audience:  "terraxen",
+				ClaimsConfig: config.ClaimsConfig{
+					RoleMapping: map[string]string{"org_admin": "org_admin"},
+				},
+			},
+		},
+	})
+	secret := []byte(testJWTSecret)
+
+	token := signToken(t, jwt.SigningMethodHS256, secret, validClaims(ta.org.Id))
+	rec := ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rejected := map[string]string{
+		"no scheme":        token,
+		"empty":            "Bearer ",
+		"malformed":        "Bearer not-a-token",
+		"wrong secret":     "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("other"), validClaims(ta.org.Id)),
+		"unsigned":         "Bearer " + signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims(ta.org.Id)),
+		"expired":          "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, withClaim(validClaims(ta.org.Id), "exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":        "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, withClaim(validClaims(ta.org.Id), "exp", nil)),
+		"wrong issuer":     "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, withClaim(validClaims(ta.org.Id), "iss", "https://other.test")),
+		"wrong audience":   "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, withClaim(validClaims(ta.org.Id), "aud", "other")),
+		"missing audience": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, withClaim(validClaims(ta.org.Id), "aud", nil)),
+	}
+	for name, authorization := range rejected {
+		rec := ta.bearerRequest(http.MethodGet, "/api/v1/audit", authorization)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, name)
+	}
+}
+
+func TestTokenRolesRequireMapping(t *testing.T) {
+	jwtConfig := config.JWTConfig{Algorithm: "HS256", Secret: testJWTSecret}
+	ta := newTestApiWithConfig(t, &config.Config{Auth: config.AuthConfig{JWT: jwtConfig}})
+	superAdmin := signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), withClaim(validClaims(ta.org.Id), "roles", []string{"super_admin", "org_admin"}))
+
+	// Without a mapping a token grants no roles, not even those named like Terraxen roles
+	rec := ta.bearerRequest(http.MethodGet, "/api/v1/organizations/", "Bearer "+superAdmin)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+superAdmin)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	jwtConfig.RoleMapping = map[string]string{"org_admin": "org_admin"}
+	ta = newTestApiWithConfig(t, &config.Config{Auth: config.AuthConfig{JWT: jwtConfig}})
+	superAdmin = signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), withClaim(validClaims(ta.org.Id), "roles", []string{"super_admin", "org_admin"}))
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/organizations/", "Bearer "+superAdmin)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "super_admin is not mapped")
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+superAdmin)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestBearerTokensRejectedWithoutJWTConfig(t *testing.T) {
+	ta := newTestApi(t)
+
+	token := signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), validClaims(ta.org.Id))
+	rec := ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestJWTVerifierPublicKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		algorithm string
+		method    jwt.SigningMethod
+		private   interface{}
+		public    interface{}
+	}{
+		{"RS256", jwt.SigningMethodRS256, rsaKey, &rsaKey.PublicKey},
+		{"ES256", jwt.SigningMethodES256, ecKey, &ecKey.PublicKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			v, err := NewJWTVerifier(config.JWTConfig{
+				Algorithm:    tt.algorithm,
+				PublicKey:    publicKeyPEMString(t, tt.public),
+				ClaimsConfig: config.ClaimsConfig{OrganizationClaim: "org"},
+			})
+			require.NoError(t, err)
+
+			claims := jwt.MapClaims{
+				"sub": "user-2",
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"org": "org-1",
+			}
+			result, err := v.Verify(signToken(t, tt.method, tt.private, claims))
+			require.NoError(t, err)
+			assert.Equal(t, "org-1", result.OrganizationId)
+			assert.Equal(t, "user-2", result.UserId)
+
+			// A token signed with the shared secret algorithm must not pass as the public key
+			forged := signToken(t, jwt.SigningMethodHS256, []byte(publicKeyPEMString(t, tt.public)), claims)
+			_, err = v.Verify(forged)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = NewJWTVerifier(config.JWTConfig{Algorithm: "RS256"})
+	assert.Error(t, err)
+	_, err = NewJWTVerifier(config.JWTConfig{Algorithm: "HS512", Secret: testJWTSecret})
+	assert.Error(t, err)
+}
+
+func withClaim(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
@@ -0,0 +1,268 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (nsApi *NamespaceHandler) LockNamespace(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	var lockReq LockNamespaceRequest
+	if err := DecodeBody(c, &lockReq); err != nil {
+		return
+	}
+
+	lock := services.NamespaceLock{
+		LockedBy: requestActor(c),
+		Reason:   lockReq.Reason,
+		LockedAt: time.Now().UTC(),
+	}
+	if lockReq.Expires != nil {
+		lock.Expires = lockReq.Expires.UTC()
+	}
+
+	// Replacing the lock of someone else could shorten it
+	current, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return
+	}
+	if !nsApi.ensureLockHolder(c, current) {
+		return
+	}
+
+	ns, err := nsApi.nsSvc.LockNamespace(orgId, nsId, lock)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to lock namespace")
+		return
+	}
+
+	nsApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespaceLock, nsId, current.Lock, ns.Lock)
+	setETag(c, ns.Revision)
+	responseSingleItem(c, ns)
+}
+
+func (nsApi *NamespaceHandler) UnlockNamespace(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	locked, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return
+	}
+	if !nsApi.ensureLockHolder(c, locked) {
+		return
+	}
+
+	ns, err := nsApi.nsSvc.UnlockNamespace(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to unlock namespace")
+		return
+	}
+
+	if locked.Lock != nil {
+		nsApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceNamespaceLock, nsId, locked.Lock, nil)
+	}
+	setETag(c, ns.Revision)
+	responseSingleItem(c, ns)
+}
+
+// Checks that the active lock of the namespace, if any, may be changed: by whoever locked it,
+// or by overriding it. Writes the error response and returns false otherwise.
+func (nsApi *NamespaceHandler) ensureLockHolder(c *gin.Context, ns *services.Namespace) bool {
+	lock := ns.Lock
+	if !lock.Active(time.Now()) || lock.LockedBy == requestActor(c) {
+		return true
+	}
+	reason := fmt.Sprintf("Namespace %s is locked by %s: %s", ns.Name, lock.LockedBy, lock.Reason)
+	return allowLockOverride(c, nsApi.authz, reason)
+}
+
+// Checks that variables and the schema pin of the namespace may be changed, or the namespace
+// deleted. Writes the error response and returns false if the namespace, one of its parents or
+// the organization is frozen.
+func (nsApi *NamespaceHandler) ensureNamespaceWritable(c *gin.Context, orgId string, nsId string) bool {
+	chain, err := nsApi.nsSvc.GetNamespaceAncestors(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return false
+	}
+
+	now := time.Now()
+	lockedNs, lock := services.ActiveNamespaceLock(chain, now)
+	if lock != nil {
+		reason := fmt.Sprintf("Namespace %s is locked: %s", lockedNs.Name, lock.Reason)
+		return allowLockOverride(c, nsApi.authz, reason)
+	}
+
+	org, err := nsApi.orgSvc.GetOrganizationById(orgId)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Something went wrong")
+		return false
+	}
+	return ensureOrganizationNotFrozen(c, nsApi.authz, org, now)
+}
+
+// Writes the error response and returns false if the organization is in a freeze window
+func ensureOrganizationNotFrozen(c *gin.Context, authz *Authorizer, org *services.Organization, now time.Time) bool {
+	if org == nil {
+		return true
+	}
+
+	fw := org.ActiveFreezeWindow(now)
+	if fw == nil {
+		return true
+	}
+
+	return allowLockOverride(c, authz, freezeReason(fw))
+}
+
+func freezeReason(fw *services.FreezeWindow) string {
+	return fmt.Sprintf("Organization is in freeze window %s until %s: %s", fw.Name, fw.End.Format(time.RFC3339), fw.Reason)
+}
+
+// Lets a protected change through when the caller asked to override and holds the
+// lock:override permission
+func allowLockOverride(c *gin.Context, authz *Authorizer, reason string) bool {
+	override, err := strconv.ParseBool(c.Query("override"))
+	if err != nil || !override {
+		responseError(c, http.StatusLocked, reason)
+		return false
+	}
+
+	allowed, err := authz.Permits(c, services.PermissionLockOverride)
+	if err != nil {
+		log.Printf("failed to check permission %s: %v", services.PermissionLockOverride, err)
+		responseError(c, http.StatusInternalServerError, "Failed to check permissions")
+		return false
+	}
+	if !allowed {
+		responseError(c, http.StatusForbidden, fmt.Sprintf("Missing permission %s", services.PermissionLockOverride))
+		return false
+	}
+	return true
+}
+
+// Returns the freeze window active now that the new windows no longer cover until its end,
+// or nil. Such a change shortens or removes a freeze while it protects the organization.
+func shortenedFreezeWindow(current []services.FreezeWindow, windows []services.FreezeWindow, now time.Time) *services.FreezeWindow {
+	for i := range current {
+		fw := &current[i]
+		if !fw.Active(now) {
+			continue
+		}
+		covered := false
+		for _, w := range windows {
+			if !w.Start.After(now) && !w.End.Before(fw.End) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fw
+		}
+	}
+	return nil
+}
+
+func (orgApi *OrganizationHandler) GetFreezeWindows(c *gin.Context) {
+	orgUrlId := c.Param("orgId")
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	if orgUrlId != orgId {
+		responseError(c, http.StatusInternalServerError, "Organization ID mismatch")
+		return
+	}
+
+	org, err := orgApi.orgSvc.GetOrganizationById(orgId)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Something went wrong our end")
+		return
+	}
+
+	if org == nil {
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return
+	}
+
+	setETag(c, org.Revision)
+	responseSingleItem(c, org.FreezeWindows)
+}
+
+func (orgApi *OrganizationHandler) PutFreezeWindows(c *gin.Context) {
+	orgUrlId := c.Param("orgId")
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	if orgUrlId != orgId {
+		responseError(c, http.StatusInternalServerError, "Organization ID mismatch")
+		return
+	}
+
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	var fwReq FreezeWindowsRequest
+	if err := DecodeBody(c, &fwReq); err != nil {
+		return
+	}
+
+	windows := make([]services.FreezeWindow, 0, len(fwReq.FreezeWindows))
+	for _, fw := range fwReq.FreezeWindows {
+		if !fw.End.After(fw.Start) {
+			responseError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Freeze window %s must end after it starts", fw.Name))
+			return
+		}
+		windows = append(windows, services.FreezeWindow{
+			Name:   fw.Name,
+			Reason: fw.Reason,
+			Start:  fw.Start.UTC(),
+			End:    fw.End.UTC(),
+		})
+	}
+
+	current, err := orgApi.orgSvc.GetOrganizationById(orgId)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Something went wrong our end")
+		return
+	}
+
+	if current == nil {
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return
+	}
+	if fw := shortenedFreezeWindow(current.FreezeWindows, windows, time.Now()); fw != nil {
+		if !allowLockOverride(c, orgApi.authz, freezeReason(fw)) {
+			return
+		}
+	}
+
+	org, err := orgApi.orgSvc.SetFreezeWindows(orgId, windows, revision)
+	if err == services.ErrRevisionMismatch {
+		responseError(c, http.StatusPreconditionFailed, "Organization has been modified since it was read")
+		return
+	}
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Something went wrong our end")
+		return
+	}
+
+	if org == nil {
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return
+	}
+
+	orgApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceFreezeWindows, orgId, current.FreezeWindows, org.FreezeWindows)
+	setETag(c, org.Revision)
+	responseSingleItem(c, org.FreezeWindows)
+}
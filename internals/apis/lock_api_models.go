@@ -0,0 +1,19 @@
+package apis
+
+import "time"
+
+type LockNamespaceRequest struct {
+	Reason  string     `json:"reason"`
+	Expires *time.Time `json:"expires"`
+}
+
+type FreezeWindowsRequest struct {
+	FreezeWindows []FreezeWindowRequest `json:"freeze_windows"`
+}
+
+type FreezeWindowRequest struct {
+	Name   string    `json:"name"`
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
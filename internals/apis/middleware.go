@@ -1,72 +1,246 @@
 package apis
 
 import (
-	"fmt"
+	"crypto/subtle"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
-	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 const (
-	ORG_CONTEXT_NAME = "x-organization-id"
+	ORG_CONTEXT_NAME        = "x-organization-id"
+	API_KEY_CONTEXT_NAME    = "x-api-key"
+	REQUEST_ID_CONTEXT_NAME = "x-request-id"
+	USER_CONTEXT_NAME       = "x-user-id"
+	ROLES_CONTEXT_NAME      = "x-roles"
+	ADMIN_CONTEXT_NAME      = "x-admin"
 )
 
-type TerraxenClaims struct {
-	jwt.StandardClaims
-	OrganizationId string
-	UserId         string
-}
+const (
+	requestIdHeader    = "X-Request-Id"
+	organizationHeader = "X-Terraxen-Organization"
+	adminHeader        = "X-Terraxen-Admin"
+)
+
+// Subject of the server administrator in the audit log
+const adminActor = "admin"
+
+// How precisely the last use of an API key is recorded
+const keyUseResolution = time.Minute
 
 type Middlewares struct {
-	apiSvc services.ApiKeyProvider
+	apiSvc     services.ApiKeyProvider
+	orgSvc     services.OrganizationServiceProvider
+	adminToken string
+	verifiers  []*JWTVerifier
 }
 
-func NewMiddlewares(apiKeySvc services.ApiKeyProvider) *Middlewares {
+// NewMiddlewares returns the middlewares, accepting the administrator credential when
+// adminToken is set and bearer tokens that pass any of the verifiers. Nil verifiers are
+// skipped.
+func NewMiddlewares(apiKeySvc services.ApiKeyProvider, orgSvc services.OrganizationServiceProvider, adminToken string, verifiers ...*JWTVerifier) *Middlewares {
 	mdw := &Middlewares{
-		apiSvc: apiKeySvc,
+		apiSvc:     apiKeySvc,
+		orgSvc:     orgSvc,
+		adminToken: adminToken,
+	}
+	for _, v := range verifiers {
+		if v != nil {
+			mdw.verifiers = append(mdw.verifiers, v)
+		}
 	}
 	return mdw
 }
 
+// RequestId tags the request with the ID sent by the caller, or a new one, and returns it
+// in the response so changes in the audit log can be traced back to a request
+func (m *Middlewares) RequestId(c *gin.Context) {
+	requestId := c.GetHeader(requestIdHeader)
+	if requestId == "" {
+		requestId = uuid.NewString()
+	}
+	c.Set(REQUEST_ID_CONTEXT_NAME, requestId)
+	c.Header(requestIdHeader, requestId)
+	c.Next()
+}
+
 func (m *Middlewares) ValidateRequest(c *gin.Context) {
 	apiKey := c.GetHeader("X-Terraxen-API")
 	authHeader := c.GetHeader("authorization")
+	if adminToken := c.GetHeader(adminHeader); adminToken != "" {
+		if m.adminToken == "" || subtle.ConstantTimeCompare([]byte(adminToken), []byte(m.adminToken)) != 1 {
+			responseError(c, http.StatusForbidden, "Admin credential rejected")
+			return
+		}
+		// The administrator acts outside of any organization, as a super admin
+		c.Set(ORG_CONTEXT_NAME, "")
+		c.Set(ADMIN_CONTEXT_NAME, true)
+		c.Set(ROLES_CONTEXT_NAME, []string{services.RoleSuperAdmin})
+		c.Next()
+		return
+	}
+
 	if apiKey != "" {
-		ak := m.apiSvc.GetKey(apiKey)
+		var ak *services.ApiKey
+		if services.ApiKeyChecksumValid(apiKey) {
+			ak = m.apiSvc.GetKey(apiKey)
+		}
 		if ak == nil {
 			responseError(c, http.StatusForbidden, "Api key rejected")
 			return
 		}
+		now := time.Now()
+		if ak.Expired(now) {
+			responseError(c, http.StatusForbidden, "Api key expired")
+			return
+		}
+		if !m.organizationActive(c, ak.OrganizationId) {
+			return
+		}
+		m.recordKeyUse(ak, now)
 		c.Set(ORG_CONTEXT_NAME, ak.OrganizationId)
+		c.Set(API_KEY_CONTEXT_NAME, ak)
 		c.Next()
 		return
 	}
 
 	if authHeader != "" {
-		parts := strings.Split(authHeader, " ")
-
-		m.validateJWT(parts[1], []byte("terraxen"))
+		claims, err := m.validateJWT(authHeader)
+		if err != nil {
+			log.Printf("bearer token rejected: %v", err)
+			responseError(c, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		orgId, member := selectOrganization(c, claims)
+		if !member {
+			responseError(c, http.StatusForbidden, "Not a member of the organization")
+			return
+		}
+		if !m.organizationActive(c, orgId) {
+			return
+		}
+		c.Set(ORG_CONTEXT_NAME, orgId)
+		c.Set(USER_CONTEXT_NAME, claims.UserId)
+		c.Set(ROLES_CONTEXT_NAME, claims.Roles)
+		c.Next()
+		return
 	}
 
 	c.Set(ORG_CONTEXT_NAME, "")
 	c.Next()
 }
 
-func (m *Middlewares) validateJWT(jwtToken string, key []byte) {
-
-	token, err := jwt.ParseWithClaims(jwtToken, &TerraxenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// since we only use the one private key to sign the tokens,
-		// we also only use its public counter part to verify
-		return key, nil
-	})
+// Rejects requests for a suspended or deleted organization, responding with an error and
+// returning false
+func (m *Middlewares) organizationActive(c *gin.Context, orgId string) bool {
+	if orgId == "" {
+		return true
+	}
+	org, err := m.orgSvc.GetOrganizationById(orgId)
 	if err != nil {
-		log.Fatalf("JWT verify failed: %v", err)
+		log.Printf("failed to get organization %s: %v", orgId, err)
+		responseError(c, http.StatusInternalServerError, "Failed to check the organization")
+		return false
 	}
+	if org != nil && org.Deletion != nil {
+		responseError(c, http.StatusForbidden, "Organization deleted")
+		return false
+	}
+	if org != nil && org.Suspension != nil {
+		responseError(c, http.StatusForbidden, "Organization suspended")
+		return false
+	}
+	return true
+}
+
+// Records when the key was used, at most once per keyUseResolution so that busy keys do not
+// write to the store on every request. A failure is logged rather than failing the request.
+func (m *Middlewares) recordKeyUse(ak *services.ApiKey, now time.Time) {
+	if now.Sub(ak.LastUsedAt) < keyUseResolution {
+		return
+	}
+	at := now.UTC()
+	if err := m.apiSvc.SetKeyLastUsed(ak.Id, at); err != nil {
+		log.Printf("failed to record the use of API key %s: %v", ak.Id, err)
+		return
+	}
+	ak.LastUsedAt = at
+}
+
+// Verifies the bearer token in the authorization header and returns its claims
+func (m *Middlewares) validateJWT(authHeader string) (*TerraxenClaims, error) {
+	if len(m.verifiers) == 0 {
+		return nil, errors.New("JWT authentication is not configured")
+	}
+
+	parts := strings.Fields(authHeader)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil, errors.New("authorization header is not a bearer token")
+	}
+
+	var err error
+	for _, v := range m.verifiers {
+		var claims *TerraxenClaims
+		if claims, err = v.Verify(parts[1]); err == nil {
+			return claims, nil
+		}
+	}
+	return nil, err
+}
+
+// Returns the organization the request is for. Callers that are members of several
+// organizations choose one with the X-Terraxen-Organization header; without it the request
+// is for no organization. Returns false if the caller is not a member of the one chosen.
+func selectOrganization(c *gin.Context, claims *TerraxenClaims) (string, bool) {
+	requested := c.GetHeader(organizationHeader)
+	if requested == "" {
+		return claims.OrganizationId, true
+	}
+	for _, orgId := range claims.Organizations {
+		if orgId == requested {
+			return orgId, true
+		}
+	}
+	return "", false
+}
+
+// Returns the API key used to authenticate the request, or nil
+func requestApiKey(c *gin.Context) *services.ApiKey {
+	value, found := c.Get(API_KEY_CONTEXT_NAME)
+	if !found {
+		return nil
+	}
+	ak, _ := value.(*services.ApiKey)
+	return ak
+}
+
+// Returns an identifier for whoever made the request, which is also the subject of the
+// roles bound to them
+func requestActor(c *gin.Context) string {
+	if isAdminRequest(c) {
+		return adminActor
+	}
+	if ak := requestApiKey(c); ak != nil {
+		return services.ApiKeySubject(ak.Id)
+	}
+	if userId := c.GetString(USER_CONTEXT_NAME); userId != "" {
+		return services.UserSubject(userId)
+	}
+	return ""
+}
+
+// Returns the roles in the token used to authenticate the request
+func requestRoles(c *gin.Context) []string {
+	return c.GetStringSlice(ROLES_CONTEXT_NAME)
+}
 
-	claims := token.Claims.(*TerraxenClaims)
-	fmt.Println(claims.UserId)
+// Reports whether the request was made with the administrator credential
+func isAdminRequest(c *gin.Context) bool {
+	return c.GetBool(ADMIN_CONTEXT_NAME)
 }
@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/MrWestbury/terraxen-naming-service/internals/engine"
@@ -12,13 +13,19 @@ type NamespaceHandler struct {
 	orgSvc    services.OrganizationServiceProvider
 	nsSvc     services.NamespaceServiceProvider
 	schemaSvc services.SchemaServiceProvider
+	authz     *Authorizer
+	auditor   *Auditor
+	history   *VariableHistory
 }
 
-func NewNamespaceHandler(svc services.NamespaceServiceProvider, oSvc services.OrganizationServiceProvider, sSvc services.SchemaServiceProvider) *NamespaceHandler {
+func NewNamespaceHandler(svc services.NamespaceServiceProvider, oSvc services.OrganizationServiceProvider, sSvc services.SchemaServiceProvider, authz *Authorizer, auditor *Auditor, history *VariableHistory) *NamespaceHandler {
 	nsApi := &NamespaceHandler{
 		nsSvc:     svc,
 		orgSvc:    oSvc,
 		schemaSvc: sSvc,
+		authz:     authz,
+		auditor:   auditor,
+		history:   history,
 	}
 
 	return nsApi
@@ -50,87 +57,169 @@ func (nsApi *NamespaceHandler) CreateNamespace(c *gin.Context) {
 		return
 	}
 
-	ns, err := nsApi.nsSvc.CreateNamespace(orgId, nsRequest.Name, nsRequest.Schema, nsRequest.SchemaVersion, map[string]string{})
+	ns, err := nsApi.nsSvc.CreateNamespace(orgId, nsRequest.Name, nsRequest.Parent, nsRequest.Schema, nsRequest.SchemaVersion, map[string]string{})
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to created namespace")
+		responseNamespaceError(c, err, "Failed to created namespace")
 		return
 	}
 
+	nsApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespace, ns.Id, nil, ns)
+	nsApi.history.RecordNamespace(orgId, ns.Id)
+	setETag(c, ns.Revision)
 	responseSingleItem(c, ns)
 }
 
+// Create a new namespace with the schema pin and variables of an existing one
+func (nsApi *NamespaceHandler) CloneNamespace(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	var cloneReq CloneNamespaceRequest
+	if err := DecodeBody(c, &cloneReq); err != nil {
+		return
+	}
+
+	source, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return
+	}
+
+	parentId := source.ParentId
+	if cloneReq.Parent != nil {
+		parentId = *cloneReq.Parent
+	}
+
+	schemaVersion := source.SchemaVersion
+	if cloneReq.SchemaVersion != "" {
+		schemaVersion = cloneReq.SchemaVersion
+	}
+
+	if !validateNamespaceVariables(c, nsApi.schemaSvc, orgId, source.SchemaId, schemaVersion, cloneReq.Variables) {
+		return
+	}
+
+	vars, err := ownVariables(nsApi.nsSvc, orgId, source.Id)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to get namespace variables")
+		return
+	}
+	for k, v := range cloneReq.Variables {
+		vars[k] = v
+	}
+
+	ns, err := nsApi.nsSvc.CreateNamespace(orgId, cloneReq.Name, parentId, source.SchemaId, schemaVersion, vars)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to clone namespace")
+		return
+	}
+
+	nsApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespace, ns.Id, nil, ns)
+	nsApi.auditor.RecordVariables(c, orgId, ns.Id, nil, vars)
+	nsApi.history.RecordNamespace(orgId, ns.Id)
+	setETag(c, ns.Revision)
+	responseSingleItemStatus(c, http.StatusCreated, ns)
+}
+
 func (nsApi *NamespaceHandler) GetNamespace(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	nsId := c.Param("ns")
 
 	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to created namespace")
+		responseNamespaceError(c, err, "Failed to get namespace")
 		return
 	}
 
+	setETag(c, ns.Revision)
 	responseSingleItem(c, ns)
 }
 
-func (nsApi *NamespaceHandler) Resolve(c *gin.Context) {
+func (nsApi *NamespaceHandler) ListChildNamespaces(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
-
 	nsId := c.Param("ns")
-	resourceName := c.Param("resource")
 
-	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	_, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to get namespace")
+		responseNamespaceError(c, err, "Failed to get namespace")
 		return
 	}
 
-	org, err := nsApi.orgSvc.GetOrganizationById(orgId)
+	children, err := nsApi.nsSvc.ListChildNamespaces(orgId, nsId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Something went wrong")
+		responseError(c, http.StatusInternalServerError, "Failed to list child namespaces")
 		return
 	}
-	if org == nil {
-		responseError(c, http.StatusNotFound, "Organization not found")
+
+	responseSingleItem(c, children)
+}
+
+// Get the variables of a namespace merged with those inherited from its parents
+func (nsApi *NamespaceHandler) GetEffectiveVariables(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	vars, err := nsApi.nsSvc.GetVariablesAsMap(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get effective variables")
 		return
 	}
 
-	schemaVersion, err := nsApi.schemaSvc.GetSchemaVersion(orgId, ns.SchemaId, ns.SchemaVersion)
-	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Something went wrong")
+	responseSingleItem(c, vars)
+}
+
+// Resolve a resource name in the namespace. With ?at= the namespace, its parents and their
+// variables are reconstructed from the variable history as they were at that time.
+func (nsApi *NamespaceHandler) Resolve(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	nsId := c.Param("ns")
+	resourceName := c.Param("resource")
+
+	at, ok := queryTime(c, "at")
+	if !ok {
+		return
 	}
 
-	resource, found := schemaVersion.Resources[resourceName]
-	if !found {
-		responseError(c, http.StatusNotFound, "resource name not found")
+	var state *namespaceState
+	var err error
+	if at.IsZero() {
+		state, err = nsApi.currentState(orgId, nsId)
+	} else {
+		state, err = nsApi.history.stateAt(orgId, nsId, at)
+	}
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
 		return
 	}
+	ns := state.namespace
 
-	resultVars := make(map[string]string)
-	for k, v := range org.OrgVars {
-		result, err := engine.ResolvePattern(v, resultVars)
+	// Resolve against the schema version as it was, when the history knows it
+	schemaVersion := state.schemaVersion
+	if schemaVersion == nil {
+		schemaVersion, err = nsApi.schemaSvc.GetSchemaVersion(orgId, ns.SchemaId, ns.SchemaVersion)
 		if err != nil {
-			resultVars[k] = v
+			responseError(c, http.StatusInternalServerError, "Something went wrong")
+			return
 		}
-		resultVars[k] = result
 	}
 
-	nsVars, err := nsApi.nsSvc.GetVariablesAsMap(orgId, nsId)
-	if err != nil {
-		responseError(c, http.StatusInternalServerError, "something went wrong")
+	resource, found := schemaVersion.Resources[resourceName]
+	if !found {
+		responseError(c, http.StatusNotFound, "resource name not found")
 		return
 	}
 
-	for k, v := range nsVars {
-		result, err := engine.ResolvePattern(v, resultVars)
-		if err != nil {
-			resultVars[k] = v
-		}
-		resultVars[k] = result
+	resolver := engine.NewResolver()
+	resolver.AddLayer(engine.SourceOrganization, state.orgVars)
+	for _, chainNs := range state.chain {
+		resolver.AddLayer(fmt.Sprintf("%s:%s", engine.SourceNamespace, chainNs.Name), state.ownVars[chainNs.Id])
 	}
+	resolver.AddLayer(engine.SourceRequest, requestVariables(c))
 
-	resolved, err := engine.ResolvePattern(resource, resultVars)
+	resolved, trace, err := resolver.Resolve(resource)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to resolve resource")
+		responseResolveError(c, err)
 		return
 	}
 	item := ResolveResourceResponse{
@@ -138,46 +227,121 @@ func (nsApi *NamespaceHandler) Resolve(c *gin.Context) {
 		Pattern:      resource,
 		Value:        resolved,
 	}
+	if explainRequested(c) {
+		item.Explain = trace
+	}
 	responseSingleItem(c, item)
 }
 
+// currentState returns the namespace, its parents and the variables of each as they are now
+func (nsApi *NamespaceHandler) currentState(orgId string, nsId string) (*namespaceState, error) {
+	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := nsApi.orgSvc.GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, services.ErrOrganizationNotFound
+	}
+
+	chain, err := nsApi.nsSvc.GetNamespaceAncestors(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &namespaceState{
+		namespace: ns,
+		orgVars:   org.OrgVars,
+		chain:     chain,
+		ownVars:   map[string]map[string]string{},
+	}
+	for _, chainNs := range chain {
+		state.ownVars[chainNs.Id], err = ownVariables(nsApi.nsSvc, orgId, chainNs.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
 func (nsApi *NamespaceHandler) UpdateNamespace(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	nsId := c.Param("ns")
 
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
 	var updateBody UpdateNamespaceRequest
-	err := DecodeBody(c, &updateBody)
-	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Something went wrong")
+	if err := DecodeBody(c, &updateBody); err != nil {
 		return
 	}
 
 	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to get namespace")
+		responseNamespaceError(c, err, "Failed to get namespace")
 		return
 	}
 
-	ns.Name = updateBody.Name
-	ns.SchemaVersion = updateBody.SchemaVersion
+	parentId := ns.ParentId
+	if updateBody.Parent != nil {
+		parentId = *updateBody.Parent
+	}
 
-	nsApi.nsSvc.UpdateNamespace(orgId, nsId, updateBody.Name, updateBody.SchemaVersion)
+	if ns.SchemaVersion != updateBody.SchemaVersion || ns.ParentId != parentId {
+		if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+			return
+		}
+	}
+
+	before := ns
+	ns, err = nsApi.nsSvc.UpdateNamespace(orgId, nsId, updateBody.Name, parentId, updateBody.SchemaVersion, revision)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to update namespace")
+		return
+	}
+
+	nsApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceNamespace, nsId, before, ns)
+	nsApi.history.RecordNamespace(orgId, nsId)
+
+	setETag(c, ns.Revision)
+	responseSingleItem(c, ns)
 }
 
 func (nsApi *NamespaceHandler) DeleteNamespace(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	nsId := c.Param("ns")
 
-	err := nsApi.nsSvc.DeleteNamespace(orgId, nsId)
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
-		if err == services.ErrNamespaceNotFound {
-			responseError(c, http.StatusNotFound, "Namespace not found")
-			return
-		}
-		responseError(c, http.StatusInternalServerError, "Failed to get namespace")
+		responseNamespaceError(c, err, "Failed to get namespace")
 		return
 	}
 
+	// Deleting a namespace removes its variables, so a lock or freeze window protects it too
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+		return
+	}
+
+	err = nsApi.nsSvc.DeleteNamespace(orgId, nsId, revision)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to delete namespace")
+		return
+	}
+
+	nsApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceNamespace, nsId, ns, nil)
+	nsApi.history.RecordNamespaceDeleted(ns)
+
 	responseNoContent(c, http.StatusNoContent)
 }
 
@@ -185,14 +349,21 @@ func (nsApi *NamespaceHandler) ListNamespaceVariables(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	nsId := c.Param("ns")
 
-	nsApi.nsSvc.ListNamespaceVars(orgId, nsId)
-	ns, err := nsApi.nsSvc.ListNamespaceVars(orgId, nsId)
+	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return
+	}
+
+	nsVars, err := nsApi.nsSvc.ListNamespaceVars(orgId, nsId)
 	if err != nil {
 		responseError(c, http.StatusInternalServerError, "Failed to get namespace")
 		return
 	}
 
-	responseSingleItem(c, ns)
+	// Variables share the revision of their namespace, which is what If-Match compares against
+	setETag(c, ns.Revision)
+	responseSingleItem(c, nsVars)
 }
 
 func (nsApi *NamespaceHandler) PostNamespaceVariable(c *gin.Context) {
@@ -208,7 +379,11 @@ func (nsApi *NamespaceHandler) PostNamespaceVariable(c *gin.Context) {
 
 	ns, err := nsApi.nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to get namespace")
+		responseNamespaceError(c, err, "Failed to get namespace")
+		return
+	}
+
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
 		return
 	}
 
@@ -218,15 +393,103 @@ func (nsApi *NamespaceHandler) PostNamespaceVariable(c *gin.Context) {
 		return
 	}
 
-	nsVar, err := nsApi.nsSvc.CreateNamespaceVariable(ns.OrganizationId, ns.Id, reqBody.Name, reqBody.Value)
-	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to create namespace variable")
+	// Creating against the revision read above keeps the existence check true at write time
+	summary, err := nsApi.nsSvc.PatchNamespaceVariables(ns.OrganizationId, ns.Id, map[string]string{reqBody.Name: reqBody.Value}, nil, ns.Revision)
+	if err == services.ErrRevisionMismatch {
+		responseError(c, http.StatusConflict, "Namespace variables changed while the variable was created")
+		return
+	} else if err != nil {
+		responseNamespaceError(c, err, "Failed to create namespace variable")
 		return
 	}
 
+	nsVar := newNamespaceVar(ns.OrganizationId, ns.Id, reqBody.Name, reqBody.Value)
+	nsApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespaceVariable, variableResourceId(nsId, nsVar.Key), nil, nsVar.Value)
+	nsApi.history.RecordNamespace(orgId, nsId)
+
+	setETag(c, summary.Revision)
 	responseSingleItem(c, nsVar)
 }
 
+// Replace the full set of variables on a namespace
+func (nsApi *NamespaceHandler) PutNamespaceVariables(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	var reqBody ReplaceNamespaceVariablesRequest
+	if err := DecodeBody(c, &reqBody); err != nil {
+		return
+	}
+
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+		return
+	}
+
+	if reqBody.Variables == nil {
+		reqBody.Variables = map[string]string{}
+	}
+
+	before, err := ownVariables(nsApi.nsSvc, orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace variables")
+		return
+	}
+
+	summary, err := nsApi.nsSvc.ReplaceNamespaceVariables(orgId, nsId, reqBody.Variables, revision)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to replace namespace variables")
+		return
+	}
+
+	nsApi.auditor.RecordVariables(c, orgId, nsId, before, reqBody.Variables)
+	nsApi.history.RecordNamespace(orgId, nsId)
+
+	setETag(c, summary.Revision)
+	responseSingleItem(c, summary)
+}
+
+// Upsert and delete variables on a namespace
+func (nsApi *NamespaceHandler) PatchNamespaceVariables(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	nsId := c.Param("ns")
+
+	var reqBody PatchNamespaceVariablesRequest
+	if err := DecodeBody(c, &reqBody); err != nil {
+		return
+	}
+
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+		return
+	}
+
+	before, err := ownVariables(nsApi.nsSvc, orgId, nsId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace variables")
+		return
+	}
+
+	// A patch only names the keys it changes, so it applies on top of any revision
+	summary, err := nsApi.nsSvc.PatchNamespaceVariables(orgId, nsId, reqBody.Upsert, reqBody.Delete, 0)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to patch namespace variables")
+		return
+	}
+
+	after, err := services.ApplyVariablePatch(before, reqBody.Upsert, reqBody.Delete)
+	if err == nil {
+		nsApi.auditor.RecordVariables(c, orgId, nsId, before, after)
+	}
+	nsApi.history.RecordNamespace(orgId, nsId)
+
+	setETag(c, summary.Revision)
+	responseSingleItem(c, summary)
+}
+
 func (nsApi *NamespaceHandler) GetNamespaceVariable(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	nsId := c.Param("ns")
@@ -234,7 +497,7 @@ func (nsApi *NamespaceHandler) GetNamespaceVariable(c *gin.Context) {
 
 	nsVar, err := nsApi.nsSvc.GetNamespaceVariable(orgId, nsId, varId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to get namespace variable")
+		responseNamespaceError(c, err, "Failed to get namespace variable")
 		return
 	}
 
@@ -258,12 +521,37 @@ func (nsApi *NamespaceHandler) PutNamespaceVariable(c *gin.Context) {
 		return
 	}
 
-	nsVar, err := nsApi.nsSvc.UpdateNamespaceVariable(orgId, nsId, varId, reqBody.Value)
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+		return
+	}
+
+	previous, err := nsApi.nsSvc.GetNamespaceVariable(orgId, nsId, varId)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to update namespace variable")
+		responseNamespaceError(c, err, "Failed to get namespace variable")
 		return
 	}
 
+	if previous == nil {
+		responseError(c, http.StatusNotFound, "Namespace variable not found")
+		return
+	}
+
+	summary, err := nsApi.nsSvc.PatchNamespaceVariables(orgId, nsId, map[string]string{varId: reqBody.Value}, nil, revision)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to update namespace variable")
+		return
+	}
+
+	nsVar := newNamespaceVar(orgId, nsId, varId, reqBody.Value)
+	nsApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceNamespaceVariable, variableResourceId(nsId, varId), previous.Value, nsVar.Value)
+	nsApi.history.RecordNamespace(orgId, nsId)
+
+	setETag(c, summary.Revision)
 	responseSingleItem(c, nsVar)
 }
 
@@ -272,11 +560,79 @@ func (nsApi *NamespaceHandler) DeleteNamespaceVariable(c *gin.Context) {
 	nsId := c.Param("ns")
 	varId := c.Param("var")
 
-	err := nsApi.nsSvc.DeleteNamespaceVariable(orgId, nsId, varId)
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	if !nsApi.ensureNamespaceWritable(c, orgId, nsId) {
+		return
+	}
+
+	previous, err := nsApi.nsSvc.GetNamespaceVariable(orgId, nsId, varId)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to get namespace variable")
+		return
+	}
+
+	if previous == nil {
+		responseError(c, http.StatusNotFound, "Namespace variable not found")
+		return
+	}
+
+	_, err = nsApi.nsSvc.PatchNamespaceVariables(orgId, nsId, nil, []string{varId}, revision)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Failed to delete namespace variable")
+		responseNamespaceError(c, err, "Failed to delete namespace variable")
 		return
 	}
 
+	nsApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceNamespaceVariable, variableResourceId(nsId, varId), previous.Value, nil)
+	nsApi.history.RecordNamespace(orgId, nsId)
+
 	responseNoContent(c, http.StatusNoContent)
 }
+
+func newNamespaceVar(orgId string, nsId string, key string, value string) *services.NamespaceVar {
+	return &services.NamespaceVar{
+		Key:         key,
+		Value:       value,
+		OrgId:       orgId,
+		NamespaceId: nsId,
+	}
+}
+
+// Get the variables set directly on a namespace, without those inherited from its parents
+func ownVariables(nsSvc services.NamespaceServiceProvider, orgId string, nsId string) (map[string]string, error) {
+	items, err := nsSvc.ListNamespaceVars(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for _, i := range items {
+		result[i.Key] = i.Value
+	}
+	return result, nil
+}
+
+func responseNamespaceError(c *gin.Context, err error, errMessage string) {
+	switch err {
+	case services.ErrNamespaceNotFound:
+		responseError(c, http.StatusNotFound, "Namespace not found")
+	case services.ErrNamespaceVarNotFound:
+		responseError(c, http.StatusNotFound, "Namespace variable not found")
+	case services.ErrNamespaceAlreadyExists, services.ErrNamespaceHasChildren, services.ErrNamespaceVarExists:
+		responseError(c, http.StatusConflict, err.Error())
+	case services.ErrNamespaceCycle, services.ErrNamespaceTooDeep, services.ErrInvalidVariablePatch,
+		services.ErrSchemaNotFound, services.ErrSchemaVersionNotFound:
+		responseError(c, http.StatusUnprocessableEntity, err.Error())
+	case services.ErrRevisionMismatch:
+		responseError(c, http.StatusPreconditionFailed, "Namespace has been modified since it was read")
+	case services.ErrOrganizationNotFound:
+		responseError(c, http.StatusNotFound, "Organization not found")
+	case services.ErrNoVariableHistory:
+		responseError(c, http.StatusNotFound, "No variable history for the namespace at that time")
+	default:
+		responseError(c, http.StatusInternalServerError, errMessage)
+	}
+}
@@ -1,20 +1,26 @@
 package apis
 
+import "github.com/MrWestbury/terraxen-naming-service/internals/engine"
+
 type NewNamespaceRequest struct {
 	Name          string `json:"name"`
+	Parent        string `json:"parent_id"`
 	Schema        string `json:"schema_id"`
 	SchemaVersion string `json:"schema_version"`
 }
 
 type UpdateNamespaceRequest struct {
-	Name          string `json:"name"`
-	SchemaVersion string `json:"schema_version"`
+	Name string `json:"name"`
+	// Parent keeps the current parent when it is absent, and moves the namespace to the root when empty
+	Parent        *string `json:"parent_id"`
+	SchemaVersion string  `json:"schema_version"`
 }
 
 type ResolveResourceResponse struct {
-	ResourceName string `json:"name"`
-	Pattern      string `json:"pattern"`
-	Value        string `json:"value"`
+	ResourceName string        `json:"name"`
+	Pattern      string        `json:"pattern"`
+	Value        string        `json:"value"`
+	Explain      *engine.Trace `json:"explain,omitempty"`
 }
 
 type NewNamespaceVariable struct {
@@ -22,6 +28,22 @@ type NewNamespaceVariable struct {
 	Value string `json:"value"`
 }
 
+type ReplaceNamespaceVariablesRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+type PatchNamespaceVariablesRequest struct {
+	Upsert map[string]string `json:"upsert"`
+	Delete []string          `json:"delete"`
+}
+
 type UpdateNamespaceVariable struct {
 	Value string `json:"value"`
 }
+
+type CloneNamespaceRequest struct {
+	Name          string            `json:"name"`
+	Parent        *string           `json:"parent_id"`
+	SchemaVersion string            `json:"schema_version"`
+	Variables     map[string]string `json:"variables"`
+}
@@ -0,0 +1,358 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/backends"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testApi struct {
+	api       *Api
+	providers *services.Providers
+	org       *services.Organization
+	key       *services.ApiKey
+}
+
+func newTestApi(t *testing.T) *testApi {
+	return newTestApiWithConfig(t, &config.Config{})
+}
+
+func newTestApiWithConfig(t *testing.T, cfg *config.Config) *testApi {
+	gin.SetMode(gin.TestMode)
+	providers := backends.NewMemory()
+
+	org, err := providers.Organizations.NewOrganization("test-org")
+	require.NoError(t, err)
+	key, err := providers.ApiKeys.GenerateNewApiKey(org.Id, "", time.Time{}, nil)
+	require.NoError(t, err)
+	admin, err := services.NewRoleBinding(org.Id, services.ApiKeySubject(key.Id), services.RoleOrgAdmin, "", "")
+	require.NoError(t, err)
+	require.NoError(t, providers.RoleBindings.CreateRoleBinding(admin))
+
+	api, err := NewApi(cfg, providers)
+	require.NoError(t, err)
+
+	return &testApi{
+		api:       api,
+		providers: providers,
+		org:       org,
+		key:       key,
+	}
+}
+
+func (ta *testApi) request(method string, path string, body string) *httptest.ResponseRecorder {
+	return ta.requestIfMatch(method, path, body, "")
+}
+
+// requestIfMatch sends a request with the If-Match header set, unless ifMatch is empty
+func (ta *testApi) requestIfMatch(method string, path string, body string, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Terraxen-API", ta.key.Key)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (ta *testApi) namespace(t *testing.T, resources map[string]string, vars map[string]string) *services.Namespace {
+	schema, err := ta.providers.Schemas.CreateSchema(ta.org.Id, "test-schema")
+	require.NoError(t, err)
+	_, err = ta.providers.Schemas.CreateSchemaVersion(ta.org.Id, schema.Id, resources, true)
+	require.NoError(t, err)
+
+	ns, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "prod", "", schema.Id, "2", vars)
+	require.NoError(t, err)
+	return ns
+}
+
+func TestResolveExplain(t *testing.T) {
+	ta := newTestApi(t)
+	_, err := ta.providers.Organizations.UpdateOrganization(ta.org.Id, ta.org.Name, map[string]string{"company": "acme"}, 0)
+	require.NoError(t, err)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{company}-{env}-{index}"}, map[string]string{"env": "prod"})
+
+	rec := ta.request(http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/resolve/vm?index=01&explain=true", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body struct {
+		Data ResolveResourceResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "vm-acme-prod-01", body.Data.Value)
+	require.NotNil(t, body.Data.Explain)
+
+	sources := map[string]string{}
+	for _, seg := range body.Data.Explain.Segments {
+		sources[seg.Variable] = seg.Source
+	}
+	assert.Equal(t, map[string]string{
+		"company": "organization",
+		"env":     "namespace:prod",
+		"index":   "request",
+	}, sources)
+}
+
+func TestLockedNamespaceRejectsVariableChanges(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+
+	lockPath := "/api/v1/namespaces/" + ns.Id + "/lock"
+	varPath := "/api/v1/namespaces/" + ns.Id + "/variables/env"
+	owner := ta.keyWithRole(t, services.RoleNamespaceOwner, nil)
+	// Scopes only narrow what a key can do, an admin key without lock:override cannot override
+	narrowed := ta.keyWithRole(t, services.RoleOrgAdmin, map[string]string{SCOPE_OPERATIONS: "namespace:write"})
+
+	rec := ta.request(http.MethodPut, lockPath, `{"reason": "live"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = ta.requestAsIfMatch(owner, http.MethodPut, varPath, `{"value": "dev"}`, "*")
+	assert.Equal(t, http.StatusLocked, rec.Code)
+	rec = ta.requestAsIfMatch(owner, http.MethodDelete, "/api/v1/namespaces/"+ns.Id, "", "*")
+	assert.Equal(t, http.StatusLocked, rec.Code, "a locked namespace cannot be deleted")
+	rec = ta.requestAsIfMatch(owner, http.MethodDelete, "/api/v1/namespaces/"+ns.Id+"?override=true", "", "*")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	for _, key := range []*services.ApiKey{owner, narrowed} {
+		rec = ta.requestAsIfMatch(key, http.MethodPut, varPath+"?override=true", `{"value": "dev"}`, "*")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Missing permission lock:override")
+	}
+	rec = ta.requestIfMatch(http.MethodPut, varPath+"?override=true", `{"value": "staging"}`, "*")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Only the locker, or an override, can unlock or replace the lock
+	rec = ta.requestAs(owner, http.MethodDelete, lockPath, "")
+	assert.Equal(t, http.StatusLocked, rec.Code)
+	rec = ta.requestAs(owner, http.MethodDelete, lockPath+"?override=true", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = ta.requestAs(owner, http.MethodPut, lockPath, `{"reason": "mine now", "expires": "2000-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusLocked, rec.Code)
+
+	rec = ta.request(http.MethodDelete, lockPath, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = ta.requestAsIfMatch(owner, http.MethodPut, varPath, `{"value": "dev"}`, "*")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = ta.requestAs(owner, http.MethodPut, lockPath, `{"reason": "release"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.request(http.MethodDelete, lockPath, "")
+	assert.Equal(t, http.StatusLocked, rec.Code)
+	rec = ta.request(http.MethodDelete, lockPath+"?override=true", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestNamespaceUpdatesRequireMatchingETag(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	path := "/api/v1/namespaces/" + ns.Id
+	update := `{"name": "production", "schema_version": "2"}`
+
+	rec := ta.request(http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	rec = ta.request(http.MethodPut, path, update)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+	rec = ta.requestIfMatch(http.MethodPut, path, update, `W/"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = ta.requestIfMatch(http.MethodPut, path, update, etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// A second writer still holding the first revision must not overwrite the change
+	rec = ta.requestIfMatch(http.MethodPut, path, `{"name": "prod", "schema_version": "2"}`, etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = ta.requestIfMatch(http.MethodDelete, path, "", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = ta.requestIfMatch(http.MethodDelete, path, "", `"2"`)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+func TestNamespaceUpdateKeepsParentWhenOmitted(t *testing.T) {
+	ta := newTestApi(t)
+	parent := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	child, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "payments", parent.Id, parent.SchemaId, parent.SchemaVersion, nil)
+	require.NoError(t, err)
+	_, err = ta.providers.Namespaces.LockNamespace(ta.org.Id, child.Id, services.NamespaceLock{LockedBy: "user:release", Reason: "live"})
+	require.NoError(t, err)
+	path := "/api/v1/namespaces/" + child.Id
+
+	rec := ta.requestIfMatch(http.MethodPut, path, `{"name": "payments-prod"`, "*")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), `"code"`), "only one error is written")
+
+	// Renaming a locked namespace is allowed, as long as it stays where it is
+	rec = ta.requestIfMatch(http.MethodPut, path, `{"name": "payments-prod", "schema_version": "2"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	found, err := ta.providers.Namespaces.GetNamespaceById(ta.org.Id, child.Id)
+	require.NoError(t, err)
+	assert.Equal(t, parent.Id, found.ParentId)
+	assert.Equal(t, "payments-prod", found.Name)
+
+	rec = ta.requestIfMatch(http.MethodPut, path, `{"name": "payments-prod", "parent_id": "", "schema_version": "2"}`, "*")
+	assert.Equal(t, http.StatusLocked, rec.Code, "moving to the root is a change of parent")
+}
+
+func TestNamespaceVariableChangesRequireMatchingETag(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}-{region}"}, map[string]string{"env": "prod", "region": "uks"})
+	varsPath := "/api/v1/namespaces/" + ns.Id + "/variables"
+
+	rec := ta.request(http.MethodGet, varsPath, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	rec = ta.request(http.MethodPut, varsPath+"/env", `{"value": "dev"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	rec = ta.request(http.MethodPut, varsPath, `{"variables": {"env": "dev"}}`)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	rec = ta.request(http.MethodDelete, varsPath+"/region", "")
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+	rec = ta.requestIfMatch(http.MethodPut, varsPath+"/env", `{"value": "dev"}`, etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// A second writer still holding the first revision must not overwrite the change
+	rec = ta.requestIfMatch(http.MethodPut, varsPath, `{"variables": {"env": "test"}}`, etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	rec = ta.requestIfMatch(http.MethodDelete, varsPath+"/region", "", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	// Patches and new variables apply on top of any revision, but still move it on
+	rec = ta.request(http.MethodPatch, varsPath, `{"upsert": {"tier": "1"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	rec = ta.request(http.MethodPost, varsPath, `{"name": "team", "value": "core"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+
+	rec = ta.requestIfMatch(http.MethodDelete, varsPath+"/region", "", `"4"`)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	vars, err := ta.providers.Namespaces.GetVariablesAsMap(ta.org.Id, ns.Id)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "dev", "tier": "1", "team": "core"}, vars)
+}
+
+func TestResolveAtPointInTime(t *testing.T) {
+	ta := newTestApi(t)
+	ns := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	resolve := func(at time.Time) *httptest.ResponseRecorder {
+		return ta.request(http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/resolve/vm?at="+url.QueryEscape(at.Format(time.RFC3339Nano)), "")
+	}
+	value := func(rec *httptest.ResponseRecorder) string {
+		var body struct {
+			Data ResolveResourceResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Data.Value
+	}
+
+	beforeHistory := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	rec := ta.requestIfMatch(http.MethodPut, "/api/v1/namespaces/"+ns.Id+"/variables/env", `{"value": "staging"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	time.Sleep(5 * time.Millisecond)
+	staging := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	rec = ta.requestIfMatch(http.MethodPut, "/api/v1/namespaces/"+ns.Id+"/variables/env", `{"value": "dev"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = resolve(staging)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "vm-staging", value(rec))
+
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/resolve/vm", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "vm-dev", value(rec))
+
+	rec = resolve(beforeHistory)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the namespace was only recorded from its first change")
+
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/history", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var history struct {
+		Data []services.VariableSnapshot `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+	require.Len(t, history.Data, 2)
+	assert.Equal(t, "dev", history.Data[0].Variables["env"])
+	assert.Equal(t, "staging", history.Data[1].Variables["env"])
+}
+
+func TestResolveAtPointInTimeUsesSchemaVersionOfThen(t *testing.T) {
+	ta := newTestApi(t)
+	pinned := ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	latest, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "latest", "", pinned.SchemaId, "latest", map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	versions := "/api/v1/schemas/" + pinned.SchemaId + "/versions"
+	resolve := func(ns *services.Namespace, at time.Time) string {
+		rec := ta.request(http.MethodGet, "/api/v1/namespaces/"+ns.Id+"/resolve/vm?at="+url.QueryEscape(at.Format(time.RFC3339Nano)), "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var body struct {
+			Data ResolveResourceResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Data.Value
+	}
+	pause := func() time.Time {
+		time.Sleep(5 * time.Millisecond)
+		now := time.Now()
+		time.Sleep(5 * time.Millisecond)
+		return now
+	}
+
+	rec := ta.requestIfMatch(http.MethodPut, "/api/v1/namespaces/"+latest.Id+"/variables/env", `{"value": "dev"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	beforePublish := pause()
+
+	// A new version moves the latest pin
+	rec = ta.request(http.MethodPost, versions, `{"resources": {"vm": "vm2-{env}"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created struct {
+		Data services.SchemaVersion `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	afterPublish := pause()
+
+	assert.Equal(t, "vm-dev", resolve(latest, beforePublish))
+	assert.Equal(t, "vm2-dev", resolve(latest, afterPublish))
+
+	// Editing an unpublished version changes what the namespaces pinned to it resolve to
+	draft, err := ta.providers.Namespaces.CreateNamespace(ta.org.Id, "draft", "", pinned.SchemaId, strconv.Itoa(created.Data.Id), map[string]string{"env": "test"})
+	require.NoError(t, err)
+	rec = ta.requestIfMatch(http.MethodPut, "/api/v1/namespaces/"+draft.Id+"/variables/env", `{"value": "qa"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	beforeEdit := pause()
+
+	rec = ta.requestIfMatch(http.MethodPut, versions+"/"+strconv.Itoa(created.Data.Id), `{"resources": {"vm": "vm3-{env}"}}`, strconv.Quote(strconv.Itoa(created.Data.Revision)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	assert.Equal(t, "vm2-qa", resolve(draft, beforeEdit))
+	assert.Equal(t, "vm3-qa", resolve(draft, time.Now()))
+	assert.Equal(t, "vm2-dev", resolve(latest, beforeEdit))
+	assert.Equal(t, "vm3-dev", resolve(latest, time.Now()))
+}
@@ -0,0 +1,153 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+type NamespaceTemplateHandler struct {
+	orgSvc    services.OrganizationServiceProvider
+	nsSvc     services.NamespaceServiceProvider
+	schemaSvc services.SchemaServiceProvider
+	auditor   *Auditor
+	history   *VariableHistory
+}
+
+func NewNamespaceTemplateHandler(oSvc services.OrganizationServiceProvider, nsSvc services.NamespaceServiceProvider, sSvc services.SchemaServiceProvider, auditor *Auditor, history *VariableHistory) *NamespaceTemplateHandler {
+	tplApi := &NamespaceTemplateHandler{
+		orgSvc:    oSvc,
+		nsSvc:     nsSvc,
+		schemaSvc: sSvc,
+		auditor:   auditor,
+		history:   history,
+	}
+
+	return tplApi
+}
+
+func (tplApi *NamespaceTemplateHandler) ListTemplates(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	templates, err := tplApi.orgSvc.ListNamespaceTemplates(orgId)
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to list namespace templates")
+		return
+	}
+
+	responseSingleItem(c, templates)
+}
+
+func (tplApi *NamespaceTemplateHandler) CreateTemplate(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	var tplReq NewNamespaceTemplateRequest
+	if err := DecodeBody(c, &tplReq); err != nil {
+		return
+	}
+
+	if tplReq.Variables == nil {
+		tplReq.Variables = map[string]string{}
+	}
+
+	if !validateNamespaceVariables(c, tplApi.schemaSvc, orgId, tplReq.Schema, tplReq.SchemaVersion, tplReq.Variables) {
+		return
+	}
+
+	tpl, err := tplApi.orgSvc.CreateNamespaceTemplate(orgId, tplReq.Name, tplReq.Schema, tplReq.SchemaVersion, tplReq.Variables)
+	if err != nil {
+		responseTemplateError(c, err, "Failed to create namespace template")
+		return
+	}
+
+	tplApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespaceTemplate, tpl.Id, nil, tpl)
+
+	responseSingleItemStatus(c, http.StatusCreated, tpl)
+}
+
+func (tplApi *NamespaceTemplateHandler) GetTemplate(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	templateId := c.Param("template")
+
+	tpl, err := tplApi.orgSvc.GetNamespaceTemplate(orgId, templateId)
+	if err != nil {
+		responseTemplateError(c, err, "Failed to get namespace template")
+		return
+	}
+
+	responseSingleItem(c, tpl)
+}
+
+func (tplApi *NamespaceTemplateHandler) DeleteTemplate(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	templateId := c.Param("template")
+
+	tpl, err := tplApi.orgSvc.GetNamespaceTemplate(orgId, templateId)
+	if err != nil {
+		responseTemplateError(c, err, "Failed to get namespace template")
+		return
+	}
+
+	err = tplApi.orgSvc.DeleteNamespaceTemplate(orgId, templateId)
+	if err != nil {
+		responseTemplateError(c, err, "Failed to delete namespace template")
+		return
+	}
+
+	tplApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceNamespaceTemplate, templateId, tpl, nil)
+
+	responseNoContent(c, http.StatusNoContent)
+}
+
+// Stamp out a new namespace pre-filled with the schema pin and variables of the template
+func (tplApi *NamespaceTemplateHandler) CreateNamespaceFromTemplate(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	templateId := c.Param("template")
+
+	var nsReq NamespaceFromTemplateRequest
+	if err := DecodeBody(c, &nsReq); err != nil {
+		return
+	}
+
+	tpl, err := tplApi.orgSvc.GetNamespaceTemplate(orgId, templateId)
+	if err != nil {
+		responseTemplateError(c, err, "Failed to get namespace template")
+		return
+	}
+
+	vars := make(map[string]string)
+	for k, v := range tpl.Variables {
+		vars[k] = v
+	}
+	for k, v := range nsReq.Variables {
+		vars[k] = v
+	}
+
+	if !validateNamespaceVariables(c, tplApi.schemaSvc, orgId, tpl.SchemaId, tpl.SchemaVersion, vars) {
+		return
+	}
+
+	ns, err := tplApi.nsSvc.CreateNamespace(orgId, nsReq.Name, nsReq.Parent, tpl.SchemaId, tpl.SchemaVersion, vars)
+	if err != nil {
+		responseNamespaceError(c, err, "Failed to create namespace from template")
+		return
+	}
+
+	tplApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceNamespace, ns.Id, nil, ns)
+	tplApi.auditor.RecordVariables(c, orgId, ns.Id, nil, vars)
+	tplApi.history.RecordNamespace(orgId, ns.Id)
+
+	responseSingleItemStatus(c, http.StatusCreated, ns)
+}
+
+func responseTemplateError(c *gin.Context, err error, errMessage string) {
+	switch err {
+	case services.ErrTemplateNotFound:
+		responseError(c, http.StatusNotFound, "Namespace template not found")
+	case services.ErrTemplateAlreadyExists:
+		responseError(c, http.StatusConflict, err.Error())
+	default:
+		responseError(c, http.StatusInternalServerError, errMessage)
+	}
+}
@@ -0,0 +1,14 @@
+package apis
+
+type NewNamespaceTemplateRequest struct {
+	Name          string            `json:"name"`
+	Schema        string            `json:"schema_id"`
+	SchemaVersion string            `json:"schema_version"`
+	Variables     map[string]string `json:"variables"`
+}
+
+type NamespaceFromTemplateRequest struct {
+	Name      string            `json:"name"`
+	Parent    string            `json:"parent_id"`
+	Variables map[string]string `json:"variables"`
+}
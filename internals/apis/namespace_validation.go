@@ -0,0 +1,50 @@
+package apis
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/engine"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Returns the names of any variables that are not referenced by the resources of the schema version
+func undeclaredVariables(schemaSvc services.SchemaServiceProvider, orgId string, schemaId string, schemaVersion string, vars map[string]string) ([]string, error) {
+	sv, err := schemaSvc.GetSchemaVersion(orgId, schemaId, schemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := engine.ReferencedVariables(sv.Resources, vars)
+
+	undeclared := make([]string, 0)
+	for k := range vars {
+		if !declared[k] {
+			undeclared = append(undeclared, k)
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared, nil
+}
+
+// Validates the variables against the schema version, writing the error response and returning false if invalid
+func validateNamespaceVariables(c *gin.Context, schemaSvc services.SchemaServiceProvider, orgId string, schemaId string, schemaVersion string, vars map[string]string) bool {
+	undeclared, err := undeclaredVariables(schemaSvc, orgId, schemaId, schemaVersion, vars)
+	if err != nil {
+		switch err {
+		case services.ErrSchemaNotFound, services.ErrSchemaVersionNotFound:
+			responseError(c, http.StatusUnprocessableEntity, err.Error())
+		default:
+			responseError(c, http.StatusInternalServerError, "Failed to validate variables against schema")
+		}
+		return false
+	}
+
+	if len(undeclared) > 0 {
+		responseError(c, http.StatusUnprocessableEntity, "Variables not declared by schema: "+strings.Join(undeclared, ", "))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,348 @@
+package apis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/dgrijalva/jwt-go/v4"
+)
+
+const (
+	defaultJWKSCacheTime = time.Hour
+	oidcRequestTimeout   = 10 * time.Second
+
+	// An unknown key ID makes the cache fetch the key set again, at most this often, so that
+	// tokens signed with a new key are accepted as soon as the provider rotates its keys
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+var defaultOIDCAlgorithms = []string{"RS256", "ES256"}
+
+// NewOIDCVerifier returns a verifier for tokens issued by the OpenID Connect provider in the
+// config, or nil when OIDC is not configured. The signing keys are fetched when the first
+// token is verified, so the provider does not need to be up when the server starts.
+func NewOIDCVerifier(cfg config.OIDCConfig, client *http.Client) (*JWTVerifier, error) {
+	if cfg.Issuer == "" {
+		return nil, nil
+	}
+
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultOIDCAlgorithms
+	}
+	for _, alg := range algorithms {
+		if alg != "RS256" && alg != "ES256" {
+			return nil, fmt.Errorf("oidc: unsupported algorithm %q", alg)
+		}
+	}
+
+	cacheTime := defaultJWKSCacheTime
+	if cfg.JWKSCacheSeconds > 0 {
+		cacheTime = time.Duration(cfg.JWKSCacheSeconds) * time.Second
+	}
+
+	keys := &jwksCache{
+		client:     client,
+		issuer:     cfg.Issuer,
+		jwksURL:    cfg.JWKSURL,
+		url:        cfg.JWKSURL,
+		cacheTime:  cacheTime,
+		minRefresh: jwksMinRefreshInterval,
+	}
+
+	options := parserOptions(algorithms, cfg.Issuer, cfg.Audience, cfg.LeewaySeconds)
+	return &JWTVerifier{
+		parser:   jwt.NewParser(options...),
+		keyFunc:  keys.keyFunc,
+		audience: cfg.Audience,
+		claims:   cfg.ClaimsConfig,
+		jwks:     keys,
+	}, nil
+}
+
+// jwksCache keeps the signing keys of an OpenID Connect provider, by key ID. The key set is
+// fetched by one request at a time without holding the lock, so a slow or unreachable provider
+// only holds up the tokens that the keys already kept cannot verify.
+type jwksCache struct {
+	client     *http.Client
+	issuer     string
+	jwksURL    string
+	cacheTime  time.Duration
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]jsonWebKey
+	url       string
+	fetchedAt time.Time
+	fetchErr  error
+	fetching  chan struct{}
+}
+
+// jsonWebKey is a public key from a key set and the algorithm it is for, if the set says
+type jsonWebKey struct {
+	alg string
+	key interface{}
+}
+
+// keyFunc returns the key the token was signed with
+func (kc *jwksCache) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	keys, err := kc.keySet(kid)
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := lookupKey(keys, kid)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.alg != "" && jwk.alg != alg {
+		return nil, fmt.Errorf("oidc: key %q is for %s, not %s", kid, jwk.alg, alg)
+	}
+	switch jwk.key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return nil, fmt.Errorf("oidc: key %q cannot verify %s", kid, alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return nil, fmt.Errorf("oidc: key %q cannot verify %s", kid, alg)
+		}
+	}
+	return jwk.key, nil
+}
+
+// keySet returns the keys to verify a token signed with kid. The set is fetched again once it
+// has been kept for the cache time, or when it does not have kid, but no more often than the
+// minimum refresh interval, so tokens with made up key IDs cannot flood the provider. Only a
+// caller without a key for kid waits for the fetch.
+func (kc *jwksCache) keySet(kid string) (map[string]jsonWebKey, error) {
+	kc.mu.Lock()
+	age := time.Since(kc.fetchedAt)
+	_, err := lookupKey(kc.keys, kid)
+	missing := err != nil
+	if age <= kc.cacheTime && (!missing || age <= kc.minRefresh) {
+		keys, err := kc.keys, kc.fetchErr
+		kc.mu.Unlock()
+		if keys == nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	done := kc.startFetch()
+	keys := kc.keys
+	kc.mu.Unlock()
+	if !missing {
+		// The kept keys verify the token while the set is fetched again
+		return keys, nil
+	}
+
+	<-done
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if kc.keys == nil {
+		return nil, kc.fetchErr
+	}
+	return kc.keys, nil
+}
+
+// startFetch fetches the key set in the background unless a fetch is running already, and
+// returns a channel closed once it is done. Called with the lock held.
+func (kc *jwksCache) startFetch() chan struct{} {
+	if kc.fetching != nil {
+		return kc.fetching
+	}
+	done := make(chan struct{})
+	kc.fetching = done
+	kc.fetchedAt = time.Now()
+	url := kc.url
+
+	go func() {
+		defer close(done)
+		keys, url, err := kc.fetch(url)
+
+		kc.mu.Lock()
+		defer kc.mu.Unlock()
+		kc.fetching = nil
+		kc.fetchErr = err
+		if err != nil {
+			// Keep using the keys we have until the provider is back. The jwks_uri may have
+			// moved, so it is discovered again on the next fetch.
+			log.Printf("failed to refresh OIDC signing keys: %v", err)
+			kc.url = kc.jwksURL
+			return
+		}
+		kc.keys = keys
+		kc.url = url
+	}()
+	return done
+}
+
+// Tokens without a key ID can only be verified when the set has a single key
+func lookupKey(keys map[string]jsonWebKey, kid string) (jsonWebKey, error) {
+	if kid == "" {
+		if len(keys) == 1 {
+			for _, jwk := range keys {
+				return jwk, nil
+			}
+		}
+		return jsonWebKey{}, errors.New("oidc: token has no key ID")
+	}
+
+	jwk, found := keys[kid]
+	if !found {
+		return jsonWebKey{}, fmt.Errorf("oidc: unknown key ID %q", kid)
+	}
+	return jwk, nil
+}
+
+// fetch fetches the key set from url, discovering where it is from the issuer first if url is
+// empty. Returns the keys and the url they were fetched from.
+func (kc *jwksCache) fetch(url string) (map[string]jsonWebKey, string, error) {
+	if url == "" {
+		var err error
+		if url, err = kc.discover(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := kc.getJSON(url, &set); err != nil {
+		return nil, "", err
+	}
+
+	keys := map[string]jsonWebKey{}
+	for _, raw := range set.Keys {
+		kid, jwk, err := parseJSONWebKey(raw)
+		if err != nil {
+			// Providers can publish keys we do not use, such as encryption keys
+			continue
+		}
+		keys[kid] = jwk
+	}
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("oidc: no usable signing keys at %s", url)
+	}
+	return keys, url, nil
+}
+
+// Returns the jwks_uri from the discovery document of the issuer
+func (kc *jwksCache) discover() (string, error) {
+	discoveryUrl := strings.TrimSuffix(kc.issuer, "/") + "/.well-known/openid-configuration"
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := kc.getJSON(discoveryUrl, &doc); err != nil {
+		return "", err
+	}
+	if doc.Issuer != kc.issuer {
+		return "", fmt.Errorf("oidc: discovery document is for issuer %q, not %q", doc.Issuer, kc.issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("oidc: discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func (kc *jwksCache) getJSON(url string, v interface{}) error {
+	resp, err := kc.client.Get(url)
+	if err != nil {
+		return fmt.Errorf("oidc: failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: failed to fetch %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("oidc: failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// Parses an RSA or P-256 signing key from a key set
+func parseJSONWebKey(raw json.RawMessage) (string, jsonWebKey, error) {
+	var jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", jsonWebKey{}, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", jsonWebKey{}, fmt.Errorf("key %q is not for signing", jwk.Kid)
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64Int(jwk.N)
+		if err != nil {
+			return "", jsonWebKey{}, err
+		}
+		e, err := base64Int(jwk.E)
+		if err != nil {
+			return "", jsonWebKey{}, err
+		}
+		if !e.IsInt64() {
+			return "", jsonWebKey{}, fmt.Errorf("key %q has an invalid exponent", jwk.Kid)
+		}
+		key := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		return jwk.Kid, jsonWebKey{alg: jwk.Alg, key: key}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return "", jsonWebKey{}, fmt.Errorf("key %q uses unsupported curve %q", jwk.Kid, jwk.Crv)
+		}
+		x, err := base64Int(jwk.X)
+		if err != nil {
+			return "", jsonWebKey{}, err
+		}
+		y, err := base64Int(jwk.Y)
+		if err != nil {
+			return "", jsonWebKey{}, err
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return "", jsonWebKey{}, fmt.Errorf("key %q is not on the P-256 curve", jwk.Kid)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		return jwk.Kid, jsonWebKey{alg: jwk.Alg, key: key}, nil
+	default:
+		return "", jsonWebKey{}, fmt.Errorf("key %q has unsupported type %q", jwk.Kid, jwk.Kty)
+	}
+}
+
+func base64Int(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
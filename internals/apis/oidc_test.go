@@ -0,0 +1,320 @@
+package apis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider is a stand-in OpenID Connect provider serving a discovery document and a key set
+type testProvider struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	keys        []map[string]string
+	keysPath    string
+	stall       chan struct{}
+	jwksFetches int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{keysPath: "/keys"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   p.server.URL,
+			"jwks_uri": p.server.URL + p.keysPath,
+		})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		stall := p.stall
+		p.mu.Unlock()
+		if stall != nil {
+			<-stall
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.URL.Path != p.keysPath {
+			http.NotFound(w, r)
+			return
+		}
+		p.jwksFetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": p.keys})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) setKeys(keys ...map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+}
+
+// moveKeys serves the key set from another path, as providers do when the jwks_uri changes
+func (p *testProvider) moveKeys(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keysPath = path
+}
+
+// stallKeys holds key set requests until the returned function is called
+func (p *testProvider) stallKeys() func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stall := make(chan struct{})
+	p.stall = stall
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.stall == stall {
+			p.stall = nil
+			close(stall)
+		}
+	}
+}
+
+func (p *testProvider) fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.jwksFetches
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func oidcClaims(issuer string, orgs interface{}, roles interface{}) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    issuer,
+		"aud":    "terraxen",
+		"sub":    "engineer@example.com",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": orgs,
+		"roles":  roles,
+	}
+}
+
+func TestOIDCTokensMapToOrganizationsAndRoles(t *testing.T) {
+	provider := newTestProvider(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider.setKeys(rsaJWK("key-1", &key.PublicKey))
+
+	ta := newTestApiWithConfig(t, &config.Config{
+		Auth: config.AuthConfig{
+			OIDC: config.OIDCConfig{
+				Issuer:   provider.server.URL,
+				Audience: "terraxen",
+				ClaimsConfig: config.ClaimsConfig{
+					OrganizationClaim: "groups",
+					RoleMapping:       map[string]string{"naming-admins": "org_admin"},
+				},
+			},
+		},
+	})
+	other, err := ta.providers.Organizations.NewOrganization("other-org")
+	require.NoError(t, err)
+
+	single := signWithKid(t, jwt.SigningMethodRS256, "key-1", key, oidcClaims(provider.server.URL, ta.org.Id, []string{"naming-admins", "everyone"}))
+	rec := ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+single)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	v, err := NewOIDCVerifier(config.OIDCConfig{Issuer: provider.server.URL, Audience: "terraxen"}, http.DefaultClient)
+	require.NoError(t, err)
+	v.claims.RoleMapping = map[string]string{"naming-admins": "org_admin"}
+	claims, err := v.Verify(single)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"org_admin"}, claims.Roles)
+	assert.Equal(t, "engineer@example.com", claims.UserId)
+
+	// Members of several organizations choose one with the organization header
+	multi := signWithKid(t, jwt.SigningMethodRS256, "key-1", key, oidcClaims(provider.server.URL, []string{ta.org.Id, other.Id}, "naming-admins"))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+multi)
+	rec = httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Set(organizationHeader, other.Id)
+	rec = httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req.Header.Set(organizationHeader, "not-a-member")
+	rec = httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	wrongIssuer := signWithKid(t, jwt.SigningMethodRS256, "key-1", key, oidcClaims("https://other.test", ta.org.Id, nil))
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/audit", "Bearer "+wrongIssuer)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	provider := newTestProvider(t)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	provider.setKeys(rsaJWK("old", &oldKey.PublicKey))
+
+	v, err := NewOIDCVerifier(config.OIDCConfig{Issuer: provider.server.URL, Audience: "terraxen"}, http.DefaultClient)
+	require.NoError(t, err)
+
+	claims := oidcClaims(provider.server.URL, "org-1", nil)
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+	require.NoError(t, err)
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.fetches(), "key set is cached")
+
+	// The provider rotates to a new key. Unknown key IDs only refresh the set so often.
+	provider.setKeys(ecJWK("new", &newKey.PublicKey))
+	rotated := signWithKid(t, jwt.SigningMethodES256, "new", newKey, claims)
+	_, err = v.Verify(rotated)
+	assert.Error(t, err)
+	assert.Equal(t, 1, provider.fetches())
+
+	v.jwks.mu.Lock()
+	v.jwks.fetchedAt = time.Now().Add(-jwksMinRefreshInterval - time.Second)
+	v.jwks.mu.Unlock()
+	_, err = v.Verify(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.fetches())
+
+	// Keys removed from the set are no longer accepted
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+	assert.Error(t, err)
+
+	// A key cannot be used with another algorithm than the one it is for
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodHS256, "new", []byte("secret"), claims))
+	assert.Error(t, err)
+}
+
+// ageKeySet makes the cached key set look as if it was fetched age ago
+func ageKeySet(v *JWTVerifier, age time.Duration) {
+	v.jwks.mu.Lock()
+	defer v.jwks.mu.Unlock()
+	v.jwks.fetchedAt = time.Now().Add(-age)
+}
+
+func TestOIDCSlowProviderDoesNotBlockCachedKeys(t *testing.T) {
+	provider := newTestProvider(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider.setKeys(rsaJWK("key-1", &key.PublicKey))
+
+	v, err := NewOIDCVerifier(config.OIDCConfig{Issuer: provider.server.URL, Audience: "terraxen"}, http.DefaultClient)
+	require.NoError(t, err)
+	token := signWithKid(t, jwt.SigningMethodRS256, "key-1", key, oidcClaims(provider.server.URL, "org-1", nil))
+	_, err = v.Verify(token)
+	require.NoError(t, err)
+
+	// The cached set has expired and the provider does not answer. Tokens signed with a key
+	// we have are still verified while the set is fetched again.
+	release := provider.stallKeys()
+	defer release()
+	ageKeySet(v, defaultJWKSCacheTime+time.Second)
+
+	verified := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := v.Verify(token)
+			verified <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-verified:
+			assert.NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("verification waited for the provider")
+		}
+	}
+
+	release()
+	assert.Eventually(t, func() bool { return provider.fetches() == 2 }, 2*time.Second, 10*time.Millisecond, "one refresh at a time")
+}
+
+func TestOIDCKeySetIsDiscoveredAgainAfterFailure(t *testing.T) {
+	provider := newTestProvider(t)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider.setKeys(rsaJWK("old", &oldKey.PublicKey))
+
+	v, err := NewOIDCVerifier(config.OIDCConfig{Issuer: provider.server.URL, Audience: "terraxen"}, http.DefaultClient)
+	require.NoError(t, err)
+	claims := oidcClaims(provider.server.URL, "org-1", nil)
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+	require.NoError(t, err)
+
+	// The provider moves its key set and rotates the key
+	provider.moveKeys("/keys-v2")
+	provider.setKeys(rsaJWK("new", &newKey.PublicKey))
+	rotated := signWithKid(t, jwt.SigningMethodRS256, "new", newKey, claims)
+
+	ageKeySet(v, jwksMinRefreshInterval+time.Second)
+	_, err = v.Verify(rotated)
+	assert.Error(t, err, "the old jwks_uri is gone")
+
+	// Failures are retried no more often than the minimum refresh interval
+	_, err = v.Verify(rotated)
+	assert.Error(t, err)
+	assert.Equal(t, 1, provider.fetches())
+
+	ageKeySet(v, jwksMinRefreshInterval+time.Second)
+	_, err = v.Verify(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.fetches())
+
+	// The keys kept through the failure were the old ones
+	_, err = v.Verify(signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+	assert.Error(t, err)
+}
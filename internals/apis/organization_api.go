@@ -2,23 +2,43 @@ package apis
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"reflect"
+	"time"
 
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/gin-gonic/gin"
 )
 
+const defaultRestoreWindow = 30 * 24 * time.Hour
+
 type OrganizationHandler struct {
-	orgSvc services.OrganizationServiceProvider
+	providers     *services.Providers
+	orgSvc        services.OrganizationServiceProvider
+	auditor       *Auditor
+	authz         *Authorizer
+	history       *VariableHistory
+	restoreWindow time.Duration
 }
 
-func NewOrganizationHandler(orgSvc services.OrganizationServiceProvider) *OrganizationHandler {
+func NewOrganizationHandler(providers *services.Providers, authz *Authorizer, auditor *Auditor, history *VariableHistory, restoreWindow time.Duration) *OrganizationHandler {
+	if restoreWindow <= 0 {
+		restoreWindow = defaultRestoreWindow
+	}
 	orgHandler := &OrganizationHandler{
-		orgSvc: orgSvc,
+		providers:     providers,
+		orgSvc:        providers.Organizations,
+		auditor:       auditor,
+		authz:         authz,
+		history:       history,
+		restoreWindow: restoreWindow,
 	}
 	return orgHandler
 }
 
+// CreateOrganization creates an organization along with its first admin key, whose secret is
+// only shown in this response. Only the server administrator can create organizations.
 func (orgApi *OrganizationHandler) CreateOrganization(c *gin.Context) {
 	orgRequest := NewOrganizationRequest{}
 
@@ -26,23 +46,36 @@ func (orgApi *OrganizationHandler) CreateOrganization(c *gin.Context) {
 		return
 	}
 
-	exists := orgApi.orgSvc.ExistsByName(orgRequest.Name)
-	if exists {
-		responseError(c, http.StatusConflict, "Organization already exists")
+	if orgRequest.Name == "" {
+		responseError(c, http.StatusBadRequest, "Organization name is required")
 		return
 	}
 
-	newOrg, err := orgApi.orgSvc.NewOrganization(orgRequest.Name)
-	if err != nil {
+	keyName := orgRequest.AdminKeyName
+	if keyName == "" {
+		keyName = defaultAdminKeyName
+	}
+
+	bootstrap, err := services.BootstrapOrganization(orgApi.providers, orgRequest.Name, keyName)
+	if err == services.ErrOrganizationExists {
+		responseError(c, http.StatusConflict, "Organization already exists")
+		return
+	} else if err != nil {
+		log.Printf("failed to bootstrap organization %s: %v", orgRequest.Name, err)
 		responseError(c, http.StatusInternalServerError, "Something went wrong on our side")
 		return
 	}
 
-	responseSingleItemStatus(c, http.StatusCreated, newOrg)
-}
-
-func (orgApi *OrganizationHandler) GetListOfOrganizations(c *gin.Context) {
-
+	newOrg, key := bootstrap.Organization, bootstrap.ApiKey
+	orgApi.auditor.Record(c, newOrg.Id, services.AuditActionCreate, services.AuditResourceOrganization, newOrg.Id, nil, newOrg)
+	orgApi.auditor.Record(c, newOrg.Id, services.AuditActionCreate, services.AuditResourceApiKey, key.Id, nil, auditApiKey(key))
+	orgApi.auditor.Record(c, newOrg.Id, services.AuditActionCreate, services.AuditResourceRoleBinding, bootstrap.RoleBinding.Id, nil, bootstrap.RoleBinding)
+	orgApi.history.RecordOrganization(newOrg)
+	setETag(c, newOrg.Revision)
+	responseSingleItemStatus(c, http.StatusCreated, NewOrganizationResponse{
+		Organization: newOrg,
+		ApiKey:       publicApiKey(key),
+	})
 }
 
 func (orgApi *OrganizationHandler) GetOrganization(c *gin.Context) {
@@ -65,6 +98,7 @@ func (orgApi *OrganizationHandler) GetOrganization(c *gin.Context) {
 		return
 	}
 
+	setETag(c, org.Revision)
 	responseSingleItem(c, org)
 }
 
@@ -77,6 +111,11 @@ func (orgApi *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 		return
 	}
 
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
 	org, err := orgApi.orgSvc.GetOrganizationById(orgId)
 	if err != nil {
 		responseError(c, http.StatusInternalServerError, "Something went wrong our end")
@@ -96,19 +135,30 @@ func (orgApi *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 		return
 	}
 
-	orgApi.orgSvc.UpdateOrganization(orgId, updateReq.Name, updateReq.Variables)
-
-	responseSingleItem(c, org)
-}
-
-func (orgApi *OrganizationHandler) DeleteOrganization(c *gin.Context) {
-	orgUrlId := c.Param("orgId")
-	orgId := c.GetString(ORG_CONTEXT_NAME)
+	varsChanged := len(org.OrgVars) != len(updateReq.Variables) || (len(org.OrgVars) > 0 && !reflect.DeepEqual(org.OrgVars, updateReq.Variables))
+	if varsChanged {
+		if !ensureOrganizationNotFrozen(c, orgApi.authz, org, time.Now()) {
+			return
+		}
+	}
 
-	if orgUrlId != orgId {
-		responseError(c, http.StatusInternalServerError, "Organization ID mismatch")
+	before := org
+	org, err = orgApi.orgSvc.UpdateOrganization(orgId, updateReq.Name, updateReq.Variables, revision)
+	if err != nil {
+		if err == services.ErrOrganizationExists {
+			responseError(c, http.StatusConflict, "Organization with that name already exists")
+		} else if err == services.ErrRevisionMismatch {
+			responseError(c, http.StatusPreconditionFailed, "Organization has been modified since it was read")
+		} else {
+			responseError(c, http.StatusInternalServerError, "Something went wrong our end")
+		}
 		return
 	}
 
-	orgApi.orgSvc.DeleteOrganization(orgId)
+	orgApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceOrganization, orgId, before, org)
+	if varsChanged {
+		orgApi.history.RecordOrganization(org)
+	}
+	setETag(c, org.Revision)
+	responseSingleItem(c, org)
 }
@@ -1,11 +1,47 @@
 package apis
 
+import "github.com/MrWestbury/terraxen-naming-service/internals/services"
+
+// Name given to the first admin key of an organization when the request does not name it
+const defaultAdminKeyName = "admin"
+
 type NewOrganizationRequest struct {
-	Request bool
-	Name    string `json:"name"`
+	Request      bool
+	Name         string `json:"name"`
+	AdminKeyName string `json:"admin_key_name"`
+}
+
+// NewOrganizationResponse holds a new organization and its first admin key, including the
+// secret of the key
+type NewOrganizationResponse struct {
+	Organization *services.Organization `json:"organization"`
+	ApiKey       *services.ApiKey       `json:"api_key"`
 }
 
 type UpdateOrganizationRequest struct {
 	Name      string            `json:"name"`
 	Variables map[string]string `json:"variables"`
 }
+
+type RestoreOrganizationRequest struct {
+	AdminKeyName string `json:"admin_key_name"`
+}
+
+type SuspendOrganizationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// OrganizationSummary is an organization as listed to super admins, with its status and what
+// it holds
+type OrganizationSummary struct {
+	services.Organization
+	Status string            `json:"status"`
+	Usage  OrganizationUsage `json:"usage"`
+}
+
+type OrganizationUsage struct {
+	Namespaces         int `json:"namespaces"`
+	Schemas            int `json:"schemas"`
+	NamespaceTemplates int `json:"namespace_templates"`
+	ApiKeys            int `json:"api_keys"`
+}
@@ -1,7 +1,154 @@
 package apis
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "test-admin-token"
+
+// requestAsAdmin sends a request with the administrator credential
+func (ta *testApi) requestAsAdmin(token string, method string, path string, body string) *httptest.ResponseRecorder {
+	return ta.requestAsAdminIfMatch(token, method, path, body, "")
+}
+
+// requestAsAdminIfMatch sends a request with the administrator credential and an If-Match
+// header, unless ifMatch is empty
+func (ta *testApi) requestAsAdminIfMatch(token string, method string, path string, body string, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(adminHeader, token)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	ta.api.router.ServeHTTP(rec, req)
+	return rec
+}
 
 func TestRegisterOrganizationApi(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{Admin: config.AdminConfig{Token: testAdminToken}})
+
+	registered := map[string]bool{}
+	for _, route := range ta.api.router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	tenantRoutes := []string{
+		"GET /api/v1/organizations/",
+		"POST /api/v1/organizations/",
+		"DELETE /api/v1/organizations/:orgId",
+		"POST /api/v1/organizations/:orgId/restore",
+		"PUT /api/v1/organizations/:orgId/suspension",
+		"DELETE /api/v1/organizations/:orgId/suspension",
+	}
+	for _, route := range append(tenantRoutes,
+		"GET /api/v1/organizations/:orgId",
+		"PUT /api/v1/organizations/:orgId",
+		"GET /api/v1/organizations/:orgId/freeze-windows",
+		"PUT /api/v1/organizations/:orgId/freeze-windows",
+		"GET /api/v1/organizations/:orgId/history",
+	) {
+		assert.True(t, registered[route], "%s is registered", route)
+	}
+
+	// The organization's own admin manages the organization, but not the tenants of the server
+	rec := ta.request(http.MethodGet, "/api/v1/organizations/"+ta.org.Id, "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	for _, route := range tenantRoutes {
+		parts := strings.SplitN(route, " ", 2)
+		path := strings.Replace(parts[1], ":orgId", ta.org.Id, 1)
+		rec := ta.request(parts[0], path, "")
+		assert.Equal(t, http.StatusForbidden, rec.Code, "%s needs the admin credential", route)
+	}
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodGet, "/api/v1/organizations/", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestCreateOrganizationRequiresAdmin(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{Admin: config.AdminConfig{Token: testAdminToken}})
+
+	rec := ta.request(http.MethodPost, "/api/v1/organizations/", `{"name": "acme"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "an organization admin cannot create organizations")
+	rec = ta.requestAsAdmin("wrong", http.MethodPost, "/api/v1/organizations/", `{"name": "acme"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Admin credential rejected")
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodPost, "/api/v1/organizations/", `{"name": "acme", "admin_key_name": "onboarding"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Data NewOrganizationResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	org, key := created.Data.Organization, created.Data.ApiKey
+	assert.Equal(t, "acme", org.Name)
+	assert.Equal(t, org.Id, key.OrganizationId)
+	assert.Equal(t, "onboarding", key.Name)
+	assert.NotContains(t, rec.Body.String(), `"hash"`)
+
+	// The new key administers the new organization and nothing else
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/organizations/"+org.Id, "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.requestAs(key, http.MethodPost, "/api/v1/apikeys/", `{"name": "ci"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.requestAs(key, http.MethodGet, "/api/v1/organizations/"+ta.org.Id, "")
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+
+	events, err := ta.providers.Audit.ListEvents(org.Id, services.AuditFilter{Actor: adminActor})
+	require.NoError(t, err)
+	assert.Len(t, events, 3, "the organization, key and role binding are audited")
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodPost, "/api/v1/organizations/", `{"name": "acme"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodPost, "/api/v1/organizations/", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestActiveFreezeWindowsCannotBeShortened(t *testing.T) {
+	ta := newTestApi(t)
+	path := "/api/v1/organizations/" + ta.org.Id + "/freeze-windows"
+	now := time.Now().UTC()
+	window := func(name string, start time.Time, end time.Time) string {
+		return fmt.Sprintf(`{"name": %q, "start": %q, "end": %q}`, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	active := window("release", now.Add(-time.Hour), now.Add(time.Hour))
+	later := window("audit", now.Add(24*time.Hour), now.Add(48*time.Hour))
+	narrowed := ta.keyWithRole(t, services.RoleOrgAdmin, map[string]string{SCOPE_OPERATIONS: "organization:read,organization:write"})
+
+	rec := ta.requestIfMatch(http.MethodPut, path, `{"freeze_windows": [`+active+`]}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Windows can be added and the active one extended, but not ended early
+	rec = ta.requestAsIfMatch(narrowed, http.MethodPut, path, `{"freeze_windows": [`+active+`, `+later+`]}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	extended := window("release", now.Add(-time.Hour), now.Add(2*time.Hour))
+	rec = ta.requestAsIfMatch(narrowed, http.MethodPut, path, `{"freeze_windows": [`+extended+`]}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	shortened := window("release", now.Add(-time.Hour), now.Add(time.Minute))
+	for _, body := range []string{`{"freeze_windows": [` + shortened + `]}`, `{"freeze_windows": []}`} {
+		rec = ta.requestAsIfMatch(narrowed, http.MethodPut, path, body, "*")
+		assert.Equal(t, http.StatusLocked, rec.Code, body)
+		rec = ta.requestAsIfMatch(narrowed, http.MethodPut, path+"?override=true", body, "*")
+		assert.Equal(t, http.StatusForbidden, rec.Code, body)
+	}
+
+	rec = ta.requestIfMatch(http.MethodPut, path+"?override=true", `{"freeze_windows": []}`, "*")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestAdminCredentialIsDisabledWithoutToken(t *testing.T) {
+	ta := newTestApi(t)
 
+	rec := ta.requestAsAdmin("anything", http.MethodPost, "/api/v1/organizations/", `{"name": "acme"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.False(t, ta.providers.Organizations.ExistsByName("acme"))
 }
@@ -0,0 +1,127 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+type RoleBindingHandler struct {
+	bindingSvc services.RoleBindingProvider
+	nsSvc      services.NamespaceServiceProvider
+	schemaSvc  services.SchemaServiceProvider
+	auditor    *Auditor
+}
+
+func NewRoleBindingHandler(bindingSvc services.RoleBindingProvider, nsSvc services.NamespaceServiceProvider, schemaSvc services.SchemaServiceProvider, auditor *Auditor) *RoleBindingHandler {
+	rbApi := &RoleBindingHandler{
+		bindingSvc: bindingSvc,
+		nsSvc:      nsSvc,
+		schemaSvc:  schemaSvc,
+		auditor:    auditor,
+	}
+	return rbApi
+}
+
+// List the role bindings of the organization, or of a single subject with ?subject=
+func (rbApi *RoleBindingHandler) ListRoleBindings(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	var bindings []*services.RoleBinding
+	var err error
+	if subject := c.Query("subject"); subject != "" {
+		bindings, err = rbApi.bindingSvc.ListSubjectRoleBindings(orgId, subject)
+	} else {
+		bindings, err = rbApi.bindingSvc.ListRoleBindings(orgId)
+	}
+	if err != nil {
+		responseError(c, http.StatusInternalServerError, "Failed to list role bindings")
+		return
+	}
+
+	responseSingleItem(c, bindings)
+}
+
+// Grant a role to an API key or user, across the organization or on a namespace or schema
+func (rbApi *RoleBindingHandler) CreateRoleBinding(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+
+	var rbReq NewRoleBindingRequest
+	if err := DecodeBody(c, &rbReq); err != nil {
+		return
+	}
+
+	binding, err := services.NewRoleBinding(orgId, rbReq.Subject, rbReq.Role, rbReq.ResourceType, rbReq.ResourceId)
+	if err != nil {
+		responseRoleBindingError(c, err, "Invalid role binding")
+		return
+	}
+
+	if !roleBindingResourceExists(c, rbApi.nsSvc, rbApi.schemaSvc, binding) {
+		return
+	}
+
+	if err := rbApi.bindingSvc.CreateRoleBinding(binding); err != nil {
+		responseRoleBindingError(c, err, "Failed to create role binding")
+		return
+	}
+
+	rbApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceRoleBinding, binding.Id, nil, binding)
+	responseSingleItemStatus(c, http.StatusCreated, binding)
+}
+
+func (rbApi *RoleBindingHandler) DeleteRoleBinding(c *gin.Context) {
+	orgId := c.GetString(ORG_CONTEXT_NAME)
+	bindingId := c.Param("binding")
+
+	binding, err := rbApi.bindingSvc.GetRoleBinding(orgId, bindingId)
+	if err != nil {
+		responseRoleBindingError(c, err, "Failed to get role binding")
+		return
+	}
+
+	if err := rbApi.bindingSvc.DeleteRoleBinding(orgId, bindingId); err != nil {
+		responseRoleBindingError(c, err, "Failed to delete role binding")
+		return
+	}
+
+	rbApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceRoleBinding, bindingId, binding, nil)
+	responseNoContent(c, http.StatusNoContent)
+}
+
+// Checks that the namespace or schema a binding is for exists, writing the error response and
+// returning false if it does not
+func roleBindingResourceExists(c *gin.Context, nsSvc services.NamespaceServiceProvider, schemaSvc services.SchemaServiceProvider, binding *services.RoleBinding) bool {
+	switch binding.ResourceType {
+	case services.RoleBindingResourceNamespace:
+		if _, err := nsSvc.GetNamespaceById(binding.OrganizationId, binding.ResourceId); err != nil {
+			responseNamespaceError(c, err, "Failed to get namespace")
+			return false
+		}
+	case services.RoleBindingResourceSchema:
+		schema, err := schemaSvc.GetSchemaById(binding.OrganizationId, binding.ResourceId)
+		if err != nil {
+			responseError(c, http.StatusInternalServerError, "Failed to get schema")
+			return false
+		}
+		if schema == nil {
+			responseError(c, http.StatusNotFound, "Schema not found")
+			return false
+		}
+	}
+	return true
+}
+
+func responseRoleBindingError(c *gin.Context, err error, errMessage string) {
+	switch err {
+	case services.ErrInvalidRoleBinding:
+		responseError(c, http.StatusBadRequest, err.Error())
+	case services.ErrRoleBindingExists:
+		responseError(c, http.StatusConflict, err.Error())
+	case services.ErrRoleBindingNotFound:
+		responseError(c, http.StatusNotFound, "Role binding not found")
+	default:
+		responseError(c, http.StatusInternalServerError, errMessage)
+	}
+}
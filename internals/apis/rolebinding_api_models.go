@@ -0,0 +1,8 @@
+package apis
+
+type NewRoleBindingRequest struct {
+	Subject      string `json:"subject"`
+	Role         string `json:"role"`
+	ResourceType string `json:"resource_type"`
+	ResourceId   string `json:"resource_id"`
+}
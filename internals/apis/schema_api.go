@@ -11,11 +11,15 @@ import (
 
 type SchemaApiHandler struct {
 	schemaSvc services.SchemaServiceProvider
+	auditor   *Auditor
+	history   *VariableHistory
 }
 
-func NewSchemaApiHandler(svc services.SchemaServiceProvider) *SchemaApiHandler {
+func NewSchemaApiHandler(svc services.SchemaServiceProvider, auditor *Auditor, history *VariableHistory) *SchemaApiHandler {
 	schemaApi := &SchemaApiHandler{
 		schemaSvc: svc,
+		auditor:   auditor,
+		history:   history,
 	}
 
 	return schemaApi
@@ -60,7 +64,7 @@ func (sApi *SchemaApiHandler) CreateSchema(c *gin.Context) {
 
 	schema, err := sApi.schemaSvc.CreateSchema(orgId, schemaReq.Name)
 	if err != nil {
-		if err.Error() == "schema already exists" {
+		if err == services.ErrSchemaAlreadyExists {
 			responseError(c, http.StatusConflict, "Schema name already exists in organization")
 			return
 		} else {
@@ -70,6 +74,8 @@ func (sApi *SchemaApiHandler) CreateSchema(c *gin.Context) {
 		}
 	}
 
+	sApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceSchema, schema.Id, nil, schema)
+	setETag(c, schema.Revision)
 	responseSingleItem(c, schema)
 }
 
@@ -82,7 +88,12 @@ func (sApi *SchemaApiHandler) GetSchema(c *gin.Context) {
 		responseError(c, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	if schema == nil {
+		responseError(c, http.StatusNotFound, "Schema not found")
+		return
+	}
 
+	setETag(c, schema.Revision)
 	responseSingleItem(c, schema)
 }
 
@@ -90,6 +101,11 @@ func (sApi *SchemaApiHandler) UpdateSchema(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	schemaId := c.Param("schema")
 
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
 	var schemaReq UpdateSchemaRequest
 	decoder := json.NewDecoder(c.Request.Body)
 	decoder.DisallowUnknownFields()
@@ -103,14 +119,28 @@ func (sApi *SchemaApiHandler) UpdateSchema(c *gin.Context) {
 		responseError(c, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	if schema == nil {
+		responseError(c, http.StatusNotFound, "Schema not found")
+		return
+	}
+	before := *schema
 	schema.Name = schemaReq.Name
+	schema.Revision = revision
 
-	err = sApi.schemaSvc.UpdateSchema(*schema)
+	schema, err = sApi.schemaSvc.UpdateSchema(*schema)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Something went wrong")
+		if err == services.ErrSchemaAlreadyExists {
+			responseError(c, http.StatusConflict, "Schema with that name already exists")
+		} else if err == services.ErrRevisionMismatch {
+			responseError(c, http.StatusPreconditionFailed, "Schema has been modified since it was read")
+		} else {
+			responseError(c, http.StatusInternalServerError, "Something went wrong")
+		}
 		return
 	}
 
+	sApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceSchema, schemaId, before, schema)
+	setETag(c, schema.Revision)
 	responseSingleItem(c, schema)
 }
 
@@ -118,14 +148,37 @@ func (sApi *SchemaApiHandler) DeleteSchema(c *gin.Context) {
 	orgId := c.GetString(ORG_CONTEXT_NAME)
 	schemaId := c.Param("schema")
 
-	err := sApi.schemaSvc.DeleteSchema(orgId, schemaId)
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	schema, err := sApi.schemaSvc.GetSchemaById(orgId, schemaId)
 	if err != nil {
-		if err.Error() == "schema not found" {
+		responseError(c, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if schema == nil {
+		responseError(c, http.StatusNotFound, "Schema not found")
+		return
+	}
+
+	err = sApi.schemaSvc.DeleteSchema(orgId, schemaId, revision)
+	if err != nil {
+		if err == services.ErrSchemaNotFound {
 			responseError(c, http.StatusNotFound, "Schema not found")
 
+		} else if err == services.ErrSchemaInUse {
+			responseError(c, http.StatusConflict, "Schema is used by namespaces")
+
+		} else if err == services.ErrRevisionMismatch {
+			responseError(c, http.StatusPreconditionFailed, "Schema has been modified since it was read")
+
 		} else {
 			responseError(c, http.StatusInternalServerError, "Something went wrong")
 		}
 		return
 	}
+
+	sApi.auditor.Record(c, orgId, services.AuditActionDelete, services.AuditResourceSchema, schemaId, schema, nil)
 }
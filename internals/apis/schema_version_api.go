@@ -65,6 +65,9 @@ func (sApi *SchemaApiHandler) CreateSchemaVersion(c *gin.Context) {
 		return
 	}
 
+	sApi.auditor.Record(c, orgId, services.AuditActionCreate, services.AuditResourceSchemaVersion, schemaVersionResourceId(sv), nil, sv)
+	sApi.history.RecordSchemaVersion(orgId, sv)
+	setETag(c, sv.Revision)
 	responseSingleItem(c, sv)
 }
 
@@ -79,6 +82,7 @@ func (sApi *SchemaApiHandler) GetSchemaVersion(c *gin.Context) {
 		return
 	}
 
+	setETag(c, sv.Revision)
 	responseSingleItem(c, sv)
 }
 
@@ -87,6 +91,11 @@ func (sApi *SchemaApiHandler) UpdateSchemaVersion(c *gin.Context) {
 	schemaId := c.Param("schema")
 	schemaVersion := c.Param("version")
 
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
 	var req UpdateSchemaVersionRequest
 	err := DecodeBody(c, &req)
 	if err != nil {
@@ -105,14 +114,26 @@ func (sApi *SchemaApiHandler) UpdateSchemaVersion(c *gin.Context) {
 		return
 	}
 
-	updatedVer, err := sApi.schemaSvc.UpdateSchemaVersion(orgId, schemaId, schemaVersion, req.Resources, req.Published)
+	updatedVer, err := sApi.schemaSvc.UpdateSchemaVersion(orgId, schemaId, schemaVersion, req.Resources, req.Published, revision)
+	if err == services.ErrRevisionMismatch {
+		responseError(c, http.StatusPreconditionFailed, "Schema version has been modified since it was read")
+		return
+	}
 	if err != nil {
 		responseError(c, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	sApi.auditor.Record(c, orgId, services.AuditActionUpdate, services.AuditResourceSchemaVersion, schemaVersionResourceId(updatedVer), schemaVer, updatedVer)
+	sApi.history.RecordSchemaVersion(orgId, updatedVer)
+	setETag(c, updatedVer.Revision)
 	responseSingleItem(c, updatedVer)
 }
 
+// Schema versions are identified in the audit log by their schema and version number
+func schemaVersionResourceId(sv *services.SchemaVersion) string {
+	return fmt.Sprintf("%s/%d", sv.SchemaId, sv.Id)
+}
+
 func (sApi *SchemaApiHandler) DeleteSchemaVersion(c *gin.Context) {
 	// TODO: If we delete, do we actually delete, or just disable?
 }
@@ -142,9 +163,12 @@ func (sApi *SchemaApiHandler) ResolveResourceName(c *gin.Context) {
 		return
 	}
 
-	result, err := engine.ResolvePattern(res, resolveReq.Variables)
+	resolver := engine.NewResolver()
+	resolver.AddLayer(engine.SourceRequest, resolveReq.Variables)
+
+	result, trace, err := resolver.Resolve(res)
 	if err != nil {
-		responseError(c, http.StatusInternalServerError, "Something went wrong")
+		responseResolveError(c, err)
 		return
 	}
 
@@ -153,6 +177,9 @@ func (sApi *SchemaApiHandler) ResolveResourceName(c *gin.Context) {
 		Pattern:      res,
 		Value:        result,
 	}
+	if explainRequested(c) {
+		response.Explain = trace
+	}
 
 	responseSingleItem(c, response)
 }
@@ -0,0 +1,302 @@
+package apis
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Statuses of an organization in the tenant list
+const (
+	organizationStatusActive    = "active"
+	organizationStatusSuspended = "suspended"
+	organizationStatusDeleted   = "deleted"
+)
+
+// GetListOfOrganizations lists every organization with what it holds, for super admins. ?q=
+// searches the names and ?status= selects active, suspended or deleted organizations.
+func (orgApi *OrganizationHandler) GetListOfOrganizations(c *gin.Context) {
+	search := strings.ToLower(c.Query("q"))
+	status := c.Query("status")
+	switch status {
+	case "", organizationStatusActive, organizationStatusSuspended, organizationStatusDeleted:
+	default:
+		responseError(c, http.StatusBadRequest, "status must be active, suspended or deleted")
+		return
+	}
+
+	orgs, err := orgApi.orgSvc.ListOrganizations()
+	if err != nil {
+		log.Printf("failed to list organizations: %v", err)
+		responseError(c, http.StatusInternalServerError, "Failed to list organizations")
+		return
+	}
+
+	matching := make([]*services.Organization, 0, len(orgs))
+	for _, org := range orgs {
+		if search != "" && !strings.Contains(strings.ToLower(org.Name), search) {
+			continue
+		}
+		if status != "" && organizationStatus(org) != status {
+			continue
+		}
+		matching = append(matching, org)
+	}
+
+	lm := ProcessListMetadata(c)
+	results := make([]*OrganizationSummary, 0)
+	for _, org := range paginate(matching, lm) {
+		usage, err := orgApi.usage(org.Id)
+		if err != nil {
+			log.Printf("failed to count the resources of organization %s: %v", org.Id, err)
+			responseError(c, http.StatusInternalServerError, "Failed to list organizations")
+			return
+		}
+		results = append(results, &OrganizationSummary{
+			Organization: *org,
+			Status:       organizationStatus(org),
+			Usage:        usage,
+		})
+	}
+	responseSingleItem(c, results)
+}
+
+// DeleteOrganization deletes an organization and revokes its API keys, for super admins. It
+// can be restored until the purge_after time of its deletion, when it and everything it owns
+// are purged.
+func (orgApi *OrganizationHandler) DeleteOrganization(c *gin.Context) {
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	org, ok := orgApi.targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	deleted, revoked, err := services.SoftDeleteOrganization(orgApi.providers, org.Id, requestActor(c), time.Now(), orgApi.restoreWindow, revision)
+	if deleted != nil && org.Deletion == nil {
+		orgApi.auditor.Record(c, org.Id, services.AuditActionDelete, services.AuditResourceOrganization, org.Id, org, nil)
+	}
+	for _, ak := range revoked {
+		orgApi.auditor.Record(c, org.Id, services.AuditActionDelete, services.AuditResourceApiKey, ak.Id, auditApiKey(ak), nil)
+	}
+	if err == services.ErrRevisionMismatch {
+		responseError(c, http.StatusPreconditionFailed, "Organization has been modified since it was read")
+		return
+	} else if err != nil {
+		log.Printf("failed to delete organization %s: %v", org.Id, err)
+		responseError(c, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+
+	setETag(c, deleted.Revision)
+	responseSingleItem(c, deleted)
+}
+
+// RestoreOrganization restores a deleted organization before it is purged, for super admins.
+// Its keys were revoked when it was deleted, so it is given a new admin key, whose secret is
+// only shown in this response.
+func (orgApi *OrganizationHandler) RestoreOrganization(c *gin.Context) {
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var restoreReq RestoreOrganizationRequest
+	if c.Request.ContentLength != 0 {
+		if err := DecodeBody(c, &restoreReq); err != nil {
+			return
+		}
+	}
+	keyName := restoreReq.AdminKeyName
+	if keyName == "" {
+		keyName = defaultAdminKeyName
+	}
+
+	org, ok := orgApi.targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	restored, err := services.RestoreDeletedOrganization(orgApi.providers, org.Id, keyName, time.Now(), revision)
+	switch err {
+	case nil:
+	case services.ErrOrganizationNotFound:
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return
+	case services.ErrOrganizationNotDeleted:
+		responseError(c, http.StatusConflict, "Organization is not deleted")
+		return
+	case services.ErrOrganizationPurgeDue:
+		responseError(c, http.StatusGone, "Organization can no longer be restored")
+		return
+	case services.ErrRevisionMismatch:
+		responseError(c, http.StatusPreconditionFailed, "Organization has been modified since it was read")
+		return
+	default:
+		log.Printf("failed to restore organization %s: %v", org.Id, err)
+		responseError(c, http.StatusInternalServerError, "Failed to restore organization")
+		return
+	}
+
+	key := restored.ApiKey
+	orgApi.auditor.Record(c, org.Id, services.AuditActionUpdate, services.AuditResourceOrganization, org.Id, org, restored.Organization)
+	orgApi.auditor.Record(c, org.Id, services.AuditActionCreate, services.AuditResourceApiKey, key.Id, nil, auditApiKey(key))
+	orgApi.auditor.Record(c, org.Id, services.AuditActionCreate, services.AuditResourceRoleBinding, restored.RoleBinding.Id, nil, restored.RoleBinding)
+	setETag(c, restored.Organization.Revision)
+	responseSingleItem(c, NewOrganizationResponse{
+		Organization: restored.Organization,
+		ApiKey:       publicApiKey(key),
+	})
+}
+
+// SuspendOrganization blocks the API keys and users of an organization until it is
+// reactivated, for super admins
+func (orgApi *OrganizationHandler) SuspendOrganization(c *gin.Context) {
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	var suspendReq SuspendOrganizationRequest
+	if err := DecodeBody(c, &suspendReq); err != nil {
+		return
+	}
+
+	org, ok := orgApi.targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	suspension := services.OrganizationSuspension{
+		SuspendedBy: requestActor(c),
+		Reason:      suspendReq.Reason,
+		SuspendedAt: time.Now().UTC(),
+	}
+	updated, err := orgApi.orgSvc.SuspendOrganization(org.Id, suspension, revision)
+	if !orgApi.suspensionChanged(c, err) {
+		return
+	}
+
+	orgApi.auditor.Record(c, org.Id, services.AuditActionCreate, services.AuditResourceSuspension, org.Id, org.Suspension, updated.Suspension)
+	setETag(c, updated.Revision)
+	responseSingleItem(c, updated)
+}
+
+// ReactivateOrganization lifts the suspension of an organization, for super admins
+func (orgApi *OrganizationHandler) ReactivateOrganization(c *gin.Context) {
+	revision, ok := requiredRevision(c)
+	if !ok {
+		return
+	}
+
+	org, ok := orgApi.targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	updated, err := orgApi.orgSvc.ReactivateOrganization(org.Id, revision)
+	if !orgApi.suspensionChanged(c, err) {
+		return
+	}
+
+	if org.Suspension != nil {
+		orgApi.auditor.Record(c, org.Id, services.AuditActionDelete, services.AuditResourceSuspension, org.Id, org.Suspension, nil)
+	}
+	setETag(c, updated.Revision)
+	responseSingleItem(c, updated)
+}
+
+// Returns the organization in the orgId parameter, which a super admin may manage from
+// outside of it. Writes the error response and returns false if it does not exist.
+func (orgApi *OrganizationHandler) targetOrganization(c *gin.Context) (*services.Organization, bool) {
+	orgId := c.Param("orgId")
+	org, err := orgApi.orgSvc.GetOrganizationById(orgId)
+	if err != nil {
+		log.Printf("failed to get organization %s: %v", orgId, err)
+		responseError(c, http.StatusInternalServerError, "Something went wrong our end")
+		return nil, false
+	}
+	if org == nil {
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return nil, false
+	}
+	return org, true
+}
+
+// Responds with the error of a change to the suspension of an organization, returning false,
+// or returns true if it succeeded
+func (orgApi *OrganizationHandler) suspensionChanged(c *gin.Context, err error) bool {
+	if err == services.ErrOrganizationNotFound {
+		responseError(c, http.StatusNotFound, "No organization with that ID found")
+		return false
+	} else if err == services.ErrRevisionMismatch {
+		responseError(c, http.StatusPreconditionFailed, "Organization has been modified since it was read")
+		return false
+	} else if err != nil {
+		log.Printf("failed to change the suspension of organization %s: %v", c.Param("orgId"), err)
+		responseError(c, http.StatusInternalServerError, "Failed to change the suspension of the organization")
+		return false
+	}
+	return true
+}
+
+// Counts what the organization holds
+func (orgApi *OrganizationHandler) usage(orgId string) (OrganizationUsage, error) {
+	var usage OrganizationUsage
+	namespaces, err := orgApi.providers.Namespaces.ListNamespaces(orgId)
+	if err != nil {
+		return usage, err
+	}
+	schemas, err := orgApi.providers.Schemas.ListSchemaInOrganization(orgId)
+	if err != nil {
+		return usage, err
+	}
+	templates, err := orgApi.orgSvc.ListNamespaceTemplates(orgId)
+	if err != nil {
+		return usage, err
+	}
+	keys, err := orgApi.providers.ApiKeys.ListKeys(orgId)
+	if err != nil {
+		return usage, err
+	}
+
+	usage.Namespaces = len(namespaces)
+	usage.Schemas = len(schemas)
+	usage.NamespaceTemplates = len(templates)
+	usage.ApiKeys = len(keys)
+	return usage, nil
+}
+
+func organizationStatus(org *services.Organization) string {
+	if org.Deletion != nil {
+		return organizationStatusDeleted
+	}
+	if org.Suspension != nil {
+		return organizationStatusSuspended
+	}
+	return organizationStatusActive
+}
+
+// Returns the page of orgs selected by the offset and limit of the request
+func paginate(orgs []*services.Organization, lm *ListMeta) []*services.Organization {
+	start := lm.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(orgs) {
+		start = len(orgs)
+	}
+	end := len(orgs)
+	if lm.Limit > 0 && start+lm.Limit < end {
+		end = start + lm.Limit
+	}
+	return orgs[start:end]
+}
@@ -0,0 +1,226 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuperAdminsListOrganizations(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{
+		Admin: config.AdminConfig{Token: testAdminToken},
+		Auth: config.AuthConfig{
+			JWT: config.JWTConfig{
+				Algorithm: "HS256",
+				Secret:    testJWTSecret,
+				ClaimsConfig: config.ClaimsConfig{
+					RoleMapping: map[string]string{"platform-admins": "super_admin"},
+				},
+			},
+		},
+	})
+	ta.namespace(t, map[string]string{"vm": "vm-{env}"}, map[string]string{"env": "prod"})
+	other, err := ta.providers.Organizations.NewOrganization("other-org")
+	require.NoError(t, err)
+	_, err = ta.providers.Organizations.SuspendOrganization(other.Id, services.OrganizationSuspension{Reason: "unpaid"}, 0)
+	require.NoError(t, err)
+
+	var body struct {
+		Data []OrganizationSummary `json:"data"`
+	}
+	rec := ta.requestAsAdmin(testAdminToken, http.MethodGet, "/api/v1/organizations/", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Data, 2)
+	assert.Equal(t, "other-org", body.Data[0].Name)
+	assert.Equal(t, organizationStatusSuspended, body.Data[0].Status)
+	assert.Equal(t, ta.org.Id, body.Data[1].Id)
+	assert.Equal(t, organizationStatusActive, body.Data[1].Status)
+	assert.Equal(t, OrganizationUsage{Namespaces: 1, Schemas: 1, ApiKeys: 1}, body.Data[1].Usage)
+
+	filters := map[string]string{
+		"?q=TEST":           ta.org.Id,
+		"?status=suspended": other.Id,
+		"?limit=1&offset=1": ta.org.Id,
+	}
+	for query, expected := range filters {
+		rec = ta.requestAsAdmin(testAdminToken, http.MethodGet, "/api/v1/organizations/"+query, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		require.Len(t, body.Data, 1, query)
+		assert.Equal(t, expected, body.Data[0].Id, query)
+	}
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodGet, "/api/v1/organizations/?status=gone", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Organization admins cannot see other tenants, super admins from a token can
+	rec = ta.request(http.MethodGet, "/api/v1/organizations/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing permission tenant:read")
+	token := signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), withClaim(validClaims(""), "roles", []string{"platform-admins"}))
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/organizations/", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	token = signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), withClaim(validClaims(""), "roles", []string{"super_admin"}))
+	rec = ta.bearerRequest(http.MethodGet, "/api/v1/organizations/", "Bearer "+token)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "only mapped roles are taken from a token")
+
+	// super_admin is not a role that can be bound within an organization
+	rec = ta.request(http.MethodPost, "/api/v1/rolebindings/", `{"subject": "user:someone", "role": "super_admin"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSuspendedOrganizationsAreBlocked(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{Admin: config.AdminConfig{Token: testAdminToken}})
+	suspension := "/api/v1/organizations/" + ta.org.Id + "/suspension"
+
+	rec := ta.request(http.MethodPut, suspension, `{"reason": "unpaid"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "organizations cannot suspend themselves")
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodPut, suspension, `{"reason": "unpaid"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code, "the revision of the organization is required")
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPut, suspension, `{"reason": "unpaid"}`, `"99"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPut, suspension, `{"reason": "unpaid"}`, "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	var body struct {
+		Data services.Organization `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.NotNil(t, body.Data.Suspension)
+	assert.Equal(t, "unpaid", body.Data.Suspension.Reason)
+	assert.Equal(t, adminActor, body.Data.Suspension.SuspendedBy)
+	assert.WithinDuration(t, time.Now(), body.Data.Suspension.SuspendedAt, time.Minute)
+
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Organization suspended")
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodDelete, suspension, "")
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, suspension, "", etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	events, err := ta.providers.Audit.ListEvents(ta.org.Id, services.AuditFilter{ResourceType: services.AuditResourceSuspension})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPut, "/api/v1/organizations/missing/suspension", `{}`, "*")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSuperAdminsDeleteOrganizations(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{Admin: config.AdminConfig{Token: testAdminToken}})
+	ta.namespace(t, map[string]string{"vm": "vm-{env}"}, nil)
+	orgPath := "/api/v1/organizations/" + ta.org.Id
+
+	rec := ta.request(http.MethodDelete, orgPath, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodDelete, orgPath, "")
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code, "the revision of the organization is required")
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, orgPath, "", `"99"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.NotNil(t, ta.providers.ApiKeys.GetKeyById(ta.key.Id), "keys are kept when the revision does not match")
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, orgPath, "", fmt.Sprintf(`"%d"`, ta.org.Revision))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data services.Organization `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.NotNil(t, body.Data.Deletion)
+	assert.Equal(t, adminActor, body.Data.Deletion.DeletedBy)
+	assert.WithinDuration(t, time.Now().Add(defaultRestoreWindow), body.Data.Deletion.PurgeAfter, time.Minute)
+
+	// Its keys are revoked at once, its data is kept until the purge
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	keys, err := ta.providers.ApiKeys.ListKeys(ta.org.Id)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	namespaces, err := ta.providers.Namespaces.ListNamespaces(ta.org.Id)
+	require.NoError(t, err)
+	assert.Len(t, namespaces, 1)
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodGet, "/api/v1/organizations/?status=deleted", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), ta.org.Id)
+
+	// Deleting it again does not move its purge
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, orgPath, "", "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), body.Data.Deletion.PurgeAfter.Format(time.RFC3339Nano))
+
+	purged, err := services.PurgeDeletedOrganizations(ta.providers, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, purged, "nothing is purged before the restore window ends")
+	purged, err = services.PurgeDeletedOrganizations(ta.providers, body.Data.Deletion.PurgeAfter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ta.org.Id}, purged)
+	assert.False(t, ta.providers.Organizations.ExistsById(ta.org.Id))
+	namespaces, err = ta.providers.Namespaces.ListNamespaces(ta.org.Id)
+	require.NoError(t, err)
+	assert.Empty(t, namespaces)
+
+	events, err := ta.providers.Audit.ListEvents(ta.org.Id, services.AuditFilter{Actor: adminActor})
+	require.NoError(t, err)
+	assert.Len(t, events, 2, "the audit log of the organization and its revoked key outlives it")
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, orgPath, "", "*")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSuperAdminsRestoreOrganizations(t *testing.T) {
+	ta := newTestApiWithConfig(t, &config.Config{
+		Admin:         config.AdminConfig{Token: testAdminToken},
+		Organizations: config.OrganizationsConfig{RestoreWindowSeconds: 60},
+	})
+	orgPath := "/api/v1/organizations/" + ta.org.Id
+
+	rec := ta.requestAsAdminIfMatch(testAdminToken, http.MethodPost, orgPath+"/restore", "", "*")
+	assert.Equal(t, http.StatusConflict, rec.Code, "only a deleted organization can be restored")
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodDelete, orgPath, "", "*")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+
+	rec = ta.requestAsAdmin(testAdminToken, http.MethodPost, orgPath+"/restore", `{"admin_key_name": "recovered"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code, "the revision of the organization is required")
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPost, orgPath+"/restore", `{"admin_key_name": "recovered"}`, fmt.Sprintf(`"%d"`, ta.org.Revision))
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, "the organization changed when it was deleted")
+
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPost, orgPath+"/restore", `{"admin_key_name": "recovered"}`, etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var restored struct {
+		Data NewOrganizationResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &restored))
+	assert.Nil(t, restored.Data.Organization.Deletion)
+	assert.Equal(t, "recovered", restored.Data.ApiKey.Name)
+
+	// The revoked key stays revoked, the new one administers the organization
+	rec = ta.request(http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Api key rejected")
+	rec = ta.requestAs(restored.Data.ApiKey, http.MethodGet, "/api/v1/namespaces/", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Once the restore window has ended it is gone
+	deleted, _, err := services.SoftDeleteOrganization(ta.providers, ta.org.Id, "test", time.Now().Add(-time.Hour), time.Minute, 0)
+	require.NoError(t, err)
+	require.NotNil(t, deleted.Deletion)
+	rec = ta.requestAsAdminIfMatch(testAdminToken, http.MethodPost, orgPath+"/restore", "", "*")
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
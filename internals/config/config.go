@@ -7,10 +7,102 @@ import (
 )
 
 type Config struct {
+	Backend  string `json:"backend"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	DBHost   string `json:"host"`
 	DBName   string `json:"db"`
+	DataFile string `json:"data_file"`
+
+	// SkipMigrations stops the server applying pending migrations at startup
+	SkipMigrations bool `json:"skip_migrations"`
+
+	Mongo       MongoConfig `json:"mongo"`
+	PostgresDSN string      `json:"postgres_dsn"`
+
+	Auth    AuthConfig    `json:"auth"`
+	ApiKeys ApiKeysConfig `json:"api_keys"`
+	Admin   AdminConfig   `json:"admin"`
+
+	Organizations OrganizationsConfig `json:"organizations"`
+}
+
+// MongoConfig holds the connection settings of the mongo backend. When URI is empty the
+// connection string is built from the username, password and host of the top level config.
+type MongoConfig struct {
+	URI              string `json:"uri"`
+	ServerAPIVersion string `json:"server_api_version"`
+	MaxPoolSize      uint64 `json:"max_pool_size"`
+	MinPoolSize      uint64 `json:"min_pool_size"`
+	MaxConnIdleTime  int    `json:"max_conn_idle_seconds"`
+	ConnectTimeout   int    `json:"connect_timeout_seconds"`
+	OperationTimeout int    `json:"operation_timeout_seconds"`
+}
+
+// AuthConfig holds how callers of the API are authenticated
+type AuthConfig struct {
+	JWT  JWTConfig  `json:"jwt"`
+	OIDC OIDCConfig `json:"oidc"`
+}
+
+// JWTConfig sets how bearer tokens signed with a known key are verified. They are rejected
+// when Algorithm is empty. HS256 tokens are checked with Secret; RS256 and ES256 tokens with
+// the PEM encoded public key in PublicKey or read from PublicKeyFile. Issuer and Audience are
+// required to match when set.
+type JWTConfig struct {
+	Algorithm     string `json:"algorithm"`
+	Secret        string `json:"secret"`
+	PublicKey     string `json:"public_key"`
+	PublicKeyFile string `json:"public_key_file"`
+	Issuer        string `json:"issuer"`
+	Audience      string `json:"audience"`
+	LeewaySeconds int    `json:"leeway_seconds"`
+	ClaimsConfig
+}
+
+// OIDCConfig sets how bearer tokens from an OpenID Connect provider are verified. Disabled
+// when Issuer is empty. The signing keys are fetched from JWKSURL, or from the jwks_uri found
+// in the discovery document of the issuer, and kept for JWKSCacheSeconds.
+type OIDCConfig struct {
+	Issuer           string   `json:"issuer"`
+	Audience         string   `json:"audience"`
+	JWKSURL          string   `json:"jwks_url"`
+	Algorithms       []string `json:"algorithms"`
+	JWKSCacheSeconds int      `json:"jwks_cache_seconds"`
+	LeewaySeconds    int      `json:"leeway_seconds"`
+	ClaimsConfig
+}
+
+// ClaimsConfig names the token claims holding the organizations, user and roles of the
+// caller. The organization claim defaults to OrganizationId, the user claim to UserId and
+// the roles claim to roles. RoleMapping maps the roles in the token to Terraxen roles; roles
+// it does not list are ignored, so without it tokens grant no roles.
+type ClaimsConfig struct {
+	OrganizationClaim string            `json:"organization_claim"`
+	UserClaim         string            `json:"user_claim"`
+	RolesClaim        string            `json:"roles_claim"`
+	RoleMapping       map[string]string `json:"role_mapping"`
+}
+
+// ApiKeysConfig holds the settings of API keys. RotationGraceSeconds is how long a rotated key
+// keeps working when the rotation does not say, 24 hours if not set.
+type ApiKeysConfig struct {
+	RotationGraceSeconds int `json:"rotation_grace_seconds"`
+}
+
+// AdminConfig holds the credential of the server administrator, who creates organizations and
+// their first admin key. It is sent in the X-Terraxen-Admin header. The administrator routes
+// are disabled when Token is empty.
+type AdminConfig struct {
+	Token string `json:"token"`
+}
+
+// OrganizationsConfig sets how deleted organizations are handled. RestoreWindowSeconds is how
+// long one can be restored, 30 days if not set. Deleted organizations are purged once their
+// window ends by a job running every PurgeIntervalSeconds, an hour if not set.
+type OrganizationsConfig struct {
+	RestoreWindowSeconds int `json:"restore_window_seconds"`
+	PurgeIntervalSeconds int `json:"purge_interval_seconds"`
 }
 
 func GetConfig(filepath string) *Config {
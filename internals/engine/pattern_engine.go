@@ -5,18 +5,85 @@ import (
 	"strings"
 )
 
+var placeholderPattern = regexp.MustCompile(`{(.*?)}`)
+
 func ResolvePattern(pattern string, attribs map[string]string) (string, error) {
-	var re = regexp.MustCompile(`{(.*?)}`)
+	result, _ := evaluate(pattern, func(name string) (string, bool) {
+		rep, found := attribs[name]
+		return rep, found
+	})
+	return result, nil
+}
+
+// placeholderMatch records a single placeholder found while evaluating a pattern
+type placeholderMatch struct {
+	placeholder string
+	name        string
+	value       string
+	found       bool
+}
 
-	patternVars := re.FindAllString(pattern, -1)
+// evaluate replaces every placeholder in the pattern with the value returned by lookup
+// and reports each distinct placeholder in the order it first appears
+func evaluate(pattern string, lookup func(name string) (string, bool)) (string, []placeholderMatch) {
+	patternVars := placeholderPattern.FindAllString(pattern, -1)
 
 	result := pattern
+	seen := make(map[string]bool)
+	var matches []placeholderMatch
 	for _, ptVar := range patternVars {
-		matches := re.FindStringSubmatch(ptVar)
-		rep, found := attribs[matches[1]]
+		if seen[ptVar] {
+			continue
+		}
+		seen[ptVar] = true
+
+		sub := placeholderPattern.FindStringSubmatch(ptVar)
+		rep, found := lookup(sub[1])
 		if found {
 			result = strings.ReplaceAll(result, ptVar, rep)
 		}
+		matches = append(matches, placeholderMatch{
+			placeholder: ptVar,
+			name:        sub[1],
+			value:       rep,
+			found:       found,
+		})
 	}
-	return result, nil
+	return result, matches
+}
+
+// PatternVariables returns the names of the variables used in a pattern
+func PatternVariables(pattern string) []string {
+	_, matches := evaluate(pattern, func(name string) (string, bool) {
+		return "", false
+	})
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// ReferencedVariables returns the variables referenced by the resource patterns, either
+// directly or through the value of another referenced variable in vars
+func ReferencedVariables(resources map[string]string, vars map[string]string) map[string]bool {
+	referenced := make(map[string]bool)
+	pending := make([]string, 0)
+	for _, pattern := range resources {
+		pending = append(pending, PatternVariables(pattern)...)
+	}
+
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if referenced[name] {
+			continue
+		}
+		referenced[name] = true
+		if value, found := vars[name]; found {
+			pending = append(pending, PatternVariables(value)...)
+		}
+	}
+	return referenced
 }
@@ -28,3 +28,22 @@ func TestResolvePattern(t *testing.T) {
 	}
 
 }
+
+func TestReferencedVariables(t *testing.T) {
+	resources := map[string]string{
+		"storage": "st{prefix}{env}",
+		"vm":      "vm-{env}-{index}",
+	}
+	vars := map[string]string{
+		"prefix": "{company}",
+		"unused": "{other}",
+	}
+
+	referenced := ReferencedVariables(resources, vars)
+	assert.Equal(t, map[string]bool{
+		"prefix":  true,
+		"env":     true,
+		"index":   true,
+		"company": true,
+	}, referenced)
+}
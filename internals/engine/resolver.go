@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SourceOrganization = "organization"
+	SourceNamespace    = "namespace"
+	SourceRequest      = "request"
+	SourceUnresolved   = "unresolved"
+)
+
+// Transform describes a step applied to a variable before it was used in a pattern
+type Transform struct {
+	Name   string `json:"name"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// Segment explains how a single placeholder in a pattern got its value
+type Segment struct {
+	Placeholder string      `json:"placeholder"`
+	Variable    string      `json:"variable"`
+	Value       string      `json:"value"`
+	Source      string      `json:"source"`
+	Transforms  []Transform `json:"transforms"`
+}
+
+// Trace is the explanation of a resolved pattern
+type Trace struct {
+	Pattern  string    `json:"pattern"`
+	Result   string    `json:"result"`
+	Segments []Segment `json:"segments"`
+}
+
+// ErrVariableCycle is returned when variables reference each other in a loop, so that none
+// of them has a value
+type ErrVariableCycle struct {
+	Variables []string
+}
+
+func (e *ErrVariableCycle) Error() string {
+	return fmt.Sprintf("variables reference each other in a cycle: %s", strings.Join(e.Variables, " -> "))
+}
+
+type variable struct {
+	value      string
+	source     string
+	transforms []Transform
+}
+
+// layerValue is the raw value a layer gives a variable
+type layerValue struct {
+	raw    string
+	source string
+}
+
+// layerRef identifies the value a single layer gives a variable, by its index in the layers
+// of that variable
+type layerRef struct {
+	name  string
+	layer int
+}
+
+// Resolver resolves patterns against layers of variables. Layers added later override
+// earlier ones, and the variables referenced by a value are taken from the merged layers, so
+// a parent value referencing a variable picks up the value a child namespace gives it. A
+// value referencing its own variable, such as env: "{env}-x", extends the value of the layer
+// beneath it instead.
+type Resolver struct {
+	layers map[string][]layerValue
+	vars   map[layerRef]*variable
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		layers: make(map[string][]layerValue),
+		vars:   make(map[layerRef]*variable),
+	}
+}
+
+// AddLayer adds the variables from source on top of the existing layers
+func (r *Resolver) AddLayer(source string, vars map[string]string) {
+	for k, raw := range vars {
+		r.layers[k] = append(r.layers[k], layerValue{raw: raw, source: source})
+	}
+	// Values resolved so far may reference the new variables
+	r.vars = make(map[layerRef]*variable)
+}
+
+// Values returns the resolved variables
+func (r *Resolver) Values() (map[string]string, error) {
+	result := make(map[string]string)
+	for k := range r.layers {
+		v, err := r.variable(r.top(k), nil)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = v.value
+	}
+	return result, nil
+}
+
+// Resolve resolves the pattern and explains where each placeholder value came from
+func (r *Resolver) Resolve(pattern string) (string, *Trace, error) {
+	result, matches, used, err := r.substitute(pattern, nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	trace := &Trace{
+		Pattern:  pattern,
+		Result:   result,
+		Segments: make([]Segment, 0, len(matches)),
+	}
+	for i, m := range matches {
+		seg := Segment{
+			Placeholder: m.placeholder,
+			Variable:    m.name,
+			Value:       m.placeholder,
+			Source:      SourceUnresolved,
+			Transforms:  []Transform{},
+		}
+		if m.found {
+			v := used[i]
+			seg.Value = v.value
+			seg.Source = v.source
+			seg.Transforms = append(seg.Transforms, v.transforms...)
+		}
+		trace.Segments = append(trace.Segments, seg)
+	}
+
+	return result, trace, nil
+}
+
+// The top layer of a variable, which is the value it has in the merged variables
+func (r *Resolver) top(name string) layerRef {
+	return layerRef{name: name, layer: len(r.layers[name]) - 1}
+}
+
+// Resolves the value a single layer gives a variable against the merged variables. Only that
+// layer is evaluated, so the values it overrides are not resolved unless it references them.
+func (r *Resolver) variable(ref layerRef, resolving []layerRef) (*variable, error) {
+	if v, found := r.vars[ref]; found {
+		return v, nil
+	}
+	for i, n := range resolving {
+		if n == ref {
+			cycle := make([]string, 0, len(resolving)-i+1)
+			for _, c := range resolving[i:] {
+				cycle = append(cycle, c.name)
+			}
+			return nil, &ErrVariableCycle{Variables: append(cycle, ref.name)}
+		}
+	}
+	resolving = append(resolving, ref)
+
+	layer := r.layers[ref.name][ref.layer]
+	value, transforms, err := r.evaluate(layer.raw, &ref, resolving)
+	if err != nil {
+		return nil, err
+	}
+	if ref.layer > 0 {
+		below := r.layers[ref.name][ref.layer-1]
+		transforms = append(transforms, Transform{
+			Name:   "override:" + below.source,
+			Input:  below.raw,
+			Output: value,
+		})
+	}
+
+	v := &variable{
+		value:      value,
+		source:     layer.source,
+		transforms: transforms,
+	}
+	r.vars[ref] = v
+	return v, nil
+}
+
+// Substitutes the variables referenced by a pattern, returning the variable used for each
+// match. self is the layer the pattern is the value of, if any, and resolving holds the
+// layers whose values are being resolved, to detect a cycle.
+func (r *Resolver) substitute(pattern string, self *layerRef, resolving []layerRef) (string, []placeholderMatch, []*variable, error) {
+	var err error
+	var used []*variable
+	result, matches := evaluate(pattern, func(name string) (string, bool) {
+		if err != nil || r.layers[name] == nil {
+			used = append(used, nil)
+			return "", false
+		}
+		ref := r.top(name)
+		if self != nil && name == self.name {
+			// A value referencing its own variable builds on the layer beneath it. The
+			// bottom layer has nothing beneath it, so the reference is a cycle.
+			ref = *self
+			if self.layer > 0 {
+				ref.layer--
+			}
+		}
+		var v *variable
+		if v, err = r.variable(ref, resolving); err != nil {
+			used = append(used, nil)
+			return "", false
+		}
+		used = append(used, v)
+		return v.value, true
+	})
+	return result, matches, used, err
+}
+
+// Substitutes the variables referenced by the raw value of a layer, returning the transforms applied
+func (r *Resolver) evaluate(raw string, self *layerRef, resolving []layerRef) (string, []Transform, error) {
+	value, _, used, err := r.substitute(raw, self, resolving)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var transforms []Transform
+	for _, v := range used {
+		if v != nil {
+			transforms = append(transforms, v.transforms...)
+		}
+	}
+	if value != raw {
+		transforms = append(transforms, Transform{
+			Name:   "substitute",
+			Input:  raw,
+			Output: value,
+		})
+	}
+	return value, transforms, nil
+}
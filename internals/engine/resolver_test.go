@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLayers(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{
+		"company": "acme",
+		"env":     "dev",
+	})
+	resolver.AddLayer(SourceNamespace, map[string]string{
+		"env":    "prod",
+		"prefix": "{company}-{env}",
+	})
+	resolver.AddLayer(SourceRequest, map[string]string{
+		"region": "uks",
+	})
+
+	result, trace, err := resolver.Resolve("{prefix}-{region}-{missing}")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme-prod-uks-{missing}", result)
+	assert.Equal(t, result, trace.Result)
+	assert.Len(t, trace.Segments, 3)
+
+	prefix := trace.Segments[0]
+	assert.Equal(t, "prefix", prefix.Variable)
+	assert.Equal(t, SourceNamespace, prefix.Source)
+	assert.Equal(t, "acme-prod", prefix.Value)
+	assert.Equal(t, []Transform{
+		{Name: "override:organization", Input: "dev", Output: "prod"},
+		{Name: "substitute", Input: "{company}-{env}", Output: "acme-prod"},
+	}, prefix.Transforms)
+
+	region := trace.Segments[1]
+	assert.Equal(t, SourceRequest, region.Source)
+	assert.Equal(t, "uks", region.Value)
+
+	missing := trace.Segments[2]
+	assert.Equal(t, SourceUnresolved, missing.Source)
+	assert.Equal(t, "{missing}", missing.Value)
+}
+
+func TestResolverOverride(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{"env": "dev"})
+	resolver.AddLayer(SourceNamespace, map[string]string{"env": "prod"})
+
+	result, trace, _ := resolver.Resolve("app-{env}")
+	assert.Equal(t, "app-prod", result)
+	assert.Equal(t, SourceNamespace, trace.Segments[0].Source)
+	assert.Equal(t, []Transform{{Name: "override:organization", Input: "dev", Output: "prod"}}, trace.Segments[0].Transforms)
+}
+
+func TestResolverReferencesMergedVariables(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{"prefix": "{company}-{env}", "env": "dev"})
+	resolver.AddLayer(SourceNamespace, map[string]string{"company": "acme", "env": "prod"})
+
+	result, _, err := resolver.Resolve("{prefix}")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme-prod", result, "a parent value uses the variables set beneath it")
+}
+
+func TestResolverCycle(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{"a": "{b}", "b": "x-{c}", "c": "{a}"})
+
+	_, _, err := resolver.Resolve("{a}")
+	cycle, ok := err.(*ErrVariableCycle)
+	require.True(t, ok, err)
+	assert.Equal(t, []string{"a", "b", "c", "a"}, cycle.Variables)
+
+	_, err = resolver.Values()
+	assert.Error(t, err)
+}
+
+func TestResolverSelfReferenceExtendsLayerBeneath(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{"env": "dev", "company": "acme"})
+	resolver.AddLayer(SourceNamespace, map[string]string{"env": "{env}-x"})
+	resolver.AddLayer(SourceRequest, map[string]string{"env": "{company}-{env}"})
+
+	result, trace, err := resolver.Resolve("{env}")
+	require.NoError(t, err)
+	assert.Equal(t, "acme-dev-x", result)
+	assert.Equal(t, SourceRequest, trace.Segments[0].Source)
+
+	values, err := resolver.Values()
+	require.NoError(t, err)
+	assert.Equal(t, "acme-dev-x", values["env"])
+
+	bottom := NewResolver()
+	bottom.AddLayer(SourceOrganization, map[string]string{"env": "{env}-x"})
+	_, _, err = bottom.Resolve("{env}")
+	cycle, ok := err.(*ErrVariableCycle)
+	require.True(t, ok, err)
+	assert.Equal(t, []string{"env", "env"}, cycle.Variables)
+}
+
+func TestResolverOnlyEvaluatesWinningLayer(t *testing.T) {
+	resolver := NewResolver()
+	resolver.AddLayer(SourceOrganization, map[string]string{"a": "{b}", "b": "{a}"})
+	resolver.AddLayer(SourceNamespace, map[string]string{"a": "fixed"})
+
+	result, _, err := resolver.Resolve("{a}-{b}")
+	require.NoError(t, err, "the cycle is in a value that is overridden")
+	assert.Equal(t, "fixed-fixed", result)
+}
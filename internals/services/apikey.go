@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash/crc32"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApiKeyPrefixLength is the length of the start of a key that is stored, and shown, in the clear
+const ApiKeyPrefixLength = 12
+
+// Keys are txn_, random characters and a checksum of them, so that secret scanners can
+// recognise a leaked key and tell it from random text
+const (
+	apiKeyMarker         = "txn_"
+	apiKeyRandomLength   = 32
+	apiKeyChecksumLength = 6
+	apiKeySaltLength     = 16
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// NewApiKey creates a new API key for an organization, ready to be stored. A zero expiry
+// means the key never expires. The returned key holds the secret, which is never stored:
+// use WithoutSecret for the record to store.
+func NewApiKey(orgId string, name string, expires time.Time, scope map[string]string) *ApiKey {
+	ak := &ApiKey{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		Key:            generateApiKey(),
+		Expires:        expires,
+		Scope:          copyScope(scope),
+	}
+	ak.hashKey()
+	return ak
+}
+
+// RotateApiKey returns a new key replacing ak, with its name and scope and the given expiry,
+// and sets ak to be replaced by it. ak keeps working until the end of the grace period, or
+// its own expiry if that is sooner, so that callers can move to the new key.
+func RotateApiKey(ak *ApiKey, expires time.Time, graceEnd time.Time) *ApiKey {
+	successor := NewApiKey(ak.OrganizationId, ak.Name, expires, ak.Scope)
+	successor.RotatedFrom = ak.Id
+
+	ak.ReplacedBy = successor.Id
+	if ak.Expires.IsZero() || graceEnd.Before(ak.Expires) {
+		ak.Expires = graceEnd
+	}
+	return successor
+}
+
+// Expired reports whether the key can no longer be used at the time
+func (ak *ApiKey) Expired(now time.Time) bool {
+	return !ak.Expires.IsZero() && !now.Before(ak.Expires)
+}
+
+// ApiKeyChecksumValid reports whether a key in the current format has a valid checksum, so
+// that mistyped or made up keys are rejected without being looked up. Keys created before the
+// format had a checksum are not checked.
+func ApiKeyChecksumValid(key string) bool {
+	if !strings.HasPrefix(key, apiKeyMarker) {
+		return true
+	}
+	body := strings.TrimPrefix(key, apiKeyMarker)
+	if len(body) != apiKeyRandomLength+apiKeyChecksumLength {
+		return false
+	}
+	random, checksum := body[:apiKeyRandomLength], body[apiKeyRandomLength:]
+	return subtle.ConstantTimeCompare([]byte(apiKeyChecksum(random)), []byte(checksum)) == 1
+}
+
+// Returns a new key from crypto/rand. Like uuid.NewString, panics if the system cannot
+// provide random bytes.
+func generateApiKey() string {
+	random := make([]byte, 0, apiKeyRandomLength)
+	buf := make([]byte, apiKeyRandomLength)
+	for len(random) < apiKeyRandomLength {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			// Bytes past the largest multiple of the alphabet size would bias the key
+			if int(b) < 256/len(base62Alphabet)*len(base62Alphabet) && len(random) < apiKeyRandomLength {
+				random = append(random, base62Alphabet[int(b)%len(base62Alphabet)])
+			}
+		}
+	}
+	return apiKeyMarker + string(random) + apiKeyChecksum(string(random))
+}
+
+// The CRC32 of the random part of a key in base62, padded to a fixed length
+func apiKeyChecksum(random string) string {
+	sum := uint64(crc32.ChecksumIEEE([]byte(random)))
+	encoded := make([]byte, apiKeyChecksumLength)
+	for i := apiKeyChecksumLength - 1; i >= 0; i-- {
+		encoded[i] = base62Alphabet[sum%uint64(len(base62Alphabet))]
+		sum /= uint64(len(base62Alphabet))
+	}
+	return string(encoded)
+}
+
+// ApiKeyPrefix returns the prefix of a key, by which stores find it
+func ApiKeyPrefix(key string) string {
+	if len(key) < ApiKeyPrefixLength {
+		return key
+	}
+	return key[:ApiKeyPrefixLength]
+}
+
+// Sets the prefix, salt and hash from the secret key. Like uuid.NewString, panics if the
+// system cannot provide random bytes.
+func (ak *ApiKey) hashKey() {
+	salt := make([]byte, apiKeySaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	ak.Prefix = ApiKeyPrefix(ak.Key)
+	ak.Salt = hex.EncodeToString(salt)
+	ak.Hash = hashApiKey(ak.Salt, ak.Key)
+}
+
+// HashPlaintextKey replaces the secret of a key stored before keys were hashed by its prefix
+// and hash. Returns false if the key was already hashed.
+func (ak *ApiKey) HashPlaintextKey() bool {
+	if ak.Key == "" || ak.Hash != "" {
+		return false
+	}
+	ak.hashKey()
+	ak.Key = ""
+	return true
+}
+
+// WithoutSecret returns a copy of the key without its secret, as it is stored
+func (ak *ApiKey) WithoutSecret() *ApiKey {
+	c := *ak
+	c.Key = ""
+	c.Scope = copyScope(ak.Scope)
+	return &c
+}
+
+// Matches reports, in constant time, whether key is the secret of the API key
+func (ak *ApiKey) Matches(key string) bool {
+	if ak.Hash == "" || ak.Prefix != ApiKeyPrefix(key) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashApiKey(ak.Salt, key)), []byte(ak.Hash)) == 1
+}
+
+// The hash of a key is the hex SHA-256 of its salt followed by the key. The postgres migration
+// hashing existing keys computes it the same way.
+func hashApiKey(salt string, key string) string {
+	sum := sha256.Sum256([]byte(salt + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func copyScope(scope map[string]string) map[string]string {
+	c := make(map[string]string, len(scope))
+	for k, v := range scope {
+		c[k] = v
+	}
+	return c
+}
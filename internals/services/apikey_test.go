@@ -0,0 +1,36 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewApiKeysAreRandomWithChecksum(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		ak := NewApiKey("org", "ci", time.Time{}, nil)
+		assert.False(t, seen[ak.Key], "keys are unique")
+		seen[ak.Key] = true
+
+		assert.Regexp(t, `^txn_[0-9A-Za-z]{38}$`, ak.Key)
+		assert.True(t, ApiKeyChecksumValid(ak.Key))
+		assert.True(t, ak.Matches(ak.Key))
+	}
+
+	ak := NewApiKey("org", "ci", time.Time{}, nil)
+	random := strings.TrimPrefix(ak.Key, apiKeyMarker)
+	changed := apiKeyMarker + string(random[0]^1) + random[1:]
+	assert.False(t, ApiKeyChecksumValid(changed), "a mistyped key fails the checksum")
+	assert.False(t, ApiKeyChecksumValid(ak.Key[:len(ak.Key)-1]))
+	assert.True(t, ApiKeyChecksumValid("API-0123456789ABCDEFGHIJ"), "keys from before checksums are not checked")
+}
+
+func TestApiKeyExpiry(t *testing.T) {
+	now := time.Now()
+	assert.False(t, NewApiKey("org", "", time.Time{}, nil).Expired(now), "a zero expiry never expires")
+	assert.False(t, NewApiKey("org", "", now.Add(time.Minute), nil).Expired(now))
+	assert.True(t, NewApiKey("org", "", now, nil).Expired(now))
+}
@@ -2,21 +2,49 @@ package services
 
 import "time"
 
+// ApiKey authenticates requests for an organization. The secret key is only known when the
+// key is created; stores keep its prefix, to find it again, and a salted hash to verify it.
 type ApiKey struct {
 	Id             string            `json:"id"`
 	OrganizationId string            `json:"organization_id"`
 	Name           string            `json:"name"`
-	Key            string            `json:"key"`
+	Key            string            `json:"key,omitempty"`
+	Prefix         string            `json:"prefix"`
+	Salt           string            `json:"salt,omitempty"`
+	Hash           string            `json:"hash,omitempty"`
 	Expires        time.Time         `json:"expires"`
 	Scope          map[string]string `json:"scope"`
+	// A rotated key names the key replacing it, which names the key it replaced
+	ReplacedBy  string    `json:"replaced_by,omitempty"`
+	RotatedFrom string    `json:"rotated_from,omitempty"`
+	LastUsedAt  time.Time `json:"last_used_at"`
 }
 
 type Namespace struct {
 	Id             string
 	Name           string
 	OrganizationId string
+	ParentId       string
 	SchemaId       string
 	SchemaVersion  string
+	Lock           *NamespaceLock
+	Revision       int
+}
+
+type NamespaceLock struct {
+	LockedBy string    `json:"locked_by"`
+	Reason   string    `json:"reason"`
+	LockedAt time.Time `json:"locked_at"`
+	Expires  time.Time `json:"expires"`
+}
+
+type NamespaceTemplate struct {
+	Id             string            `json:"id"`
+	OrganizationId string            `json:"organization_id"`
+	Name           string            `json:"name"`
+	SchemaId       string            `json:"schema_id"`
+	SchemaVersion  string            `json:"schema_version"`
+	Variables      map[string]string `json:"variables"`
 }
 
 type NamespaceVar struct {
@@ -27,9 +55,36 @@ type NamespaceVar struct {
 }
 
 type Organization struct {
-	Id      string            `json:"id"`
-	Name    string            `json:"name"`
-	OrgVars map[string]string `json:"vars"`
+	Id            string            `json:"id"`
+	Name          string            `json:"name"`
+	OrgVars       map[string]string `json:"vars"`
+	FreezeWindows []FreezeWindow    `json:"freeze_windows"`
+	// Suspension is set while the organization is suspended, blocking its keys and users
+	Suspension *OrganizationSuspension `json:"suspension,omitempty"`
+	// Deletion is set once the organization is deleted, until it is restored or purged
+	Deletion *OrganizationDeletion `json:"deletion,omitempty"`
+	Revision int                   `json:"revision"`
+}
+
+type OrganizationSuspension struct {
+	SuspendedBy string    `json:"suspended_by"`
+	Reason      string    `json:"reason"`
+	SuspendedAt time.Time `json:"suspended_at"`
+}
+
+// OrganizationDeletion records when an organization was deleted. It can be restored until
+// PurgeAfter, when it and everything it owns are removed for good.
+type OrganizationDeletion struct {
+	DeletedBy  string    `json:"deleted_by"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+type FreezeWindow struct {
+	Name   string    `json:"name"`
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
 }
 
 type OrganizationVar struct {
@@ -43,6 +98,7 @@ type Schema struct {
 	Id             string
 	OrganizationId string
 	Name           string
+	Revision       int
 }
 
 type SchemaVersion struct {
@@ -50,4 +106,5 @@ type SchemaVersion struct {
 	Published bool              `json:"published"`
 	SchemaId  string            `json:"schema_id"`
 	Resources map[string]string `json:"resources"`
+	Revision  int               `json:"revision"`
 }
@@ -0,0 +1,131 @@
+package backends
+
+import (
+	"fmt"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/boltbackend"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/memorybackend"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/mongobackend"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/postgresbackend"
+)
+
+const (
+	BackendMongo    = "mongo"
+	BackendMemory   = "memory"
+	BackendBolt     = "bolt"
+	BackendPostgres = "postgres"
+)
+
+// New creates the services of the storage backend selected in the config and applies its
+// pending migrations. With skip_migrations set it refuses to start while any are pending.
+func New(cfg *config.Config) (*services.Providers, error) {
+	providers, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SkipMigrations {
+		var pending []services.Migration
+		pending, err = services.PendingMigrations(providers.Migrator)
+		if err == nil && len(pending) > 0 {
+			err = fmt.Errorf("%d database migrations are pending, apply them with the migrate command", len(pending))
+		}
+	} else {
+		_, err = services.RunMigrations(providers.Migrator, false)
+	}
+	if err != nil {
+		providers.Close()
+		return nil, err
+	}
+	return providers, nil
+}
+
+// Open creates the services of the storage backend selected in the config without applying
+// migrations. MongoDB is used when none is set.
+func Open(cfg *config.Config) (*services.Providers, error) {
+	switch cfg.Backend {
+	case "", BackendMongo:
+		db, err := mongobackend.Open(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewMongo(db), nil
+	case BackendMemory:
+		return NewMemory(), nil
+	case BackendBolt:
+		db, err := boltbackend.Open(cfg.DataFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewBolt(db), nil
+	case BackendPostgres:
+		db, err := postgresbackend.Open(cfg.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgres(db), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+	}
+}
+
+// NewMongo creates the services of the MongoDB backend sharing the client in db
+func NewMongo(db *mongobackend.DB) *services.Providers {
+	return &services.Providers{
+		ApiKeys:       mongobackend.NewApiKeyService(db),
+		Namespaces:    mongobackend.NewNamespaceService(db),
+		Organizations: mongobackend.NewOrganizationService(db),
+		Schemas:       mongobackend.NewSchemaService(db),
+		Audit:         mongobackend.NewAuditService(db),
+		History:       mongobackend.NewVariableHistoryService(db),
+		RoleBindings:  mongobackend.NewRoleBindingService(db),
+		Migrator:      db,
+		Closer:        db,
+	}
+}
+
+// NewMemory creates the services of a new, empty in-memory backend
+func NewMemory() *services.Providers {
+	store := memorybackend.NewStore()
+	return &services.Providers{
+		ApiKeys:       memorybackend.NewApiKeyService(store),
+		Namespaces:    memorybackend.NewNamespaceService(store),
+		Organizations: memorybackend.NewOrganizationService(store),
+		Schemas:       memorybackend.NewSchemaService(store),
+		Audit:         memorybackend.NewAuditService(store),
+		History:       memorybackend.NewVariableHistoryService(store),
+		RoleBindings:  memorybackend.NewRoleBindingService(store),
+	}
+}
+
+// NewBolt creates the services of the embedded backend stored in db
+func NewBolt(db *boltbackend.DB) *services.Providers {
+	return &services.Providers{
+		ApiKeys:       boltbackend.NewApiKeyService(db),
+		Namespaces:    boltbackend.NewNamespaceService(db),
+		Organizations: boltbackend.NewOrganizationService(db),
+		Schemas:       boltbackend.NewSchemaService(db),
+		Audit:         boltbackend.NewAuditService(db),
+		History:       boltbackend.NewVariableHistoryService(db),
+		RoleBindings:  boltbackend.NewRoleBindingService(db),
+		Migrator:      db,
+		Closer:        db,
+	}
+}
+
+// NewPostgres creates the services of the PostgreSQL backend connected to db
+func NewPostgres(db *postgresbackend.DB) *services.Providers {
+	return &services.Providers{
+		ApiKeys:       postgresbackend.NewApiKeyService(db),
+		Namespaces:    postgresbackend.NewNamespaceService(db),
+		Organizations: postgresbackend.NewOrganizationService(db),
+		Schemas:       postgresbackend.NewSchemaService(db),
+		Audit:         postgresbackend.NewAuditService(db),
+		History:       postgresbackend.NewVariableHistoryService(db),
+		RoleBindings:  postgresbackend.NewRoleBindingService(db),
+		Migrator:      db,
+		Closer:        db,
+	}
+}
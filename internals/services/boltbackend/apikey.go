@@ -0,0 +1,139 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	bolt "go.etcd.io/bbolt"
+)
+
+type ApiKeyService struct {
+	db *DB
+}
+
+func NewApiKeyService(db *DB) *ApiKeyService {
+	return &ApiKeyService{
+		db: db,
+	}
+}
+
+func listApiKeys(tx *bolt.Tx, match func(ak *services.ApiKey) bool) ([]*services.ApiKey, error) {
+	var result []*services.ApiKey
+	err := forEachJSON(tx.Bucket(apiKeysBucket), "", func(raw []byte) error {
+		var ak services.ApiKey
+		if err := json.Unmarshal(raw, &ak); err != nil {
+			return err
+		}
+		if match(&ak) {
+			result = append(result, &ak)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (akSvc *ApiKeyService) GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*services.ApiKey, error) {
+	ak := services.NewApiKey(orgId, name, expires, scope)
+
+	err := akSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(apiKeysBucket), ak.Id, ak.WithoutSecret())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ak, nil
+}
+
+func (akSvc *ApiKeyService) ListKeys(orgId string) ([]*services.ApiKey, error) {
+	var result []*services.ApiKey
+	err := akSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = listApiKeys(tx, func(ak *services.ApiKey) bool {
+			return ak.OrganizationId == orgId
+		})
+		return err
+	})
+	return result, err
+}
+
+func (akSvc *ApiKeyService) GetKey(key string) *services.ApiKey {
+	var result []*services.ApiKey
+	akSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = listApiKeys(tx, func(ak *services.ApiKey) bool {
+			return ak.Matches(key)
+		})
+		return err
+	})
+	if len(result) == 0 {
+		return nil
+	}
+	return result[0]
+}
+
+func (akSvc *ApiKeyService) GetKeyById(apiId string) *services.ApiKey {
+	var ak services.ApiKey
+	var found bool
+	err := akSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = getJSON(tx.Bucket(apiKeysBucket), apiId, &ak)
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to get api key: %v", err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	return &ak
+}
+
+func (akSvc *ApiKeyService) RotateKey(rotated *services.ApiKey, successor *services.ApiKey) error {
+	return akSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiKeysBucket)
+		var current services.ApiKey
+		found, err := getJSON(b, rotated.Id, &current)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return services.ErrApiKeyNotFound
+		}
+		if current.ReplacedBy != "" {
+			return services.ErrApiKeyRotated
+		}
+		if err := putJSON(b, rotated.Id, rotated.WithoutSecret()); err != nil {
+			return err
+		}
+		return putJSON(b, successor.Id, successor.WithoutSecret())
+	})
+}
+
+func (akSvc *ApiKeyService) SetKeyLastUsed(apiId string, at time.Time) error {
+	return akSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiKeysBucket)
+		var ak services.ApiKey
+		found, err := getJSON(b, apiId, &ak)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return services.ErrApiKeyNotFound
+		}
+		ak.LastUsedAt = at
+		return putJSON(b, apiId, &ak)
+	})
+}
+
+func (akSvc *ApiKeyService) DeleteKey(apiId string) error {
+	return akSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiKeysBucket)
+		if b.Get([]byte(apiId)) == nil {
+			return services.ErrApiKeyNotFound
+		}
+		return b.Delete([]byte(apiId))
+	})
+}
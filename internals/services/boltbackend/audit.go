@@ -0,0 +1,56 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	bolt "go.etcd.io/bbolt"
+)
+
+type AuditService struct {
+	db *DB
+}
+
+func NewAuditService(db *DB) *AuditService {
+	return &AuditService{
+		db: db,
+	}
+}
+
+// Events are keyed by organization and zero padded time so a cursor visits an
+// organization's events in the order they happened
+func auditKey(event *services.AuditEvent) string {
+	return fmt.Sprintf("%s/%020d/%s", event.OrganizationId, event.Time.UnixNano(), event.Id)
+}
+
+func (aSvc *AuditService) RecordEvent(event *services.AuditEvent) error {
+	return aSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(auditBucket), auditKey(event), event)
+	})
+}
+
+func (aSvc *AuditService) ListEvents(orgId string, filter services.AuditFilter) ([]*services.AuditEvent, error) {
+	var matched []*services.AuditEvent
+	err := aSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(auditBucket), orgId+"/", func(raw []byte) error {
+			var event services.AuditEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				return err
+			}
+			if filter.Matches(&event) {
+				matched = append(matched, &event)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*services.AuditEvent, 0, len(matched))
+	for i := len(matched) - 1; i >= 0; i-- {
+		result = append(result, matched[i])
+	}
+	return filter.Page(result), nil
+}
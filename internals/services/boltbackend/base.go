@@ -0,0 +1,160 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	migrationsBucket     = []byte("migrations")
+	organizationsBucket  = []byte("organizations")
+	templatesBucket      = []byte("namespacetemplates")
+	namespacesBucket     = []byte("namespaces")
+	namespaceVarsBucket  = []byte("namespacevars")
+	schemasBucket        = []byte("schemas")
+	schemaVersionsBucket = []byte("schemaversions")
+	apiKeysBucket        = []byte("api_keys")
+	auditBucket          = []byte("audit")
+	historyBucket        = []byte("variablehistory")
+	roleBindingsBucket   = []byte("rolebindings")
+)
+
+// DB is an embedded, file based store shared by the services of the bolt backend
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Open opens or creates the database file at path. Pending migrations are not applied.
+func Open(path string) (*DB, error) {
+	boltDb, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	db := &DB{
+		bolt: boltDb,
+	}
+	err = db.bolt.Update(db.initMigrations)
+	if err != nil {
+		boltDb.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// Backup writes a consistent copy of the database to w
+func (db *DB) Backup(w io.Writer) (int64, error) {
+	var size int64
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		size, err = tx.WriteTo(w)
+		return err
+	})
+	return size, err
+}
+
+// BackupFile writes a consistent copy of the database to a new file at path
+func (db *DB) BackupFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Backup(f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func getJSON(b *bolt.Bucket, key string, v interface{}) (bool, error) {
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), raw)
+}
+
+// forEachJSON calls fn with the raw value of every key in the bucket starting with prefix
+func forEachJSON(b *bolt.Bucket, prefix string, fn func(raw []byte) error) error {
+	c := b.Cursor()
+	p := []byte(prefix)
+	for k, v := c.Seek(p); k != nil && hasPrefix(k, p); k, v = c.Next() {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// owner holds the organization of a stored value. Values of types with JSON tags keep it in
+// organization_id, the others in OrganizationId.
+type owner struct {
+	Tagged   string `json:"organization_id"`
+	Untagged string `json:"OrganizationId"`
+}
+
+// deleteOwned removes every value in the bucket that belongs to the organization and returns
+// their keys
+func deleteOwned(b *bolt.Bucket, orgId string) ([]string, error) {
+	var keys []string
+	err := b.ForEach(func(k []byte, v []byte) error {
+		var o owner
+		if err := json.Unmarshal(v, &o); err != nil {
+			return err
+		}
+		if o.Tagged == orgId || o.Untagged == orgId {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, deleteKeys(b, keys)
+}
+
+// deletePrefix removes every key in the bucket starting with prefix
+func deletePrefix(b *bolt.Bucket, prefix string) error {
+	var keys []string
+	c := b.Cursor()
+	p := []byte(prefix)
+	for k, _ := c.Seek(p); k != nil && hasPrefix(k, p); k, _ = c.Next() {
+		keys = append(keys, string(k))
+	}
+	return deleteKeys(b, keys)
+}
+
+// Keys are collected before they are deleted as a bucket must not change while a cursor is
+// iterating over it
+func deleteKeys(b *bolt.Bucket, keys []string) error {
+	for _, k := range keys {
+		if err := b.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasPrefix(key []byte, prefix []byte) bool {
+	return len(key) >= len(prefix) && string(key[:len(prefix)]) == string(prefix)
+}
@@ -0,0 +1,169 @@
+package boltbackend
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/servicestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestDB opens the database at path with all migrations applied
+func openTestDB(t *testing.T, path string) *DB {
+	db, err := Open(path)
+	require.NoError(t, err)
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+	return db
+}
+
+func TestBackupAndReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openTestDB(t, filepath.Join(dir, "terraxen.db"))
+
+	orgSvc := NewOrganizationService(db)
+	org, err := orgSvc.NewOrganization("acme")
+	require.NoError(t, err)
+
+	schema, err := NewSchemaService(db).CreateSchema(org.Id, "vm")
+	require.NoError(t, err)
+
+	nsSvc := NewNamespaceService(db)
+	ns, err := nsSvc.CreateNamespace(org.Id, "prod", "", schema.Id, "1", map[string]string{"env": "prod"})
+	require.NoError(t, err)
+
+	backupFile := filepath.Join(dir, "backup.db")
+	require.NoError(t, db.BackupFile(backupFile))
+	require.NoError(t, db.Close())
+
+	restored, err := Open(backupFile)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	restoredOrg, err := NewOrganizationService(restored).GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", restoredOrg.Name)
+
+	vars, err := NewNamespaceService(restored).GetVariablesAsMap(org.Id, ns.Id)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, vars)
+}
+
+func TestMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraxen.db")
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	pending, err := services.RunMigrations(db, true)
+	require.NoError(t, err)
+	assert.Equal(t, db.Migrations(), pending)
+	pending, err = services.PendingMigrations(db)
+	require.NoError(t, err)
+	assert.Equal(t, db.Migrations(), pending, "a dry run applies nothing")
+
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	pending, err = services.PendingMigrations(db)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	applied, err := db.AppliedMigrations()
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations))
+	assert.Equal(t, 1, applied[0].Version)
+	assert.False(t, applied[0].AppliedAt.IsZero())
+}
+
+func TestProviders(t *testing.T) {
+	servicestest.RunProvidersSuite(t, func(t *testing.T) *services.Providers {
+		db := openTestDB(t, filepath.Join(t.TempDir(), "terraxen.db"))
+		t.Cleanup(func() { db.Close() })
+
+		return &services.Providers{
+			ApiKeys:       NewApiKeyService(db),
+			Namespaces:    NewNamespaceService(db),
+			Organizations: NewOrganizationService(db),
+			Schemas:       NewSchemaService(db),
+			Audit:         NewAuditService(db),
+			History:       NewVariableHistoryService(db),
+			RoleBindings:  NewRoleBindingService(db),
+			Migrator:      db,
+			Closer:        db,
+		}
+	})
+}
+
+func TestInitialRevisionsAreSet(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "terraxen.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.ApplyMigration(1))
+
+	// An organization written before revisions were tracked
+	require.NoError(t, db.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(organizationsBucket).Put([]byte("org"), []byte(`{"id":"org","name":"acme"}`))
+	}))
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+
+	org, err := NewOrganizationService(db).GetOrganizationById("org")
+	require.NoError(t, err)
+	assert.Equal(t, 1, org.Revision)
+	_, err = NewOrganizationService(db).UpdateOrganization("org", "acme", nil, 1)
+	assert.NoError(t, err)
+}
+
+func TestExistingApiKeysBecomeOrganizationAdmins(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "terraxen.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	for version := 1; version <= 4; version++ {
+		require.NoError(t, db.ApplyMigration(version))
+	}
+
+	ak, err := NewApiKeyService(db).GenerateNewApiKey("org", "", time.Time{}, nil)
+	require.NoError(t, err)
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+
+	bindings, err := NewRoleBindingService(db).ListSubjectRoleBindings("org", services.ApiKeySubject(ak.Id))
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, services.RoleOrgAdmin, bindings[0].Role)
+	assert.Equal(t, services.RoleBindingResourceOrganization, bindings[0].ResourceType)
+}
+
+func TestExistingApiKeysAreHashed(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "terraxen.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	for version := 1; version <= 5; version++ {
+		require.NoError(t, db.ApplyMigration(version))
+	}
+
+	legacy := &services.ApiKey{Id: "legacy", OrganizationId: "org", Key: "API-0123456789ABCDEFGHIJ", Expires: time.Now().Add(-time.Hour)}
+	require.NoError(t, db.bolt.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(apiKeysBucket), legacy.Id, legacy)
+	}))
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+
+	require.NoError(t, db.bolt.View(func(tx *bolt.Tx) error {
+		assert.NotContains(t, string(tx.Bucket(apiKeysBucket).Get([]byte(legacy.Id))), legacy.Key)
+		return nil
+	}))
+	found := NewApiKeyService(db).GetKey(legacy.Key)
+	require.NotNil(t, found)
+	assert.Equal(t, legacy.Id, found.Id)
+	assert.Equal(t, "API-01234567", found.Prefix)
+	assert.True(t, found.Expires.IsZero(), "the expiry that was never checked is cleared")
+}
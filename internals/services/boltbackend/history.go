@@ -0,0 +1,88 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	bolt "go.etcd.io/bbolt"
+)
+
+type VariableHistoryService struct {
+	db *DB
+}
+
+func NewVariableHistoryService(db *DB) *VariableHistoryService {
+	return &VariableHistoryService{
+		db: db,
+	}
+}
+
+// Snapshots of an organization or namespace share a key prefix. Organization snapshots have
+// an empty namespace ID, which no namespace has.
+func snapshotPrefix(orgId string, nsId string) string {
+	return orgId + "/" + nsId + "/"
+}
+
+// Snapshots are keyed by zero padded time and then the order they were recorded, so a cursor
+// visits them oldest first
+func snapshotKey(snapshot *services.VariableSnapshot, seq uint64) string {
+	return fmt.Sprintf("%s%020d/%020d", snapshotPrefix(snapshot.OrganizationId, snapshot.NamespaceId), snapshot.Time.UnixNano(), seq)
+}
+
+func (hSvc *VariableHistoryService) RecordSnapshot(snapshot *services.VariableSnapshot) error {
+	return hSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putJSON(b, snapshotKey(snapshot, seq), snapshot)
+	})
+}
+
+// listSnapshots returns the snapshots of the organization or namespace, oldest first
+func (hSvc *VariableHistoryService) listSnapshots(orgId string, nsId string) ([]*services.VariableSnapshot, error) {
+	var result []*services.VariableSnapshot
+	err := hSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(historyBucket), snapshotPrefix(orgId, nsId), func(raw []byte) error {
+			var snapshot services.VariableSnapshot
+			if err := json.Unmarshal(raw, &snapshot); err != nil {
+				return err
+			}
+			result = append(result, &snapshot)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (hSvc *VariableHistoryService) ListSnapshots(orgId string, nsId string) ([]*services.VariableSnapshot, error) {
+	snapshots, err := hSvc.listSnapshots(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*services.VariableSnapshot, 0, len(snapshots))
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		result = append(result, snapshots[i])
+	}
+	return result, nil
+}
+
+func (hSvc *VariableHistoryService) SnapshotAt(orgId string, nsId string, at time.Time) (*services.VariableSnapshot, error) {
+	snapshots, err := hSvc.listSnapshots(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *services.VariableSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Time.After(at) {
+			break
+		}
+		result = snapshot
+	}
+	return result, nil
+}
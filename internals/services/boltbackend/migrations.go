@@ -0,0 +1,224 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	bolt "go.etcd.io/bbolt"
+)
+
+// migration changes the stored data inside the write transaction that records it
+type migration struct {
+	services.Migration
+	apply func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order of version. Versions are never reused or reordered.
+var migrations = []migration{
+	{
+		Migration: services.Migration{Version: 1, Description: "create buckets"},
+		apply: func(tx *bolt.Tx) error {
+			buckets := [][]byte{
+				organizationsBucket,
+				templatesBucket,
+				namespacesBucket,
+				namespaceVarsBucket,
+				schemasBucket,
+				schemaVersionsBucket,
+				apiKeysBucket,
+			}
+			for _, name := range buckets {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: services.Migration{Version: 2, Description: "set initial revisions"},
+		apply: func(tx *bolt.Tx) error {
+			// Records are stored as the JSON of the services types, whose revision fields differ in case
+			records := []struct {
+				bucket []byte
+				field  string
+			}{
+				{organizationsBucket, "revision"},
+				{namespacesBucket, "Revision"},
+				{schemasBucket, "Revision"},
+				{schemaVersionsBucket, "revision"},
+			}
+			for _, r := range records {
+				if err := setInitialRevision(tx.Bucket(r.bucket), r.field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: services.Migration{Version: 3, Description: "create audit bucket"},
+		apply: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(auditBucket)
+			return err
+		},
+	},
+	{
+		Migration: services.Migration{Version: 4, Description: "create variable history bucket"},
+		apply: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(historyBucket)
+			return err
+		},
+	},
+	{
+		Migration: services.Migration{Version: 5, Description: "create role bindings and make existing API keys organization admins"},
+		apply: func(tx *bolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists(roleBindingsBucket); err != nil {
+				return err
+			}
+			keys, err := listApiKeys(tx, func(ak *services.ApiKey) bool {
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			for _, ak := range keys {
+				if err := putRoleBinding(tx, services.LegacyApiKeyRoleBinding(ak)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: services.Migration{Version: 6, Description: "hash API keys"},
+		apply: func(tx *bolt.Tx) error {
+			keys, err := listApiKeys(tx, func(ak *services.ApiKey) bool {
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			for _, ak := range keys {
+				if !ak.HashPlaintextKey() {
+					continue
+				}
+				if err := putJSON(tx.Bucket(apiKeysBucket), ak.Id, ak); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Keys used to be given an expiry an hour after they were created that was never
+		// checked. Now that it is, existing keys keep working until they are deleted.
+		Migration: services.Migration{Version: 7, Description: "make existing API keys non-expiring"},
+		apply: func(tx *bolt.Tx) error {
+			keys, err := listApiKeys(tx, func(ak *services.ApiKey) bool {
+				return !ak.Expires.IsZero()
+			})
+			if err != nil {
+				return err
+			}
+			for _, ak := range keys {
+				ak.Expires = time.Time{}
+				if err := putJSON(tx.Bucket(apiKeysBucket), ak.Id, ak); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// setInitialRevision sets revision 1 on the records in b that have no revision field
+func setInitialRevision(b *bolt.Bucket, field string) error {
+	updates := map[string][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		var record map[string]interface{}
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		if _, found := record[field]; found {
+			return nil
+		}
+		record[field] = 1
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = raw
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keys cannot be written while iterating over the bucket
+	for k, raw := range updates {
+		if err := b.Put([]byte(k), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Applied migrations are keyed by zero padded version so a cursor visits them in order
+func migrationKey(version int) string {
+	return fmt.Sprintf("%010d", version)
+}
+
+// initMigrations creates the bucket that records migrations
+func (db *DB) initMigrations(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(migrationsBucket)
+	return err
+}
+
+// Migrations returns the migrations of the bolt backend
+func (db *DB) Migrations() []services.Migration {
+	result := make([]services.Migration, len(migrations))
+	for i, m := range migrations {
+		result[i] = m.Migration
+	}
+	return result
+}
+
+// AppliedMigrations returns the migrations recorded in the database
+func (db *DB) AppliedMigrations() ([]services.AppliedMigration, error) {
+	result := []services.AppliedMigration{}
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(migrationsBucket), "", func(raw []byte) error {
+			var record services.AppliedMigration
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return err
+			}
+			result = append(result, record)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// ApplyMigration runs the migration and records it in the same transaction
+func (db *DB) ApplyMigration(version int) error {
+	for _, m := range migrations {
+		if m.Version != version {
+			continue
+		}
+		return db.bolt.Update(func(tx *bolt.Tx) error {
+			applied := tx.Bucket(migrationsBucket)
+			if applied.Get([]byte(migrationKey(version))) != nil {
+				return nil
+			}
+			if err := m.apply(tx); err != nil {
+				return err
+			}
+			record := services.AppliedMigration{Migration: m.Migration, AppliedAt: time.Now().UTC()}
+			return putJSON(applied, migrationKey(version), record)
+		})
+	}
+	return fmt.Errorf("unknown migration %d", version)
+}
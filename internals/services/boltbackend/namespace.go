@@ -0,0 +1,505 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type NamespaceService struct {
+	db *DB
+}
+
+func NewNamespaceService(db *DB) *NamespaceService {
+	return &NamespaceService{
+		db: db,
+	}
+}
+
+func namespaceVarKey(nsId string, key string) string {
+	return nsId + "/" + key
+}
+
+func getNamespace(tx *bolt.Tx, orgId string, nsId string) (*services.Namespace, error) {
+	var ns services.Namespace
+	found, err := getJSON(tx.Bucket(namespacesBucket), nsId, &ns)
+	if err != nil {
+		return nil, err
+	}
+	if !found || ns.OrganizationId != orgId {
+		return nil, services.ErrNamespaceNotFound
+	}
+	return &ns, nil
+}
+
+func namespaceGetter(tx *bolt.Tx) services.NamespaceGetter {
+	return func(orgId string, nsId string) (*services.Namespace, error) {
+		return getNamespace(tx, orgId, nsId)
+	}
+}
+
+func schemaVersionGetter(tx *bolt.Tx) services.SchemaVersionGetter {
+	return func(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+		return getSchemaVersion(tx, orgId, schemaId, schemaVersionId)
+	}
+}
+
+func listNamespaces(tx *bolt.Tx, match func(ns *services.Namespace) bool) ([]*services.Namespace, error) {
+	nsList := make([]*services.Namespace, 0)
+	err := forEachJSON(tx.Bucket(namespacesBucket), "", func(raw []byte) error {
+		var ns services.Namespace
+		if err := json.Unmarshal(raw, &ns); err != nil {
+			return err
+		}
+		if match(&ns) {
+			nsList = append(nsList, &ns)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nsList, func(i, j int) bool {
+		return nsList[i].Name < nsList[j].Name
+	})
+	return nsList, nil
+}
+
+func listNamespaceVars(tx *bolt.Tx, nsId string) ([]*services.NamespaceVar, error) {
+	var results []*services.NamespaceVar
+	err := forEachJSON(tx.Bucket(namespaceVarsBucket), nsId+"/", func(raw []byte) error {
+		var nsVar services.NamespaceVar
+		if err := json.Unmarshal(raw, &nsVar); err != nil {
+			return err
+		}
+		results = append(results, &nsVar)
+		return nil
+	})
+	return results, err
+}
+
+func ownVariables(tx *bolt.Tx, nsId string) (map[string]string, error) {
+	items, err := listNamespaceVars(tx, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for _, i := range items {
+		result[i.Key] = i.Value
+	}
+	return result, nil
+}
+
+func existsByName(tx *bolt.Tx, orgId string, nsName string) (bool, error) {
+	matches, err := listNamespaces(tx, func(ns *services.Namespace) bool {
+		return ns.OrganizationId == orgId && ns.Name == nsName
+	})
+	return len(matches) > 0, err
+}
+
+func (nsSvc *NamespaceService) CreateNamespace(orgId string, name string, parentId string, schemaId string, schemaVersion string, vars map[string]string) (*services.Namespace, error) {
+	ns := &services.Namespace{
+		Id:             uuid.NewString(),
+		Name:           name,
+		OrganizationId: orgId,
+		ParentId:       parentId,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Revision:       1,
+	}
+
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		exists, err := existsByName(tx, orgId, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return services.ErrNamespaceAlreadyExists
+		}
+
+		org, err := getOrganization(tx, orgId)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			return services.ErrOrganizationNotFound
+		}
+
+		err = services.CheckNamespaceParent(namespaceGetter(tx), orgId, "", parentId)
+		if err != nil {
+			return err
+		}
+		err = services.CheckNamespacePin(schemaVersionGetter(tx), orgId, schemaId, schemaVersion)
+		if err != nil {
+			return err
+		}
+
+		err = putJSON(tx.Bucket(namespacesBucket), ns.Id, ns)
+		if err != nil {
+			return err
+		}
+
+		varBucket := tx.Bucket(namespaceVarsBucket)
+		for k, v := range vars {
+			nsVar := &services.NamespaceVar{
+				Key:         k,
+				Value:       v,
+				OrgId:       orgId,
+				NamespaceId: ns.Id,
+			}
+			if err := putJSON(varBucket, namespaceVarKey(ns.Id, k), nsVar); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) ExistsByName(orgId string, nsName string) bool {
+	exists := false
+	nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		exists, err = existsByName(tx, orgId, nsName)
+		return err
+	})
+	return exists
+}
+
+func (nsSvc *NamespaceService) GetNamespaceById(orgId string, nsId string) (*services.Namespace, error) {
+	var ns *services.Namespace
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		ns, err = getNamespace(tx, orgId, nsId)
+		return err
+	})
+	return ns, err
+}
+
+func (nsSvc *NamespaceService) ListNamespaces(orgId string) ([]*services.Namespace, error) {
+	var nsList []*services.Namespace
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		nsList, err = listNamespaces(tx, func(ns *services.Namespace) bool {
+			return ns.OrganizationId == orgId
+		})
+		return err
+	})
+	return nsList, err
+}
+
+func (nsSvc *NamespaceService) ListChildNamespaces(orgId string, nsId string) ([]*services.Namespace, error) {
+	var nsList []*services.Namespace
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		nsList, err = listNamespaces(tx, func(ns *services.Namespace) bool {
+			return ns.OrganizationId == orgId && ns.ParentId == nsId
+		})
+		return err
+	})
+	return nsList, err
+}
+
+func (nsSvc *NamespaceService) GetNamespaceAncestors(orgId string, nsId string) ([]*services.Namespace, error) {
+	var chain []*services.Namespace
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		chain, err = services.WalkNamespaceAncestors(namespaceGetter(tx), orgId, nsId)
+		return err
+	})
+	return chain, err
+}
+
+func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName string, parentId string, schemaVersion string, revision int) (*services.Namespace, error) {
+	var ns *services.Namespace
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		ns, err = getNamespace(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, ns.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		if ns.Name != nsName {
+			exists, err := existsByName(tx, orgId, nsName)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return services.ErrNamespaceAlreadyExists
+			}
+		}
+
+		err = services.CheckNamespaceParent(namespaceGetter(tx), orgId, nsId, parentId)
+		if err != nil {
+			return err
+		}
+		err = services.CheckNamespacePin(schemaVersionGetter(tx), orgId, ns.SchemaId, schemaVersion)
+		if err != nil {
+			return err
+		}
+
+		ns.Name = nsName
+		ns.ParentId = parentId
+		ns.SchemaVersion = schemaVersion
+		ns.Revision++
+		return putJSON(tx.Bucket(namespacesBucket), ns.Id, ns)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespace(orgId string, nsId string, revision int) error {
+	return nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		ns, err := getNamespace(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, ns.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		children, err := listNamespaces(tx, func(ns *services.Namespace) bool {
+			return ns.OrganizationId == orgId && ns.ParentId == nsId
+		})
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return services.ErrNamespaceHasChildren
+		}
+
+		vars, err := listNamespaceVars(tx, nsId)
+		if err != nil {
+			return err
+		}
+		varBucket := tx.Bucket(namespaceVarsBucket)
+		for _, nsVar := range vars {
+			if err := varBucket.Delete([]byte(namespaceVarKey(nsId, nsVar.Key))); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(namespacesBucket).Delete([]byte(nsId))
+	})
+}
+
+func (nsSvc *NamespaceService) LockNamespace(orgId string, nsId string, lock services.NamespaceLock) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, &lock)
+}
+
+func (nsSvc *NamespaceService) UnlockNamespace(orgId string, nsId string) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, nil)
+}
+
+func (nsSvc *NamespaceService) setLock(orgId string, nsId string, lock *services.NamespaceLock) (*services.Namespace, error) {
+	var ns *services.Namespace
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		ns, err = getNamespace(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+
+		ns.Lock = lock
+		ns.Revision++
+		return putJSON(tx.Bucket(namespacesBucket), ns.Id, ns)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*services.NamespaceVar, error) {
+	var results []*services.NamespaceVar
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		vars, err := listNamespaceVars(tx, nsId)
+		if err != nil {
+			return err
+		}
+		for _, nsVar := range vars {
+			if nsVar.OrgId == orgId {
+				results = append(results, nsVar)
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Replace all of the variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) ReplaceNamespaceVariables(orgId string, nsId string, vars map[string]string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return vars, nil
+	})
+}
+
+// Upsert and delete variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) PatchNamespaceVariables(orgId string, nsId string, upserts map[string]string, deletes []string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return services.ApplyVariablePatch(current, upserts, deletes)
+	})
+}
+
+func (nsSvc *NamespaceService) changeVariables(orgId string, nsId string, revision int, change func(current map[string]string) (map[string]string, error)) (*services.VariableChangeSummary, error) {
+	var summary *services.VariableChangeSummary
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		ns, err := getNamespace(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, ns.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		current, err := ownVariables(tx, nsId)
+		if err != nil {
+			return err
+		}
+		desired, err := change(current)
+		if err != nil {
+			return err
+		}
+		summary = services.DiffVariables(current, desired)
+
+		varBucket := tx.Bucket(namespaceVarsBucket)
+		for _, k := range summary.Deleted {
+			if err := varBucket.Delete([]byte(namespaceVarKey(nsId, k))); err != nil {
+				return err
+			}
+		}
+		changed := append(append([]string{}, summary.Created...), summary.Updated...)
+		for _, k := range changed {
+			nsVar := &services.NamespaceVar{
+				Key:         k,
+				Value:       desired[k],
+				OrgId:       orgId,
+				NamespaceId: nsId,
+			}
+			if err := putJSON(varBucket, namespaceVarKey(nsId, k), nsVar); err != nil {
+				return err
+			}
+		}
+
+		ns.Revision++
+		summary.Revision = ns.Revision
+		return putJSON(tx.Bucket(namespacesBucket), ns.Id, ns)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Get the effective variables of a namespace, merged down the chain of parent namespaces
+func (nsSvc *NamespaceService) GetVariablesAsMap(orgId string, nsId string) (map[string]string, error) {
+	var result map[string]string
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		chain, err := services.WalkNamespaceAncestors(namespaceGetter(tx), orgId, nsId)
+		if err != nil {
+			return err
+		}
+
+		result, err = services.MergeNamespaceVariables(chain, func(ns *services.Namespace) (map[string]string, error) {
+			return ownVariables(tx, ns.Id)
+		})
+		return err
+	})
+	return result, err
+}
+
+func getNamespaceVariable(tx *bolt.Tx, orgId string, nsId string, key string) (*services.NamespaceVar, error) {
+	var nsVar services.NamespaceVar
+	found, err := getJSON(tx.Bucket(namespaceVarsBucket), namespaceVarKey(nsId, key), &nsVar)
+	if err != nil {
+		return nil, err
+	}
+	if !found || nsVar.OrgId != orgId {
+		return nil, services.ErrNamespaceVarNotFound
+	}
+	return &nsVar, nil
+}
+
+func (nsSvc *NamespaceService) GetNamespaceVariable(orgId string, nsId string, varId string) (*services.NamespaceVar, error) {
+	var nsVar *services.NamespaceVar
+	err := nsSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		nsVar, err = getNamespaceVariable(tx, orgId, nsId, varId)
+		return err
+	})
+	return nsVar, err
+}
+
+func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string, key string, value string) (*services.NamespaceVar, error) {
+	newVar := &services.NamespaceVar{
+		OrgId:       orgId,
+		NamespaceId: nsId,
+		Key:         key,
+		Value:       value,
+	}
+
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		_, err := getNamespace(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+
+		_, err = getNamespaceVariable(tx, orgId, nsId, key)
+		if err == nil {
+			return services.ErrNamespaceVarExists
+		} else if err != services.ErrNamespaceVarNotFound {
+			return err
+		}
+
+		return putJSON(tx.Bucket(namespaceVarsBucket), namespaceVarKey(nsId, key), newVar)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newVar, nil
+}
+
+func (nsSvc *NamespaceService) UpdateNamespaceVariable(orgId string, nsId string, varId string, value string) (*services.NamespaceVar, error) {
+	var nsVar *services.NamespaceVar
+	err := nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		nsVar, err = getNamespaceVariable(tx, orgId, nsId, varId)
+		if err != nil {
+			return err
+		}
+
+		nsVar.Value = value
+		return putJSON(tx.Bucket(namespaceVarsBucket), namespaceVarKey(nsId, varId), nsVar)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nsVar, nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespaceVariable(orgId string, nsId string, varId string) error {
+	return nsSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		_, err := getNamespaceVariable(tx, orgId, nsId, varId)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(namespaceVarsBucket).Delete([]byte(namespaceVarKey(nsId, varId)))
+	})
+}
+
+func (nsSvc *NamespaceService) NamespaceVariableExists(orgId string, nsId string, varId string) bool {
+	_, err := nsSvc.GetNamespaceVariable(orgId, nsId, varId)
+	return err == nil
+}
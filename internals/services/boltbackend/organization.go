@@ -0,0 +1,334 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type OrganizationService struct {
+	db *DB
+}
+
+func NewOrganizationService(db *DB) *OrganizationService {
+	return &OrganizationService{
+		db: db,
+	}
+}
+
+func getOrganization(tx *bolt.Tx, orgId string) (*services.Organization, error) {
+	var org services.Organization
+	found, err := getJSON(tx.Bucket(organizationsBucket), orgId, &org)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func getOrganizationByName(tx *bolt.Tx, orgName string) (*services.Organization, error) {
+	var result *services.Organization
+	err := forEachJSON(tx.Bucket(organizationsBucket), "", func(raw []byte) error {
+		var org services.Organization
+		if err := json.Unmarshal(raw, &org); err != nil {
+			return err
+		}
+		if org.Name == orgName {
+			result = &org
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (orgSvc *OrganizationService) NewOrganization(orgName string) (*services.Organization, error) {
+	newOrg := &services.Organization{
+		Id:       uuid.NewString(),
+		Name:     orgName,
+		OrgVars:  make(map[string]string),
+		Revision: 1,
+	}
+
+	err := orgSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		existing, err := getOrganizationByName(tx, orgName)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return services.ErrOrganizationExists
+		}
+		return putJSON(tx.Bucket(organizationsBucket), newOrg.Id, newOrg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newOrg, nil
+}
+
+func (orgSvc *OrganizationService) GetOrganizationById(orgId string) (*services.Organization, error) {
+	var org *services.Organization
+	err := orgSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		org, err = getOrganization(tx, orgId)
+		return err
+	})
+	return org, err
+}
+
+func (orgSvc *OrganizationService) ExistsById(orgId string) bool {
+	org, _ := orgSvc.GetOrganizationById(orgId)
+	return org != nil
+}
+
+func (orgSvc *OrganizationService) ExistsByName(orgName string) bool {
+	var org *services.Organization
+	orgSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		org, err = getOrganizationByName(tx, orgName)
+		return err
+	})
+	return org != nil
+}
+
+func (orgSvc *OrganizationService) UpdateOrganization(orgId string, orgName string, orgVars map[string]string, revision int) (*services.Organization, error) {
+	return orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		if org.Name != orgName {
+			existing, err := getOrganizationByName(tx, orgName)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return services.ErrOrganizationExists
+			}
+		}
+
+		org.Name = orgName
+		org.OrgVars = orgVars
+		return nil
+	})
+}
+
+func (orgSvc *OrganizationService) ListOrganizations() ([]*services.Organization, error) {
+	results := make([]*services.Organization, 0)
+	err := orgSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(organizationsBucket), "", func(raw []byte) error {
+			var org services.Organization
+			if err := json.Unmarshal(raw, &org); err != nil {
+				return err
+			}
+			results = append(results, &org)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func (orgSvc *OrganizationService) SuspendOrganization(orgId string, suspension services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	return orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		org.Suspension = &suspension
+		return nil
+	})
+}
+
+func (orgSvc *OrganizationService) ReactivateOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		org.Suspension = nil
+		return nil
+	})
+}
+
+// updateOrganization applies update to the organization and increments its revision
+func (orgSvc *OrganizationService) updateOrganization(orgId string, revision int, update func(tx *bolt.Tx, org *services.Organization) error) (*services.Organization, error) {
+	var org *services.Organization
+	err := orgSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		org, err = getOrganization(tx, orgId)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			return services.ErrOrganizationNotFound
+		}
+		if !services.RevisionMatches(revision, org.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		if err := update(tx, org); err != nil {
+			return err
+		}
+		org.Revision++
+		return putJSON(tx.Bucket(organizationsBucket), org.Id, org)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (orgSvc *OrganizationService) DeleteOrganization(orgId string, deletion services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	return orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		org.Deletion = &deletion
+		return nil
+	})
+}
+
+func (orgSvc *OrganizationService) RestoreOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		org.Deletion = nil
+		return nil
+	})
+}
+
+func (orgSvc *OrganizationService) PurgeOrganization(orgId string) error {
+	return orgSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		org, err := getOrganization(tx, orgId)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			return services.ErrOrganizationNotFound
+		}
+
+		nsIds, err := deleteOwned(tx.Bucket(namespacesBucket), orgId)
+		if err != nil {
+			return err
+		}
+		for _, nsId := range nsIds {
+			if err := deletePrefix(tx.Bucket(namespaceVarsBucket), nsId+"/"); err != nil {
+				return err
+			}
+		}
+
+		schemaIds, err := deleteOwned(tx.Bucket(schemasBucket), orgId)
+		if err != nil {
+			return err
+		}
+		for _, schemaId := range schemaIds {
+			if err := deletePrefix(tx.Bucket(schemaVersionsBucket), schemaId+"/"); err != nil {
+				return err
+			}
+		}
+
+		for _, bucket := range [][]byte{templatesBucket, apiKeysBucket} {
+			if _, err := deleteOwned(tx.Bucket(bucket), orgId); err != nil {
+				return err
+			}
+		}
+		for _, bucket := range [][]byte{roleBindingsBucket, historyBucket} {
+			if err := deletePrefix(tx.Bucket(bucket), orgId+"/"); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(organizationsBucket).Delete([]byte(orgId))
+	})
+}
+
+func (orgSvc *OrganizationService) SetFreezeWindows(orgId string, windows []services.FreezeWindow, revision int) (*services.Organization, error) {
+	org, err := orgSvc.updateOrganization(orgId, revision, func(tx *bolt.Tx, org *services.Organization) error {
+		org.FreezeWindows = windows
+		return nil
+	})
+	if err == services.ErrOrganizationNotFound {
+		return nil, nil
+	}
+	return org, err
+}
+
+func listTemplates(tx *bolt.Tx, orgId string) ([]*services.NamespaceTemplate, error) {
+	results := make([]*services.NamespaceTemplate, 0)
+	err := forEachJSON(tx.Bucket(templatesBucket), "", func(raw []byte) error {
+		var tpl services.NamespaceTemplate
+		if err := json.Unmarshal(raw, &tpl); err != nil {
+			return err
+		}
+		if tpl.OrganizationId == orgId {
+			results = append(results, &tpl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func getTemplate(tx *bolt.Tx, orgId string, templateId string) (*services.NamespaceTemplate, error) {
+	var tpl services.NamespaceTemplate
+	found, err := getJSON(tx.Bucket(templatesBucket), templateId, &tpl)
+	if err != nil {
+		return nil, err
+	}
+	if !found || tpl.OrganizationId != orgId {
+		return nil, services.ErrTemplateNotFound
+	}
+	return &tpl, nil
+}
+
+func (orgSvc *OrganizationService) CreateNamespaceTemplate(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*services.NamespaceTemplate, error) {
+	tpl := &services.NamespaceTemplate{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Variables:      vars,
+	}
+
+	err := orgSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		existing, err := listTemplates(tx, orgId)
+		if err != nil {
+			return err
+		}
+		for _, t := range existing {
+			if t.Name == name {
+				return services.ErrTemplateAlreadyExists
+			}
+		}
+		return putJSON(tx.Bucket(templatesBucket), tpl.Id, tpl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (orgSvc *OrganizationService) ListNamespaceTemplates(orgId string) ([]*services.NamespaceTemplate, error) {
+	var results []*services.NamespaceTemplate
+	err := orgSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		results, err = listTemplates(tx, orgId)
+		return err
+	})
+	return results, err
+}
+
+func (orgSvc *OrganizationService) GetNamespaceTemplate(orgId string, templateId string) (*services.NamespaceTemplate, error) {
+	var tpl *services.NamespaceTemplate
+	err := orgSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		tpl, err = getTemplate(tx, orgId, templateId)
+		return err
+	})
+	return tpl, err
+}
+
+func (orgSvc *OrganizationService) DeleteNamespaceTemplate(orgId string, templateId string) error {
+	return orgSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		_, err := getTemplate(tx, orgId, templateId)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(templatesBucket).Delete([]byte(templateId))
+	})
+}
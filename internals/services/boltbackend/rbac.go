@@ -0,0 +1,120 @@
+package boltbackend
+
+import (
+	"encoding/json"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	bolt "go.etcd.io/bbolt"
+)
+
+type RoleBindingService struct {
+	db *DB
+}
+
+func NewRoleBindingService(db *DB) *RoleBindingService {
+	return &RoleBindingService{
+		db: db,
+	}
+}
+
+// Bindings are keyed by organization so a cursor visits an organization's bindings by ID
+func roleBindingKey(orgId string, bindingId string) string {
+	return orgId + "/" + bindingId
+}
+
+func listRoleBindings(tx *bolt.Tx, orgId string, match func(b *services.RoleBinding) bool) ([]*services.RoleBinding, error) {
+	result := []*services.RoleBinding{}
+	err := forEachJSON(tx.Bucket(roleBindingsBucket), orgId+"/", func(raw []byte) error {
+		var b services.RoleBinding
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		if match(&b) {
+			result = append(result, &b)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func putRoleBinding(tx *bolt.Tx, binding *services.RoleBinding) error {
+	existing, err := listRoleBindings(tx, binding.OrganizationId, func(b *services.RoleBinding) bool {
+		return services.SameRoleBinding(b, binding)
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return services.ErrRoleBindingExists
+	}
+	return putJSON(tx.Bucket(roleBindingsBucket), roleBindingKey(binding.OrganizationId, binding.Id), binding)
+}
+
+func (rbSvc *RoleBindingService) CreateRoleBinding(binding *services.RoleBinding) error {
+	return rbSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		return putRoleBinding(tx, binding)
+	})
+}
+
+func (rbSvc *RoleBindingService) ListRoleBindings(orgId string) ([]*services.RoleBinding, error) {
+	return rbSvc.list(orgId, func(b *services.RoleBinding) bool {
+		return true
+	})
+}
+
+func (rbSvc *RoleBindingService) ListSubjectRoleBindings(orgId string, subject string) ([]*services.RoleBinding, error) {
+	return rbSvc.list(orgId, func(b *services.RoleBinding) bool {
+		return b.Subject == subject
+	})
+}
+
+func (rbSvc *RoleBindingService) GetRoleBinding(orgId string, bindingId string) (*services.RoleBinding, error) {
+	bindings, err := rbSvc.list(orgId, func(b *services.RoleBinding) bool {
+		return b.Id == bindingId
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return nil, services.ErrRoleBindingNotFound
+	}
+	return bindings[0], nil
+}
+
+func (rbSvc *RoleBindingService) list(orgId string, match func(b *services.RoleBinding) bool) ([]*services.RoleBinding, error) {
+	var result []*services.RoleBinding
+	err := rbSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = listRoleBindings(tx, orgId, match)
+		return err
+	})
+	return result, err
+}
+
+func (rbSvc *RoleBindingService) DeleteRoleBinding(orgId string, bindingId string) error {
+	return rbSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(roleBindingsBucket)
+		key := []byte(roleBindingKey(orgId, bindingId))
+		if b.Get(key) == nil {
+			return services.ErrRoleBindingNotFound
+		}
+		return b.Delete(key)
+	})
+}
+
+func (rbSvc *RoleBindingService) DeleteSubjectRoleBindings(orgId string, subject string) error {
+	return rbSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		bindings, err := listRoleBindings(tx, orgId, func(b *services.RoleBinding) bool {
+			return b.Subject == subject
+		})
+		if err != nil {
+			return err
+		}
+		for _, binding := range bindings {
+			if err := tx.Bucket(roleBindingsBucket).Delete([]byte(roleBindingKey(orgId, binding.Id))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,312 @@
+package boltbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type SchemaService struct {
+	db *DB
+}
+
+func NewSchemaService(db *DB) *SchemaService {
+	return &SchemaService{
+		db: db,
+	}
+}
+
+// Schema versions are keyed by schema ID and zero padded version number so a cursor visits them in order
+func schemaVersionKey(schemaId string, versionId int) string {
+	return fmt.Sprintf("%s/%010d", schemaId, versionId)
+}
+
+func getSchema(tx *bolt.Tx, orgId string, schemaId string) (*services.Schema, error) {
+	var schema services.Schema
+	found, err := getJSON(tx.Bucket(schemasBucket), schemaId, &schema)
+	if err != nil || !found || schema.OrganizationId != orgId {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func listSchemas(tx *bolt.Tx, orgId string) ([]*services.Schema, error) {
+	results := make([]*services.Schema, 0)
+	err := forEachJSON(tx.Bucket(schemasBucket), "", func(raw []byte) error {
+		var schema services.Schema
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			return err
+		}
+		if schema.OrganizationId == orgId {
+			results = append(results, &schema)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func listSchemaVersions(tx *bolt.Tx, schemaId string) ([]*services.SchemaVersion, error) {
+	var results []*services.SchemaVersion
+	err := forEachJSON(tx.Bucket(schemaVersionsBucket), schemaId+"/", func(raw []byte) error {
+		var sv services.SchemaVersion
+		if err := json.Unmarshal(raw, &sv); err != nil {
+			return err
+		}
+		results = append(results, &sv)
+		return nil
+	})
+	return results, err
+}
+
+func getSchemaVersion(tx *bolt.Tx, orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	schema, err := getSchema(tx, orgId, schemaId)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, services.ErrSchemaNotFound
+	}
+
+	if schemaVersionId == "latest" {
+		versions, err := listSchemaVersions(tx, schemaId)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, services.ErrSchemaVersionNotFound
+		}
+		return versions[len(versions)-1], nil
+	}
+
+	versionIdInt, err := strconv.Atoi(schemaVersionId)
+	if err != nil {
+		return nil, services.ErrSchemaVersionNotFound
+	}
+
+	var sv services.SchemaVersion
+	found, err := getJSON(tx.Bucket(schemaVersionsBucket), schemaVersionKey(schemaId, versionIdInt), &sv)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, services.ErrSchemaVersionNotFound
+	}
+	return &sv, nil
+}
+
+func (sSvc *SchemaService) CreateSchema(orgId string, name string) (*services.Schema, error) {
+	newSchema := &services.Schema{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		Revision:       1,
+	}
+
+	newSchemaVersion := &services.SchemaVersion{
+		Id:        1,
+		SchemaId:  newSchema.Id,
+		Resources: make(map[string]string),
+		Revision:  1,
+	}
+
+	err := sSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		existing, err := listSchemas(tx, orgId)
+		if err != nil {
+			return err
+		}
+		for _, schema := range existing {
+			if schema.Name == name {
+				return services.ErrSchemaAlreadyExists
+			}
+		}
+
+		err = putJSON(tx.Bucket(schemasBucket), newSchema.Id, newSchema)
+		if err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(schemaVersionsBucket), schemaVersionKey(newSchema.Id, newSchemaVersion.Id), newSchemaVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSchema, nil
+}
+
+// List schemas in a given organization by the organization ID
+func (sSvc *SchemaService) ListSchemaInOrganization(orgId string) ([]*services.Schema, error) {
+	var results []*services.Schema
+	err := sSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		results, err = listSchemas(tx, orgId)
+		return err
+	})
+	return results, err
+}
+
+func (sSvc *SchemaService) GetSchemaById(orgId string, schemaId string) (*services.Schema, error) {
+	var schema *services.Schema
+	err := sSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		schema, err = getSchema(tx, orgId, schemaId)
+		return err
+	})
+	return schema, err
+}
+
+// Update the name of a schema. The revision of the schema passed in is the one expected.
+func (sSvc *SchemaService) UpdateSchema(schema services.Schema) (*services.Schema, error) {
+	var existing *services.Schema
+	err := sSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		existing, err = getSchema(tx, schema.OrganizationId, schema.Id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return services.ErrSchemaNotFound
+		}
+		if !services.RevisionMatches(schema.Revision, existing.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		if existing.Name != schema.Name {
+			schemas, err := listSchemas(tx, schema.OrganizationId)
+			if err != nil {
+				return err
+			}
+			for _, other := range schemas {
+				if other.Name == schema.Name {
+					return services.ErrSchemaAlreadyExists
+				}
+			}
+		}
+		existing.Name = schema.Name
+		existing.Revision++
+		return putJSON(tx.Bucket(schemasBucket), existing.Id, existing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (sSvc *SchemaService) DeleteSchema(orgId string, schemaId string, revision int) error {
+	return sSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		schema, err := getSchema(tx, orgId, schemaId)
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			return services.ErrSchemaNotFound
+		}
+		if !services.RevisionMatches(revision, schema.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		pinned, err := listNamespaces(tx, func(ns *services.Namespace) bool {
+			return ns.OrganizationId == orgId && ns.SchemaId == schemaId
+		})
+		if err != nil {
+			return err
+		}
+		if len(pinned) > 0 {
+			return services.ErrSchemaInUse
+		}
+
+		versions, err := listSchemaVersions(tx, schemaId)
+		if err != nil {
+			return err
+		}
+		versionBucket := tx.Bucket(schemaVersionsBucket)
+		for _, sv := range versions {
+			if err := versionBucket.Delete([]byte(schemaVersionKey(schemaId, sv.Id))); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(schemasBucket).Delete([]byte(schemaId))
+	})
+}
+
+func (sSvc *SchemaService) ListSchemaVersions(orgId string, schemaId string) ([]*services.SchemaVersion, error) {
+	var results []*services.SchemaVersion
+	err := sSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		schema, err := getSchema(tx, orgId, schemaId)
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			return services.ErrSchemaNotFound
+		}
+
+		results, err = listSchemaVersions(tx, schemaId)
+		return err
+	})
+	return results, err
+}
+
+func (sSvc *SchemaService) CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
+	var newSchemaVersion *services.SchemaVersion
+	err := sSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		latestVersion, err := getSchemaVersion(tx, orgId, schemaId, "latest")
+		if err != nil {
+			return err
+		}
+
+		newSchemaVersion = &services.SchemaVersion{
+			Id:        latestVersion.Id + 1,
+			SchemaId:  schemaId,
+			Resources: resources,
+			Published: published,
+			Revision:  1,
+		}
+		return putJSON(tx.Bucket(schemaVersionsBucket), schemaVersionKey(schemaId, newSchemaVersion.Id), newSchemaVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaVersion, nil
+}
+
+func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	var sv *services.SchemaVersion
+	err := sSvc.db.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		sv, err = getSchemaVersion(tx, orgId, schemaId, schemaVersionId)
+		return err
+	})
+	return sv, err
+}
+
+func (sSvc *SchemaService) UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool, revision int) (*services.SchemaVersion, error) {
+	var sv *services.SchemaVersion
+	err := sSvc.db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		sv, err = getSchemaVersion(tx, orgId, schemaId, schemaVersionId)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, sv.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		sv.Published = published
+		sv.Resources = resources
+		sv.Revision++
+		return putJSON(tx.Bucket(schemaVersionsBucket), schemaVersionKey(schemaId, sv.Id), sv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sv, nil
+}
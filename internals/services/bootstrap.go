@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Bootstrap is an organization created by BootstrapOrganization, with its first admin key and
+// the binding making the key an organization admin
+type Bootstrap struct {
+	Organization *Organization
+	ApiKey       *ApiKey
+	RoleBinding  *RoleBinding
+}
+
+// BootstrapOrganization creates an organization together with a key that administers it, so
+// that a new tenant can be handed a working credential. Fails with ErrOrganizationExists if the
+// name is taken.
+//
+// This is not atomic. The providers have no transactions spanning them, so a step that fails
+// is compensated for: the key is removed if its binding cannot be stored, and the organization
+// is purged if it gets no admin key. If the process stops between the steps, or the purge
+// itself fails, the organization is left without a key. It can only be deleted by a super
+// admin then, after which it is purged like any other deleted organization.
+func BootstrapOrganization(p *Providers, orgName string, keyName string) (*Bootstrap, error) {
+	org, err := p.Organizations.NewOrganization(orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	ak, binding, err := CreateAdminKey(p, org.Id, keyName)
+	if err != nil {
+		undoBootstrap(p, org)
+		return nil, err
+	}
+
+	return &Bootstrap{
+		Organization: org,
+		ApiKey:       ak,
+		RoleBinding:  binding,
+	}, nil
+}
+
+// CreateAdminKey creates a key that never expires and the binding making it an admin of the
+// organization. The key is removed again if the binding cannot be stored.
+func CreateAdminKey(p *Providers, orgId string, keyName string) (*ApiKey, *RoleBinding, error) {
+	ak, err := p.ApiKeys.GenerateNewApiKey(orgId, keyName, time.Time{}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	binding, err := NewRoleBinding(orgId, ApiKeySubject(ak.Id), RoleOrgAdmin, "", "")
+	if err == nil {
+		err = p.RoleBindings.CreateRoleBinding(binding)
+	}
+	if err != nil {
+		if err := p.ApiKeys.DeleteKey(ak.Id); err != nil {
+			log.Printf("failed to remove API key %s that could not be made an admin: %v", ak.Id, err)
+		}
+		return nil, nil, fmt.Errorf("failed to make the key an organization admin: %w", err)
+	}
+	return ak, binding, nil
+}
+
+// Removes what a failed bootstrap created. A failure is logged as the original error is the
+// one returned.
+func undoBootstrap(p *Providers, org *Organization) {
+	if err := p.Organizations.PurgeOrganization(org.Id); err != nil {
+		log.Printf("failed to remove organization %s of failed bootstrap: %v", org.Id, err)
+	}
+}
@@ -3,7 +3,29 @@ package services
 import "errors"
 
 var (
+	ErrApiKeyNotFound         = errors.New("api key not found")
+	ErrApiKeyRotated          = errors.New("api key has already been rotated")
 	ErrNamespaceAlreadyExists = errors.New("namespace with name already exists in organization")
 	ErrNamespaceNotFound      = errors.New("namespace not found")
+	ErrNamespaceCycle         = errors.New("namespace parent would create a cycle")
+	ErrNamespaceTooDeep       = errors.New("namespace hierarchy is too deep")
+	ErrNamespaceHasChildren   = errors.New("namespace has child namespaces")
+	ErrInvalidVariablePatch   = errors.New("variable cannot be both upserted and deleted")
+	ErrNamespaceVarExists     = errors.New("namespace variable already exists")
+	ErrNamespaceVarNotFound   = errors.New("namespace variable not found")
+	ErrNoVariableHistory      = errors.New("no variable history at that time")
+	ErrOrganizationExists     = errors.New("organization already exists")
+	ErrOrganizationNotFound   = errors.New("organization not found")
+	ErrOrganizationNotDeleted = errors.New("organization is not deleted")
+	ErrOrganizationPurgeDue   = errors.New("organization can no longer be restored")
+	ErrRevisionMismatch       = errors.New("resource has been modified since it was read")
+	ErrInvalidRoleBinding     = errors.New("role cannot be bound to that resource")
+	ErrRoleBindingExists      = errors.New("role binding already exists")
+	ErrRoleBindingNotFound    = errors.New("role binding not found")
+	ErrSchemaAlreadyExists    = errors.New("schema already exists")
 	ErrSchemaNotFound         = errors.New("schema not found")
+	ErrSchemaInUse            = errors.New("schema is used by namespaces")
+	ErrSchemaVersionNotFound  = errors.New("schema version not found")
+	ErrTemplateAlreadyExists  = errors.New("namespace template with name already exists in organization")
+	ErrTemplateNotFound       = errors.New("namespace template not found")
 )
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"time"
+)
+
+// VariableSnapshot is the state of the variables of an organization, or of a namespace and
+// its schema pin, from the time it was taken until the next snapshot. Organization snapshots
+// have no NamespaceId. ResolvedSchemaVersion is the schema version the pin resolved to, with
+// its resources as they were, since a latest pin moves and unpublished versions are edited.
+type VariableSnapshot struct {
+	OrganizationId string            `json:"organization_id"`
+	NamespaceId    string            `json:"namespace_id,omitempty"`
+	Time           time.Time         `json:"time"`
+	Deleted        bool              `json:"deleted,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	ParentId       string            `json:"parent_id,omitempty"`
+	SchemaId       string            `json:"schema_id,omitempty"`
+	SchemaVersion  string            `json:"schema_version,omitempty"`
+	Variables      map[string]string `json:"variables"`
+
+	ResolvedSchemaVersion *SchemaVersion `json:"resolved_schema_version,omitempty"`
+}
+
+// NewOrganizationSnapshot returns a snapshot of the organization variables taken now
+func NewOrganizationSnapshot(org *Organization) *VariableSnapshot {
+	return &VariableSnapshot{
+		OrganizationId: org.Id,
+		Time:           snapshotTime(),
+		Variables:      copyVariables(org.OrgVars),
+	}
+}
+
+// NewNamespaceSnapshot returns a snapshot of the namespace, its own variables and the schema
+// version its pin resolves to, taken now
+func NewNamespaceSnapshot(ns *Namespace, vars map[string]string, sv *SchemaVersion) *VariableSnapshot {
+	snapshot := &VariableSnapshot{
+		OrganizationId: ns.OrganizationId,
+		NamespaceId:    ns.Id,
+		Time:           snapshotTime(),
+		Name:           ns.Name,
+		ParentId:       ns.ParentId,
+		SchemaId:       ns.SchemaId,
+		SchemaVersion:  ns.SchemaVersion,
+		Variables:      copyVariables(vars),
+	}
+	if sv != nil {
+		resolved := *sv
+		resolved.Resources = copyVariables(sv.Resources)
+		snapshot.ResolvedSchemaVersion = &resolved
+	}
+	return snapshot
+}
+
+// NewDeletedNamespaceSnapshot returns a snapshot recording that the namespace was deleted now
+func NewDeletedNamespaceSnapshot(ns *Namespace) *VariableSnapshot {
+	snapshot := NewNamespaceSnapshot(ns, nil, nil)
+	snapshot.Deleted = true
+	return snapshot
+}
+
+// Namespace returns the namespace as it was when the snapshot was taken
+func (s *VariableSnapshot) Namespace() *Namespace {
+	return &Namespace{
+		Id:             s.NamespaceId,
+		Name:           s.Name,
+		OrganizationId: s.OrganizationId,
+		ParentId:       s.ParentId,
+		SchemaId:       s.SchemaId,
+		SchemaVersion:  s.SchemaVersion,
+	}
+}
+
+// Snapshots are kept to the millisecond, which every backend stores exactly
+func snapshotTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func copyVariables(vars map[string]string) map[string]string {
+	result := make(map[string]string, len(vars))
+	for k, v := range vars {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package services
+
+import "time"
+
+// Active returns true if the lock has not expired. A lock without an expiry never expires.
+func (lock *NamespaceLock) Active(now time.Time) bool {
+	if lock == nil {
+		return false
+	}
+	return lock.Expires.IsZero() || now.Before(lock.Expires)
+}
+
+// Active returns true if now falls within the freeze window
+func (fw FreezeWindow) Active(now time.Time) bool {
+	return !now.Before(fw.Start) && now.Before(fw.End)
+}
+
+// ActiveFreezeWindow returns the first freeze window of the organization covering now, or nil
+func (org *Organization) ActiveFreezeWindow(now time.Time) *FreezeWindow {
+	for i := range org.FreezeWindows {
+		if org.FreezeWindows[i].Active(now) {
+			return &org.FreezeWindows[i]
+		}
+	}
+	return nil
+}
+
+// ActiveNamespaceLock returns the first active lock in a chain of namespaces, or nil.
+// A lock on a parent namespace protects all of its children.
+func ActiveNamespaceLock(chain []*Namespace, now time.Time) (*Namespace, *NamespaceLock) {
+	for _, ns := range chain {
+		if ns.Lock.Active(now) {
+			return ns, ns.Lock
+		}
+	}
+	return nil, nil
+}
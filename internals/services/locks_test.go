@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceLockActive(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var noLock *NamespaceLock
+	assert.False(t, noLock.Active(now))
+	assert.True(t, (&NamespaceLock{}).Active(now))
+	assert.True(t, (&NamespaceLock{Expires: now.Add(time.Minute)}).Active(now))
+	assert.False(t, (&NamespaceLock{Expires: now}).Active(now))
+}
+
+func TestActiveFreezeWindow(t *testing.T) {
+	now := time.Date(2022, 12, 24, 12, 0, 0, 0, time.UTC)
+	org := &Organization{
+		FreezeWindows: []FreezeWindow{
+			{Name: "past", Start: now.Add(-48 * time.Hour), End: now.Add(-24 * time.Hour)},
+			{Name: "christmas", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+		},
+	}
+
+	fw := org.ActiveFreezeWindow(now)
+	assert.NotNil(t, fw)
+	assert.Equal(t, "christmas", fw.Name)
+	assert.Nil(t, org.ActiveFreezeWindow(now.Add(2*time.Hour)))
+}
+
+func TestActiveNamespaceLock(t *testing.T) {
+	now := time.Now()
+	parent := &Namespace{Id: "parent", Lock: &NamespaceLock{Reason: "live"}}
+	child := &Namespace{Id: "child", ParentId: "parent"}
+
+	ns, lock := ActiveNamespaceLock([]*Namespace{parent, child}, now)
+	assert.Equal(t, parent, ns)
+	assert.Equal(t, "live", lock.Reason)
+
+	ns, lock = ActiveNamespaceLock([]*Namespace{child}, now)
+	assert.Nil(t, ns)
+	assert.Nil(t, lock)
+}
@@ -0,0 +1,105 @@
+package memorybackend
+
+import (
+	"sort"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+type ApiKeyService struct {
+	store *Store
+}
+
+func NewApiKeyService(store *Store) *ApiKeyService {
+	return &ApiKeyService{
+		store: store,
+	}
+}
+
+func (akSvc *ApiKeyService) GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*services.ApiKey, error) {
+	ak := services.NewApiKey(orgId, name, expires, scope)
+
+	akSvc.store.mu.Lock()
+	defer akSvc.store.mu.Unlock()
+
+	akSvc.store.apiKeys[ak.Id] = ak.WithoutSecret()
+	return ak, nil
+}
+
+func (akSvc *ApiKeyService) ListKeys(orgId string) ([]*services.ApiKey, error) {
+	akSvc.store.mu.RLock()
+	defer akSvc.store.mu.RUnlock()
+
+	var result []*services.ApiKey
+	for _, ak := range akSvc.store.apiKeys {
+		if ak.OrganizationId == orgId {
+			result = append(result, copyApiKey(ak))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
+func (akSvc *ApiKeyService) GetKey(key string) *services.ApiKey {
+	akSvc.store.mu.RLock()
+	defer akSvc.store.mu.RUnlock()
+
+	for _, ak := range akSvc.store.apiKeys {
+		if ak.Matches(key) {
+			return copyApiKey(ak)
+		}
+	}
+	return nil
+}
+
+func (akSvc *ApiKeyService) GetKeyById(apiId string) *services.ApiKey {
+	akSvc.store.mu.RLock()
+	defer akSvc.store.mu.RUnlock()
+
+	if ak, found := akSvc.store.apiKeys[apiId]; found {
+		return copyApiKey(ak)
+	}
+	return nil
+}
+
+func (akSvc *ApiKeyService) RotateKey(rotated *services.ApiKey, successor *services.ApiKey) error {
+	akSvc.store.mu.Lock()
+	defer akSvc.store.mu.Unlock()
+
+	current, found := akSvc.store.apiKeys[rotated.Id]
+	if !found {
+		return services.ErrApiKeyNotFound
+	}
+	if current.ReplacedBy != "" {
+		return services.ErrApiKeyRotated
+	}
+	akSvc.store.apiKeys[rotated.Id] = rotated.WithoutSecret()
+	akSvc.store.apiKeys[successor.Id] = successor.WithoutSecret()
+	return nil
+}
+
+func (akSvc *ApiKeyService) SetKeyLastUsed(apiId string, at time.Time) error {
+	akSvc.store.mu.Lock()
+	defer akSvc.store.mu.Unlock()
+
+	ak, found := akSvc.store.apiKeys[apiId]
+	if !found {
+		return services.ErrApiKeyNotFound
+	}
+	ak.LastUsedAt = at
+	return nil
+}
+
+func (akSvc *ApiKeyService) DeleteKey(apiId string) error {
+	akSvc.store.mu.Lock()
+	defer akSvc.store.mu.Unlock()
+
+	if _, found := akSvc.store.apiKeys[apiId]; !found {
+		return services.ErrApiKeyNotFound
+	}
+	delete(akSvc.store.apiKeys, apiId)
+	return nil
+}
@@ -0,0 +1,38 @@
+package memorybackend
+
+import (
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+type AuditService struct {
+	store *Store
+}
+
+func NewAuditService(store *Store) *AuditService {
+	return &AuditService{
+		store: store,
+	}
+}
+
+func (aSvc *AuditService) RecordEvent(event *services.AuditEvent) error {
+	aSvc.store.mu.Lock()
+	defer aSvc.store.mu.Unlock()
+
+	aSvc.store.auditEvents = append(aSvc.store.auditEvents, copyAuditEvent(event))
+	return nil
+}
+
+func (aSvc *AuditService) ListEvents(orgId string, filter services.AuditFilter) ([]*services.AuditEvent, error) {
+	aSvc.store.mu.RLock()
+	defer aSvc.store.mu.RUnlock()
+
+	// Events are appended in the order they happened, so walk them backwards for newest first
+	result := []*services.AuditEvent{}
+	for i := len(aSvc.store.auditEvents) - 1; i >= 0; i-- {
+		event := aSvc.store.auditEvents[i]
+		if event.OrganizationId == orgId && filter.Matches(event) {
+			result = append(result, copyAuditEvent(event))
+		}
+	}
+	return filter.Page(result), nil
+}
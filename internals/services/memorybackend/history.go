@@ -0,0 +1,63 @@
+package memorybackend
+
+import (
+	"sort"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+type VariableHistoryService struct {
+	store *Store
+}
+
+func NewVariableHistoryService(store *Store) *VariableHistoryService {
+	return &VariableHistoryService{
+		store: store,
+	}
+}
+
+func (hSvc *VariableHistoryService) RecordSnapshot(snapshot *services.VariableSnapshot) error {
+	hSvc.store.mu.Lock()
+	defer hSvc.store.mu.Unlock()
+
+	hSvc.store.snapshots = append(hSvc.store.snapshots, copySnapshot(snapshot))
+	return nil
+}
+
+func (hSvc *VariableHistoryService) ListSnapshots(orgId string, nsId string) ([]*services.VariableSnapshot, error) {
+	hSvc.store.mu.RLock()
+	defer hSvc.store.mu.RUnlock()
+
+	// Walk backwards so snapshots taken at the same time stay newest first after sorting
+	result := []*services.VariableSnapshot{}
+	for i := len(hSvc.store.snapshots) - 1; i >= 0; i-- {
+		snapshot := hSvc.store.snapshots[i]
+		if snapshot.OrganizationId == orgId && snapshot.NamespaceId == nsId {
+			result = append(result, copySnapshot(snapshot))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	return result, nil
+}
+
+func (hSvc *VariableHistoryService) SnapshotAt(orgId string, nsId string, at time.Time) (*services.VariableSnapshot, error) {
+	hSvc.store.mu.RLock()
+	defer hSvc.store.mu.RUnlock()
+
+	var result *services.VariableSnapshot
+	for _, snapshot := range hSvc.store.snapshots {
+		if snapshot.OrganizationId != orgId || snapshot.NamespaceId != nsId || snapshot.Time.After(at) {
+			continue
+		}
+		if result == nil || !snapshot.Time.Before(result.Time) {
+			result = snapshot
+		}
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return copySnapshot(result), nil
+}
@@ -0,0 +1,394 @@
+package memorybackend
+
+import (
+	"sort"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+type NamespaceService struct {
+	store *Store
+}
+
+func NewNamespaceService(store *Store) *NamespaceService {
+	return &NamespaceService{
+		store: store,
+	}
+}
+
+func (nsSvc *NamespaceService) CreateNamespace(orgId string, name string, parentId string, schemaId string, schemaVersion string, vars map[string]string) (*services.Namespace, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	if nsSvc.existsByName(orgId, name) {
+		return nil, services.ErrNamespaceAlreadyExists
+	}
+
+	if _, found := nsSvc.store.organizations[orgId]; !found {
+		return nil, services.ErrOrganizationNotFound
+	}
+
+	err := services.CheckNamespaceParent(nsSvc.getNamespace, orgId, "", parentId)
+	if err != nil {
+		return nil, err
+	}
+	err = services.CheckNamespacePin(nsSvc.getSchemaVersion, orgId, schemaId, schemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := &services.Namespace{
+		Id:             uuid.NewString(),
+		Name:           name,
+		OrganizationId: orgId,
+		ParentId:       parentId,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Revision:       1,
+	}
+	nsSvc.store.namespaces[ns.Id] = copyNamespace(ns)
+
+	nsVars := make(map[string]*services.NamespaceVar)
+	for k, v := range vars {
+		nsVars[k] = &services.NamespaceVar{
+			Key:         k,
+			Value:       v,
+			OrgId:       orgId,
+			NamespaceId: ns.Id,
+		}
+	}
+	nsSvc.store.namespaceVars[ns.Id] = nsVars
+
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) ExistsByName(orgId string, nsName string) bool {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	return nsSvc.existsByName(orgId, nsName)
+}
+
+func (nsSvc *NamespaceService) existsByName(orgId string, nsName string) bool {
+	for _, ns := range nsSvc.store.namespaces {
+		if ns.OrganizationId == orgId && ns.Name == nsName {
+			return true
+		}
+	}
+	return false
+}
+
+func (nsSvc *NamespaceService) GetNamespaceById(orgId string, nsId string) (*services.Namespace, error) {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	ns, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	return copyNamespace(ns), nil
+}
+
+// Get the stored namespace. The caller must hold the store lock.
+func (nsSvc *NamespaceService) getNamespace(orgId string, nsId string) (*services.Namespace, error) {
+	ns, found := nsSvc.store.namespaces[nsId]
+	if !found || ns.OrganizationId != orgId {
+		return nil, services.ErrNamespaceNotFound
+	}
+	return ns, nil
+}
+
+// Get the stored schema version a namespace is pinned to. The caller must hold the store lock.
+func (nsSvc *NamespaceService) getSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	schemas := &SchemaService{store: nsSvc.store}
+	return schemas.getSchemaVersion(orgId, schemaId, schemaVersionId)
+}
+
+func (nsSvc *NamespaceService) ListNamespaces(orgId string) ([]*services.Namespace, error) {
+	return nsSvc.listNamespaces(func(ns *services.Namespace) bool {
+		return ns.OrganizationId == orgId
+	}), nil
+}
+
+func (nsSvc *NamespaceService) ListChildNamespaces(orgId string, nsId string) ([]*services.Namespace, error) {
+	return nsSvc.listNamespaces(func(ns *services.Namespace) bool {
+		return ns.OrganizationId == orgId && ns.ParentId == nsId
+	}), nil
+}
+
+func (nsSvc *NamespaceService) listNamespaces(match func(ns *services.Namespace) bool) []*services.Namespace {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	nsList := make([]*services.Namespace, 0)
+	for _, ns := range nsSvc.store.namespaces {
+		if match(ns) {
+			nsList = append(nsList, copyNamespace(ns))
+		}
+	}
+	sort.Slice(nsList, func(i, j int) bool {
+		return nsList[i].Name < nsList[j].Name
+	})
+	return nsList
+}
+
+func (nsSvc *NamespaceService) GetNamespaceAncestors(orgId string, nsId string) ([]*services.Namespace, error) {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	chain, err := services.WalkNamespaceAncestors(nsSvc.getNamespace, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	for i, ns := range chain {
+		chain[i] = copyNamespace(ns)
+	}
+	return chain, nil
+}
+
+func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName string, parentId string, schemaVersion string, revision int) (*services.Namespace, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	ns, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	if !services.RevisionMatches(revision, ns.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	if ns.Name != nsName && nsSvc.existsByName(orgId, nsName) {
+		return nil, services.ErrNamespaceAlreadyExists
+	}
+
+	err = services.CheckNamespaceParent(nsSvc.getNamespace, orgId, nsId, parentId)
+	if err != nil {
+		return nil, err
+	}
+	err = services.CheckNamespacePin(nsSvc.getSchemaVersion, orgId, ns.SchemaId, schemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.Name = nsName
+	ns.ParentId = parentId
+	ns.SchemaVersion = schemaVersion
+	ns.Revision++
+	return copyNamespace(ns), nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespace(orgId string, nsId string, revision int) error {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	ns, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return err
+	}
+	if !services.RevisionMatches(revision, ns.Revision) {
+		return services.ErrRevisionMismatch
+	}
+
+	for _, ns := range nsSvc.store.namespaces {
+		if ns.OrganizationId == orgId && ns.ParentId == nsId {
+			return services.ErrNamespaceHasChildren
+		}
+	}
+
+	delete(nsSvc.store.namespaces, nsId)
+	delete(nsSvc.store.namespaceVars, nsId)
+	return nil
+}
+
+func (nsSvc *NamespaceService) LockNamespace(orgId string, nsId string, lock services.NamespaceLock) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, &lock)
+}
+
+func (nsSvc *NamespaceService) UnlockNamespace(orgId string, nsId string) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, nil)
+}
+
+func (nsSvc *NamespaceService) setLock(orgId string, nsId string, lock *services.NamespaceLock) (*services.Namespace, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	ns, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.Lock = lock
+	ns.Revision++
+	return copyNamespace(ns), nil
+}
+
+func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*services.NamespaceVar, error) {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	var results []*services.NamespaceVar
+	for _, nsVar := range nsSvc.store.namespaceVars[nsId] {
+		if nsVar.OrgId == orgId {
+			results = append(results, copyNamespaceVar(nsVar))
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+	return results, nil
+}
+
+// Replace all of the variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) ReplaceNamespaceVariables(orgId string, nsId string, vars map[string]string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return vars, nil
+	})
+}
+
+// Upsert and delete variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) PatchNamespaceVariables(orgId string, nsId string, upserts map[string]string, deletes []string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return services.ApplyVariablePatch(current, upserts, deletes)
+	})
+}
+
+func (nsSvc *NamespaceService) changeVariables(orgId string, nsId string, revision int, change func(current map[string]string) (map[string]string, error)) (*services.VariableChangeSummary, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	ns, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	if !services.RevisionMatches(revision, ns.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	current := nsSvc.ownVariables(nsId)
+	desired, err := change(current)
+	if err != nil {
+		return nil, err
+	}
+	summary := services.DiffVariables(current, desired)
+
+	nsVars := make(map[string]*services.NamespaceVar)
+	for k, v := range desired {
+		nsVars[k] = &services.NamespaceVar{
+			Key:         k,
+			Value:       v,
+			OrgId:       orgId,
+			NamespaceId: nsId,
+		}
+	}
+	nsSvc.store.namespaceVars[nsId] = nsVars
+	ns.Revision++
+	summary.Revision = ns.Revision
+
+	return summary, nil
+}
+
+// Get the effective variables of a namespace, merged down the chain of parent namespaces
+func (nsSvc *NamespaceService) GetVariablesAsMap(orgId string, nsId string) (map[string]string, error) {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	chain, err := services.WalkNamespaceAncestors(nsSvc.getNamespace, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	return services.MergeNamespaceVariables(chain, func(ns *services.Namespace) (map[string]string, error) {
+		return nsSvc.ownVariables(ns.Id), nil
+	})
+}
+
+// Get the variables set directly on a namespace. The caller must hold the store lock.
+func (nsSvc *NamespaceService) ownVariables(nsId string) map[string]string {
+	result := make(map[string]string)
+	for k, nsVar := range nsSvc.store.namespaceVars[nsId] {
+		result[k] = nsVar.Value
+	}
+	return result
+}
+
+func (nsSvc *NamespaceService) GetNamespaceVariable(orgId string, nsId string, varId string) (*services.NamespaceVar, error) {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	nsVar, err := nsSvc.getVariable(orgId, nsId, varId)
+	if err != nil {
+		return nil, err
+	}
+	return copyNamespaceVar(nsVar), nil
+}
+
+// Get the stored namespace variable. The caller must hold the store lock.
+func (nsSvc *NamespaceService) getVariable(orgId string, nsId string, key string) (*services.NamespaceVar, error) {
+	nsVar, found := nsSvc.store.namespaceVars[nsId][key]
+	if !found || nsVar.OrgId != orgId {
+		return nil, services.ErrNamespaceVarNotFound
+	}
+	return nsVar, nil
+}
+
+func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string, key string, value string) (*services.NamespaceVar, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	_, err := nsSvc.getNamespace(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := nsSvc.store.namespaceVars[nsId][key]; found {
+		return nil, services.ErrNamespaceVarExists
+	}
+
+	newVar := &services.NamespaceVar{
+		OrgId:       orgId,
+		NamespaceId: nsId,
+		Key:         key,
+		Value:       value,
+	}
+	if nsSvc.store.namespaceVars[nsId] == nil {
+		nsSvc.store.namespaceVars[nsId] = make(map[string]*services.NamespaceVar)
+	}
+	nsSvc.store.namespaceVars[nsId][key] = copyNamespaceVar(newVar)
+	return newVar, nil
+}
+
+func (nsSvc *NamespaceService) UpdateNamespaceVariable(orgId string, nsId string, varId string, value string) (*services.NamespaceVar, error) {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	nsVar, err := nsSvc.getVariable(orgId, nsId, varId)
+	if err != nil {
+		return nil, err
+	}
+
+	nsVar.Value = value
+	return copyNamespaceVar(nsVar), nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespaceVariable(orgId string, nsId string, varId string) error {
+	nsSvc.store.mu.Lock()
+	defer nsSvc.store.mu.Unlock()
+
+	_, err := nsSvc.getVariable(orgId, nsId, varId)
+	if err != nil {
+		return err
+	}
+
+	delete(nsSvc.store.namespaceVars[nsId], varId)
+	return nil
+}
+
+func (nsSvc *NamespaceService) NamespaceVariableExists(orgId string, nsId string, varId string) bool {
+	nsSvc.store.mu.RLock()
+	defer nsSvc.store.mu.RUnlock()
+
+	_, err := nsSvc.getVariable(orgId, nsId, varId)
+	return err == nil
+}
@@ -0,0 +1,282 @@
+package memorybackend
+
+import (
+	"sort"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+type OrganizationService struct {
+	store *Store
+}
+
+func NewOrganizationService(store *Store) *OrganizationService {
+	return &OrganizationService{
+		store: store,
+	}
+}
+
+func (orgSvc *OrganizationService) NewOrganization(orgName string) (*services.Organization, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	if orgSvc.getOrganizationByName(orgName) != nil {
+		return nil, services.ErrOrganizationExists
+	}
+
+	newOrg := &services.Organization{
+		Id:       uuid.NewString(),
+		Name:     orgName,
+		OrgVars:  make(map[string]string),
+		Revision: 1,
+	}
+	orgSvc.store.organizations[newOrg.Id] = copyOrganization(newOrg)
+	return newOrg, nil
+}
+
+// Get the stored organization by name. The caller must hold the store lock.
+func (orgSvc *OrganizationService) getOrganizationByName(orgName string) *services.Organization {
+	for _, org := range orgSvc.store.organizations {
+		if org.Name == orgName {
+			return org
+		}
+	}
+	return nil
+}
+
+func (orgSvc *OrganizationService) GetOrganizationById(orgId string) (*services.Organization, error) {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	org, found := orgSvc.store.organizations[orgId]
+	if !found {
+		return nil, nil
+	}
+	return copyOrganization(org), nil
+}
+
+func (orgSvc *OrganizationService) ExistsById(orgId string) bool {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	_, found := orgSvc.store.organizations[orgId]
+	return found
+}
+
+func (orgSvc *OrganizationService) ExistsByName(orgName string) bool {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	return orgSvc.getOrganizationByName(orgName) != nil
+}
+
+func (orgSvc *OrganizationService) UpdateOrganization(orgId string, orgName string, orgVars map[string]string, revision int) (*services.Organization, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	org, found := orgSvc.store.organizations[orgId]
+	if !found {
+		return nil, services.ErrOrganizationNotFound
+	}
+	if !services.RevisionMatches(revision, org.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	if org.Name != orgName && orgSvc.getOrganizationByName(orgName) != nil {
+		return nil, services.ErrOrganizationExists
+	}
+
+	org.Name = orgName
+	org.OrgVars = copyStringMap(orgVars)
+	org.Revision++
+	return copyOrganization(org), nil
+}
+
+func (orgSvc *OrganizationService) DeleteOrganization(orgId string, deletion services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	return orgSvc.setDeletion(orgId, &deletion, revision)
+}
+
+func (orgSvc *OrganizationService) RestoreOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setDeletion(orgId, nil, revision)
+}
+
+func (orgSvc *OrganizationService) setDeletion(orgId string, deletion *services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	org, found := orgSvc.store.organizations[orgId]
+	if !found {
+		return nil, services.ErrOrganizationNotFound
+	}
+	if !services.RevisionMatches(revision, org.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+	org.Deletion = deletion
+	org.Revision++
+	return copyOrganization(org), nil
+}
+
+func (orgSvc *OrganizationService) PurgeOrganization(orgId string) error {
+	store := orgSvc.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, found := store.organizations[orgId]; !found {
+		return services.ErrOrganizationNotFound
+	}
+
+	for id, ns := range store.namespaces {
+		if ns.OrganizationId == orgId {
+			delete(store.namespaceVars, id)
+			delete(store.namespaces, id)
+		}
+	}
+	for id, schema := range store.schemas {
+		if schema.OrganizationId == orgId {
+			delete(store.schemaVersions, id)
+			delete(store.schemas, id)
+		}
+	}
+	for id, tpl := range store.templates {
+		if tpl.OrganizationId == orgId {
+			delete(store.templates, id)
+		}
+	}
+	for id, ak := range store.apiKeys {
+		if ak.OrganizationId == orgId {
+			delete(store.apiKeys, id)
+		}
+	}
+	for id, binding := range store.roleBindings {
+		if binding.OrganizationId == orgId {
+			delete(store.roleBindings, id)
+		}
+	}
+	snapshots := make([]*services.VariableSnapshot, 0, len(store.snapshots))
+	for _, snapshot := range store.snapshots {
+		if snapshot.OrganizationId != orgId {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	store.snapshots = snapshots
+
+	delete(store.organizations, orgId)
+	return nil
+}
+
+func (orgSvc *OrganizationService) ListOrganizations() ([]*services.Organization, error) {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	results := make([]*services.Organization, 0, len(orgSvc.store.organizations))
+	for _, org := range orgSvc.store.organizations {
+		results = append(results, copyOrganization(org))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func (orgSvc *OrganizationService) SuspendOrganization(orgId string, suspension services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	return orgSvc.setSuspension(orgId, &suspension, revision)
+}
+
+func (orgSvc *OrganizationService) ReactivateOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setSuspension(orgId, nil, revision)
+}
+
+func (orgSvc *OrganizationService) setSuspension(orgId string, suspension *services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	org, found := orgSvc.store.organizations[orgId]
+	if !found {
+		return nil, services.ErrOrganizationNotFound
+	}
+	if !services.RevisionMatches(revision, org.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+	org.Suspension = suspension
+	org.Revision++
+	return copyOrganization(org), nil
+}
+
+func (orgSvc *OrganizationService) SetFreezeWindows(orgId string, windows []services.FreezeWindow, revision int) (*services.Organization, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	org, found := orgSvc.store.organizations[orgId]
+	if !found {
+		return nil, nil
+	}
+	if !services.RevisionMatches(revision, org.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	org.FreezeWindows = append([]services.FreezeWindow{}, windows...)
+	org.Revision++
+	return copyOrganization(org), nil
+}
+
+func (orgSvc *OrganizationService) CreateNamespaceTemplate(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*services.NamespaceTemplate, error) {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	for _, tpl := range orgSvc.store.templates {
+		if tpl.OrganizationId == orgId && tpl.Name == name {
+			return nil, services.ErrTemplateAlreadyExists
+		}
+	}
+
+	tpl := &services.NamespaceTemplate{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Variables:      copyStringMap(vars),
+	}
+	orgSvc.store.templates[tpl.Id] = copyTemplate(tpl)
+	return tpl, nil
+}
+
+func (orgSvc *OrganizationService) ListNamespaceTemplates(orgId string) ([]*services.NamespaceTemplate, error) {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	results := make([]*services.NamespaceTemplate, 0)
+	for _, tpl := range orgSvc.store.templates {
+		if tpl.OrganizationId == orgId {
+			results = append(results, copyTemplate(tpl))
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func (orgSvc *OrganizationService) GetNamespaceTemplate(orgId string, templateId string) (*services.NamespaceTemplate, error) {
+	orgSvc.store.mu.RLock()
+	defer orgSvc.store.mu.RUnlock()
+
+	tpl, found := orgSvc.store.templates[templateId]
+	if !found || tpl.OrganizationId != orgId {
+		return nil, services.ErrTemplateNotFound
+	}
+	return copyTemplate(tpl), nil
+}
+
+func (orgSvc *OrganizationService) DeleteNamespaceTemplate(orgId string, templateId string) error {
+	orgSvc.store.mu.Lock()
+	defer orgSvc.store.mu.Unlock()
+
+	tpl, found := orgSvc.store.templates[templateId]
+	if !found || tpl.OrganizationId != orgId {
+		return services.ErrTemplateNotFound
+	}
+	delete(orgSvc.store.templates, templateId)
+	return nil
+}
@@ -0,0 +1,94 @@
+package memorybackend
+
+import (
+	"sort"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+type RoleBindingService struct {
+	store *Store
+}
+
+func NewRoleBindingService(store *Store) *RoleBindingService {
+	return &RoleBindingService{
+		store: store,
+	}
+}
+
+func (rbSvc *RoleBindingService) CreateRoleBinding(binding *services.RoleBinding) error {
+	rbSvc.store.mu.Lock()
+	defer rbSvc.store.mu.Unlock()
+
+	for _, existing := range rbSvc.store.roleBindings {
+		if services.SameRoleBinding(existing, binding) {
+			return services.ErrRoleBindingExists
+		}
+	}
+	c := *binding
+	rbSvc.store.roleBindings[binding.Id] = &c
+	return nil
+}
+
+func (rbSvc *RoleBindingService) ListRoleBindings(orgId string) ([]*services.RoleBinding, error) {
+	return rbSvc.list(func(b *services.RoleBinding) bool {
+		return b.OrganizationId == orgId
+	}), nil
+}
+
+func (rbSvc *RoleBindingService) ListSubjectRoleBindings(orgId string, subject string) ([]*services.RoleBinding, error) {
+	return rbSvc.list(func(b *services.RoleBinding) bool {
+		return b.OrganizationId == orgId && b.Subject == subject
+	}), nil
+}
+
+func (rbSvc *RoleBindingService) GetRoleBinding(orgId string, bindingId string) (*services.RoleBinding, error) {
+	bindings := rbSvc.list(func(b *services.RoleBinding) bool {
+		return b.OrganizationId == orgId && b.Id == bindingId
+	})
+	if len(bindings) == 0 {
+		return nil, services.ErrRoleBindingNotFound
+	}
+	return bindings[0], nil
+}
+
+func (rbSvc *RoleBindingService) list(match func(b *services.RoleBinding) bool) []*services.RoleBinding {
+	rbSvc.store.mu.RLock()
+	defer rbSvc.store.mu.RUnlock()
+
+	result := []*services.RoleBinding{}
+	for _, b := range rbSvc.store.roleBindings {
+		if match(b) {
+			c := *b
+			result = append(result, &c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+func (rbSvc *RoleBindingService) DeleteRoleBinding(orgId string, bindingId string) error {
+	rbSvc.store.mu.Lock()
+	defer rbSvc.store.mu.Unlock()
+
+	b, found := rbSvc.store.roleBindings[bindingId]
+	if !found || b.OrganizationId != orgId {
+		return services.ErrRoleBindingNotFound
+	}
+	delete(rbSvc.store.roleBindings, bindingId)
+	return nil
+}
+
+func (rbSvc *RoleBindingService) DeleteSubjectRoleBindings(orgId string, subject string) error {
+	rbSvc.store.mu.Lock()
+	defer rbSvc.store.mu.Unlock()
+
+	for id, b := range rbSvc.store.roleBindings {
+		if b.OrganizationId == orgId && b.Subject == subject {
+			delete(rbSvc.store.roleBindings, id)
+		}
+	}
+	return nil
+}
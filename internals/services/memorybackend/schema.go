@@ -0,0 +1,222 @@
+package memorybackend
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+type SchemaService struct {
+	store *Store
+}
+
+func NewSchemaService(store *Store) *SchemaService {
+	return &SchemaService{
+		store: store,
+	}
+}
+
+func (sSvc *SchemaService) CreateSchema(orgId string, name string) (*services.Schema, error) {
+	sSvc.store.mu.Lock()
+	defer sSvc.store.mu.Unlock()
+
+	for _, schema := range sSvc.store.schemas {
+		if schema.OrganizationId == orgId && schema.Name == name {
+			return nil, services.ErrSchemaAlreadyExists
+		}
+	}
+
+	newSchema := &services.Schema{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		Revision:       1,
+	}
+
+	newSchemaVersion := &services.SchemaVersion{
+		Id:        1,
+		SchemaId:  newSchema.Id,
+		Resources: make(map[string]string),
+		Revision:  1,
+	}
+
+	sSvc.store.schemas[newSchema.Id] = copySchema(newSchema)
+	sSvc.store.schemaVersions[newSchema.Id] = []*services.SchemaVersion{newSchemaVersion}
+	return newSchema, nil
+}
+
+// List schemas in a given organization by the organization ID
+func (sSvc *SchemaService) ListSchemaInOrganization(orgId string) ([]*services.Schema, error) {
+	sSvc.store.mu.RLock()
+	defer sSvc.store.mu.RUnlock()
+
+	results := make([]*services.Schema, 0)
+	for _, schema := range sSvc.store.schemas {
+		if schema.OrganizationId == orgId {
+			results = append(results, copySchema(schema))
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+func (sSvc *SchemaService) GetSchemaById(orgId string, schemaId string) (*services.Schema, error) {
+	sSvc.store.mu.RLock()
+	defer sSvc.store.mu.RUnlock()
+
+	schema := sSvc.getSchema(orgId, schemaId)
+	if schema == nil {
+		return nil, nil
+	}
+	return copySchema(schema), nil
+}
+
+// Get the stored schema. The caller must hold the store lock.
+func (sSvc *SchemaService) getSchema(orgId string, schemaId string) *services.Schema {
+	schema, found := sSvc.store.schemas[schemaId]
+	if !found || schema.OrganizationId != orgId {
+		return nil
+	}
+	return schema
+}
+
+// Update the name of a schema. The revision of the schema passed in is the one expected.
+func (sSvc *SchemaService) UpdateSchema(schema services.Schema) (*services.Schema, error) {
+	sSvc.store.mu.Lock()
+	defer sSvc.store.mu.Unlock()
+
+	existing := sSvc.getSchema(schema.OrganizationId, schema.Id)
+	if existing == nil {
+		return nil, services.ErrSchemaNotFound
+	}
+	if !services.RevisionMatches(schema.Revision, existing.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	if existing.Name != schema.Name {
+		for _, other := range sSvc.store.schemas {
+			if other.OrganizationId == schema.OrganizationId && other.Name == schema.Name {
+				return nil, services.ErrSchemaAlreadyExists
+			}
+		}
+	}
+	existing.Name = schema.Name
+	existing.Revision++
+	return copySchema(existing), nil
+}
+
+func (sSvc *SchemaService) DeleteSchema(orgId string, schemaId string, revision int) error {
+	sSvc.store.mu.Lock()
+	defer sSvc.store.mu.Unlock()
+
+	schema := sSvc.getSchema(orgId, schemaId)
+	if schema == nil {
+		return services.ErrSchemaNotFound
+	}
+	if !services.RevisionMatches(revision, schema.Revision) {
+		return services.ErrRevisionMismatch
+	}
+
+	for _, ns := range sSvc.store.namespaces {
+		if ns.OrganizationId == orgId && ns.SchemaId == schemaId {
+			return services.ErrSchemaInUse
+		}
+	}
+	delete(sSvc.store.schemas, schemaId)
+	delete(sSvc.store.schemaVersions, schemaId)
+	return nil
+}
+
+func (sSvc *SchemaService) ListSchemaVersions(orgId string, schemaId string) ([]*services.SchemaVersion, error) {
+	sSvc.store.mu.RLock()
+	defer sSvc.store.mu.RUnlock()
+
+	if sSvc.getSchema(orgId, schemaId) == nil {
+		return nil, services.ErrSchemaNotFound
+	}
+
+	var results []*services.SchemaVersion
+	for _, sv := range sSvc.store.schemaVersions[schemaId] {
+		results = append(results, copySchemaVersion(sv))
+	}
+	return results, nil
+}
+
+func (sSvc *SchemaService) CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
+	sSvc.store.mu.Lock()
+	defer sSvc.store.mu.Unlock()
+
+	latestVersion, err := sSvc.getSchemaVersion(orgId, schemaId, "latest")
+	if err != nil {
+		return nil, err
+	}
+
+	newSchemaVersion := &services.SchemaVersion{
+		Id:        latestVersion.Id + 1,
+		SchemaId:  schemaId,
+		Resources: copyStringMap(resources),
+		Published: published,
+		Revision:  1,
+	}
+	sSvc.store.schemaVersions[schemaId] = append(sSvc.store.schemaVersions[schemaId], copySchemaVersion(newSchemaVersion))
+	return newSchemaVersion, nil
+}
+
+func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	sSvc.store.mu.RLock()
+	defer sSvc.store.mu.RUnlock()
+
+	sv, err := sSvc.getSchemaVersion(orgId, schemaId, schemaVersionId)
+	if err != nil {
+		return nil, err
+	}
+	return copySchemaVersion(sv), nil
+}
+
+// Get the stored schema version by number or "latest". The caller must hold the store lock.
+func (sSvc *SchemaService) getSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	if sSvc.getSchema(orgId, schemaId) == nil {
+		return nil, services.ErrSchemaNotFound
+	}
+
+	versions := sSvc.store.schemaVersions[schemaId]
+	if schemaVersionId == "latest" {
+		if len(versions) == 0 {
+			return nil, services.ErrSchemaVersionNotFound
+		}
+		return versions[len(versions)-1], nil
+	}
+
+	versionIdInt, err := strconv.Atoi(schemaVersionId)
+	if err != nil {
+		return nil, services.ErrSchemaVersionNotFound
+	}
+	for _, sv := range versions {
+		if sv.Id == versionIdInt {
+			return sv, nil
+		}
+	}
+	return nil, services.ErrSchemaVersionNotFound
+}
+
+func (sSvc *SchemaService) UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool, revision int) (*services.SchemaVersion, error) {
+	sSvc.store.mu.Lock()
+	defer sSvc.store.mu.Unlock()
+
+	sv, err := sSvc.getSchemaVersion(orgId, schemaId, schemaVersionId)
+	if err != nil {
+		return nil, err
+	}
+	if !services.RevisionMatches(revision, sv.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	sv.Published = published
+	sv.Resources = copyStringMap(resources)
+	sv.Revision++
+	return copySchemaVersion(sv), nil
+}
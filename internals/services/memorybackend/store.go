@@ -0,0 +1,117 @@
+package memorybackend
+
+import (
+	"sync"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+// Store holds all of the data for the in-memory backend. The services created from
+// a store share its data, in the same way the MongoDB services share a database.
+type Store struct {
+	mu             sync.RWMutex
+	organizations  map[string]*services.Organization
+	templates      map[string]*services.NamespaceTemplate
+	namespaces     map[string]*services.Namespace
+	namespaceVars  map[string]map[string]*services.NamespaceVar
+	schemas        map[string]*services.Schema
+	schemaVersions map[string][]*services.SchemaVersion
+	apiKeys        map[string]*services.ApiKey
+	auditEvents    []*services.AuditEvent
+	snapshots      []*services.VariableSnapshot
+	roleBindings   map[string]*services.RoleBinding
+}
+
+func NewStore() *Store {
+	return &Store{
+		organizations:  make(map[string]*services.Organization),
+		templates:      make(map[string]*services.NamespaceTemplate),
+		namespaces:     make(map[string]*services.Namespace),
+		namespaceVars:  make(map[string]map[string]*services.NamespaceVar),
+		schemas:        make(map[string]*services.Schema),
+		schemaVersions: make(map[string][]*services.SchemaVersion),
+		apiKeys:        make(map[string]*services.ApiKey),
+		roleBindings:   make(map[string]*services.RoleBinding),
+	}
+}
+
+func copyStringMap(src map[string]string) map[string]string {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]string, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func copyOrganization(org *services.Organization) *services.Organization {
+	c := *org
+	c.OrgVars = copyStringMap(org.OrgVars)
+	if org.FreezeWindows != nil {
+		c.FreezeWindows = append([]services.FreezeWindow{}, org.FreezeWindows...)
+	}
+	if org.Suspension != nil {
+		suspension := *org.Suspension
+		c.Suspension = &suspension
+	}
+	if org.Deletion != nil {
+		deletion := *org.Deletion
+		c.Deletion = &deletion
+	}
+	return &c
+}
+
+func copyNamespace(ns *services.Namespace) *services.Namespace {
+	c := *ns
+	if ns.Lock != nil {
+		lock := *ns.Lock
+		c.Lock = &lock
+	}
+	return &c
+}
+
+func copyNamespaceVar(nsVar *services.NamespaceVar) *services.NamespaceVar {
+	c := *nsVar
+	return &c
+}
+
+func copyTemplate(tpl *services.NamespaceTemplate) *services.NamespaceTemplate {
+	c := *tpl
+	c.Variables = copyStringMap(tpl.Variables)
+	return &c
+}
+
+func copySchema(schema *services.Schema) *services.Schema {
+	c := *schema
+	return &c
+}
+
+func copySchemaVersion(sv *services.SchemaVersion) *services.SchemaVersion {
+	c := *sv
+	c.Resources = copyStringMap(sv.Resources)
+	return &c
+}
+
+func copyApiKey(ak *services.ApiKey) *services.ApiKey {
+	c := *ak
+	c.Scope = copyStringMap(ak.Scope)
+	return &c
+}
+
+func copyAuditEvent(event *services.AuditEvent) *services.AuditEvent {
+	c := *event
+	c.Before = append([]byte(nil), event.Before...)
+	c.After = append([]byte(nil), event.After...)
+	return &c
+}
+
+func copySnapshot(snapshot *services.VariableSnapshot) *services.VariableSnapshot {
+	c := *snapshot
+	c.Variables = copyStringMap(snapshot.Variables)
+	if snapshot.ResolvedSchemaVersion != nil {
+		c.ResolvedSchemaVersion = copySchemaVersion(snapshot.ResolvedSchemaVersion)
+	}
+	return &c
+}
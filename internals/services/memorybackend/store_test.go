@@ -0,0 +1,23 @@
+package memorybackend
+
+import (
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/servicestest"
+)
+
+func TestProviders(t *testing.T) {
+	servicestest.RunProvidersSuite(t, func(t *testing.T) *services.Providers {
+		store := NewStore()
+		return &services.Providers{
+			ApiKeys:       NewApiKeyService(store),
+			Namespaces:    NewNamespaceService(store),
+			Organizations: NewOrganizationService(store),
+			Schemas:       NewSchemaService(store),
+			Audit:         NewAuditService(store),
+			History:       NewVariableHistoryService(store),
+			RoleBindings:  NewRoleBindingService(store),
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is a versioned change to the data held by a storage backend
+type Migration struct {
+	Version     int
+	Description string
+}
+
+// AppliedMigration is a migration recorded as applied in the database
+type AppliedMigration struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrator is implemented by the storage backends that keep data between restarts
+type Migrator interface {
+	// Migrations returns every migration known to the backend, ordered by version
+	Migrations() []Migration
+	// AppliedMigrations returns the migrations recorded as applied in the database
+	AppliedMigrations() ([]AppliedMigration, error)
+	// ApplyMigration runs a migration and records it as applied. Applying a migration
+	// that is already recorded, for example by another instance, does nothing.
+	ApplyMigration(version int) error
+}
+
+// PendingMigrations returns the migrations known to m that have not been applied. It fails
+// if the database records a migration this build does not know, which means the data was
+// written by a newer release.
+func PendingMigrations(m Migrator) ([]Migration, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	applied, err := m.AppliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	known := map[int]bool{}
+	for _, migration := range m.Migrations() {
+		known[migration.Version] = true
+	}
+	done := map[int]bool{}
+	for _, migration := range applied {
+		if !known[migration.Version] {
+			return nil, fmt.Errorf("database has migration %d applied which is newer than this release", migration.Version)
+		}
+		done[migration.Version] = true
+	}
+
+	pending := []Migration{}
+	for _, migration := range m.Migrations() {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// RunMigrations applies the pending migrations of m in order and returns them. With dryRun
+// the pending migrations are only reported.
+func RunMigrations(m Migrator, dryRun bool) ([]Migration, error) {
+	pending, err := PendingMigrations(m)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range pending {
+		if dryRun {
+			log.Printf("Would apply migration %d: %s", migration.Version, migration.Description)
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", migration.Version, migration.Description)
+		err = m.ApplyMigration(migration.Version)
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %d failed: %w", migration.Version, err)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMigrator struct {
+	migrations []Migration
+	applied    []AppliedMigration
+	failOn     int
+}
+
+func (f *fakeMigrator) Migrations() []Migration {
+	return f.migrations
+}
+
+func (f *fakeMigrator) AppliedMigrations() ([]AppliedMigration, error) {
+	return f.applied, nil
+}
+
+func (f *fakeMigrator) ApplyMigration(version int) error {
+	if version == f.failOn {
+		return errors.New("boom")
+	}
+	f.applied = append(f.applied, AppliedMigration{Migration: Migration{Version: version}, AppliedAt: time.Now()})
+	return nil
+}
+
+func newFakeMigrator() *fakeMigrator {
+	return &fakeMigrator{
+		migrations: []Migration{{1, "first"}, {2, "second"}, {3, "third"}},
+		applied:    []AppliedMigration{{Migration: Migration{1, "first"}}},
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	m := newFakeMigrator()
+
+	pending, err := RunMigrations(m, true)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{{2, "second"}, {3, "third"}}, pending)
+	assert.Len(t, m.applied, 1, "a dry run applies nothing")
+
+	pending, err = RunMigrations(m, false)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+	assert.Len(t, m.applied, 3)
+
+	pending, err = RunMigrations(m, false)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	pending, err = RunMigrations(nil, false)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestRunMigrationsStopsAtFailure(t *testing.T) {
+	m := newFakeMigrator()
+	m.failOn = 3
+
+	applied, err := RunMigrations(m, false)
+	assert.Error(t, err)
+	assert.Equal(t, []Migration{{2, "second"}}, applied)
+	assert.Len(t, m.applied, 2)
+}
+
+func TestPendingMigrationsRejectsNewerDatabase(t *testing.T) {
+	m := newFakeMigrator()
+	m.applied = append(m.applied, AppliedMigration{Migration: Migration{Version: 4}})
+
+	_, err := PendingMigrations(m)
+	assert.Error(t, err)
+}
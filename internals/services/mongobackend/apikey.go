@@ -1,70 +1,55 @@
 package mongobackend
 
 import (
-	"context"
-	"fmt"
-	"math/rand"
+	"log"
 	"time"
 
-	"github.com/MrWestbury/terraxen-naming-service/internals/config"
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
-	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ApiKeyService struct {
 	BaseService
 }
 
-func NewApiKeyService(cfg *config.Config) *ApiKeyService {
+func NewApiKeyService(db *DB) *ApiKeyService {
 	apiKeySvc := &ApiKeyService{}
-	apiKeySvc.Connect(cfg)
-	apiKeySvc.collection = apiKeySvc.client.Collection("api_keys")
+	apiKeySvc.db = db
+	apiKeySvc.collection = db.database.Collection("api_keys")
 	return apiKeySvc
 }
 
-func (akSvc *ApiKeyService) GenerateNewApiKey(orgId string) (*services.ApiKey, error) {
-	randStr := RandString(20)
-	duration, _ := time.ParseDuration("1h")
-	expires := time.Now().Add(duration)
-	ak := &services.ApiKey{
-		Id:             uuid.NewString(),
-		OrganizationId: orgId,
-		Key:            fmt.Sprintf("API-%s", randStr),
-		Expires:        expires,
-		Scope:          make(map[string]string),
-	}
-
-	ctx := context.Background()
-	akSvc.collection.InsertOne(ctx, ak)
-
-	return ak, nil
-}
+func (akSvc *ApiKeyService) GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*services.ApiKey, error) {
+	ak := services.NewApiKey(orgId, name, expires, scope)
 
-func RandString(n int) string {
-	src := rand.NewSource(time.Now().UnixNano())
-	letterBytes := "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[src.Int63()%int64(len(letterBytes))]
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
+	_, err := akSvc.collection.InsertOne(ctx, ak.WithoutSecret())
+	if err != nil {
+		return nil, err
 	}
-	return string(b)
 
+	return ak, nil
 }
 
 func (akSvc *ApiKeyService) ListKeys(orgId string) ([]*services.ApiKey, error) {
-	ctx := context.Background()
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
 	filter := bson.D{
 		primitive.E{Key: "organizationid", Value: orgId},
 	}
-	cur, err := akSvc.collection.Find(ctx, filter)
-	defer CloseCursor(ctx, cur)
+	opts := options.Find()
+	opts.SetSort(bson.D{primitive.E{Key: "id", Value: 1}})
 
+	cur, err := akSvc.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer CloseCursor(ctx, cur)
+
 	var result []*services.ApiKey
 	for cur.Next(ctx) {
 		var apiKey services.ApiKey
@@ -79,22 +64,100 @@ func (akSvc *ApiKeyService) ListKeys(orgId string) ([]*services.ApiKey, error) {
 }
 
 func (akSvc *ApiKeyService) GetKey(key string) *services.ApiKey {
-	ctx := context.Background()
-	result := akSvc.collection.FindOne(ctx, bson.M{"key": key})
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
+	cur, err := akSvc.collection.Find(ctx, bson.M{"prefix": services.ApiKeyPrefix(key)})
+	if err != nil {
+		log.Printf("failed to look up api key: %v", err)
+		return nil
+	}
+	defer CloseCursor(ctx, cur)
+
+	// Prefixes are short enough that two keys can share one
+	for cur.Next(ctx) {
+		var apiKey services.ApiKey
+		if err := cur.Decode(&apiKey); err != nil {
+			log.Printf("failed to look up api key: %v", err)
+			return nil
+		}
+		if apiKey.Matches(key) {
+			return &apiKey
+		}
+	}
+	return nil
+}
+
+func (akSvc *ApiKeyService) GetKeyById(apiId string) *services.ApiKey {
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
+	result := akSvc.collection.FindOne(ctx, bson.M{"id": apiId})
 	if result.Err() == mongo.ErrNoDocuments {
 		return nil
 	}
 	var apiKey services.ApiKey
-	result.Decode(&apiKey)
+	if err := result.Decode(&apiKey); err != nil {
+		log.Printf("failed to get api key: %v", err)
+		return nil
+	}
 	return &apiKey
 }
 
+// RotateKey stores the successor first and removes it again if the key cannot be marked as
+// replaced, as there is no transaction across the two documents
+func (akSvc *ApiKeyService) RotateKey(rotated *services.ApiKey, successor *services.ApiKey) error {
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
+
+	if _, err := akSvc.collection.InsertOne(ctx, successor.WithoutSecret()); err != nil {
+		return err
+	}
+
+	filter := bson.M{"id": rotated.Id, "replacedby": bson.M{"$in": bson.A{nil, ""}}}
+	update := bson.M{"$set": bson.M{"replacedby": rotated.ReplacedBy, "expires": rotated.Expires}}
+	result, err := akSvc.collection.UpdateOne(ctx, filter, update)
+	if err == nil && result.MatchedCount == 1 {
+		return nil
+	}
+
+	if _, delErr := akSvc.collection.DeleteOne(ctx, bson.M{"id": successor.Id}); delErr != nil {
+		log.Printf("failed to remove successor %s of api key %s: %v", successor.Id, rotated.Id, delErr)
+	}
+	if err != nil {
+		return err
+	}
+	count, err := akSvc.collection.CountDocuments(ctx, bson.M{"id": rotated.Id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return services.ErrApiKeyNotFound
+	}
+	return services.ErrApiKeyRotated
+}
+
+func (akSvc *ApiKeyService) SetKeyLastUsed(apiId string, at time.Time) error {
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
+
+	result, err := akSvc.collection.UpdateOne(ctx, bson.M{"id": apiId}, bson.M{"$set": bson.M{"lastusedat": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrApiKeyNotFound
+	}
+	return nil
+}
+
 func (akSvc *ApiKeyService) DeleteKey(apiId string) error {
-	ctx := context.Background()
+	ctx, cancel := akSvc.db.context()
+	defer cancel()
 
 	filter := bson.M{"id": apiId}
 	result := akSvc.collection.FindOneAndDelete(ctx, filter)
-	if result.Err() != nil {
+	if result.Err() == mongo.ErrNoDocuments {
+		return services.ErrApiKeyNotFound
+	} else if result.Err() != nil {
 		return result.Err()
 	}
 	return nil
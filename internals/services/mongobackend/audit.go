@@ -0,0 +1,128 @@
+package mongobackend
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditService struct {
+	BaseService
+}
+
+func NewAuditService(db *DB) *AuditService {
+	auditSvc := &AuditService{}
+	auditSvc.db = db
+	auditSvc.collection = db.database.Collection("audit")
+	return auditSvc
+}
+
+// auditDocument is an audit event as stored. The resource snapshots are kept as JSON text,
+// as they may be any JSON value rather than a document.
+type auditDocument struct {
+	Id             string    `bson:"id"`
+	OrganizationId string    `bson:"organizationid"`
+	Time           time.Time `bson:"time"`
+	Actor          string    `bson:"actor"`
+	RequestId      string    `bson:"requestid"`
+	Action         string    `bson:"action"`
+	ResourceType   string    `bson:"resourcetype"`
+	ResourceId     string    `bson:"resourceid"`
+	Before         string    `bson:"before,omitempty"`
+	After          string    `bson:"after,omitempty"`
+}
+
+func (doc *auditDocument) event() *services.AuditEvent {
+	event := &services.AuditEvent{
+		Id:             doc.Id,
+		OrganizationId: doc.OrganizationId,
+		Time:           doc.Time.UTC(),
+		Actor:          doc.Actor,
+		RequestId:      doc.RequestId,
+		Action:         doc.Action,
+		ResourceType:   doc.ResourceType,
+		ResourceId:     doc.ResourceId,
+	}
+	if doc.Before != "" {
+		event.Before = json.RawMessage(doc.Before)
+	}
+	if doc.After != "" {
+		event.After = json.RawMessage(doc.After)
+	}
+	return event
+}
+
+func (aSvc *AuditService) RecordEvent(event *services.AuditEvent) error {
+	doc := auditDocument{
+		Id:             event.Id,
+		OrganizationId: event.OrganizationId,
+		Time:           event.Time,
+		Actor:          event.Actor,
+		RequestId:      event.RequestId,
+		Action:         event.Action,
+		ResourceType:   event.ResourceType,
+		ResourceId:     event.ResourceId,
+		Before:         string(event.Before),
+		After:          string(event.After),
+	}
+
+	ctx, cancel := aSvc.db.context()
+	defer cancel()
+	_, err := aSvc.collection.InsertOne(ctx, doc)
+	return err
+}
+
+func (aSvc *AuditService) ListEvents(orgId string, filter services.AuditFilter) ([]*services.AuditEvent, error) {
+	query := bson.M{"organizationid": orgId}
+	fields := map[string]string{
+		"actor":        filter.Actor,
+		"requestid":    filter.RequestId,
+		"action":       filter.Action,
+		"resourcetype": filter.ResourceType,
+		"resourceid":   filter.ResourceId,
+	}
+	for field, value := range fields {
+		if value != "" {
+			query[field] = value
+		}
+	}
+	period := bson.M{}
+	if !filter.Since.IsZero() {
+		period["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		period["$lt"] = filter.Until
+	}
+	if len(period) > 0 {
+		query["time"] = period
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "id", Value: -1}})
+	if filter.Offset > 0 {
+		opts.SetSkip(int64(filter.Offset))
+	}
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	ctx, cancel := aSvc.db.context()
+	defer cancel()
+	cur, err := aSvc.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	result := []*services.AuditEvent{}
+	for cur.Next(ctx) {
+		var doc auditDocument
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		result = append(result, doc.event())
+	}
+	return result, cur.Err()
+}
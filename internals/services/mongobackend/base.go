@@ -5,37 +5,156 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"time"
 
 	"github.com/MrWestbury/terraxen-naming-service/internals/config"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
-type BaseService struct {
-	client     *mongo.Database
-	collection *mongo.Collection
+const (
+	defaultConnectTimeout   = 10 * time.Second
+	defaultOperationTimeout = 30 * time.Second
+)
+
+// DB is a MongoDB client shared by the services of the mongo backend
+type DB struct {
+	client   *mongo.Client
+	database *mongo.Database
+	timeout  time.Duration
 }
 
-func (bs *BaseService) Connect(cfg *config.Config) {
+// Open connects to the database described by the config. Pending migrations are not applied.
+func Open(cfg *config.Config) (*DB, error) {
+	uri, serverAPIVersion := connectionURI(cfg)
+
+	dbName := cfg.DBName
+	if dbName == "" {
+		cs, err := connstring.ParseAndValidate(uri)
+		if err != nil {
+			return nil, err
+		}
+		dbName = cs.Database
+	}
+	if dbName == "" {
+		return nil, errors.New("database not selected")
+	}
 
-	uri := fmt.Sprintf("mongodb+srv://%s:%s@%s/%s?retryWrites=true&w=majority", cfg.Username, cfg.Password, cfg.DBHost, cfg.DBName)
+	clientOptions := options.Client().ApplyURI(uri)
+	if serverAPIVersion != "" {
+		clientOptions.SetServerAPIOptions(options.ServerAPI(options.ServerAPIVersion(serverAPIVersion)))
+	}
+	if cfg.Mongo.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(cfg.Mongo.MaxPoolSize)
+	}
+	if cfg.Mongo.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(cfg.Mongo.MinPoolSize)
+	}
+	if cfg.Mongo.MaxConnIdleTime > 0 {
+		clientOptions.SetMaxConnIdleTime(time.Duration(cfg.Mongo.MaxConnIdleTime) * time.Second)
+	}
 
-	serverAPIOptions := options.ServerAPI(options.ServerAPIVersion1)
-	clientOptions := options.Client().
-		ApplyURI(uri).
-		SetServerAPIOptions(serverAPIOptions)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	connectTimeout := defaultConnectTimeout
+	if cfg.Mongo.ConnectTimeout > 0 {
+		connectTimeout = time.Duration(cfg.Mongo.ConnectTimeout) * time.Second
+	}
+	clientOptions.SetConnectTimeout(connectTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
 	defer cancel()
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to connect to mongo: %w", err)
+	}
+
+	db := &DB{
+		client:   client,
+		database: client.Database(dbName),
+		timeout:  defaultOperationTimeout,
+	}
+	if cfg.Mongo.OperationTimeout > 0 {
+		db.timeout = time.Duration(cfg.Mongo.OperationTimeout) * time.Second
+	}
+	return db, nil
+}
+
+// connectionURI returns the configured connection string and the server API version to
+// request. Without a URI it falls back to an Atlas style mongodb+srv connection string.
+func connectionURI(cfg *config.Config) (string, string) {
+	if cfg.Mongo.URI != "" {
+		return cfg.Mongo.URI, cfg.Mongo.ServerAPIVersion
+	}
+
+	uri := url.URL{
+		Scheme:   "mongodb+srv",
+		Host:     cfg.DBHost,
+		Path:     "/" + cfg.DBName,
+		RawQuery: "retryWrites=true&w=majority",
+	}
+	if cfg.Username != "" {
+		uri.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+
+	serverAPIVersion := cfg.Mongo.ServerAPIVersion
+	if serverAPIVersion == "" {
+		serverAPIVersion = string(options.ServerAPIVersion1)
+	}
+	return uri.String(), serverAPIVersion
+}
+
+// Close disconnects the client, waiting for in flight operations up to the operation timeout
+func (db *DB) Close() error {
+	ctx, cancel := db.context()
+	defer cancel()
+	return db.client.Disconnect(ctx)
+}
+
+// context returns a context bounded by the operation timeout. The provider interfaces take no
+// context, so operations are not cancelled with the request that started them.
+func (db *DB) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), db.timeout)
+}
+
+type BaseService struct {
+	db         *DB
+	collection *mongo.Collection
+}
+
+// withRevision returns a copy of filter that also matches the expected revision, unless it is 0
+func withRevision(filter bson.M, revision int) bson.M {
+	result := bson.M{}
+	for k, v := range filter {
+		result[k] = v
+	}
+	if revision != 0 {
+		result["revision"] = revision
+	}
+	return result
+}
+
+// notUpdated explains why a compare-and-swap write matched no documents. Either the document
+// matching filter no longer exists, or its revision has moved on.
+func (bs *BaseService) notUpdated(filter bson.M, notFound error) error {
+	ctx, cancel := bs.db.context()
+	defer cancel()
+	count, err := bs.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
 	}
-	db := client.Database(cfg.DBName)
-	if db == nil {
-		log.Panic(errors.New("database not selected"))
+	if count == 0 {
+		return notFound
 	}
-	bs.client = db
+	return services.ErrRevisionMismatch
 }
 
 func CloseCursor(ctx context.Context, cur *mongo.Cursor) {
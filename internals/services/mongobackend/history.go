@@ -0,0 +1,75 @@
+package mongobackend
+
+import (
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Snapshots taken in the same millisecond are ordered by their generated object IDs, which
+// increase in the order they are inserted
+var newestSnapshotFirst = bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}
+
+type VariableHistoryService struct {
+	BaseService
+}
+
+func NewVariableHistoryService(db *DB) *VariableHistoryService {
+	historySvc := &VariableHistoryService{}
+	historySvc.db = db
+	historySvc.collection = db.database.Collection("variablehistory")
+	return historySvc
+}
+
+func (hSvc *VariableHistoryService) RecordSnapshot(snapshot *services.VariableSnapshot) error {
+	ctx, cancel := hSvc.db.context()
+	defer cancel()
+	_, err := hSvc.collection.InsertOne(ctx, snapshot)
+	return err
+}
+
+func (hSvc *VariableHistoryService) ListSnapshots(orgId string, nsId string) ([]*services.VariableSnapshot, error) {
+	ctx, cancel := hSvc.db.context()
+	defer cancel()
+
+	filter := bson.M{"organizationid": orgId, "namespaceid": nsId}
+	cur, err := hSvc.collection.Find(ctx, filter, options.Find().SetSort(newestSnapshotFirst))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	result := []*services.VariableSnapshot{}
+	for cur.Next(ctx) {
+		var snapshot services.VariableSnapshot
+		if err := cur.Decode(&snapshot); err != nil {
+			return nil, err
+		}
+		snapshot.Time = snapshot.Time.UTC()
+		result = append(result, &snapshot)
+	}
+	return result, cur.Err()
+}
+
+func (hSvc *VariableHistoryService) SnapshotAt(orgId string, nsId string, at time.Time) (*services.VariableSnapshot, error) {
+	ctx, cancel := hSvc.db.context()
+	defer cancel()
+
+	filter := bson.M{"organizationid": orgId, "namespaceid": nsId, "time": bson.M{"$lte": at}}
+	result := hSvc.collection.FindOne(ctx, filter, options.FindOne().SetSort(newestSnapshotFirst))
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var snapshot services.VariableSnapshot
+	if err := result.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	snapshot.Time = snapshot.Time.UTC()
+	return &snapshot, nil
+}
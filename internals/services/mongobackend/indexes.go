@@ -0,0 +1,130 @@
+package mongobackend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Names of the unique indexes whose violations are translated into services errors
+const (
+	organizationsNameIndex      = "organizations_name_key"
+	namespacesNameIndex         = "namespaces_organization_name_key"
+	namespaceVarsKeyIndex       = "namespacevars_namespace_key_key"
+	schemasNameIndex            = "schemas_organization_name_key"
+	schemaVersionsIdIndex       = "schemaversions_schema_version_key"
+	namespaceTemplatesNameIndex = "namespacetemplates_organization_name_key"
+)
+
+// The unique index on plaintext API keys, dropped when they were hashed
+const legacyApiKeysKeyIndex = "api_keys_key_key"
+
+// collectionIndexes lists the indexes each collection needs. Uniqueness that the services
+// rely on is enforced here rather than by checking before inserting.
+var collectionIndexes = map[string][]mongo.IndexModel{
+	"organizations": {
+		uniqueIndex("organizations_id_key", "id"),
+		uniqueIndex(organizationsNameIndex, "name"),
+	},
+	"namespaces": {
+		uniqueIndex("namespaces_id_key", "id"),
+		uniqueIndex(namespacesNameIndex, "organizationid", "name"),
+		lookupIndex("namespaces_parent_idx", "organizationid", "parentid"),
+		lookupIndex("namespaces_schema_idx", "organizationid", "schemaid"),
+	},
+	"namespacevars": {
+		uniqueIndex(namespaceVarsKeyIndex, "namespaceid", "key"),
+		lookupIndex("namespacevars_namespace_idx", "orgid", "namespaceid"),
+	},
+	"schemas": {
+		uniqueIndex("schemas_id_key", "id"),
+		uniqueIndex(schemasNameIndex, "organizationid", "name"),
+	},
+	"schemaversions": {
+		uniqueIndex(schemaVersionsIdIndex, "schemaid", "id"),
+	},
+	"namespacetemplates": {
+		uniqueIndex("namespacetemplates_id_key", "id"),
+		uniqueIndex(namespaceTemplatesNameIndex, "organizationid", "name"),
+	},
+	"api_keys": {
+		uniqueIndex("api_keys_id_key", "id"),
+		lookupIndex("api_keys_organization_idx", "organizationid"),
+		lookupIndex("api_keys_prefix_idx", "prefix"),
+	},
+	"audit": {
+		uniqueIndex("audit_id_key", "id"),
+		{
+			Keys:    bson.D{{Key: "organizationid", Value: 1}, {Key: "time", Value: -1}},
+			Options: options.Index().SetName("audit_organization_time_idx"),
+		},
+	},
+	"rolebindings": {
+		uniqueIndex("rolebindings_id_key", "id"),
+		uniqueIndex(roleBindingsIndex, "organizationid", "subject", "role", "resourcetype", "resourceid"),
+	},
+	"variablehistory": {
+		{
+			Keys:    bson.D{{Key: "organizationid", Value: 1}, {Key: "namespaceid", Value: 1}, {Key: "time", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("variablehistory_subject_time_idx"),
+		},
+	},
+}
+
+func indexKeys(fields []string) bson.D {
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	return keys
+}
+
+func uniqueIndex(name string, fields ...string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    indexKeys(fields),
+		Options: options.Index().SetName(name).SetUnique(true),
+	}
+}
+
+func lookupIndex(name string, fields ...string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    indexKeys(fields),
+		Options: options.Index().SetName(name),
+	}
+}
+
+// ensureIndexes creates any missing indexes. Creating an index that already exists is a
+// no-op, so instances racing to apply the migration do not conflict.
+func (db *DB) ensureIndexes() error {
+	for collection, indexes := range collectionIndexes {
+		ctx, cancel := db.context()
+		_, err := db.database.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to create indexes on %s, check for duplicate documents: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// isDuplicateKey reports whether err is a violation of the named unique index
+func isDuplicateKey(err error, index string) bool {
+	if !mongo.IsDuplicateKeyError(err) {
+		return false
+	}
+	return strings.Contains(err.Error(), "index: "+index+" ")
+}
+
+// isIndexNotFound reports whether err is from dropping an index, or from a collection, that
+// does not exist
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	return cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound"
+}
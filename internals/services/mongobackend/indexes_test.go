@@ -0,0 +1,55 @@
+package mongobackend
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	err := mongo.WriteException{
+		WriteErrors: []mongo.WriteError{{
+			Code:    11000,
+			Message: `E11000 duplicate key error collection: terraxen.organizations index: organizations_name_key dup key: { name: "acme" }`,
+		}},
+	}
+
+	assert.True(t, isDuplicateKey(err, organizationsNameIndex))
+	assert.False(t, isDuplicateKey(err, "organizations_name"))
+	assert.False(t, isDuplicateKey(err, schemasNameIndex))
+	assert.False(t, isDuplicateKey(errors.New("index: organizations_name_key "), organizationsNameIndex))
+	assert.False(t, isDuplicateKey(nil, organizationsNameIndex))
+}
+
+func TestConcurrentCreatesAreUnique(t *testing.T) {
+	orgSvc := NewOrganizationService(openTestDB(t))
+	name := "org-" + uuid.NewString()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := orgSvc.NewOrganization(name)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.Equal(t, services.ErrOrganizationExists, err)
+		}
+	}
+	assert.Equal(t, 1, created)
+}
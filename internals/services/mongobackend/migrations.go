@@ -0,0 +1,225 @@
+package mongobackend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const migrationsCollection = "migrations"
+
+// migration changes the stored data. Mongo has no transactions across collections here,
+// so a migration must be safe to run again if recording it fails.
+type migration struct {
+	services.Migration
+	apply func(db *DB) error
+}
+
+// migrations are applied in order of version. Versions are never reused or reordered.
+var migrations = []migration{
+	{
+		Migration: services.Migration{Version: 1, Description: "create indexes"},
+		apply:     (*DB).ensureIndexes,
+	},
+	{
+		Migration: services.Migration{Version: 2, Description: "set initial revisions"},
+		apply:     (*DB).setInitialRevisions,
+	},
+	{
+		// Creates the indexes added to collectionIndexes since the first migration
+		Migration: services.Migration{Version: 3, Description: "create audit indexes"},
+		apply:     (*DB).ensureIndexes,
+	},
+	{
+		Migration: services.Migration{Version: 4, Description: "create variable history indexes"},
+		apply:     (*DB).ensureIndexes,
+	},
+	{
+		Migration: services.Migration{Version: 5, Description: "create role bindings and make existing API keys organization admins"},
+		apply:     (*DB).grantLegacyApiKeyRoles,
+	},
+	{
+		Migration: services.Migration{Version: 6, Description: "hash API keys"},
+		apply:     (*DB).hashApiKeys,
+	},
+	{
+		Migration: services.Migration{Version: 7, Description: "make existing API keys non-expiring"},
+		apply:     (*DB).clearApiKeyExpiry,
+	},
+}
+
+// setInitialRevisions gives documents written before revisions were tracked revision 1
+func (db *DB) setInitialRevisions() error {
+	for _, collection := range []string{"organizations", "namespaces", "schemas", "schemaversions"} {
+		ctx, cancel := db.context()
+		_, err := db.database.Collection(collection).UpdateMany(ctx,
+			bson.M{"revision": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"revision": 1}})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to set revisions on %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// grantLegacyApiKeyRoles creates the role binding indexes and makes the API keys created
+// before roles existed organization admins. The bindings are upserted by ID so the migration
+// can run again.
+func (db *DB) grantLegacyApiKeyRoles() error {
+	if err := db.ensureIndexes(); err != nil {
+		return err
+	}
+
+	ctx, cancel := db.context()
+	defer cancel()
+	cur, err := db.database.Collection("api_keys").Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	defer CloseCursor(ctx, cur)
+
+	bindings := db.database.Collection("rolebindings")
+	for cur.Next(ctx) {
+		var ak services.ApiKey
+		if err := cur.Decode(&ak); err != nil {
+			return err
+		}
+		binding := services.LegacyApiKeyRoleBinding(&ak)
+		_, err := bindings.ReplaceOne(ctx, bson.M{"id": binding.Id}, binding, options.Replace().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("failed to grant a role to API key %s: %w", ak.Id, err)
+		}
+	}
+	return cur.Err()
+}
+
+// hashApiKeys replaces the plaintext keys stored before keys were hashed by their prefix and
+// hash. The unique index on the plaintext key goes first, as the hashed keys no longer have one.
+func (db *DB) hashApiKeys() error {
+	collection := db.database.Collection("api_keys")
+
+	ctx, cancel := db.context()
+	defer cancel()
+	if _, err := collection.Indexes().DropOne(ctx, legacyApiKeysKeyIndex); err != nil && !isIndexNotFound(err) {
+		return fmt.Errorf("failed to drop index %s: %w", legacyApiKeysKeyIndex, err)
+	}
+
+	cur, err := collection.Find(ctx, bson.M{"key": bson.M{"$nin": bson.A{nil, ""}}})
+	if err != nil {
+		return err
+	}
+	defer CloseCursor(ctx, cur)
+
+	for cur.Next(ctx) {
+		var ak services.ApiKey
+		if err := cur.Decode(&ak); err != nil {
+			return err
+		}
+		if !ak.HashPlaintextKey() {
+			continue
+		}
+		_, err := collection.UpdateOne(ctx, bson.M{"id": ak.Id}, bson.M{
+			"$set":   bson.M{"prefix": ak.Prefix, "salt": ak.Salt, "hash": ak.Hash},
+			"$unset": bson.M{"key": ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to hash API key %s: %w", ak.Id, err)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return db.ensureIndexes()
+}
+
+// clearApiKeyExpiry makes the existing API keys non-expiring. Keys used to be given an expiry
+// an hour after they were created that was never checked; now that it is, existing keys keep
+// working until they are deleted.
+func (db *DB) clearApiKeyExpiry() error {
+	ctx, cancel := db.context()
+	defer cancel()
+	_, err := db.database.Collection("api_keys").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"expires": ""}})
+	return err
+}
+
+// appliedMigration is the record of a migration, keyed by version
+type appliedMigration struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedat"`
+}
+
+// Migrations returns the migrations of the mongo backend
+func (db *DB) Migrations() []services.Migration {
+	result := make([]services.Migration, len(migrations))
+	for i, m := range migrations {
+		result[i] = m.Migration
+	}
+	return result
+}
+
+// AppliedMigrations returns the migrations recorded in the migrations collection
+func (db *DB) AppliedMigrations() ([]services.AppliedMigration, error) {
+	ctx, cancel := db.context()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cur, err := db.database.Collection(migrationsCollection).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	result := []services.AppliedMigration{}
+	for cur.Next(ctx) {
+		var record appliedMigration
+		if err := cur.Decode(&record); err != nil {
+			return nil, err
+		}
+		result = append(result, services.AppliedMigration{
+			Migration: services.Migration{Version: record.Version, Description: record.Description},
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	return result, cur.Err()
+}
+
+// ApplyMigration runs the migration and records it. Another instance recording the same
+// migration first is not an error.
+func (db *DB) ApplyMigration(version int) error {
+	for _, m := range migrations {
+		if m.Version != version {
+			continue
+		}
+
+		ctx, cancel := db.context()
+		count, err := db.database.Collection(migrationsCollection).CountDocuments(ctx, bson.M{"_id": version})
+		cancel()
+		if err != nil || count > 0 {
+			return err
+		}
+
+		if err := m.apply(db); err != nil {
+			return err
+		}
+
+		record := appliedMigration{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now().UTC(),
+		}
+		ctx, cancel = db.context()
+		defer cancel()
+		_, err = db.database.Collection(migrationsCollection).InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown migration %d", version)
+}
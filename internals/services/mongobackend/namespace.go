@@ -1,10 +1,8 @@
 package mongobackend
 
 import (
-	"context"
 	"log"
 
-	"github.com/MrWestbury/terraxen-naming-service/internals/config"
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,32 +14,76 @@ import (
 type NamespaceService struct {
 	BaseService
 	varCollection *mongo.Collection
+	orgSvc        *OrganizationService
+	schemaSvc     *SchemaService
 }
 
-func NewNamespaceService(config *config.Config) *NamespaceService {
+func NewNamespaceService(db *DB) *NamespaceService {
 	nssvc := &NamespaceService{}
-	nssvc.Connect(config)
-	nssvc.collection = nssvc.client.Collection("namespaces")
-	nssvc.varCollection = nssvc.client.Collection("namespacevars")
+	nssvc.db = db
+	nssvc.collection = db.database.Collection("namespaces")
+	nssvc.varCollection = db.database.Collection("namespacevars")
+	nssvc.orgSvc = NewOrganizationService(db)
+	nssvc.schemaSvc = NewSchemaService(db)
 	return nssvc
 }
 
-func (nsSvc *NamespaceService) CreateNamespace(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*services.Namespace, error) {
+func (nsSvc *NamespaceService) CreateNamespace(orgId string, name string, parentId string, schemaId string, schemaVersion string, vars map[string]string) (*services.Namespace, error) {
 	ns := &services.Namespace{
 		Id:             uuid.NewString(),
 		Name:           name,
 		OrganizationId: orgId,
+		ParentId:       parentId,
 		SchemaId:       schemaId,
 		SchemaVersion:  schemaVersion,
+		Revision:       1,
 	}
 
-	exists := nsSvc.ExistsByName(orgId, name)
-	if exists {
-		return nil, services.ErrNamespaceAlreadyExists
+	if !nsSvc.orgSvc.ExistsById(orgId) {
+		return nil, services.ErrOrganizationNotFound
+	}
+
+	err := services.CheckNamespaceParent(nsSvc.GetNamespaceById, orgId, "", parentId)
+	if err != nil {
+		return nil, err
 	}
-	ctx := context.Background()
-	_, err := nsSvc.collection.InsertOne(ctx, ns)
+	err = services.CheckNamespacePin(nsSvc.schemaSvc.GetSchemaVersion, orgId, schemaId, schemaVersion)
 	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	session, err := nsSvc.db.client.StartSession()
+	if err != nil {
+		log.Printf("failed to start session for namespace: %v", err)
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	// The namespace and its variables are written together, so a failure leaves neither behind
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		_, err := nsSvc.collection.InsertOne(sessCtx, ns)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range vars {
+			newVar := &services.NamespaceVar{
+				OrgId:       orgId,
+				NamespaceId: ns.Id,
+				Key:         k,
+				Value:       v,
+			}
+			_, err = nsSvc.varCollection.InsertOne(sessCtx, newVar)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if isDuplicateKey(err, namespacesNameIndex) {
+		return nil, services.ErrNamespaceAlreadyExists
+	} else if err != nil {
 		log.Printf("Failed to create namespace %v", err)
 		return nil, err
 	}
@@ -56,7 +98,8 @@ func (nsSvc *NamespaceService) ExistsByName(orgId string, nsName string) bool {
 		"organizationid": orgId,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	result := nsSvc.collection.FindOne(ctx, filter)
 
 	return result.Err() != mongo.ErrNoDocuments
@@ -68,9 +111,12 @@ func (nsSvc *NamespaceService) GetNamespaceById(orgId string, nsId string) (*ser
 		"organizationid": orgId,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	result := nsSvc.collection.FindOne(ctx, filter)
-	if result.Err() != nil {
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrNamespaceNotFound
+	} else if result.Err() != nil {
 		log.Printf("failed to get namespace by ID: %v", result.Err())
 		return nil, result.Err()
 	}
@@ -91,17 +137,16 @@ func (nsSvc *NamespaceService) ListNamespaces(orgId string) ([]*services.Namespa
 
 	opts := options.Find()
 	opts.SetSort(bson.D{{Key: "name", Value: 1}})
-	opts.SetLimit(50)
-	opts.SetSkip(0)
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	cur, err := nsSvc.collection.Find(ctx, filter, opts)
 	if err != nil {
 		log.Printf("failed to list namespace: %v", err)
 		return nil, err
 	}
 	defer CloseCursor(ctx, cur)
-	var nsList []*services.Namespace
+	nsList := make([]*services.Namespace, 0)
 
 	for cur.Next(ctx) {
 		var ns services.Namespace
@@ -116,11 +161,59 @@ func (nsSvc *NamespaceService) ListNamespaces(orgId string) ([]*services.Namespa
 	return nsList, nil
 }
 
-func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName string, schemaVersion string) error {
+func (nsSvc *NamespaceService) ListChildNamespaces(orgId string, nsId string) ([]*services.Namespace, error) {
+	filter := bson.M{
+		"organizationid": orgId,
+		"parentid":       nsId,
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "name", Value: 1}})
+
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	cur, err := nsSvc.collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("failed to list child namespaces: %v", err)
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	nsList := make([]*services.Namespace, 0)
+	for cur.Next(ctx) {
+		var ns services.Namespace
+		err = cur.Decode(&ns)
+		if err != nil {
+			log.Printf("failed to decode while list child namespaces: %v", err)
+			continue
+		}
+		nsList = append(nsList, &ns)
+	}
+
+	return nsList, nil
+}
+
+func (nsSvc *NamespaceService) GetNamespaceAncestors(orgId string, nsId string) ([]*services.Namespace, error) {
+	return services.WalkNamespaceAncestors(nsSvc.GetNamespaceById, orgId, nsId)
+}
+
+func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName string, parentId string, schemaVersion string, revision int) (*services.Namespace, error) {
 	ns, err := nsSvc.GetNamespaceById(orgId, nsId)
 	if err != nil {
 		log.Printf("failed to update namespace: %v", err)
-		return err
+		return nil, err
+	}
+	if !services.RevisionMatches(revision, ns.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
+
+	err = services.CheckNamespaceParent(nsSvc.GetNamespaceById, orgId, nsId, parentId)
+	if err != nil {
+		return nil, err
+	}
+	err = services.CheckNamespacePin(nsSvc.schemaSvc.GetSchemaVersion, orgId, ns.SchemaId, schemaVersion)
+	if err != nil {
+		return nil, err
 	}
 
 	filter := bson.M{
@@ -128,38 +221,107 @@ func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName
 		"id":             nsId,
 	}
 
+	// Replace only the revision that was read, so a concurrent change is not overwritten
+	readRevision := ns.Revision
 	ns.Name = nsName
+	ns.ParentId = parentId
 	ns.SchemaVersion = schemaVersion
+	ns.Revision++
 
-	ctx := context.Background()
-	result := nsSvc.collection.FindOneAndUpdate(ctx, filter, ns)
-	if result.Err() != nil {
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	result := nsSvc.collection.FindOneAndReplace(ctx, withRevision(filter, readRevision), ns)
+	if isDuplicateKey(result.Err(), namespacesNameIndex) {
+		return nil, services.ErrNamespaceAlreadyExists
+	} else if result.Err() == mongo.ErrNoDocuments {
+		return nil, nsSvc.notUpdated(filter, services.ErrNamespaceNotFound)
+	} else if result.Err() != nil {
 		log.Printf("failed to update namespace: %v", result.Err())
-		return result.Err()
+		return nil, result.Err()
 	}
-	return result.Err()
+	return ns, nil
 }
 
-func (nsSvc *NamespaceService) DeleteNamespace(orgId string, nsId string) error {
+func (nsSvc *NamespaceService) DeleteNamespace(orgId string, nsId string, revision int) error {
 	filter := bson.M{
 		"organizationid": orgId,
 		"id":             nsId,
 	}
 
-	ctx := context.Background()
-	result, err := nsSvc.collection.DeleteOne(ctx, filter)
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	childFilter := bson.M{
+		"organizationid": orgId,
+		"parentid":       nsId,
+	}
+	children, err := nsSvc.collection.CountDocuments(ctx, childFilter)
+	if err != nil {
+		log.Printf("failed to count child namespaces: %v", err)
+		return err
+	}
+	if children > 0 {
+		return services.ErrNamespaceHasChildren
+	}
+
+	result, err := nsSvc.collection.DeleteOne(ctx, withRevision(filter, revision))
 	if err != nil {
 		log.Printf("failed to delete namespace: %v", err)
 		return err
 	}
 
 	if result.DeletedCount == 0 {
-		return services.ErrNamespaceNotFound
+		return nsSvc.notUpdated(filter, services.ErrNamespaceNotFound)
+	}
+
+	varFilter := bson.M{
+		"orgid":       orgId,
+		"namespaceid": nsId,
+	}
+	_, err = nsSvc.varCollection.DeleteMany(ctx, varFilter)
+	if err != nil {
+		log.Printf("failed to delete namespace variables: %v", err)
+		return err
 	}
 
 	return nil
 }
 
+func (nsSvc *NamespaceService) LockNamespace(orgId string, nsId string, lock services.NamespaceLock) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, &lock)
+}
+
+func (nsSvc *NamespaceService) UnlockNamespace(orgId string, nsId string) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, nil)
+}
+
+func (nsSvc *NamespaceService) setLock(orgId string, nsId string, lock *services.NamespaceLock) (*services.Namespace, error) {
+	filter := bson.M{
+		"organizationid": orgId,
+		"id":             nsId,
+	}
+
+	opts := options.FindOneAndUpdate()
+	opts.SetReturnDocument(options.After)
+
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	result := nsSvc.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"lock": lock}, "$inc": bson.M{"revision": 1}}, opts)
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrNamespaceNotFound
+	} else if result.Err() != nil {
+		log.Printf("failed to set namespace lock: %v", result.Err())
+		return nil, result.Err()
+	}
+
+	var ns services.Namespace
+	err := result.Decode(&ns)
+	if err != nil {
+		log.Printf("failed to decode namespace after setting lock: %v", err)
+		return nil, err
+	}
+	return &ns, nil
+}
+
 func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*services.NamespaceVar, error) {
 	filter := bson.M{
 		"orgid":       orgId,
@@ -167,11 +329,10 @@ func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*
 	}
 
 	opts := options.Find()
-	opts.SetSort(bson.D{primitive.E{Key: "id", Value: 1}})
-	opts.SetLimit(50)
-	opts.SetSkip(0)
+	opts.SetSort(bson.D{primitive.E{Key: "key", Value: 1}})
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	cur, err := nsSvc.varCollection.Find(ctx, filter, opts)
 	if err != nil {
 		log.Printf("Failed to list namespace vars: %v", err)
@@ -194,7 +355,142 @@ func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*
 	return results, nil
 }
 
+// Replace all of the variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) ReplaceNamespaceVariables(orgId string, nsId string, vars map[string]string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return vars, nil
+	})
+}
+
+// Upsert and delete variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) PatchNamespaceVariables(orgId string, nsId string, upserts map[string]string, deletes []string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return services.ApplyVariablePatch(current, upserts, deletes)
+	})
+}
+
+func (nsSvc *NamespaceService) changeVariables(orgId string, nsId string, revision int, change func(current map[string]string) (map[string]string, error)) (*services.VariableChangeSummary, error) {
+	_, err := nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	session, err := nsSvc.db.client.StartSession()
+	if err != nil {
+		log.Printf("failed to start session for namespace variables: %v", err)
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Bumping the namespace revision first makes concurrent changes to its variables conflict
+		nsFilter := bson.M{
+			"organizationid": orgId,
+			"id":             nsId,
+		}
+		opts := options.FindOneAndUpdate()
+		opts.SetReturnDocument(options.After)
+		bumped := nsSvc.collection.FindOneAndUpdate(sessCtx, withRevision(nsFilter, revision), bson.M{"$inc": bson.M{"revision": 1}}, opts)
+		if bumped.Err() == mongo.ErrNoDocuments {
+			return nil, nsSvc.notUpdated(nsFilter, services.ErrNamespaceNotFound)
+		} else if bumped.Err() != nil {
+			return nil, bumped.Err()
+		}
+		var ns services.Namespace
+		err := bumped.Decode(&ns)
+		if err != nil {
+			return nil, err
+		}
+
+		filter := bson.M{
+			"orgid":       orgId,
+			"namespaceid": nsId,
+		}
+
+		cur, err := nsSvc.varCollection.Find(sessCtx, filter)
+		if err != nil {
+			return nil, err
+		}
+		defer CloseCursor(sessCtx, cur)
+
+		current := make(map[string]string)
+		for cur.Next(sessCtx) {
+			var nsVar services.NamespaceVar
+			err = cur.Decode(&nsVar)
+			if err != nil {
+				return nil, err
+			}
+			current[nsVar.Key] = nsVar.Value
+		}
+
+		desired, err := change(current)
+		if err != nil {
+			return nil, err
+		}
+		summary := services.DiffVariables(current, desired)
+		summary.Revision = ns.Revision
+
+		for _, k := range summary.Created {
+			newVar := &services.NamespaceVar{
+				OrgId:       orgId,
+				NamespaceId: nsId,
+				Key:         k,
+				Value:       desired[k],
+			}
+			_, err = nsSvc.varCollection.InsertOne(sessCtx, newVar)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, k := range summary.Updated {
+			varFilter := bson.M{
+				"orgid":       orgId,
+				"namespaceid": nsId,
+				"key":         k,
+			}
+			_, err = nsSvc.varCollection.UpdateOne(sessCtx, varFilter, bson.M{"$set": bson.M{"value": desired[k]}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, k := range summary.Deleted {
+			varFilter := bson.M{
+				"orgid":       orgId,
+				"namespaceid": nsId,
+				"key":         k,
+			}
+			_, err = nsSvc.varCollection.DeleteOne(sessCtx, varFilter)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return summary, nil
+	})
+	if err != nil {
+		log.Printf("failed to change namespace variables: %v", err)
+		return nil, err
+	}
+
+	return result.(*services.VariableChangeSummary), nil
+}
+
+// Get the effective variables of a namespace, merged down the chain of parent namespaces
 func (nsSvc *NamespaceService) GetVariablesAsMap(orgId string, nsId string) (map[string]string, error) {
+	chain, err := nsSvc.GetNamespaceAncestors(orgId, nsId)
+	if err != nil {
+		log.Printf("failed getting namespace ancestors for map: %v", err)
+		return nil, err
+	}
+
+	return services.MergeNamespaceVariables(chain, func(ns *services.Namespace) (map[string]string, error) {
+		return nsSvc.getOwnVariablesAsMap(orgId, ns.Id)
+	})
+}
+
+func (nsSvc *NamespaceService) getOwnVariablesAsMap(orgId string, nsId string) (map[string]string, error) {
 	items, err := nsSvc.ListNamespaceVars(orgId, nsId)
 	if err != nil {
 		log.Printf("failed getting list of namespace variables for map: %v", err)
@@ -211,14 +507,17 @@ func (nsSvc *NamespaceService) GetVariablesAsMap(orgId string, nsId string) (map
 
 func (nsSvc *NamespaceService) GetNamespaceVariable(orgId string, nsId string, varId string) (*services.NamespaceVar, error) {
 	filter := bson.M{
-		"id":             varId,
-		"organizationid": orgId,
-		"namespaceid":    nsId,
+		"orgid":       orgId,
+		"namespaceid": nsId,
+		"key":         varId,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	result := nsSvc.varCollection.FindOne(ctx, filter)
-	if result.Err() != nil {
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrNamespaceVarNotFound
+	} else if result.Err() != nil {
 		log.Printf("Failed to get namespace variable: %v", result.Err())
 		return nil, result.Err()
 	}
@@ -227,13 +526,18 @@ func (nsSvc *NamespaceService) GetNamespaceVariable(orgId string, nsId string, v
 	err := result.Decode(&nsVar)
 	if err != nil {
 		log.Printf("Failed to get namespace variable: %v", err)
-		return nil, result.Err()
+		return nil, err
 	}
 
 	return &nsVar, nil
 }
 
 func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string, key string, value string) (*services.NamespaceVar, error) {
+	_, err := nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
 	newVar := &services.NamespaceVar{
 		OrgId:       orgId,
 		NamespaceId: nsId,
@@ -241,9 +545,12 @@ func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string
 		Value:       value,
 	}
 
-	ctx := context.Background()
-	_, err := nsSvc.varCollection.InsertOne(ctx, newVar)
-	if err != nil {
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	_, err = nsSvc.varCollection.InsertOne(ctx, newVar)
+	if isDuplicateKey(err, namespaceVarsKeyIndex) {
+		return nil, services.ErrNamespaceVarExists
+	} else if err != nil {
 		log.Printf("failed to create namespace varibale: %v", err)
 		return nil, err
 	}
@@ -251,28 +558,30 @@ func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string
 }
 
 func (nsSvc *NamespaceService) UpdateNamespaceVariable(orgId string, nsId string, varId string, value string) (*services.NamespaceVar, error) {
-	oldVar, err := nsSvc.GetNamespaceVariable(orgId, nsId, varId)
-	if err != nil {
-		log.Printf("failed to get namespace var for update: %v", err)
-		return nil, err
+	filter := bson.M{
+		"orgid":       orgId,
+		"namespaceid": nsId,
+		"key":         varId,
 	}
 
-	oldVar.Value = value
+	opts := options.FindOneAndUpdate()
+	opts.SetReturnDocument(options.After)
 
-	filter := bson.M{
-		"organizationid": orgId,
-		"namespaceid":    nsId,
-		"key":            varId,
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
+	result := nsSvc.varCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"value": value}}, opts)
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrNamespaceVarNotFound
+	} else if result.Err() != nil {
+		log.Printf("failed to update namespace variable: %v", result.Err())
+		return nil, result.Err()
 	}
 
-	ctx := context.Background()
-	result := nsSvc.varCollection.FindOneAndReplace(ctx, filter, oldVar)
-
 	var nsVar services.NamespaceVar
-	err = result.Decode(&nsVar)
+	err := result.Decode(&nsVar)
 	if err != nil {
-		log.Printf("failed to update namespace variable: %v", err)
-		return nil, result.Err()
+		log.Printf("failed to decode updated namespace variable: %v", err)
+		return nil, err
 	}
 
 	return &nsVar, nil
@@ -280,14 +589,17 @@ func (nsSvc *NamespaceService) UpdateNamespaceVariable(orgId string, nsId string
 
 func (nsSvc *NamespaceService) DeleteNamespaceVariable(orgId string, nsId string, varId string) error {
 	filter := bson.M{
-		"organizationid": orgId,
-		"namespaceid":    nsId,
-		"key":            varId,
+		"orgid":       orgId,
+		"namespaceid": nsId,
+		"key":         varId,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	result := nsSvc.varCollection.FindOneAndDelete(ctx, filter)
-	if result.Err() != nil {
+	if result.Err() == mongo.ErrNoDocuments {
+		return services.ErrNamespaceVarNotFound
+	} else if result.Err() != nil {
 		log.Printf("failed to delete namespace variable: %v", result.Err())
 		return result.Err()
 	}
@@ -297,12 +609,13 @@ func (nsSvc *NamespaceService) DeleteNamespaceVariable(orgId string, nsId string
 
 func (nsSvc *NamespaceService) NamespaceVariableExists(orgId string, nsId string, varId string) bool {
 	filter := bson.M{
-		"organizationid": orgId,
-		"namespaceid":    nsId,
-		"key":            varId,
+		"orgid":       orgId,
+		"namespaceid": nsId,
+		"key":         varId,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := nsSvc.db.context()
+	defer cancel()
 	result := nsSvc.varCollection.FindOne(ctx, filter)
 	if result.Err() != nil {
 		if result.Err() == mongo.ErrNoDocuments {
@@ -1,68 +1,53 @@
 package mongobackend
 
 import (
-	"context"
-	"errors"
 	"log"
 
-	"github.com/MrWestbury/terraxen-naming-service/internals/config"
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrganizationService struct {
 	BaseService
-	varCollection *mongo.Collection
+	varCollection      *mongo.Collection
+	templateCollection *mongo.Collection
 }
 
-func NewOrganizationService(cfg *config.Config) *OrganizationService {
+func NewOrganizationService(db *DB) *OrganizationService {
 	orgsvc := &OrganizationService{}
-	orgsvc.Connect(cfg)
-	orgsvc.collection = orgsvc.client.Collection("organizations")
-	orgsvc.varCollection = orgsvc.client.Collection("orgvars")
+	orgsvc.db = db
+	orgsvc.collection = db.database.Collection("organizations")
+	orgsvc.varCollection = db.database.Collection("orgvars")
+	orgsvc.templateCollection = db.database.Collection("namespacetemplates")
 	return orgsvc
 }
 
 func (orgsvc *OrganizationService) NewOrganization(orgName string) (*services.Organization, error) {
-	org, err := orgsvc.getOrganizationByName(orgName)
-	if err != nil {
-		return nil, err
-	}
-
-	if org != nil {
-		return nil, errors.New("organization already exists")
-	}
-
 	newOrg := &services.Organization{
-		Id:      uuid.NewString(),
-		Name:    orgName,
-		OrgVars: make(map[string]string),
+		Id:       uuid.NewString(),
+		Name:     orgName,
+		OrgVars:  make(map[string]string),
+		Revision: 1,
 	}
 
-	ctx := context.Background()
-	_, err = orgsvc.collection.InsertOne(ctx, newOrg)
-	if err != nil {
+	ctx, cancel := orgsvc.db.context()
+	defer cancel()
+	_, err := orgsvc.collection.InsertOne(ctx, newOrg)
+	if isDuplicateKey(err, organizationsNameIndex) {
+		return nil, services.ErrOrganizationExists
+	} else if err != nil {
 		return nil, err
 	}
-	return newOrg, err
-}
-
-func (orgsvc *OrganizationService) getOrganizationByName(orgName string) (*services.Organization, error) {
-	ctx := context.Background()
-	result := orgsvc.collection.FindOne(ctx, bson.M{"name": orgName})
-	if result.Err() == mongo.ErrNoDocuments {
-		return nil, nil
-	}
-
-	var org services.Organization
-	result.Decode(&org)
-	return &org, nil
+	return newOrg, nil
 }
 
 func (orgsvc *OrganizationService) GetOrganizationById(orgId string) (*services.Organization, error) {
-	ctx := context.Background()
+	ctx, cancel := orgsvc.db.context()
+	defer cancel()
 	result := orgsvc.collection.FindOne(ctx, bson.M{"id": orgId})
 	if result.Err() == mongo.ErrNoDocuments {
 		return nil, nil
@@ -73,57 +58,271 @@ func (orgsvc *OrganizationService) GetOrganizationById(orgId string) (*services.
 }
 
 func (orgsvc *OrganizationService) ExistsById(orgId string) bool {
-	ctx := context.Background()
+	ctx, cancel := orgsvc.db.context()
+	defer cancel()
 	result := orgsvc.collection.FindOne(ctx, bson.M{"id": orgId})
 	return result.Err() != mongo.ErrNoDocuments
 }
 
 func (orgsvc *OrganizationService) ExistsByName(orgName string) bool {
-	ctx := context.Background()
+	ctx, cancel := orgsvc.db.context()
+	defer cancel()
 	result := orgsvc.collection.FindOne(ctx, bson.M{"name": orgName})
 	return result.Err() != mongo.ErrNoDocuments
 }
 
-func (orgSvc *OrganizationService) UpdateOrganization(orgId string, orgName string, orgVars map[string]string) (*services.Organization, error) {
-	org, err := orgSvc.GetOrganizationById(orgId)
-	if err != nil {
+func (orgSvc *OrganizationService) UpdateOrganization(orgId string, orgName string, orgVars map[string]string, revision int) (*services.Organization, error) {
+	update := bson.M{
+		"$set": bson.M{"name": orgName, "orgvars": orgVars},
+		"$inc": bson.M{"revision": 1},
+	}
+	org, err := orgSvc.updateOrganization(orgId, revision, update)
+	if isDuplicateKey(err, organizationsNameIndex) {
+		return nil, services.ErrOrganizationExists
+	} else if err != nil && err != services.ErrOrganizationNotFound && err != services.ErrRevisionMismatch {
 		log.Printf("Failed to update organization: %v", err)
+	}
+	return org, err
+}
+
+func (orgSvc *OrganizationService) SetFreezeWindows(orgId string, windows []services.FreezeWindow, revision int) (*services.Organization, error) {
+	update := bson.M{
+		"$set": bson.M{"freezewindows": windows},
+		"$inc": bson.M{"revision": 1},
+	}
+	org, err := orgSvc.updateOrganization(orgId, revision, update)
+	if err == services.ErrOrganizationNotFound {
+		return nil, nil
+	} else if err != nil && err != services.ErrRevisionMismatch {
+		log.Printf("Failed to set freeze windows: %v", err)
+	}
+	return org, err
+}
+
+func (orgSvc *OrganizationService) ListOrganizations() ([]*services.Organization, error) {
+	opts := options.Find()
+	opts.SetSort(bson.D{primitive.E{Key: "name", Value: 1}})
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	cur, err := orgSvc.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Printf("failed to list organizations: %v", err)
 		return nil, err
 	}
+	defer CloseCursor(ctx, cur)
+
+	results := make([]*services.Organization, 0)
+	for cur.Next(ctx) {
+		var org services.Organization
+		err = cur.Decode(&org)
+		if err != nil {
+			log.Printf("failed to decode organization: %v", err)
+			continue
+		}
+		results = append(results, &org)
+	}
+	return results, nil
+}
+
+func (orgSvc *OrganizationService) SuspendOrganization(orgId string, suspension services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	return orgSvc.setSuspension(orgId, &suspension, revision)
+}
 
-	org.Name = orgName
-	org.OrgVars = orgVars
+func (orgSvc *OrganizationService) ReactivateOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setSuspension(orgId, nil, revision)
+}
 
-	ctx := context.Background()
+func (orgSvc *OrganizationService) setSuspension(orgId string, suspension *services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	update := bson.M{
+		"$set": bson.M{"suspension": suspension},
+		"$inc": bson.M{"revision": 1},
+	}
+	return orgSvc.updateOrganization(orgId, revision, update)
+}
 
+// updateOrganization applies update to the organization if it is at the expected revision
+func (orgSvc *OrganizationService) updateOrganization(orgId string, revision int, update bson.M) (*services.Organization, error) {
 	filter := bson.M{
-		"id": org.Id,
+		"id": orgId,
 	}
 
-	orgSvc.collection.FindOneAndUpdate(ctx, filter, org)
-	return org, nil
+	opts := options.FindOneAndUpdate()
+	opts.SetReturnDocument(options.After)
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	result := orgSvc.collection.FindOneAndUpdate(ctx, withRevision(filter, revision), update, opts)
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, orgSvc.notUpdated(filter, services.ErrOrganizationNotFound)
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var org services.Organization
+	err := result.Decode(&org)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
 }
 
-func (orgSvc OrganizationService) DeleteOrganization(organizationId string) error {
-	org, err := orgSvc.GetOrganizationById(organizationId)
+func (orgSvc *OrganizationService) DeleteOrganization(orgId string, deletion services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	return orgSvc.setDeletion(orgId, &deletion, revision)
+}
+
+func (orgSvc *OrganizationService) RestoreOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setDeletion(orgId, nil, revision)
+}
+
+func (orgSvc *OrganizationService) setDeletion(orgId string, deletion *services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	update := bson.M{
+		"$set": bson.M{"deletion": deletion},
+		"$inc": bson.M{"revision": 1},
+	}
+	return orgSvc.updateOrganization(orgId, revision, update)
+}
+
+// Collections holding what an organization owns, with the field naming the organization.
+// Schema versions are found through their schemas.
+var organizationCollections = map[string]string{
+	"namespaces":         "organizationid",
+	"namespacevars":      "orgid",
+	"schemas":            "organizationid",
+	"namespacetemplates": "organizationid",
+	"api_keys":           "organizationid",
+	"rolebindings":       "organizationid",
+	"variablehistory":    "organizationid",
+}
+
+func (orgSvc *OrganizationService) PurgeOrganization(orgId string) error {
+	if !orgSvc.ExistsById(orgId) {
+		return services.ErrOrganizationNotFound
+	}
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+
+	schemaIds, err := orgSvc.db.database.Collection("schemas").Distinct(ctx, "id", bson.M{"organizationid": orgId})
+	if err != nil {
+		return err
+	}
+	if len(schemaIds) > 0 {
+		_, err = orgSvc.db.database.Collection("schemaversions").DeleteMany(ctx, bson.M{"schemaid": bson.M{"$in": schemaIds}})
+		if err != nil {
+			return err
+		}
+	}
+
+	for collection, field := range organizationCollections {
+		if _, err := orgSvc.db.database.Collection(collection).DeleteMany(ctx, bson.M{field: orgId}); err != nil {
+			return err
+		}
+	}
+
+	result, err := orgSvc.collection.DeleteOne(ctx, bson.M{"id": orgId})
 	if err != nil {
-		log.Printf("Failed to update organization: %v", err)
 		return err
 	}
+	if result.DeletedCount == 0 {
+		return services.ErrOrganizationNotFound
+	}
+	return nil
+}
+
+func (orgSvc *OrganizationService) CreateNamespaceTemplate(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*services.NamespaceTemplate, error) {
+	tpl := &services.NamespaceTemplate{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Variables:      vars,
+	}
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	_, err := orgSvc.templateCollection.InsertOne(ctx, tpl)
+	if isDuplicateKey(err, namespaceTemplatesNameIndex) {
+		return nil, services.ErrTemplateAlreadyExists
+	} else if err != nil {
+		log.Printf("failed to create namespace template: %v", err)
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (orgSvc *OrganizationService) ListNamespaceTemplates(orgId string) ([]*services.NamespaceTemplate, error) {
+	filter := bson.M{
+		"organizationid": orgId,
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{primitive.E{Key: "name", Value: 1}})
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	cur, err := orgSvc.templateCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("failed to list namespace templates: %v", err)
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	results := make([]*services.NamespaceTemplate, 0)
+	for cur.Next(ctx) {
+		var tpl services.NamespaceTemplate
+		err = cur.Decode(&tpl)
+		if err != nil {
+			log.Printf("failed to decode namespace template: %v", err)
+			continue
+		}
+		results = append(results, &tpl)
+	}
+	return results, nil
+}
+
+func (orgSvc *OrganizationService) GetNamespaceTemplate(orgId string, templateId string) (*services.NamespaceTemplate, error) {
+	filter := bson.M{
+		"organizationid": orgId,
+		"id":             templateId,
+	}
+
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	result := orgSvc.templateCollection.FindOne(ctx, filter)
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrTemplateNotFound
+	} else if result.Err() != nil {
+		log.Printf("failed to get namespace template: %v", result.Err())
+		return nil, result.Err()
+	}
 
-	ctx := context.Background()
+	var tpl services.NamespaceTemplate
+	err := result.Decode(&tpl)
+	if err != nil {
+		log.Printf("failed to decode namespace template: %v", err)
+		return nil, err
+	}
+	return &tpl, nil
+}
 
+func (orgSvc *OrganizationService) DeleteNamespaceTemplate(orgId string, templateId string) error {
 	filter := bson.M{
-		"id": org.Id,
+		"organizationid": orgId,
+		"id":             templateId,
 	}
 
-	result, err := orgSvc.collection.DeleteOne(ctx, filter)
+	ctx, cancel := orgSvc.db.context()
+	defer cancel()
+	result, err := orgSvc.templateCollection.DeleteOne(ctx, filter)
 	if err != nil {
+		log.Printf("failed to delete namespace template: %v", err)
 		return err
 	}
 
 	if result.DeletedCount == 0 {
-		return errors.New("no organization deleted")
+		return services.ErrTemplateNotFound
 	}
 	return nil
 }
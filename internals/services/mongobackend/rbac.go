@@ -0,0 +1,94 @@
+package mongobackend
+
+import (
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const roleBindingsIndex = "rolebindings_subject_role_resource_key"
+
+type RoleBindingService struct {
+	BaseService
+}
+
+func NewRoleBindingService(db *DB) *RoleBindingService {
+	rbSvc := &RoleBindingService{}
+	rbSvc.db = db
+	rbSvc.collection = db.database.Collection("rolebindings")
+	return rbSvc
+}
+
+func (rbSvc *RoleBindingService) CreateRoleBinding(binding *services.RoleBinding) error {
+	ctx, cancel := rbSvc.db.context()
+	defer cancel()
+
+	_, err := rbSvc.collection.InsertOne(ctx, binding)
+	if isDuplicateKey(err, roleBindingsIndex) {
+		return services.ErrRoleBindingExists
+	}
+	return err
+}
+
+func (rbSvc *RoleBindingService) ListRoleBindings(orgId string) ([]*services.RoleBinding, error) {
+	return rbSvc.find(bson.M{"organizationid": orgId})
+}
+
+func (rbSvc *RoleBindingService) ListSubjectRoleBindings(orgId string, subject string) ([]*services.RoleBinding, error) {
+	return rbSvc.find(bson.M{"organizationid": orgId, "subject": subject})
+}
+
+func (rbSvc *RoleBindingService) GetRoleBinding(orgId string, bindingId string) (*services.RoleBinding, error) {
+	bindings, err := rbSvc.find(bson.M{"organizationid": orgId, "id": bindingId})
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return nil, services.ErrRoleBindingNotFound
+	}
+	return bindings[0], nil
+}
+
+func (rbSvc *RoleBindingService) find(filter bson.M) ([]*services.RoleBinding, error) {
+	ctx, cancel := rbSvc.db.context()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cur, err := rbSvc.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseCursor(ctx, cur)
+
+	result := []*services.RoleBinding{}
+	for cur.Next(ctx) {
+		var b services.RoleBinding
+		if err := cur.Decode(&b); err != nil {
+			return nil, err
+		}
+		result = append(result, &b)
+	}
+	return result, cur.Err()
+}
+
+func (rbSvc *RoleBindingService) DeleteRoleBinding(orgId string, bindingId string) error {
+	ctx, cancel := rbSvc.db.context()
+	defer cancel()
+
+	result, err := rbSvc.collection.DeleteOne(ctx, bson.M{"organizationid": orgId, "id": bindingId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrRoleBindingNotFound
+	}
+	return nil
+}
+
+func (rbSvc *RoleBindingService) DeleteSubjectRoleBindings(orgId string, subject string) error {
+	ctx, cancel := rbSvc.db.context()
+	defer cancel()
+
+	_, err := rbSvc.collection.DeleteMany(ctx, bson.M{"organizationid": orgId, "subject": subject})
+	return err
+}
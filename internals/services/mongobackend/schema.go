@@ -1,12 +1,9 @@
 package mongobackend
 
 import (
-	"context"
-	"errors"
 	"log"
 	"strconv"
 
-	"github.com/MrWestbury/terraxen-naming-service/internals/config"
 	"github.com/MrWestbury/terraxen-naming-service/internals/services"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,43 +14,41 @@ import (
 
 type SchemaService struct {
 	BaseService
-	versionCollection *mongo.Collection
+	versionCollection   *mongo.Collection
+	namespaceCollection *mongo.Collection
 }
 
-func NewSchemaService(cfg *config.Config) *SchemaService {
+func NewSchemaService(db *DB) *SchemaService {
 	sSvc := &SchemaService{}
-	sSvc.Connect(cfg)
-	sSvc.collection = sSvc.client.Collection("schemas")
-	sSvc.versionCollection = sSvc.client.Collection("schemaversions")
+	sSvc.db = db
+	sSvc.collection = db.database.Collection("schemas")
+	sSvc.versionCollection = db.database.Collection("schemaversions")
+	sSvc.namespaceCollection = db.database.Collection("namespaces")
 
 	return sSvc
 }
 
 func (sSvc *SchemaService) CreateSchema(orgId string, name string) (*services.Schema, error) {
-	schema, err := sSvc.getSchemaByName(orgId, name)
-	if err != nil {
-		return nil, err
-	}
-
-	if schema != nil {
-		return nil, errors.New("schema already exists")
-	}
-
 	newSchema := &services.Schema{
 		Id:             uuid.NewString(),
 		OrganizationId: orgId,
 		Name:           name,
+		Revision:       1,
 	}
 
 	newSchemaVersion := &services.SchemaVersion{
 		Id:        1,
 		SchemaId:  newSchema.Id,
 		Resources: make(map[string]string),
+		Revision:  1,
 	}
 
-	ctx := context.Background()
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 	result, err := sSvc.collection.InsertOne(ctx, newSchema)
-	if err != nil {
+	if isDuplicateKey(err, schemasNameIndex) {
+		return nil, services.ErrSchemaAlreadyExists
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -66,39 +61,15 @@ func (sSvc *SchemaService) CreateSchema(orgId string, name string) (*services.Sc
 	return newSchema, nil
 }
 
-func (sSvc *SchemaService) getSchemaByName(orgId string, name string) (*services.Schema, error) {
-	ctx := context.Background()
-	filter := bson.M{
-		"organizationid": orgId,
-		"name":           name,
-	}
-	result := sSvc.collection.FindOne(ctx, filter)
-	if result.Err() == mongo.ErrNoDocuments {
-		return nil, nil
-	} else if result.Err() != nil {
-		log.Printf("Failed to get schema by name: %v", result.Err())
-		return nil, result.Err()
-	}
-
-	var sch services.Schema
-	err := result.Decode(&sch)
-	if err != nil {
-		log.Printf("Failed to get schema by name: %v", err)
-		return nil, err
-	}
-
-	return &sch, nil
-}
-
 // List schemas in a given organization by the organization ID
 func (sSvc *SchemaService) ListSchemaInOrganization(orgId string) ([]*services.Schema, error) {
-	ctx := context.Background()
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 	filter := bson.M{
 		"organizationid": orgId,
 	}
 
 	opts := options.Find()
-	opts.SetLimit(50)
 	opts.SetSort(bson.D{primitive.E{Key: "name", Value: 1}})
 
 	cur, err := sSvc.collection.Find(ctx, filter, opts)
@@ -123,7 +94,8 @@ func (sSvc *SchemaService) ListSchemaInOrganization(orgId string) ([]*services.S
 }
 
 func (sSvc *SchemaService) GetSchemaById(orgId string, schemaId string) (*services.Schema, error) {
-	ctx := context.Background()
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 
 	filter := bson.M{
 		"organizationid": orgId,
@@ -148,38 +120,67 @@ func (sSvc *SchemaService) GetSchemaById(orgId string, schemaId string) (*servic
 	return &sch, nil
 }
 
-func (sSvc *SchemaService) UpdateSchema(schema services.Schema) error {
-	ctx := context.Background()
+// Update the name of a schema. The revision of the schema passed in is the one expected.
+func (sSvc *SchemaService) UpdateSchema(schema services.Schema) (*services.Schema, error) {
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 
 	filter := bson.M{
 		"organizationid": schema.OrganizationId,
 		"id":             schema.Id,
 	}
+	update := bson.M{
+		"$set": bson.M{"name": schema.Name},
+		"$inc": bson.M{"revision": 1},
+	}
 
-	results := sSvc.collection.FindOneAndReplace(ctx, filter, schema)
-	if results.Err() != nil {
+	opts := options.FindOneAndUpdate()
+	opts.SetReturnDocument(options.After)
+
+	results := sSvc.collection.FindOneAndUpdate(ctx, withRevision(filter, schema.Revision), update, opts)
+	if isDuplicateKey(results.Err(), schemasNameIndex) {
+		return nil, services.ErrSchemaAlreadyExists
+	} else if results.Err() == mongo.ErrNoDocuments {
+		return nil, sSvc.notUpdated(filter, services.ErrSchemaNotFound)
+	} else if results.Err() != nil {
 		log.Printf("failed to update schema: %v", results.Err())
-		return results.Err()
+		return nil, results.Err()
 	}
-	return nil
+
+	var updated services.Schema
+	err := results.Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
 }
 
-func (sSvc *SchemaService) DeleteSchema(orgId string, schemaId string) error {
-	ctx := context.Background()
+func (sSvc *SchemaService) DeleteSchema(orgId string, schemaId string, revision int) error {
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 
 	filter := bson.M{
 		"organizationid": orgId,
 		"id":             schemaId,
 	}
 
-	result, err := sSvc.collection.DeleteOne(ctx, filter)
+	pinned, err := sSvc.namespaceCollection.CountDocuments(ctx, bson.M{"organizationid": orgId, "schemaid": schemaId})
+	if err != nil {
+		log.Printf("failed to count namespaces using schema: %v", err)
+		return err
+	}
+	if pinned > 0 {
+		return services.ErrSchemaInUse
+	}
+
+	result, err := sSvc.collection.DeleteOne(ctx, withRevision(filter, revision))
 	if err != nil {
 		log.Printf("failed to delete schema: %v", err)
 		return err
 	}
 
 	if result.DeletedCount == 0 {
-		return errors.New("schema not found")
+		return sSvc.notUpdated(filter, services.ErrSchemaNotFound)
 	}
 
 	versionFilter := bson.M{
@@ -206,7 +207,8 @@ func (sSvc *SchemaService) ListSchemaVersions(orgId string, schemaId string) ([]
 		return nil, services.ErrSchemaNotFound
 	}
 
-	ctx := context.Background()
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 
 	filter := bson.M{
 		"schemaid": schema.Id,
@@ -235,31 +237,44 @@ func (sSvc *SchemaService) ListSchemaVersions(orgId string, schemaId string) ([]
 	return results, nil
 }
 
-func (sSvc *SchemaService) CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
-	latestVersion, err := sSvc.GetSchemaVersion(orgId, schemaId, "latest")
-	if err != nil {
-		log.Printf("Failed to get latest schema version: %v", err)
-		return nil, err
-	}
+// Concurrent creates can pick the same version number. The unique index rejects all but
+// one of them and the others try again with the next number.
+const maxSchemaVersionAttempts = 3
 
-	newVersion := latestVersion.Id + 1
+func (sSvc *SchemaService) CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
+	for attempt := 1; ; attempt++ {
+		latestVersion, err := sSvc.GetSchemaVersion(orgId, schemaId, "latest")
+		if err != nil {
+			log.Printf("Failed to get latest schema version: %v", err)
+			return nil, err
+		}
 
-	newSchemaVersion := &services.SchemaVersion{
-		Id:        newVersion,
-		SchemaId:  schemaId,
-		Resources: resources,
-		Published: published,
-	}
+		newSchemaVersion := &services.SchemaVersion{
+			Id:        latestVersion.Id + 1,
+			SchemaId:  schemaId,
+			Resources: resources,
+			Published: published,
+			Revision:  1,
+		}
 
-	ctx := context.Background()
+		err = sSvc.insertSchemaVersion(newSchemaVersion)
+		if isDuplicateKey(err, schemaVersionsIdIndex) && attempt < maxSchemaVersionAttempts {
+			continue
+		} else if err != nil {
+			log.Printf("Failed to create new schema version: %v", err)
+			return nil, err
+		}
 
-	_, err = sSvc.versionCollection.InsertOne(ctx, newSchemaVersion)
-	if err != nil {
-		log.Printf("Failed to create new schema version: %v", err)
-		return nil, err
+		return newSchemaVersion, nil
 	}
+}
+
+func (sSvc *SchemaService) insertSchemaVersion(sv *services.SchemaVersion) error {
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 
-	return newSchemaVersion, nil
+	_, err := sSvc.versionCollection.InsertOne(ctx, sv)
+	return err
 }
 
 func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
@@ -269,7 +284,12 @@ func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schem
 		return nil, err
 	}
 
-	ctx := context.Background()
+	if schema == nil {
+		return nil, services.ErrSchemaNotFound
+	}
+
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 	var filter bson.M
 
 	if schemaVersionId == "latest" {
@@ -280,7 +300,7 @@ func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schem
 		versionIdInt, err := strconv.Atoi(schemaVersionId)
 		if err != nil {
 			log.Printf("Invalid schema version string: %s : %v", schemaVersionId, err)
-			return nil, err
+			return nil, services.ErrSchemaVersionNotFound
 		}
 
 		filter = bson.M{
@@ -293,7 +313,9 @@ func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schem
 	opts.SetSort(bson.D{primitive.E{Key: "id", Value: -1}})
 
 	result := sSvc.versionCollection.FindOne(ctx, filter, opts)
-	if result.Err() != nil {
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrSchemaVersionNotFound
+	} else if result.Err() != nil {
 		log.Printf("Failed to find schema version: %v", result.Err())
 		return nil, result.Err()
 	}
@@ -301,30 +323,39 @@ func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schem
 	var sv services.SchemaVersion
 	err = result.Decode(&sv)
 	if err != nil {
-		log.Panicf("Failed to decode schema version: %v", err)
+		log.Printf("Failed to decode schema version: %v", err)
 		return nil, err
 	}
 
 	return &sv, nil
 }
 
-func (sSvc *SchemaService) UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
+func (sSvc *SchemaService) UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool, revision int) (*services.SchemaVersion, error) {
 	schemaVersion, err := sSvc.GetSchemaVersion(orgId, schemaId, schemaVersionId)
 	if err != nil {
 		log.Printf("Failed to get schema version during update, %v", err)
 		return nil, err
 	}
+	if !services.RevisionMatches(revision, schemaVersion.Revision) {
+		return nil, services.ErrRevisionMismatch
+	}
 
+	// Replace only the revision that was read, so a concurrent change is not overwritten
+	readRevision := schemaVersion.Revision
 	schemaVersion.Published = published
 	schemaVersion.Resources = resources
+	schemaVersion.Revision++
 
-	ctx := context.Background()
+	ctx, cancel := sSvc.db.context()
+	defer cancel()
 	filter := bson.M{
 		"schemaid": schemaId,
 		"id":       schemaVersion.Id,
 	}
-	results := sSvc.versionCollection.FindOneAndReplace(ctx, filter, schemaVersion)
-	if results.Err() != nil {
+	results := sSvc.versionCollection.FindOneAndReplace(ctx, withRevision(filter, readRevision), schemaVersion)
+	if results.Err() == mongo.ErrNoDocuments {
+		return nil, services.ErrRevisionMismatch
+	} else if results.Err() != nil {
 		log.Printf("failed to update schema: %v", results.Err())
 		return nil, results.Err()
 	}
@@ -0,0 +1,92 @@
+package services
+
+import "strconv"
+
+// MaxNamespaceDepth is the maximum number of namespaces in a chain from a root namespace
+const MaxNamespaceDepth = 16
+
+// NamespaceGetter looks up a single namespace in an organization
+type NamespaceGetter func(orgId string, nsId string) (*Namespace, error)
+
+// SchemaVersionGetter looks up a schema version by number or "latest"
+type SchemaVersionGetter func(orgId string, schemaId string, schemaVersionId string) (*SchemaVersion, error)
+
+// WalkNamespaceAncestors returns the chain of namespaces from the root down to and including nsId
+func WalkNamespaceAncestors(get NamespaceGetter, orgId string, nsId string) ([]*Namespace, error) {
+	var chain []*Namespace
+	visited := make(map[string]bool)
+
+	currentId := nsId
+	for currentId != "" {
+		if visited[currentId] {
+			return nil, ErrNamespaceCycle
+		}
+		if len(chain) >= MaxNamespaceDepth {
+			return nil, ErrNamespaceTooDeep
+		}
+		visited[currentId] = true
+
+		ns, err := get(orgId, currentId)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]*Namespace{ns}, chain...)
+		currentId = ns.ParentId
+	}
+
+	return chain, nil
+}
+
+// CheckNamespaceParent verifies that making parentId the parent of nsId keeps the hierarchy a tree.
+// An empty nsId checks the parent for a namespace that does not exist yet.
+func CheckNamespaceParent(get NamespaceGetter, orgId string, nsId string, parentId string) error {
+	if parentId == "" {
+		return nil
+	}
+	if parentId == nsId {
+		return ErrNamespaceCycle
+	}
+
+	chain, err := WalkNamespaceAncestors(get, orgId, parentId)
+	if err != nil {
+		return err
+	}
+	for _, ns := range chain {
+		if ns.Id == nsId {
+			return ErrNamespaceCycle
+		}
+	}
+	if len(chain) >= MaxNamespaceDepth {
+		return ErrNamespaceTooDeep
+	}
+	return nil
+}
+
+// CheckNamespacePin verifies that the schema a namespace is pinned to exists and, when the pin
+// names a version number, that the version does too. Namespaces without a schema are not checked.
+func CheckNamespacePin(get SchemaVersionGetter, orgId string, schemaId string, schemaVersion string) error {
+	if schemaId == "" {
+		return nil
+	}
+	if _, err := strconv.Atoi(schemaVersion); err != nil {
+		schemaVersion = "latest"
+	}
+	_, err := get(orgId, schemaId, schemaVersion)
+	return err
+}
+
+// MergeNamespaceVariables merges the variables of each namespace in the chain, with
+// namespaces later in the chain overriding those before them
+func MergeNamespaceVariables(chain []*Namespace, varsOf func(ns *Namespace) (map[string]string, error)) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, ns := range chain {
+		vars, err := varsOf(ns)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range vars {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
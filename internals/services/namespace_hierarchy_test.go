@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func namespaceGetter(namespaces ...*Namespace) NamespaceGetter {
+	return func(orgId string, nsId string) (*Namespace, error) {
+		for _, ns := range namespaces {
+			if ns.OrganizationId == orgId && ns.Id == nsId {
+				return ns, nil
+			}
+		}
+		return nil, ErrNamespaceNotFound
+	}
+}
+
+func TestWalkNamespaceAncestors(t *testing.T) {
+	get := namespaceGetter(
+		&Namespace{Id: "org", OrganizationId: "o1"},
+		&Namespace{Id: "bu", OrganizationId: "o1", ParentId: "org"},
+		&Namespace{Id: "prod", OrganizationId: "o1", ParentId: "bu"},
+	)
+
+	chain, err := WalkNamespaceAncestors(get, "o1", "prod")
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, ns := range chain {
+		ids = append(ids, ns.Id)
+	}
+	assert.Equal(t, []string{"org", "bu", "prod"}, ids)
+
+	_, err = WalkNamespaceAncestors(get, "o2", "prod")
+	assert.Equal(t, ErrNamespaceNotFound, err)
+}
+
+func TestCheckNamespaceParent(t *testing.T) {
+	get := namespaceGetter(
+		&Namespace{Id: "a", OrganizationId: "o1"},
+		&Namespace{Id: "b", OrganizationId: "o1", ParentId: "a"},
+		&Namespace{Id: "c", OrganizationId: "o1", ParentId: "b"},
+	)
+
+	assert.NoError(t, CheckNamespaceParent(get, "o1", "", "c"))
+	assert.NoError(t, CheckNamespaceParent(get, "o1", "c", "a"))
+	assert.Equal(t, ErrNamespaceCycle, CheckNamespaceParent(get, "o1", "a", "a"))
+	assert.Equal(t, ErrNamespaceCycle, CheckNamespaceParent(get, "o1", "a", "c"))
+	assert.Equal(t, ErrNamespaceNotFound, CheckNamespaceParent(get, "o1", "a", "missing"))
+}
+
+func TestMergeNamespaceVariables(t *testing.T) {
+	chain := []*Namespace{{Id: "parent"}, {Id: "child"}}
+	vars := map[string]map[string]string{
+		"parent": {"env": "dev", "team": "core"},
+		"child":  {"env": "prod"},
+	}
+
+	merged, err := MergeNamespaceVariables(chain, func(ns *Namespace) (map[string]string, error) {
+		return vars[ns.Id], nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "core"}, merged)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// SoftDeleteOrganization marks the organization deleted, restorable for restoreWindow, and
+// revokes its API keys together with every role binding granted to a key, including those
+// naming keys that no longer exist, so a restored organization starts with only the bindings
+// of its new admin key and its users. Requests for a deleted organization are refused, so its keys stop
+// working as soon as it is marked, even if revoking one then fails. Deleting an organization
+// again revokes any keys left without moving its purge. Fails with ErrRevisionMismatch if the
+// organization is not at the expected revision. Returns the keys revoked.
+func SoftDeleteOrganization(p *Providers, orgId string, deletedBy string, now time.Time, restoreWindow time.Duration, revision int) (*Organization, []*ApiKey, error) {
+	org, err := p.Organizations.GetOrganizationById(orgId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if org == nil {
+		return nil, nil, ErrOrganizationNotFound
+	}
+	if !RevisionMatches(revision, org.Revision) {
+		return nil, nil, ErrRevisionMismatch
+	}
+
+	if org.Deletion == nil {
+		now = now.UTC()
+		org, err = p.Organizations.DeleteOrganization(orgId, OrganizationDeletion{
+			DeletedBy:  deletedBy,
+			DeletedAt:  now,
+			PurgeAfter: now.Add(restoreWindow),
+		}, revision)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The bindings go first, so a key left behind by a failure has no roles if it is restored
+	bindings, err := p.RoleBindings.ListRoleBindings(orgId)
+	if err != nil {
+		return org, nil, err
+	}
+	for _, binding := range bindings {
+		if !strings.HasPrefix(binding.Subject, ApiKeySubject("")) {
+			continue
+		}
+		if err := p.RoleBindings.DeleteRoleBinding(orgId, binding.Id); err != nil && err != ErrRoleBindingNotFound {
+			return org, nil, err
+		}
+	}
+
+	keys, err := p.ApiKeys.ListKeys(orgId)
+	if err != nil {
+		return org, nil, err
+	}
+	revoked := make([]*ApiKey, 0, len(keys))
+	for _, ak := range keys {
+		if err := p.ApiKeys.DeleteKey(ak.Id); err != nil && err != ErrApiKeyNotFound {
+			return org, revoked, err
+		}
+		revoked = append(revoked, ak)
+	}
+	return org, revoked, nil
+}
+
+// RestoreDeletedOrganization restores an organization before it is purged. Its keys were
+// revoked when it was deleted, so it is given a new admin key. Fails with
+// ErrOrganizationNotDeleted if it is not deleted, ErrOrganizationPurgeDue once it can no
+// longer be restored and ErrRevisionMismatch if it is not at the expected revision.
+func RestoreDeletedOrganization(p *Providers, orgId string, keyName string, now time.Time, revision int) (*Bootstrap, error) {
+	org, err := p.Organizations.GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	deletion := org.Deletion
+	if deletion == nil {
+		return nil, ErrOrganizationNotDeleted
+	}
+	if !now.Before(deletion.PurgeAfter) {
+		return nil, ErrOrganizationPurgeDue
+	}
+
+	org, err = p.Organizations.RestoreOrganization(orgId, revision)
+	if err != nil {
+		return nil, err
+	}
+	ak, binding, err := CreateAdminKey(p, orgId, keyName)
+	if err != nil {
+		// Without a key nobody may be able to use the organization, so it stays deleted
+		if _, err := p.Organizations.DeleteOrganization(orgId, *deletion, 0); err != nil {
+			log.Printf("failed to delete organization %s again after its restore failed: %v", orgId, err)
+		}
+		return nil, err
+	}
+
+	return &Bootstrap{
+		Organization: org,
+		ApiKey:       ak,
+		RoleBinding:  binding,
+	}, nil
+}
+
+// PurgeDeletedOrganizations purges every deleted organization whose restore window ended by
+// now and returns their IDs. An organization that fails to purge is logged and left for the
+// next run; the first such error is returned once the others have been purged.
+func PurgeDeletedOrganizations(p *Providers, now time.Time) ([]string, error) {
+	orgs, err := p.Organizations.ListOrganizations()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	var firstErr error
+	for _, org := range orgs {
+		if org.Deletion == nil || now.Before(org.Deletion.PurgeAfter) {
+			continue
+		}
+		if err := p.Organizations.PurgeOrganization(org.Id); err != nil {
+			log.Printf("failed to purge deleted organization %s: %v", org.Id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged = append(purged, org.Id)
+	}
+	return purged, firstErr
+}
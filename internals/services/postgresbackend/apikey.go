@@ -0,0 +1,171 @@
+package postgresbackend
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+const apiKeyColumns = `id, organization_id, name, prefix, salt, hash, expires, scope, replaced_by, rotated_from, last_used_at`
+
+type ApiKeyService struct {
+	db *DB
+}
+
+func NewApiKeyService(db *DB) *ApiKeyService {
+	return &ApiKeyService{
+		db: db,
+	}
+}
+
+func scanApiKey(row scanner) (*services.ApiKey, error) {
+	var ak services.ApiKey
+	var scope []byte
+	var expires, lastUsedAt sql.NullTime
+	err := row.Scan(&ak.Id, &ak.OrganizationId, &ak.Name, &ak.Prefix, &ak.Salt, &ak.Hash, &expires, &scope,
+		&ak.ReplacedBy, &ak.RotatedFrom, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	ak.Expires = expires.Time
+	ak.LastUsedAt = lastUsedAt.Time
+	if err := unmarshalJSON(scope, &ak.Scope); err != nil {
+		return nil, err
+	}
+	return &ak, nil
+}
+
+func (akSvc *ApiKeyService) GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*services.ApiKey, error) {
+	ak := services.NewApiKey(orgId, name, expires, scope)
+	if err := insertApiKey(akSvc.db.sql, ak); err != nil {
+		return nil, err
+	}
+	return ak, nil
+}
+
+func insertApiKey(q queryer, ak *services.ApiKey) error {
+	scopeJSON, err := marshalJSON(ak.Scope)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		ak.Id, ak.OrganizationId, ak.Name, ak.Prefix, ak.Salt, ak.Hash, nullTime(ak.Expires), scopeJSON,
+		ak.ReplacedBy, ak.RotatedFrom, nullTime(ak.LastUsedAt))
+	if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return services.ErrOrganizationNotFound
+	}
+	return err
+}
+
+func (akSvc *ApiKeyService) ListKeys(orgId string) ([]*services.ApiKey, error) {
+	rows, err := akSvc.db.sql.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE organization_id = $1 ORDER BY id`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*services.ApiKey
+	for rows.Next() {
+		ak, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ak)
+	}
+	return result, rows.Err()
+}
+
+func (akSvc *ApiKeyService) GetKey(key string) *services.ApiKey {
+	rows, err := akSvc.db.sql.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, services.ApiKeyPrefix(key))
+	if err != nil {
+		log.Printf("failed to look up api key: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	// Prefixes are short enough that two keys can share one
+	for rows.Next() {
+		ak, err := scanApiKey(rows)
+		if err != nil {
+			log.Printf("failed to look up api key: %v", err)
+			return nil
+		}
+		if ak.Matches(key) {
+			return ak
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to look up api key: %v", err)
+	}
+	return nil
+}
+
+func (akSvc *ApiKeyService) GetKeyById(apiId string) *services.ApiKey {
+	ak, err := scanApiKey(akSvc.db.sql.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, apiId))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("failed to get api key: %v", err)
+		}
+		return nil
+	}
+	return ak
+}
+
+func (akSvc *ApiKeyService) RotateKey(rotated *services.ApiKey, successor *services.ApiKey) error {
+	return akSvc.db.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE api_keys SET replaced_by = $2, expires = $3 WHERE id = $1 AND replaced_by = ''`,
+			rotated.Id, rotated.ReplacedBy, nullTime(rotated.Expires))
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1)`, rotated.Id).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return services.ErrApiKeyNotFound
+			}
+			return services.ErrApiKeyRotated
+		}
+		return insertApiKey(tx, successor)
+	})
+}
+
+func (akSvc *ApiKeyService) SetKeyLastUsed(apiId string, at time.Time) error {
+	result, err := akSvc.db.sql.Exec(`UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, apiId, at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return services.ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func (akSvc *ApiKeyService) DeleteKey(apiId string) error {
+	result, err := akSvc.db.sql.Exec(`DELETE FROM api_keys WHERE id = $1`, apiId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return services.ErrApiKeyNotFound
+	}
+	return nil
+}
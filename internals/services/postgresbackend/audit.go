@@ -0,0 +1,103 @@
+package postgresbackend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+const auditEventColumns = `id, organization_id, time, actor, request_id, action, resource_type, resource_id, before, after`
+
+type AuditService struct {
+	db *DB
+}
+
+func NewAuditService(db *DB) *AuditService {
+	return &AuditService{
+		db: db,
+	}
+}
+
+func scanAuditEvent(row scanner) (*services.AuditEvent, error) {
+	var event services.AuditEvent
+	var before, after []byte
+	err := row.Scan(&event.Id, &event.OrganizationId, &event.Time, &event.Actor, &event.RequestId,
+		&event.Action, &event.ResourceType, &event.ResourceId, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = before
+	event.After = after
+	return &event, nil
+}
+
+// JSON held by an event is stored as null when the event has none
+func nullJSON(raw []byte) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func (aSvc *AuditService) RecordEvent(event *services.AuditEvent) error {
+	_, err := aSvc.db.sql.Exec(`INSERT INTO audit_events (`+auditEventColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		event.Id, event.OrganizationId, event.Time, event.Actor, event.RequestId, event.Action,
+		event.ResourceType, event.ResourceId, nullJSON(event.Before), nullJSON(event.After))
+	return err
+}
+
+func (aSvc *AuditService) ListEvents(orgId string, filter services.AuditFilter) ([]*services.AuditEvent, error) {
+	conditions := []string{"organization_id = $1"}
+	args := []interface{}{orgId}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Actor != "" {
+		where("actor = $%d", filter.Actor)
+	}
+	if filter.RequestId != "" {
+		where("request_id = $%d", filter.RequestId)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		where("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceId != "" {
+		where("resource_id = $%d", filter.ResourceId)
+	}
+	if !filter.Since.IsZero() {
+		where("time >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("time < $%d", filter.Until)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY time DESC, id DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+
+	rows, err := aSvc.db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*services.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, event)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,133 @@
+package postgresbackend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/lib/pq"
+)
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// DB is a PostgreSQL database shared by the services of the postgres backend
+type DB struct {
+	sql *sql.DB
+}
+
+// Open connects to the database. Pending migrations are not applied.
+func Open(dsn string) (*DB, error) {
+	sqlDb, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlDb.Ping()
+	if err != nil {
+		sqlDb.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	db := &DB{
+		sql: sqlDb,
+	}
+	err = db.initMigrations()
+	if err != nil {
+		sqlDb.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	return db.sql.Close()
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling back otherwise
+func (db *DB) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("failed to roll back transaction: %v", rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// constraintError returns the violated constraint if err is the given postgres error code
+func constraintError(err error, code string) (string, bool) {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || string(pqErr.Code) != code {
+		return "", false
+	}
+	return pqErr.Constraint, true
+}
+
+// JSON columns are passed to the driver as strings so they are sent as text
+func marshalJSON(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	return string(raw), err
+}
+
+func unmarshalJSON(raw []byte, v interface{}) error {
+	if raw == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// The numeric schema version of a pin, or null for "latest"
+func schemaVersionNumber(schemaVersion string) sql.NullInt64 {
+	n, err := strconv.Atoi(schemaVersion)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(n), Valid: true}
+}
+
+// Translate foreign key violations on a namespace pin into the typed service errors
+func namespaceSchemaError(err error) error {
+	constraint, ok := constraintError(err, pgForeignKeyViolation)
+	if !ok {
+		return err
+	}
+	switch constraint {
+	case "namespaces_schema_id_fkey":
+		return services.ErrSchemaNotFound
+	case "namespaces_schema_version_fkey":
+		return services.ErrSchemaVersionNotFound
+	case "namespaces_parent_id_fkey":
+		return services.ErrNamespaceNotFound
+	case "namespaces_organization_id_fkey", "namespace_vars_organization_id_fkey":
+		return services.ErrOrganizationNotFound
+	}
+	return err
+}
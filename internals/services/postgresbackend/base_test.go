@@ -0,0 +1,59 @@
+package postgresbackend
+
+import (
+	"os"
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/MrWestbury/terraxen-naming-service/internals/services/servicestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB connects to the database in TERRAXEN_TEST_POSTGRES_DSN and skips the test when it is not set
+func openTestDB(t *testing.T) *DB {
+	dsn := os.Getenv("TERRAXEN_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TERRAXEN_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := Open(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = services.RunMigrations(db, false)
+	require.NoError(t, err)
+	return db
+}
+
+func TestMigrationFiles(t *testing.T) {
+	all, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	for i, m := range all {
+		assert.Equal(t, i+1, m.Version, m.file)
+	}
+	assert.Equal(t, "initial", all[0].Description)
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	pending, err := services.PendingMigrations(db)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	require.NoError(t, db.ApplyMigration(1))
+}
+
+func TestProviders(t *testing.T) {
+	db := openTestDB(t)
+	servicestest.RunProvidersSuite(t, func(t *testing.T) *services.Providers {
+		return &services.Providers{
+			ApiKeys:       NewApiKeyService(db),
+			Namespaces:    NewNamespaceService(db),
+			Organizations: NewOrganizationService(db),
+			Schemas:       NewSchemaService(db),
+			Audit:         NewAuditService(db),
+			History:       NewVariableHistoryService(db),
+			RoleBindings:  NewRoleBindingService(db),
+		}
+	})
+}
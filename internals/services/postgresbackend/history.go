@@ -0,0 +1,85 @@
+package postgresbackend
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+const snapshotColumns = `organization_id, namespace_id, time, deleted, name, parent_id, schema_id, schema_version, variables, resolved_schema_version`
+
+type VariableHistoryService struct {
+	db *DB
+}
+
+func NewVariableHistoryService(db *DB) *VariableHistoryService {
+	return &VariableHistoryService{
+		db: db,
+	}
+}
+
+func scanSnapshot(row scanner) (*services.VariableSnapshot, error) {
+	var snapshot services.VariableSnapshot
+	var vars, resolved []byte
+	err := row.Scan(&snapshot.OrganizationId, &snapshot.NamespaceId, &snapshot.Time, &snapshot.Deleted, &snapshot.Name,
+		&snapshot.ParentId, &snapshot.SchemaId, &snapshot.SchemaVersion, &vars, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(vars, &snapshot.Variables); err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(resolved, &snapshot.ResolvedSchemaVersion); err != nil {
+		return nil, err
+	}
+	snapshot.Time = snapshot.Time.UTC()
+	return &snapshot, nil
+}
+
+func (hSvc *VariableHistoryService) RecordSnapshot(snapshot *services.VariableSnapshot) error {
+	vars, err := marshalJSON(snapshot.Variables)
+	if err != nil {
+		return err
+	}
+	// Snapshots without a schema version store null
+	var resolved interface{}
+	if snapshot.ResolvedSchemaVersion != nil {
+		if resolved, err = marshalJSON(snapshot.ResolvedSchemaVersion); err != nil {
+			return err
+		}
+	}
+
+	_, err = hSvc.db.sql.Exec(`INSERT INTO variable_history (`+snapshotColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		snapshot.OrganizationId, snapshot.NamespaceId, snapshot.Time, snapshot.Deleted, snapshot.Name,
+		snapshot.ParentId, snapshot.SchemaId, snapshot.SchemaVersion, vars, resolved)
+	return err
+}
+
+func (hSvc *VariableHistoryService) ListSnapshots(orgId string, nsId string) ([]*services.VariableSnapshot, error) {
+	rows, err := hSvc.db.sql.Query(`SELECT `+snapshotColumns+` FROM variable_history
+		WHERE organization_id = $1 AND namespace_id = $2 ORDER BY time DESC, seq DESC`, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*services.VariableSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, snapshot)
+	}
+	return result, rows.Err()
+}
+
+func (hSvc *VariableHistoryService) SnapshotAt(orgId string, nsId string, at time.Time) (*services.VariableSnapshot, error) {
+	snapshot, err := scanSnapshot(hSvc.db.sql.QueryRow(`SELECT `+snapshotColumns+` FROM variable_history
+		WHERE organization_id = $1 AND namespace_id = $2 AND time <= $3 ORDER BY time DESC, seq DESC LIMIT 1`, orgId, nsId, at))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
@@ -0,0 +1,136 @@
+package postgresbackend
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	services.Migration
+	file string
+}
+
+// loadMigrations returns the embedded migrations ordered by version. Each file is
+// named <version>_<description>.sql.
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	result := []migration{}
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSuffix(entry.Name(), ".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		result = append(result, migration{
+			Migration: services.Migration{
+				Version:     version,
+				Description: strings.ReplaceAll(parts[1], "_", " "),
+			},
+			file: "migrations/" + entry.Name(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// initMigrations creates the table that records applied migrations
+func (db *DB) initMigrations() error {
+	_, err := db.sql.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// Migrations returns the migrations of the postgres backend
+func (db *DB) Migrations() []services.Migration {
+	// The embedded files are checked by the tests, so they cannot fail to load
+	all, _ := loadMigrations()
+	result := make([]services.Migration, len(all))
+	for i, m := range all {
+		result[i] = m.Migration
+	}
+	return result
+}
+
+// AppliedMigrations returns the migrations recorded in schema_migrations
+func (db *DB) AppliedMigrations() ([]services.AppliedMigration, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	descriptions := map[int]string{}
+	for _, m := range all {
+		descriptions[m.Version] = m.Description
+	}
+
+	rows, err := db.sql.Query(`SELECT version, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []services.AppliedMigration{}
+	for rows.Next() {
+		var record services.AppliedMigration
+		if err := rows.Scan(&record.Version, &record.AppliedAt); err != nil {
+			return nil, err
+		}
+		record.Description = descriptions[record.Version]
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+// ApplyMigration runs the migration and records it in schema_migrations in one transaction
+func (db *DB) ApplyMigration(version int) error {
+	all, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if m.Version != version {
+			continue
+		}
+		script, err := migrationFiles.ReadFile(m.file)
+		if err != nil {
+			return err
+		}
+
+		return db.withTx(func(tx *sql.Tx) error {
+			// Serialise migrations between instances starting at the same time
+			if _, err := tx.Exec(`LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+
+			var applied bool
+			err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+			if err != nil || applied {
+				return err
+			}
+
+			if _, err := tx.Exec(string(script)); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+	}
+	return fmt.Errorf("unknown migration %d", version)
+}
@@ -0,0 +1,70 @@
+CREATE TABLE organizations (
+    id             TEXT PRIMARY KEY,
+    name           TEXT NOT NULL,
+    vars           JSONB NOT NULL DEFAULT '{}',
+    freeze_windows JSONB NOT NULL DEFAULT '[]',
+    CONSTRAINT organizations_name_key UNIQUE (name)
+);
+
+CREATE TABLE schemas (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    CONSTRAINT schemas_organization_name_key UNIQUE (organization_id, name)
+);
+
+CREATE TABLE schema_versions (
+    schema_id TEXT NOT NULL REFERENCES schemas (id) ON DELETE CASCADE,
+    version   INTEGER NOT NULL,
+    published BOOLEAN NOT NULL DEFAULT FALSE,
+    resources JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (schema_id, version)
+);
+
+-- schema_version holds the pin as given ("latest" or a number). When it is a number it is
+-- copied to schema_version_number so the pinned version is enforced by a foreign key.
+CREATE TABLE namespaces (
+    id                    TEXT PRIMARY KEY,
+    organization_id       TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name                  TEXT NOT NULL,
+    parent_id             TEXT REFERENCES namespaces (id),
+    schema_id             TEXT REFERENCES schemas (id),
+    schema_version        TEXT NOT NULL,
+    schema_version_number INTEGER,
+    lock                  JSONB,
+    CONSTRAINT namespaces_organization_name_key UNIQUE (organization_id, name),
+    CONSTRAINT namespaces_schema_version_fkey FOREIGN KEY (schema_id, schema_version_number)
+        REFERENCES schema_versions (schema_id, version)
+);
+
+CREATE INDEX namespaces_parent_idx ON namespaces (organization_id, parent_id);
+
+CREATE TABLE namespace_vars (
+    namespace_id    TEXT NOT NULL REFERENCES namespaces (id) ON DELETE CASCADE,
+    organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    key             TEXT NOT NULL,
+    value           TEXT NOT NULL,
+    CONSTRAINT namespace_vars_pkey PRIMARY KEY (namespace_id, key)
+);
+
+CREATE TABLE namespace_templates (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    schema_id       TEXT NOT NULL,
+    schema_version  TEXT NOT NULL,
+    variables       JSONB NOT NULL DEFAULT '{}',
+    CONSTRAINT namespace_templates_organization_name_key UNIQUE (organization_id, name)
+);
+
+CREATE TABLE api_keys (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            TEXT NOT NULL DEFAULT '',
+    key             TEXT NOT NULL,
+    expires         TIMESTAMPTZ NOT NULL,
+    scope           JSONB NOT NULL DEFAULT '{}',
+    CONSTRAINT api_keys_key_key UNIQUE (key)
+);
+
+CREATE INDEX api_keys_organization_idx ON api_keys (organization_id);
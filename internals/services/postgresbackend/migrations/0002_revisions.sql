@@ -0,0 +1,5 @@
+-- Every change to these rows increments revision so concurrent writers can detect each other
+ALTER TABLE organizations ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE schemas ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE schema_versions ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE namespaces ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
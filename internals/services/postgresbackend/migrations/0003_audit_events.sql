@@ -0,0 +1,16 @@
+-- Audit events are append only and outlive the resources they describe, so there is no
+-- foreign key to organizations
+CREATE TABLE audit_events (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    time            TIMESTAMPTZ NOT NULL,
+    actor           TEXT NOT NULL,
+    request_id      TEXT NOT NULL,
+    action          TEXT NOT NULL,
+    resource_type   TEXT NOT NULL,
+    resource_id     TEXT NOT NULL,
+    before          JSONB,
+    after           JSONB
+);
+
+CREATE INDEX audit_events_organization_time_idx ON audit_events (organization_id, time DESC);
@@ -0,0 +1,16 @@
+-- Snapshots of organization variables have an empty namespace_id. seq orders snapshots taken
+-- in the same millisecond.
+CREATE TABLE variable_history (
+    seq             BIGSERIAL PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    namespace_id    TEXT NOT NULL DEFAULT '',
+    time            TIMESTAMPTZ NOT NULL,
+    deleted         BOOLEAN NOT NULL DEFAULT FALSE,
+    name            TEXT NOT NULL DEFAULT '',
+    parent_id       TEXT NOT NULL DEFAULT '',
+    schema_id       TEXT NOT NULL DEFAULT '',
+    schema_version  TEXT NOT NULL DEFAULT '',
+    variables       JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX variable_history_subject_time_idx ON variable_history (organization_id, namespace_id, time DESC, seq DESC);
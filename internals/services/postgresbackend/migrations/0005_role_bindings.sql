@@ -0,0 +1,14 @@
+-- resource_id is empty for bindings across the whole organization
+CREATE TABLE role_bindings (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    subject         TEXT NOT NULL,
+    role            TEXT NOT NULL,
+    resource_type   TEXT NOT NULL,
+    resource_id     TEXT NOT NULL DEFAULT '',
+    CONSTRAINT role_bindings_subject_role_resource_key UNIQUE (organization_id, subject, role, resource_type, resource_id)
+);
+
+-- API keys created before roles existed could do anything in their organization
+INSERT INTO role_bindings (id, organization_id, subject, role, resource_type)
+SELECT 'apikey-' || id, organization_id, 'apikey:' || id, 'org_admin', 'organization' FROM api_keys;
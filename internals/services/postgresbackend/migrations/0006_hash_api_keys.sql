@@ -0,0 +1,11 @@
+ALTER TABLE api_keys ADD COLUMN prefix TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN salt TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+
+-- Keys were stored in plaintext. Keep their first 12 characters to find them by and replace
+-- the rest with the hex SHA-256 of a new salt followed by the key, as services.ApiKey does.
+UPDATE api_keys SET prefix = left(key, 12), salt = md5(random()::text || clock_timestamp()::text || id);
+UPDATE api_keys SET hash = encode(sha256(convert_to(salt || key, 'UTF8')), 'hex');
+
+ALTER TABLE api_keys DROP COLUMN key;
+CREATE INDEX api_keys_prefix_idx ON api_keys (prefix);
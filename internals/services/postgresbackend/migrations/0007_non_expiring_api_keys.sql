@@ -0,0 +1,4 @@
+-- Keys used to be given an expiry an hour after they were created that was never checked.
+-- Now that it is, existing keys keep working until they are deleted. Null means never.
+ALTER TABLE api_keys ALTER COLUMN expires DROP NOT NULL;
+UPDATE api_keys SET expires = NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE api_keys ADD COLUMN replaced_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN rotated_from TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN last_used_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE organizations ADD COLUMN deletion JSONB;
@@ -0,0 +1,2 @@
+-- The schema version a namespace pin resolved to when the snapshot was taken, with its resources
+ALTER TABLE variable_history ADD COLUMN resolved_schema_version JSONB;
@@ -0,0 +1,403 @@
+package postgresbackend
+
+import (
+	"database/sql"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+const namespaceColumns = `id, name, organization_id, COALESCE(parent_id, ''), COALESCE(schema_id, ''), schema_version, lock, revision`
+
+type NamespaceService struct {
+	db *DB
+}
+
+func NewNamespaceService(db *DB) *NamespaceService {
+	return &NamespaceService{
+		db: db,
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanNamespace(row scanner) (*services.Namespace, error) {
+	var ns services.Namespace
+	var lock []byte
+	err := row.Scan(&ns.Id, &ns.Name, &ns.OrganizationId, &ns.ParentId, &ns.SchemaId, &ns.SchemaVersion, &lock, &ns.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		ns.Lock = &services.NamespaceLock{}
+		if err := unmarshalJSON(lock, ns.Lock); err != nil {
+			return nil, err
+		}
+	}
+	return &ns, nil
+}
+
+func getNamespace(q queryer, orgId string, nsId string, forUpdate bool) (*services.Namespace, error) {
+	query := `SELECT ` + namespaceColumns + ` FROM namespaces WHERE organization_id = $1 AND id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	ns, err := scanNamespace(q.QueryRow(query, orgId, nsId))
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNamespaceNotFound
+	}
+	return ns, err
+}
+
+func namespaceGetter(q queryer) services.NamespaceGetter {
+	return func(orgId string, nsId string) (*services.Namespace, error) {
+		return getNamespace(q, orgId, nsId, false)
+	}
+}
+
+func queryNamespaces(q queryer, where string, args ...interface{}) ([]*services.Namespace, error) {
+	rows, err := q.Query(`SELECT `+namespaceColumns+` FROM namespaces WHERE `+where+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nsList := make([]*services.Namespace, 0)
+	for rows.Next() {
+		ns, err := scanNamespace(rows)
+		if err != nil {
+			return nil, err
+		}
+		nsList = append(nsList, ns)
+	}
+	return nsList, rows.Err()
+}
+
+func namespaceError(err error) error {
+	if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "namespaces_organization_name_key" {
+		return services.ErrNamespaceAlreadyExists
+	}
+	return namespaceSchemaError(err)
+}
+
+func (nsSvc *NamespaceService) CreateNamespace(orgId string, name string, parentId string, schemaId string, schemaVersion string, vars map[string]string) (*services.Namespace, error) {
+	ns := &services.Namespace{
+		Id:             uuid.NewString(),
+		Name:           name,
+		OrganizationId: orgId,
+		ParentId:       parentId,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Revision:       1,
+	}
+
+	err := nsSvc.db.withTx(func(tx *sql.Tx) error {
+		err := services.CheckNamespaceParent(namespaceGetter(tx), orgId, "", parentId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO namespaces (id, name, organization_id, parent_id, schema_id, schema_version, schema_version_number)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			ns.Id, ns.Name, orgId, nullString(parentId), nullString(schemaId), schemaVersion, schemaVersionNumber(schemaVersion))
+		if err != nil {
+			return namespaceError(err)
+		}
+
+		for k, v := range vars {
+			_, err = tx.Exec(`INSERT INTO namespace_vars (namespace_id, organization_id, key, value) VALUES ($1, $2, $3, $4)`, ns.Id, orgId, k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) ExistsByName(orgId string, nsName string) bool {
+	var exists bool
+	err := nsSvc.db.sql.QueryRow(`SELECT EXISTS (SELECT 1 FROM namespaces WHERE organization_id = $1 AND name = $2)`, orgId, nsName).Scan(&exists)
+	return err == nil && exists
+}
+
+func (nsSvc *NamespaceService) GetNamespaceById(orgId string, nsId string) (*services.Namespace, error) {
+	return getNamespace(nsSvc.db.sql, orgId, nsId, false)
+}
+
+func (nsSvc *NamespaceService) ListNamespaces(orgId string) ([]*services.Namespace, error) {
+	return queryNamespaces(nsSvc.db.sql, `organization_id = $1`, orgId)
+}
+
+func (nsSvc *NamespaceService) ListChildNamespaces(orgId string, nsId string) ([]*services.Namespace, error) {
+	return queryNamespaces(nsSvc.db.sql, `organization_id = $1 AND parent_id = $2`, orgId, nsId)
+}
+
+func (nsSvc *NamespaceService) GetNamespaceAncestors(orgId string, nsId string) ([]*services.Namespace, error) {
+	return services.WalkNamespaceAncestors(namespaceGetter(nsSvc.db.sql), orgId, nsId)
+}
+
+func (nsSvc *NamespaceService) UpdateNamespace(orgId string, nsId string, nsName string, parentId string, schemaVersion string, revision int) (*services.Namespace, error) {
+	var ns *services.Namespace
+	err := nsSvc.db.withTx(func(tx *sql.Tx) error {
+		current, err := getNamespace(tx, orgId, nsId, true)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, current.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		err = services.CheckNamespaceParent(namespaceGetter(tx), orgId, nsId, parentId)
+		if err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(`UPDATE namespaces SET name = $3, parent_id = $4, schema_version = $5, schema_version_number = $6, revision = revision + 1
+			WHERE organization_id = $1 AND id = $2 RETURNING `+namespaceColumns,
+			orgId, nsId, nsName, nullString(parentId), schemaVersion, schemaVersionNumber(schemaVersion))
+		ns, err = scanNamespace(row)
+		return namespaceError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespace(orgId string, nsId string, revision int) error {
+	return nsSvc.db.withTx(func(tx *sql.Tx) error {
+		ns, err := getNamespace(tx, orgId, nsId, true)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, ns.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		var hasChildren bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM namespaces WHERE organization_id = $1 AND parent_id = $2)`, orgId, nsId).Scan(&hasChildren)
+		if err != nil {
+			return err
+		}
+		if hasChildren {
+			return services.ErrNamespaceHasChildren
+		}
+
+		_, err = tx.Exec(`DELETE FROM namespaces WHERE organization_id = $1 AND id = $2`, orgId, nsId)
+		return err
+	})
+}
+
+func (nsSvc *NamespaceService) LockNamespace(orgId string, nsId string, lock services.NamespaceLock) (*services.Namespace, error) {
+	raw, err := marshalJSON(lock)
+	if err != nil {
+		return nil, err
+	}
+	return nsSvc.setLock(orgId, nsId, raw)
+}
+
+func (nsSvc *NamespaceService) UnlockNamespace(orgId string, nsId string) (*services.Namespace, error) {
+	return nsSvc.setLock(orgId, nsId, nil)
+}
+
+// Set the lock column of a namespace. A nil lock stores null.
+func (nsSvc *NamespaceService) setLock(orgId string, nsId string, lock interface{}) (*services.Namespace, error) {
+	row := nsSvc.db.sql.QueryRow(`UPDATE namespaces SET lock = $3, revision = revision + 1 WHERE organization_id = $1 AND id = $2 RETURNING `+namespaceColumns, orgId, nsId, lock)
+	ns, err := scanNamespace(row)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNamespaceNotFound
+	}
+	return ns, err
+}
+
+func listNamespaceVars(q queryer, orgId string, nsId string) ([]*services.NamespaceVar, error) {
+	rows, err := q.Query(`SELECT key, value, organization_id, namespace_id FROM namespace_vars
+		WHERE organization_id = $1 AND namespace_id = $2 ORDER BY key`, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*services.NamespaceVar
+	for rows.Next() {
+		var nsVar services.NamespaceVar
+		err = rows.Scan(&nsVar.Key, &nsVar.Value, &nsVar.OrgId, &nsVar.NamespaceId)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &nsVar)
+	}
+	return results, rows.Err()
+}
+
+func ownVariables(q queryer, orgId string, nsId string) (map[string]string, error) {
+	items, err := listNamespaceVars(q, orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for _, i := range items {
+		result[i.Key] = i.Value
+	}
+	return result, nil
+}
+
+func (nsSvc *NamespaceService) ListNamespaceVars(orgId string, nsId string) ([]*services.NamespaceVar, error) {
+	return listNamespaceVars(nsSvc.db.sql, orgId, nsId)
+}
+
+// Replace all of the variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) ReplaceNamespaceVariables(orgId string, nsId string, vars map[string]string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return vars, nil
+	})
+}
+
+// Upsert and delete variables set directly on a namespace in a single transaction, bumping its revision
+func (nsSvc *NamespaceService) PatchNamespaceVariables(orgId string, nsId string, upserts map[string]string, deletes []string, revision int) (*services.VariableChangeSummary, error) {
+	return nsSvc.changeVariables(orgId, nsId, revision, func(current map[string]string) (map[string]string, error) {
+		return services.ApplyVariablePatch(current, upserts, deletes)
+	})
+}
+
+func (nsSvc *NamespaceService) changeVariables(orgId string, nsId string, revision int, change func(current map[string]string) (map[string]string, error)) (*services.VariableChangeSummary, error) {
+	var summary *services.VariableChangeSummary
+	err := nsSvc.db.withTx(func(tx *sql.Tx) error {
+		// Locking the namespace row serialises concurrent bulk changes to its variables
+		ns, err := getNamespace(tx, orgId, nsId, true)
+		if err != nil {
+			return err
+		}
+		if !services.RevisionMatches(revision, ns.Revision) {
+			return services.ErrRevisionMismatch
+		}
+
+		current, err := ownVariables(tx, orgId, nsId)
+		if err != nil {
+			return err
+		}
+		desired, err := change(current)
+		if err != nil {
+			return err
+		}
+		summary = services.DiffVariables(current, desired)
+
+		for _, k := range summary.Deleted {
+			_, err = tx.Exec(`DELETE FROM namespace_vars WHERE namespace_id = $1 AND key = $2`, nsId, k)
+			if err != nil {
+				return err
+			}
+		}
+		for _, k := range summary.Created {
+			_, err = tx.Exec(`INSERT INTO namespace_vars (namespace_id, organization_id, key, value) VALUES ($1, $2, $3, $4)`, nsId, orgId, k, desired[k])
+			if err != nil {
+				return err
+			}
+		}
+		for _, k := range summary.Updated {
+			_, err = tx.Exec(`UPDATE namespace_vars SET value = $3 WHERE namespace_id = $1 AND key = $2`, nsId, k, desired[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		summary.Revision = ns.Revision + 1
+		_, err = tx.Exec(`UPDATE namespaces SET revision = revision + 1 WHERE organization_id = $1 AND id = $2`, orgId, nsId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Get the effective variables of a namespace, merged down the chain of parent namespaces
+func (nsSvc *NamespaceService) GetVariablesAsMap(orgId string, nsId string) (map[string]string, error) {
+	chain, err := nsSvc.GetNamespaceAncestors(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	return services.MergeNamespaceVariables(chain, func(ns *services.Namespace) (map[string]string, error) {
+		return ownVariables(nsSvc.db.sql, orgId, ns.Id)
+	})
+}
+
+func (nsSvc *NamespaceService) GetNamespaceVariable(orgId string, nsId string, varId string) (*services.NamespaceVar, error) {
+	var nsVar services.NamespaceVar
+	err := nsSvc.db.sql.QueryRow(`SELECT key, value, organization_id, namespace_id FROM namespace_vars
+		WHERE organization_id = $1 AND namespace_id = $2 AND key = $3`, orgId, nsId, varId).
+		Scan(&nsVar.Key, &nsVar.Value, &nsVar.OrgId, &nsVar.NamespaceId)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNamespaceVarNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &nsVar, nil
+}
+
+func (nsSvc *NamespaceService) CreateNamespaceVariable(orgId string, nsId string, key string, value string) (*services.NamespaceVar, error) {
+	_, err := nsSvc.GetNamespaceById(orgId, nsId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = nsSvc.db.sql.Exec(`INSERT INTO namespace_vars (namespace_id, organization_id, key, value) VALUES ($1, $2, $3, $4)`, nsId, orgId, key, value)
+	if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "namespace_vars_pkey" {
+		return nil, services.ErrNamespaceVarExists
+	} else if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return nil, services.ErrNamespaceNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &services.NamespaceVar{
+		OrgId:       orgId,
+		NamespaceId: nsId,
+		Key:         key,
+		Value:       value,
+	}, nil
+}
+
+func (nsSvc *NamespaceService) UpdateNamespaceVariable(orgId string, nsId string, varId string, value string) (*services.NamespaceVar, error) {
+	var nsVar services.NamespaceVar
+	err := nsSvc.db.sql.QueryRow(`UPDATE namespace_vars SET value = $4
+		WHERE organization_id = $1 AND namespace_id = $2 AND key = $3
+		RETURNING key, value, organization_id, namespace_id`, orgId, nsId, varId, value).
+		Scan(&nsVar.Key, &nsVar.Value, &nsVar.OrgId, &nsVar.NamespaceId)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNamespaceVarNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &nsVar, nil
+}
+
+func (nsSvc *NamespaceService) DeleteNamespaceVariable(orgId string, nsId string, varId string) error {
+	result, err := nsSvc.db.sql.Exec(`DELETE FROM namespace_vars WHERE organization_id = $1 AND namespace_id = $2 AND key = $3`, orgId, nsId, varId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return services.ErrNamespaceVarNotFound
+	}
+	return nil
+}
+
+func (nsSvc *NamespaceService) NamespaceVariableExists(orgId string, nsId string, varId string) bool {
+	_, err := nsSvc.GetNamespaceVariable(orgId, nsId, varId)
+	return err == nil
+}
@@ -0,0 +1,307 @@
+package postgresbackend
+
+import (
+	"database/sql"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+const organizationColumns = `id, name, vars, freeze_windows, suspension, deletion, revision`
+
+type OrganizationService struct {
+	db *DB
+}
+
+func NewOrganizationService(db *DB) *OrganizationService {
+	return &OrganizationService{
+		db: db,
+	}
+}
+
+func scanOrganization(row scanner) (*services.Organization, error) {
+	var org services.Organization
+	var vars, freezeWindows, suspension, deletion []byte
+	err := row.Scan(&org.Id, &org.Name, &vars, &freezeWindows, &suspension, &deletion, &org.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(vars, &org.OrgVars); err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(freezeWindows, &org.FreezeWindows); err != nil {
+		return nil, err
+	}
+	if suspension != nil {
+		org.Suspension = &services.OrganizationSuspension{}
+		if err := unmarshalJSON(suspension, org.Suspension); err != nil {
+			return nil, err
+		}
+	}
+	if deletion != nil {
+		org.Deletion = &services.OrganizationDeletion{}
+		if err := unmarshalJSON(deletion, org.Deletion); err != nil {
+			return nil, err
+		}
+	}
+	return &org, nil
+}
+
+func (orgSvc *OrganizationService) NewOrganization(orgName string) (*services.Organization, error) {
+	newOrg := &services.Organization{
+		Id:       uuid.NewString(),
+		Name:     orgName,
+		OrgVars:  make(map[string]string),
+		Revision: 1,
+	}
+
+	_, err := orgSvc.db.sql.Exec(`INSERT INTO organizations (id, name) VALUES ($1, $2)`, newOrg.Id, newOrg.Name)
+	if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "organizations_name_key" {
+		return nil, services.ErrOrganizationExists
+	} else if err != nil {
+		return nil, err
+	}
+	return newOrg, nil
+}
+
+func (orgSvc *OrganizationService) GetOrganizationById(orgId string) (*services.Organization, error) {
+	org, err := scanOrganization(orgSvc.db.sql.QueryRow(`SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, orgId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return org, err
+}
+
+func (orgSvc *OrganizationService) ExistsById(orgId string) bool {
+	var exists bool
+	err := orgSvc.db.sql.QueryRow(`SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)`, orgId).Scan(&exists)
+	return err == nil && exists
+}
+
+func (orgSvc *OrganizationService) ExistsByName(orgName string) bool {
+	var exists bool
+	err := orgSvc.db.sql.QueryRow(`SELECT EXISTS (SELECT 1 FROM organizations WHERE name = $1)`, orgName).Scan(&exists)
+	return err == nil && exists
+}
+
+// notUpdated explains why a compare-and-swap update of an organization matched no rows
+func (orgSvc *OrganizationService) notUpdated(orgId string) error {
+	if orgSvc.ExistsById(orgId) {
+		return services.ErrRevisionMismatch
+	}
+	return services.ErrOrganizationNotFound
+}
+
+func (orgSvc *OrganizationService) UpdateOrganization(orgId string, orgName string, orgVars map[string]string, revision int) (*services.Organization, error) {
+	vars, err := marshalJSON(orgVars)
+	if err != nil {
+		return nil, err
+	}
+
+	row := orgSvc.db.sql.QueryRow(`UPDATE organizations SET name = $2, vars = $3, revision = revision + 1
+		WHERE id = $1 AND ($4 = 0 OR revision = $4) RETURNING `+organizationColumns, orgId, orgName, vars, revision)
+	org, err := scanOrganization(row)
+	if err == sql.ErrNoRows {
+		return nil, orgSvc.notUpdated(orgId)
+	} else if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "organizations_name_key" {
+		return nil, services.ErrOrganizationExists
+	}
+	return org, err
+}
+
+func (orgSvc *OrganizationService) DeleteOrganization(orgId string, deletion services.OrganizationDeletion, revision int) (*services.Organization, error) {
+	raw, err := marshalJSON(deletion)
+	if err != nil {
+		return nil, err
+	}
+	return orgSvc.setDeletion(orgId, raw, revision)
+}
+
+func (orgSvc *OrganizationService) RestoreOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setDeletion(orgId, nil, revision)
+}
+
+// Set the deletion column of an organization. A nil deletion stores null.
+func (orgSvc *OrganizationService) setDeletion(orgId string, deletion interface{}, revision int) (*services.Organization, error) {
+	row := orgSvc.db.sql.QueryRow(`UPDATE organizations SET deletion = $2, revision = revision + 1
+		WHERE id = $1 AND ($3 = 0 OR revision = $3) RETURNING `+organizationColumns, orgId, deletion, revision)
+	org, err := scanOrganization(row)
+	if err == sql.ErrNoRows {
+		return nil, orgSvc.notUpdated(orgId)
+	}
+	return org, err
+}
+
+// PurgeOrganization relies on the foreign keys to organizations to remove what it owns. The
+// namespaces go first as they reference schemas without cascading, and the variable history
+// has no foreign key.
+func (orgSvc *OrganizationService) PurgeOrganization(orgId string) error {
+	return orgSvc.db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM variable_history WHERE organization_id = $1`, orgId); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM namespaces WHERE organization_id = $1`, orgId); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM organizations WHERE id = $1`, orgId)
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return services.ErrOrganizationNotFound
+		}
+		return nil
+	})
+}
+
+func (orgSvc *OrganizationService) ListOrganizations() ([]*services.Organization, error) {
+	rows, err := orgSvc.db.sql.Query(`SELECT ` + organizationColumns + ` FROM organizations ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*services.Organization, 0)
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, org)
+	}
+	return results, rows.Err()
+}
+
+func (orgSvc *OrganizationService) SuspendOrganization(orgId string, suspension services.OrganizationSuspension, revision int) (*services.Organization, error) {
+	raw, err := marshalJSON(suspension)
+	if err != nil {
+		return nil, err
+	}
+	return orgSvc.setSuspension(orgId, raw, revision)
+}
+
+func (orgSvc *OrganizationService) ReactivateOrganization(orgId string, revision int) (*services.Organization, error) {
+	return orgSvc.setSuspension(orgId, nil, revision)
+}
+
+// Set the suspension column of an organization. A nil suspension stores null.
+func (orgSvc *OrganizationService) setSuspension(orgId string, suspension interface{}, revision int) (*services.Organization, error) {
+	row := orgSvc.db.sql.QueryRow(`UPDATE organizations SET suspension = $2, revision = revision + 1
+		WHERE id = $1 AND ($3 = 0 OR revision = $3) RETURNING `+organizationColumns, orgId, suspension, revision)
+	org, err := scanOrganization(row)
+	if err == sql.ErrNoRows {
+		return nil, orgSvc.notUpdated(orgId)
+	}
+	return org, err
+}
+
+func (orgSvc *OrganizationService) SetFreezeWindows(orgId string, windows []services.FreezeWindow, revision int) (*services.Organization, error) {
+	if windows == nil {
+		windows = []services.FreezeWindow{}
+	}
+	raw, err := marshalJSON(windows)
+	if err != nil {
+		return nil, err
+	}
+
+	row := orgSvc.db.sql.QueryRow(`UPDATE organizations SET freeze_windows = $2, revision = revision + 1
+		WHERE id = $1 AND ($3 = 0 OR revision = $3) RETURNING `+organizationColumns, orgId, raw, revision)
+	org, err := scanOrganization(row)
+	if err == sql.ErrNoRows {
+		if err := orgSvc.notUpdated(orgId); err != services.ErrOrganizationNotFound {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return org, err
+}
+
+const templateColumns = `id, organization_id, name, schema_id, schema_version, variables`
+
+func scanTemplate(row scanner) (*services.NamespaceTemplate, error) {
+	var tpl services.NamespaceTemplate
+	var vars []byte
+	err := row.Scan(&tpl.Id, &tpl.OrganizationId, &tpl.Name, &tpl.SchemaId, &tpl.SchemaVersion, &vars)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(vars, &tpl.Variables); err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+func (orgSvc *OrganizationService) CreateNamespaceTemplate(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*services.NamespaceTemplate, error) {
+	tpl := &services.NamespaceTemplate{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		SchemaId:       schemaId,
+		SchemaVersion:  schemaVersion,
+		Variables:      vars,
+	}
+
+	raw, err := marshalJSON(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = orgSvc.db.sql.Exec(`INSERT INTO namespace_templates (`+templateColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		tpl.Id, orgId, name, schemaId, schemaVersion, raw)
+	if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "namespace_templates_organization_name_key" {
+		return nil, services.ErrTemplateAlreadyExists
+	} else if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return nil, services.ErrOrganizationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (orgSvc *OrganizationService) ListNamespaceTemplates(orgId string) ([]*services.NamespaceTemplate, error) {
+	rows, err := orgSvc.db.sql.Query(`SELECT `+templateColumns+` FROM namespace_templates WHERE organization_id = $1 ORDER BY name`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*services.NamespaceTemplate, 0)
+	for rows.Next() {
+		tpl, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, tpl)
+	}
+	return results, rows.Err()
+}
+
+func (orgSvc *OrganizationService) GetNamespaceTemplate(orgId string, templateId string) (*services.NamespaceTemplate, error) {
+	row := orgSvc.db.sql.QueryRow(`SELECT `+templateColumns+` FROM namespace_templates WHERE organization_id = $1 AND id = $2`, orgId, templateId)
+	tpl, err := scanTemplate(row)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrTemplateNotFound
+	}
+	return tpl, err
+}
+
+func (orgSvc *OrganizationService) DeleteNamespaceTemplate(orgId string, templateId string) error {
+	result, err := orgSvc.db.sql.Exec(`DELETE FROM namespace_templates WHERE organization_id = $1 AND id = $2`, orgId, templateId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return services.ErrTemplateNotFound
+	}
+	return nil
+}
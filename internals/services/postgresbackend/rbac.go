@@ -0,0 +1,94 @@
+package postgresbackend
+
+import (
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+)
+
+const roleBindingColumns = `id, organization_id, subject, role, resource_type, resource_id`
+
+type RoleBindingService struct {
+	db *DB
+}
+
+func NewRoleBindingService(db *DB) *RoleBindingService {
+	return &RoleBindingService{
+		db: db,
+	}
+}
+
+func scanRoleBinding(row scanner) (*services.RoleBinding, error) {
+	var b services.RoleBinding
+	err := row.Scan(&b.Id, &b.OrganizationId, &b.Subject, &b.Role, &b.ResourceType, &b.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (rbSvc *RoleBindingService) CreateRoleBinding(binding *services.RoleBinding) error {
+	_, err := rbSvc.db.sql.Exec(`INSERT INTO role_bindings (`+roleBindingColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		binding.Id, binding.OrganizationId, binding.Subject, binding.Role, binding.ResourceType, binding.ResourceId)
+	if _, ok := constraintError(err, pgUniqueViolation); ok {
+		return services.ErrRoleBindingExists
+	} else if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return services.ErrOrganizationNotFound
+	}
+	return err
+}
+
+func (rbSvc *RoleBindingService) ListRoleBindings(orgId string) ([]*services.RoleBinding, error) {
+	return rbSvc.query(`SELECT `+roleBindingColumns+` FROM role_bindings WHERE organization_id = $1 ORDER BY id`, orgId)
+}
+
+func (rbSvc *RoleBindingService) ListSubjectRoleBindings(orgId string, subject string) ([]*services.RoleBinding, error) {
+	return rbSvc.query(`SELECT `+roleBindingColumns+` FROM role_bindings WHERE organization_id = $1 AND subject = $2 ORDER BY id`, orgId, subject)
+}
+
+func (rbSvc *RoleBindingService) GetRoleBinding(orgId string, bindingId string) (*services.RoleBinding, error) {
+	bindings, err := rbSvc.query(`SELECT `+roleBindingColumns+` FROM role_bindings WHERE organization_id = $1 AND id = $2`, orgId, bindingId)
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return nil, services.ErrRoleBindingNotFound
+	}
+	return bindings[0], nil
+}
+
+func (rbSvc *RoleBindingService) query(query string, args ...interface{}) ([]*services.RoleBinding, error) {
+	rows, err := rbSvc.db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*services.RoleBinding{}
+	for rows.Next() {
+		b, err := scanRoleBinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+func (rbSvc *RoleBindingService) DeleteRoleBinding(orgId string, bindingId string) error {
+	result, err := rbSvc.db.sql.Exec(`DELETE FROM role_bindings WHERE organization_id = $1 AND id = $2`, orgId, bindingId)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return services.ErrRoleBindingNotFound
+	}
+	return nil
+}
+
+func (rbSvc *RoleBindingService) DeleteSubjectRoleBindings(orgId string, subject string) error {
+	_, err := rbSvc.db.sql.Exec(`DELETE FROM role_bindings WHERE organization_id = $1 AND subject = $2`, orgId, subject)
+	return err
+}
@@ -0,0 +1,258 @@
+package postgresbackend
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+)
+
+const (
+	schemaColumns        = `id, organization_id, name, revision`
+	schemaVersionColumns = `version, schema_id, published, resources, revision`
+)
+
+type SchemaService struct {
+	db *DB
+}
+
+func NewSchemaService(db *DB) *SchemaService {
+	return &SchemaService{
+		db: db,
+	}
+}
+
+func scanSchemaVersion(row scanner) (*services.SchemaVersion, error) {
+	var sv services.SchemaVersion
+	var resources []byte
+	err := row.Scan(&sv.Id, &sv.SchemaId, &sv.Published, &resources, &sv.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSON(resources, &sv.Resources); err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+func scanSchema(row scanner) (*services.Schema, error) {
+	var schema services.Schema
+	err := row.Scan(&schema.Id, &schema.OrganizationId, &schema.Name, &schema.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func (sSvc *SchemaService) CreateSchema(orgId string, name string) (*services.Schema, error) {
+	newSchema := &services.Schema{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Name:           name,
+		Revision:       1,
+	}
+
+	err := sSvc.db.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO schemas (id, organization_id, name) VALUES ($1, $2, $3)`, newSchema.Id, orgId, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_versions (schema_id, version) VALUES ($1, 1)`, newSchema.Id)
+		return err
+	})
+	if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "schemas_organization_name_key" {
+		return nil, services.ErrSchemaAlreadyExists
+	} else if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return nil, services.ErrOrganizationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return newSchema, nil
+}
+
+// List schemas in a given organization by the organization ID
+func (sSvc *SchemaService) ListSchemaInOrganization(orgId string) ([]*services.Schema, error) {
+	rows, err := sSvc.db.sql.Query(`SELECT `+schemaColumns+` FROM schemas WHERE organization_id = $1 ORDER BY name`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*services.Schema, 0)
+	for rows.Next() {
+		schema, err := scanSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, schema)
+	}
+	return results, rows.Err()
+}
+
+func (sSvc *SchemaService) GetSchemaById(orgId string, schemaId string) (*services.Schema, error) {
+	schema, err := getSchema(sSvc.db.sql, orgId, schemaId, false)
+	if err == services.ErrSchemaNotFound {
+		return nil, nil
+	}
+	return schema, err
+}
+
+// Get a schema, optionally locking its row until the end of the transaction
+func getSchema(q queryer, orgId string, schemaId string, forUpdate bool) (*services.Schema, error) {
+	query := `SELECT ` + schemaColumns + ` FROM schemas WHERE organization_id = $1 AND id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	schema, err := scanSchema(q.QueryRow(query, orgId, schemaId))
+	if err == sql.ErrNoRows {
+		return nil, services.ErrSchemaNotFound
+	}
+	return schema, err
+}
+
+// notUpdated explains why a compare-and-swap update of a schema matched no rows
+func (sSvc *SchemaService) notUpdated(orgId string, schemaId string) error {
+	_, err := getSchema(sSvc.db.sql, orgId, schemaId, false)
+	if err != nil {
+		return err
+	}
+	return services.ErrRevisionMismatch
+}
+
+// Update the name of a schema. The revision of the schema passed in is the one expected.
+func (sSvc *SchemaService) UpdateSchema(schema services.Schema) (*services.Schema, error) {
+	row := sSvc.db.sql.QueryRow(`UPDATE schemas SET name = $3, revision = revision + 1
+		WHERE organization_id = $1 AND id = $2 AND ($4 = 0 OR revision = $4) RETURNING `+schemaColumns,
+		schema.OrganizationId, schema.Id, schema.Name, schema.Revision)
+	updated, err := scanSchema(row)
+	if err == sql.ErrNoRows {
+		return nil, sSvc.notUpdated(schema.OrganizationId, schema.Id)
+	} else if constraint, ok := constraintError(err, pgUniqueViolation); ok && constraint == "schemas_organization_name_key" {
+		return nil, services.ErrSchemaAlreadyExists
+	}
+	return updated, err
+}
+
+func (sSvc *SchemaService) DeleteSchema(orgId string, schemaId string, revision int) error {
+	result, err := sSvc.db.sql.Exec(`DELETE FROM schemas WHERE organization_id = $1 AND id = $2 AND ($3 = 0 OR revision = $3)`, orgId, schemaId, revision)
+	if _, ok := constraintError(err, pgForeignKeyViolation); ok {
+		return services.ErrSchemaInUse
+	} else if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sSvc.notUpdated(orgId, schemaId)
+	}
+	return nil
+}
+
+func (sSvc *SchemaService) ListSchemaVersions(orgId string, schemaId string) ([]*services.SchemaVersion, error) {
+	if _, err := getSchema(sSvc.db.sql, orgId, schemaId, false); err != nil {
+		return nil, err
+	}
+
+	rows, err := sSvc.db.sql.Query(`SELECT `+schemaVersionColumns+` FROM schema_versions WHERE schema_id = $1 ORDER BY version`, schemaId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*services.SchemaVersion
+	for rows.Next() {
+		sv, err := scanSchemaVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, sv)
+	}
+	return results, rows.Err()
+}
+
+func (sSvc *SchemaService) CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*services.SchemaVersion, error) {
+	raw, err := marshalJSON(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var newSchemaVersion *services.SchemaVersion
+	err = sSvc.db.withTx(func(tx *sql.Tx) error {
+		// Locking the schema row serialises concurrent version creation
+		if _, err := getSchema(tx, orgId, schemaId, true); err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(`INSERT INTO schema_versions (schema_id, version, published, resources)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3 FROM schema_versions WHERE schema_id = $1
+			RETURNING `+schemaVersionColumns, schemaId, published, raw)
+		newSchemaVersion, err = scanSchemaVersion(row)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaVersion, nil
+}
+
+func (sSvc *SchemaService) GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	return getSchemaVersion(sSvc.db.sql, orgId, schemaId, schemaVersionId)
+}
+
+// Get a schema version by number or "latest"
+func getSchemaVersion(q queryer, orgId string, schemaId string, schemaVersionId string) (*services.SchemaVersion, error) {
+	if _, err := getSchema(q, orgId, schemaId, false); err != nil {
+		return nil, err
+	}
+
+	var row *sql.Row
+	if schemaVersionId == "latest" {
+		row = q.QueryRow(`SELECT `+schemaVersionColumns+` FROM schema_versions WHERE schema_id = $1 ORDER BY version DESC LIMIT 1`, schemaId)
+	} else {
+		versionIdInt, err := strconv.Atoi(schemaVersionId)
+		if err != nil {
+			return nil, services.ErrSchemaVersionNotFound
+		}
+		row = q.QueryRow(`SELECT `+schemaVersionColumns+` FROM schema_versions WHERE schema_id = $1 AND version = $2`, schemaId, versionIdInt)
+	}
+
+	sv, err := scanSchemaVersion(row)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrSchemaVersionNotFound
+	}
+	return sv, err
+}
+
+func (sSvc *SchemaService) UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool, revision int) (*services.SchemaVersion, error) {
+	raw, err := marshalJSON(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated *services.SchemaVersion
+	err = sSvc.db.withTx(func(tx *sql.Tx) error {
+		sv, err := getSchemaVersion(tx, orgId, schemaId, schemaVersionId)
+		if err != nil {
+			return err
+		}
+
+		// Schema versions are never deleted, so matching no rows means the revision has moved on
+		row := tx.QueryRow(`UPDATE schema_versions SET published = $3, resources = $4, revision = revision + 1
+			WHERE schema_id = $1 AND version = $2 AND ($5 = 0 OR revision = $5)
+			RETURNING `+schemaVersionColumns, schemaId, sv.Id, published, raw, revision)
+		updated, err = scanSchemaVersion(row)
+		if err == sql.ErrNoRows {
+			return services.ErrRevisionMismatch
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
@@ -1,24 +1,114 @@
 package services
 
+import (
+	"io"
+	"time"
+)
+
+// Providers groups the services of a single storage backend
+type Providers struct {
+	ApiKeys       ApiKeyProvider
+	Namespaces    NamespaceServiceProvider
+	Organizations OrganizationServiceProvider
+	Schemas       SchemaServiceProvider
+	Audit         AuditProvider
+	History       VariableHistoryProvider
+	RoleBindings  RoleBindingProvider
+
+	// Migrator applies the data migrations of the backend, if it keeps data between restarts
+	Migrator Migrator
+
+	// Closer releases the resources held by the backend, if it holds any
+	Closer io.Closer
+}
+
+// Close releases the resources held by the backend
+func (p *Providers) Close() error {
+	if p.Closer == nil {
+		return nil
+	}
+	return p.Closer.Close()
+}
+
+// RevisionMatches reports whether an update or delete expecting the given revision may be
+// applied to an entity at current. Organizations, namespaces, schemas and schema versions
+// start at revision 1 and every change increments it. A caller that read an entity passes
+// its revision back so a concurrent change fails with ErrRevisionMismatch rather than being
+// overwritten. An expected revision of 0 skips the check.
+func RevisionMatches(expected int, current int) bool {
+	return expected == 0 || expected == current
+}
+
 type ApiKeyProvider interface {
-	GenerateNewApiKey(orgId string) (*ApiKey, error)
+	// GenerateNewApiKey stores a new key for the organization, restricted by the scope
+	GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*ApiKey, error)
 	ListKeys(orgId string) ([]*ApiKey, error)
+	// GetKey returns the key whose secret is key, found by its prefix and verified against
+	// its hash, or nil
 	GetKey(key string) *ApiKey
+	// GetKeyById returns the key with the ID, or nil
+	GetKeyById(apiId string) *ApiKey
+	// RotateKey stores the successor and the rotated key created by RotateApiKey together.
+	// Fails with ErrApiKeyRotated if the key was rotated since it was read.
+	RotateKey(rotated *ApiKey, successor *ApiKey) error
+	// SetKeyLastUsed records when the key was last used
+	SetKeyLastUsed(apiId string, at time.Time) error
 	DeleteKey(apiId string) error
 }
 
+// AuditProvider stores the audit log. Events are only ever appended.
+type AuditProvider interface {
+	// RecordEvent stores an event created with NewAuditEvent
+	RecordEvent(event *AuditEvent) error
+	// ListEvents returns the events of the organization matching the filter, newest first
+	ListEvents(orgId string, filter AuditFilter) ([]*AuditEvent, error)
+}
+
+// RoleBindingProvider stores the roles granted to API keys and users
+type RoleBindingProvider interface {
+	// CreateRoleBinding stores a binding created with NewRoleBinding. Fails with
+	// ErrRoleBindingExists if the subject already has the role on the resource.
+	CreateRoleBinding(binding *RoleBinding) error
+	// ListRoleBindings returns the bindings of the organization ordered by ID
+	ListRoleBindings(orgId string) ([]*RoleBinding, error)
+	// ListSubjectRoleBindings returns the bindings of a subject in the organization ordered by ID
+	ListSubjectRoleBindings(orgId string, subject string) ([]*RoleBinding, error)
+	// GetRoleBinding fails with ErrRoleBindingNotFound if the organization has no such binding
+	GetRoleBinding(orgId string, bindingId string) (*RoleBinding, error)
+	DeleteRoleBinding(orgId string, bindingId string) error
+	// DeleteSubjectRoleBindings removes every binding of the subject in the organization
+	DeleteSubjectRoleBindings(orgId string, subject string) error
+}
+
+// VariableHistoryProvider stores snapshots of organization and namespace variables. An empty
+// nsId selects the variables of the organization itself.
+type VariableHistoryProvider interface {
+	// RecordSnapshot stores a snapshot. Snapshots taken at the same time are ordered as recorded.
+	RecordSnapshot(snapshot *VariableSnapshot) error
+	// ListSnapshots returns the snapshots of the organization or namespace, newest first
+	ListSnapshots(orgId string, nsId string) ([]*VariableSnapshot, error)
+	// SnapshotAt returns the newest snapshot taken at or before at, or nil if there is none
+	SnapshotAt(orgId string, nsId string, at time.Time) (*VariableSnapshot, error)
+}
+
 type NamespaceServiceProvider interface {
-	CreateNamespace(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*Namespace, error)
+	CreateNamespace(orgId string, name string, parentId string, schemaId string, schemaVersion string, vars map[string]string) (*Namespace, error)
 	GetNamespaceById(orgId string, nsId string) (*Namespace, error)
 	ListNamespaces(orgId string) ([]*Namespace, error)
+	ListChildNamespaces(orgId string, nsId string) ([]*Namespace, error)
+	GetNamespaceAncestors(orgId string, nsId string) ([]*Namespace, error)
 	ExistsByName(orgId, nsName string) bool
-	UpdateNamespace(orgId string, nsId string, nsName string, schemaVersion string) error
-	DeleteNamespace(orgId string, nsId string) error
+	UpdateNamespace(orgId string, nsId string, nsName string, parentId string, schemaVersion string, revision int) (*Namespace, error)
+	DeleteNamespace(orgId string, nsId string, revision int) error
+	LockNamespace(orgId string, nsId string, lock NamespaceLock) (*Namespace, error)
+	UnlockNamespace(orgId string, nsId string) (*Namespace, error)
 	ListNamespaceVars(orgId string, nsId string) ([]*NamespaceVar, error)
 	GetNamespaceVariable(orgId string, nsId string, varId string) (*NamespaceVar, error)
 	CreateNamespaceVariable(orgId string, nsId string, varId string, value string) (*NamespaceVar, error)
 	UpdateNamespaceVariable(orgId string, nsId string, varId string, value string) (*NamespaceVar, error)
 	DeleteNamespaceVariable(orgId string, nsId string, varId string) error
+	ReplaceNamespaceVariables(orgId string, nsId string, vars map[string]string, revision int) (*VariableChangeSummary, error)
+	PatchNamespaceVariables(orgId string, nsId string, upserts map[string]string, deletes []string, revision int) (*VariableChangeSummary, error)
 	GetVariablesAsMap(orgId string, nsId string) (map[string]string, error)
 	NamespaceVariableExists(orgId string, nsId string, varId string) bool
 }
@@ -28,18 +118,39 @@ type OrganizationServiceProvider interface {
 	GetOrganizationById(orgId string) (*Organization, error)
 	ExistsById(orgId string) bool
 	ExistsByName(orgName string) bool
-	UpdateOrganization(orgId string, orgName string, orgVars map[string]string) (*Organization, error)
-	DeleteOrganization(organizationId string) error
+	UpdateOrganization(orgId string, orgName string, orgVars map[string]string, revision int) (*Organization, error)
+	// DeleteOrganization marks the organization deleted, which hides it and everything it owns
+	// until it is restored or purged. RestoreOrganization clears the mark. Both fail with
+	// ErrOrganizationNotFound if it does not exist and ErrRevisionMismatch if it is not at the
+	// expected revision.
+	DeleteOrganization(orgId string, deletion OrganizationDeletion, revision int) (*Organization, error)
+	RestoreOrganization(orgId string, revision int) (*Organization, error)
+	// PurgeOrganization removes the organization and everything it owns, other than its audit
+	// log, which outlives it. The organization itself is removed last so a purge that fails
+	// part way can be run again. Fails with ErrOrganizationNotFound if it does not exist.
+	PurgeOrganization(orgId string) error
+	// ListOrganizations returns every organization ordered by name
+	ListOrganizations() ([]*Organization, error)
+	// SuspendOrganization and ReactivateOrganization set and clear the suspension of the
+	// organization. Both fail with ErrOrganizationNotFound if it does not exist and
+	// ErrRevisionMismatch if it is not at the expected revision.
+	SuspendOrganization(orgId string, suspension OrganizationSuspension, revision int) (*Organization, error)
+	ReactivateOrganization(orgId string, revision int) (*Organization, error)
+	SetFreezeWindows(orgId string, windows []FreezeWindow, revision int) (*Organization, error)
+	CreateNamespaceTemplate(orgId string, name string, schemaId string, schemaVersion string, vars map[string]string) (*NamespaceTemplate, error)
+	ListNamespaceTemplates(orgId string) ([]*NamespaceTemplate, error)
+	GetNamespaceTemplate(orgId string, templateId string) (*NamespaceTemplate, error)
+	DeleteNamespaceTemplate(orgId string, templateId string) error
 }
 
 type SchemaServiceProvider interface {
 	CreateSchema(orgId string, name string) (*Schema, error)
 	ListSchemaInOrganization(orgId string) ([]*Schema, error)
 	GetSchemaById(orgId string, schemaId string) (*Schema, error)
-	UpdateSchema(schema Schema) error
-	DeleteSchema(orgId string, schemaId string) error
+	UpdateSchema(schema Schema) (*Schema, error)
+	DeleteSchema(orgId string, schemaId string, revision int) error
 	ListSchemaVersions(orgId string, schemaId string) ([]*SchemaVersion, error)
 	CreateSchemaVersion(orgId string, schemaId string, resources map[string]string, published bool) (*SchemaVersion, error)
 	GetSchemaVersion(orgId string, schemaId string, schemaVersionId string) (*SchemaVersion, error)
-	UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool) (*SchemaVersion, error)
+	UpdateSchemaVersion(orgId string, schemaId string, schemaVersionId string, resources map[string]string, published bool, revision int) (*SchemaVersion, error)
 }
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"github.com/google/uuid"
+)
+
+// Permissions checked by the API before a route is served
+const (
+	PermissionOrganizationRead  = "organization:read"
+	PermissionOrganizationWrite = "organization:write"
+	PermissionSchemaRead        = "schema:read"
+	PermissionSchemaWrite       = "schema:write"
+	PermissionNamespaceRead     = "namespace:read"
+	PermissionNamespaceWrite    = "namespace:write"
+	PermissionNamespaceResolve  = "namespace:resolve"
+	PermissionTemplateRead      = "template:read"
+	PermissionTemplateWrite     = "template:write"
+	PermissionApiKeyRead        = "apikey:read"
+	PermissionApiKeyWrite       = "apikey:write"
+	PermissionAuditRead         = "audit:read"
+	PermissionRoleBindingRead   = "rolebinding:read"
+	PermissionRoleBindingWrite  = "rolebinding:write"
+
+	// PermissionLockOverride lets a change through a namespace lock or an organization freeze
+	// window when the caller asks to override it
+	PermissionLockOverride = "lock:override"
+)
+
+// Permissions over every organization, held only by super admins
+const (
+	PermissionTenantRead  = "tenant:read"
+	PermissionTenantWrite = "tenant:write"
+)
+
+// Roles that can be granted to API keys and users
+const (
+	RoleOrgAdmin       = "org_admin"
+	RoleSchemaAuthor   = "schema_author"
+	RoleNamespaceOwner = "namespace_owner"
+	RoleResolver       = "resolver"
+
+	// RoleSuperAdmin manages the organizations themselves. It cannot be bound within an
+	// organization; it is held by the server administrator and granted through token roles.
+	RoleSuperAdmin = "super_admin"
+)
+
+// Resources a role can be bound to. A role bound to a namespace also applies to the
+// namespaces beneath it.
+const (
+	RoleBindingResourceOrganization = "organization"
+	RoleBindingResourceNamespace    = "namespace"
+	RoleBindingResourceSchema       = "schema"
+)
+
+var readPermissions = []string{
+	PermissionOrganizationRead,
+	PermissionSchemaRead,
+	PermissionNamespaceRead,
+	PermissionNamespaceResolve,
+	PermissionTemplateRead,
+}
+
+// rolePermissions lists what each role may do, and roleResources what it may be bound to
+var (
+	rolePermissions = map[string][]string{
+		RoleOrgAdmin: {
+			PermissionOrganizationRead, PermissionOrganizationWrite,
+			PermissionSchemaRead, PermissionSchemaWrite,
+			PermissionNamespaceRead, PermissionNamespaceWrite, PermissionNamespaceResolve,
+			PermissionTemplateRead, PermissionTemplateWrite,
+			PermissionApiKeyRead, PermissionApiKeyWrite,
+			PermissionAuditRead,
+			PermissionRoleBindingRead, PermissionRoleBindingWrite,
+			PermissionLockOverride,
+		},
+		RoleSchemaAuthor:   append([]string{PermissionSchemaWrite}, readPermissions...),
+		RoleNamespaceOwner: append([]string{PermissionNamespaceWrite, PermissionTemplateWrite}, readPermissions...),
+		RoleResolver:       readPermissions,
+		RoleSuperAdmin:     {PermissionTenantRead, PermissionTenantWrite},
+	}
+
+	roleResources = map[string][]string{
+		RoleOrgAdmin:       {RoleBindingResourceOrganization},
+		RoleSchemaAuthor:   {RoleBindingResourceOrganization, RoleBindingResourceSchema},
+		RoleNamespaceOwner: {RoleBindingResourceOrganization, RoleBindingResourceNamespace},
+		RoleResolver:       {RoleBindingResourceOrganization, RoleBindingResourceNamespace, RoleBindingResourceSchema},
+	}
+)
+
+// RoleBinding grants a role to a subject across an organization, or on a single namespace
+// or schema. Subjects are API keys (apikey:<id>) and users (user:<id>), as they appear in
+// the audit log.
+type RoleBinding struct {
+	Id             string `json:"id"`
+	OrganizationId string `json:"organization_id"`
+	Subject        string `json:"subject"`
+	Role           string `json:"role"`
+	ResourceType   string `json:"resource_type"`
+	ResourceId     string `json:"resource_id,omitempty"`
+}
+
+// NewRoleBinding returns a binding ready to be stored. An empty resource type binds the role
+// across the organization. Fails with ErrInvalidRoleBinding if the role does not exist or
+// cannot be bound to the resource.
+func NewRoleBinding(orgId string, subject string, role string, resourceType string, resourceId string) (*RoleBinding, error) {
+	if resourceType == "" {
+		resourceType = RoleBindingResourceOrganization
+	}
+	if resourceType == RoleBindingResourceOrganization {
+		resourceId = ""
+	} else if resourceId == "" {
+		return nil, ErrInvalidRoleBinding
+	}
+	if subject == "" || !Contains(roleResources[role], resourceType) {
+		return nil, ErrInvalidRoleBinding
+	}
+
+	return &RoleBinding{
+		Id:             uuid.NewString(),
+		OrganizationId: orgId,
+		Subject:        subject,
+		Role:           role,
+		ResourceType:   resourceType,
+		ResourceId:     resourceId,
+	}, nil
+}
+
+// LegacyApiKeyRoleBinding makes an API key created before roles existed, which could do
+// anything in its organization, an organization admin. Its ID is derived from the key so
+// that a migration granting it can safely run again.
+func LegacyApiKeyRoleBinding(ak *ApiKey) *RoleBinding {
+	return &RoleBinding{
+		Id:             "apikey-" + ak.Id,
+		OrganizationId: ak.OrganizationId,
+		Subject:        ApiKeySubject(ak.Id),
+		Role:           RoleOrgAdmin,
+		ResourceType:   RoleBindingResourceOrganization,
+	}
+}
+
+// Grants reports whether the binding gives the permission on the resource. ids holds the
+// resource and, for a namespace, its parents, any of which the binding may be for.
+func (b *RoleBinding) Grants(permission string, resourceType string, ids []string) bool {
+	if !RolePermits(b.Role, permission) {
+		return false
+	}
+	if b.ResourceType == RoleBindingResourceOrganization {
+		return true
+	}
+	return b.ResourceType == resourceType && Contains(ids, b.ResourceId)
+}
+
+// RolePermits reports whether the role includes the permission
+func RolePermits(role string, permission string) bool {
+	return Contains(rolePermissions[role], permission)
+}
+
+// IsPermission reports whether permission is one of the permissions checked by the API
+func IsPermission(permission string) bool {
+	return Contains(rolePermissions[RoleOrgAdmin], permission)
+}
+
+// ApiKeySubject is the subject of role bindings granted to an API key
+func ApiKeySubject(apiKeyId string) string {
+	return "apikey:" + apiKeyId
+}
+
+// UserSubject is the subject of role bindings granted to a user
+func UserSubject(userId string) string {
+	return "user:" + userId
+}
+
+// SameRoleBinding reports whether a and b grant the same role to the same subject on the
+// same resource, which a store keeps only once
+func SameRoleBinding(a *RoleBinding, b *RoleBinding) bool {
+	return a.OrganizationId == b.OrganizationId && a.Subject == b.Subject && a.Role == b.Role &&
+		a.ResourceType == b.ResourceType && a.ResourceId == b.ResourceId
+}
+
+// Contains reports whether value is one of values
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package servicestest
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunApiKeyProviderSuite checks the behaviour of services.ApiKeyProvider
+func RunApiKeyProviderSuite(t *testing.T, factory Factory) {
+	t.Run("GenerateAndGet", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		scope := map[string]string{"operations": "namespace:resolve"}
+		expires := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		ak, err := p.ApiKeys.GenerateNewApiKey(org.Id, "ci", expires, scope)
+		require.NoError(t, err)
+		assert.NotEmpty(t, ak.Id)
+		assert.NotEmpty(t, ak.Key)
+		assert.Equal(t, org.Id, ak.OrganizationId)
+
+		found := p.ApiKeys.GetKey(ak.Key)
+		require.NotNil(t, found)
+		assert.Equal(t, ak.Id, found.Id)
+		assert.Equal(t, org.Id, found.OrganizationId)
+		assert.Equal(t, scope, found.Scope)
+		assert.Equal(t, "ci", found.Name)
+		assert.True(t, expires.Equal(found.Expires))
+		assert.Empty(t, found.Key, "the secret is not stored")
+		assert.Equal(t, services.ApiKeyPrefix(ak.Key), found.Prefix)
+
+		byId := p.ApiKeys.GetKeyById(ak.Id)
+		require.NotNil(t, byId)
+		assert.Equal(t, ak.Id, byId.Id)
+		assert.Empty(t, byId.Key)
+
+		assert.Nil(t, p.ApiKeys.GetKey(uniqueName("missing")))
+		assert.Nil(t, p.ApiKeys.GetKey(ak.Prefix+"WRONGSECRET"), "the prefix alone does not match")
+		assert.Nil(t, p.ApiKeys.GetKeyById(uniqueName("missing")))
+	})
+
+	t.Run("ListIsOrderedAndIsolated", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			ak, err := p.ApiKeys.GenerateNewApiKey(org.Id, "", time.Time{}, nil)
+			require.NoError(t, err)
+			ids = append(ids, ak.Id)
+		}
+		_, err := p.ApiKeys.GenerateNewApiKey(other.Id, "", time.Time{}, nil)
+		require.NoError(t, err)
+		sort.Strings(ids)
+
+		keys, err := p.ApiKeys.ListKeys(org.Id)
+		require.NoError(t, err)
+		var listed []string
+		for _, ak := range keys {
+			assert.Equal(t, org.Id, ak.OrganizationId)
+			listed = append(listed, ak.Id)
+		}
+		assert.Equal(t, ids, listed)
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		ak, err := p.ApiKeys.GenerateNewApiKey(org.Id, "ci", time.Time{}, map[string]string{"operations": "namespace:resolve"})
+		require.NoError(t, err)
+
+		rotated := p.ApiKeys.GetKeyById(ak.Id)
+		require.NotNil(t, rotated)
+		graceEnd := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		successor := services.RotateApiKey(rotated, time.Time{}, graceEnd)
+		require.NoError(t, p.ApiKeys.RotateKey(rotated, successor))
+
+		old := p.ApiKeys.GetKey(ak.Key)
+		require.NotNil(t, old, "the old key keeps working during the grace period")
+		assert.Equal(t, successor.Id, old.ReplacedBy)
+		assert.True(t, graceEnd.Equal(old.Expires))
+
+		found := p.ApiKeys.GetKey(successor.Key)
+		require.NotNil(t, found)
+		assert.Equal(t, ak.Id, found.RotatedFrom)
+		assert.Equal(t, "ci", found.Name)
+		assert.Equal(t, ak.Scope, found.Scope)
+
+		// A key read before it was rotated cannot be rotated again
+		stale := &services.ApiKey{Id: ak.Id, OrganizationId: org.Id}
+		assert.Equal(t, services.ErrApiKeyRotated, p.ApiKeys.RotateKey(stale, services.RotateApiKey(stale, time.Time{}, graceEnd)))
+		keys, err := p.ApiKeys.ListKeys(org.Id)
+		require.NoError(t, err)
+		assert.Len(t, keys, 2)
+
+		missing := &services.ApiKey{Id: uniqueName("missing"), OrganizationId: org.Id}
+		assert.Equal(t, services.ErrApiKeyNotFound, p.ApiKeys.RotateKey(missing, services.RotateApiKey(missing, time.Time{}, graceEnd)))
+	})
+
+	t.Run("LastUsed", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		ak, err := p.ApiKeys.GenerateNewApiKey(org.Id, "", time.Time{}, nil)
+		require.NoError(t, err)
+		assert.True(t, p.ApiKeys.GetKeyById(ak.Id).LastUsedAt.IsZero())
+
+		at := time.Now().UTC().Truncate(time.Millisecond)
+		require.NoError(t, p.ApiKeys.SetKeyLastUsed(ak.Id, at))
+		assert.True(t, at.Equal(p.ApiKeys.GetKeyById(ak.Id).LastUsedAt))
+		assert.Equal(t, services.ErrApiKeyNotFound, p.ApiKeys.SetKeyLastUsed(uniqueName("missing"), at))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		ak, err := p.ApiKeys.GenerateNewApiKey(org.Id, "", time.Time{}, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, p.ApiKeys.DeleteKey(ak.Id))
+		assert.Nil(t, p.ApiKeys.GetKey(ak.Key))
+		assert.Equal(t, services.ErrApiKeyNotFound, p.ApiKeys.DeleteKey(ak.Id))
+	})
+}
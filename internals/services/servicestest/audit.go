@@ -0,0 +1,116 @@
+package servicestest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunAuditProviderSuite checks the behaviour of services.AuditProvider
+func RunAuditProviderSuite(t *testing.T, factory Factory) {
+	start := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// record stores an event of the organization the given number of minutes after start
+	record := func(t *testing.T, p *services.Providers, orgId string, minutes int, event services.AuditEvent) *services.AuditEvent {
+		event.OrganizationId = orgId
+		stored := services.NewAuditEvent(event)
+		stored.Time = start.Add(time.Duration(minutes) * time.Minute)
+		require.NoError(t, p.Audit.RecordEvent(stored))
+		return stored
+	}
+
+	ids := func(events []*services.AuditEvent) []string {
+		result := []string{}
+		for _, event := range events {
+			result = append(result, event.Id)
+		}
+		return result
+	}
+
+	t.Run("RecordAndList", func(t *testing.T) {
+		p := factory(t)
+		orgId := uniqueName("audit")
+
+		created := record(t, p, orgId, 0, services.AuditEvent{
+			Actor:        "apikey:1",
+			RequestId:    "req-1",
+			Action:       services.AuditActionCreate,
+			ResourceType: services.AuditResourceNamespace,
+			ResourceId:   "ns-1",
+			After:        json.RawMessage(`{"name": "prod"}`),
+		})
+		updated := record(t, p, orgId, 1, services.AuditEvent{
+			Actor:        "apikey:1",
+			RequestId:    "req-2",
+			Action:       services.AuditActionUpdate,
+			ResourceType: services.AuditResourceNamespace,
+			ResourceId:   "ns-1",
+			Before:       json.RawMessage(`{"name": "prod"}`),
+			After:        json.RawMessage(`{"name": "production"}`),
+		})
+		record(t, p, uniqueName("audit"), 2, services.AuditEvent{Action: services.AuditActionDelete})
+
+		events, err := p.Audit.ListEvents(orgId, services.AuditFilter{})
+		require.NoError(t, err)
+		require.Equal(t, []string{updated.Id, created.Id}, ids(events), "newest first and only the organization's events")
+
+		found := events[0]
+		assert.Equal(t, orgId, found.OrganizationId)
+		assert.True(t, updated.Time.Equal(found.Time))
+		assert.Equal(t, "apikey:1", found.Actor)
+		assert.Equal(t, "req-2", found.RequestId)
+		assert.Equal(t, services.AuditActionUpdate, found.Action)
+		assert.Equal(t, services.AuditResourceNamespace, found.ResourceType)
+		assert.Equal(t, "ns-1", found.ResourceId)
+		assert.JSONEq(t, `{"name": "prod"}`, string(found.Before))
+		assert.JSONEq(t, `{"name": "production"}`, string(found.After))
+		assert.Empty(t, events[1].Before)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		p := factory(t)
+		orgId := uniqueName("audit")
+
+		first := record(t, p, orgId, 0, services.AuditEvent{
+			Actor: "apikey:1", RequestId: "req-1", Action: services.AuditActionCreate,
+			ResourceType: services.AuditResourceSchema, ResourceId: "schema-1",
+		})
+		second := record(t, p, orgId, 1, services.AuditEvent{
+			Actor: "apikey:2", RequestId: "req-2", Action: services.AuditActionUpdate,
+			ResourceType: services.AuditResourceSchema, ResourceId: "schema-1",
+		})
+		third := record(t, p, orgId, 2, services.AuditEvent{
+			Actor: "apikey:1", RequestId: "req-3", Action: services.AuditActionDelete,
+			ResourceType: services.AuditResourceApiKey, ResourceId: "key-1",
+		})
+
+		filters := map[string]struct {
+			filter   services.AuditFilter
+			expected []string
+		}{
+			"Actor":         {services.AuditFilter{Actor: "apikey:1"}, []string{third.Id, first.Id}},
+			"RequestId":     {services.AuditFilter{RequestId: "req-2"}, []string{second.Id}},
+			"Action":        {services.AuditFilter{Action: services.AuditActionDelete}, []string{third.Id}},
+			"ResourceType":  {services.AuditFilter{ResourceType: services.AuditResourceSchema}, []string{second.Id, first.Id}},
+			"ResourceId":    {services.AuditFilter{ResourceId: "key-1"}, []string{third.Id}},
+			"Since":         {services.AuditFilter{Since: start.Add(time.Minute)}, []string{third.Id, second.Id}},
+			"Until":         {services.AuditFilter{Until: start.Add(time.Minute)}, []string{first.Id}},
+			"Combined":      {services.AuditFilter{Actor: "apikey:1", ResourceType: services.AuditResourceSchema}, []string{first.Id}},
+			"Limit":         {services.AuditFilter{Limit: 2}, []string{third.Id, second.Id}},
+			"Offset":        {services.AuditFilter{Offset: 1, Limit: 1}, []string{second.Id}},
+			"OffsetPastEnd": {services.AuditFilter{Offset: 5}, []string{}},
+			"NoMatch":       {services.AuditFilter{Actor: "apikey:3"}, []string{}},
+		}
+		for name, tc := range filters {
+			t.Run(name, func(t *testing.T) {
+				events, err := p.Audit.ListEvents(orgId, tc.filter)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, ids(events))
+			})
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package servicestest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected failure")
+
+// createdOrganizations remembers the organizations it creates, so a test can look for what a
+// failed operation left behind
+type createdOrganizations struct {
+	services.OrganizationServiceProvider
+	ids []string
+}
+
+func (o *createdOrganizations) NewOrganization(name string) (*services.Organization, error) {
+	org, err := o.OrganizationServiceProvider.NewOrganization(name)
+	if err == nil {
+		o.ids = append(o.ids, org.Id)
+	}
+	return org, err
+}
+
+// failingApiKeys fails to generate keys
+type failingApiKeys struct {
+	services.ApiKeyProvider
+}
+
+func (failingApiKeys) GenerateNewApiKey(orgId string, name string, expires time.Time, scope map[string]string) (*services.ApiKey, error) {
+	return nil, errInjected
+}
+
+// failingRoleBindings fails to store bindings
+type failingRoleBindings struct {
+	services.RoleBindingProvider
+}
+
+func (failingRoleBindings) CreateRoleBinding(binding *services.RoleBinding) error {
+	return errInjected
+}
+
+// RunBootstrapSuite checks that BootstrapOrganization leaves nothing behind when a step fails,
+// and that deleting and restoring an organization leaves no bindings to keys that are gone
+func RunBootstrapSuite(t *testing.T, factory Factory) {
+	t.Run("Bootstrap", func(t *testing.T) {
+		p := factory(t)
+		name := uniqueName("bootstrap")
+
+		created, err := services.BootstrapOrganization(p, name, "admin")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			p.Organizations.PurgeOrganization(created.Organization.Id)
+		})
+
+		assert.True(t, p.Organizations.ExistsByName(name))
+		assert.NotNil(t, p.ApiKeys.GetKeyById(created.ApiKey.Id))
+		bindings, err := p.RoleBindings.ListRoleBindings(created.Organization.Id)
+		require.NoError(t, err)
+		assert.Equal(t, []*services.RoleBinding{created.RoleBinding}, bindings)
+		assert.Equal(t, services.ApiKeySubject(created.ApiKey.Id), created.RoleBinding.Subject)
+		assert.Equal(t, services.RoleOrgAdmin, created.RoleBinding.Role)
+	})
+
+	failures := []struct {
+		name   string
+		inject func(p *services.Providers)
+	}{
+		{"KeyFails", func(p *services.Providers) { p.ApiKeys = failingApiKeys{p.ApiKeys} }},
+		{"RoleBindingFails", func(p *services.Providers) { p.RoleBindings = failingRoleBindings{p.RoleBindings} }},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			p := factory(t)
+			orgs := &createdOrganizations{OrganizationServiceProvider: p.Organizations}
+			failing := *p
+			failing.Organizations = orgs
+			tt.inject(&failing)
+
+			name := uniqueName("bootstrap")
+			_, err := services.BootstrapOrganization(&failing, name, "admin")
+			assert.True(t, errors.Is(err, errInjected), "unexpected error %v", err)
+
+			// The organization, its key and binding are rolled back, so the name can be used again
+			require.Len(t, orgs.ids, 1)
+			orgId := orgs.ids[0]
+			found, err := p.Organizations.GetOrganizationById(orgId)
+			require.NoError(t, err)
+			assert.Nil(t, found)
+			assert.False(t, p.Organizations.ExistsByName(name))
+			keys, err := p.ApiKeys.ListKeys(orgId)
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+			bindings, err := p.RoleBindings.ListRoleBindings(orgId)
+			require.NoError(t, err)
+			assert.Empty(t, bindings)
+
+			created, err := services.BootstrapOrganization(p, name, "admin")
+			require.NoError(t, err)
+			p.Organizations.PurgeOrganization(created.Organization.Id)
+		})
+	}
+
+	t.Run("DeleteAndRestore", func(t *testing.T) {
+		p := factory(t)
+		created, err := services.BootstrapOrganization(p, uniqueName("bootstrap"), "admin")
+		require.NoError(t, err)
+		orgId := created.Organization.Id
+		t.Cleanup(func() {
+			p.Organizations.PurgeOrganization(orgId)
+		})
+
+		// A second key, and a binding left behind for a key that does not exist
+		ci, err := p.ApiKeys.GenerateNewApiKey(orgId, "ci", time.Time{}, nil)
+		require.NoError(t, err)
+		for _, subject := range []string{services.ApiKeySubject(ci.Id), services.ApiKeySubject(uuid.NewString())} {
+			binding, err := services.NewRoleBinding(orgId, subject, services.RoleResolver, "", "")
+			require.NoError(t, err)
+			require.NoError(t, p.RoleBindings.CreateRoleBinding(binding))
+		}
+		user, err := services.NewRoleBinding(orgId, services.UserSubject("alice"), services.RoleResolver, "", "")
+		require.NoError(t, err)
+		require.NoError(t, p.RoleBindings.CreateRoleBinding(user))
+
+		now := time.Now()
+		_, revoked, err := services.SoftDeleteOrganization(p, orgId, "admin", now, time.Hour, 0)
+		require.NoError(t, err)
+		assert.Len(t, revoked, 2)
+		bindings, err := p.RoleBindings.ListRoleBindings(orgId)
+		require.NoError(t, err)
+		assert.Equal(t, []*services.RoleBinding{user}, bindings, "only the bindings of users are kept")
+
+		restored, err := services.RestoreDeletedOrganization(p, orgId, "admin", now, 0)
+		require.NoError(t, err)
+		bindings, err = p.RoleBindings.ListRoleBindings(orgId)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []*services.RoleBinding{user, restored.RoleBinding}, bindings)
+		for _, binding := range bindings {
+			if binding.Subject == user.Subject {
+				continue
+			}
+			ak := p.ApiKeys.GetKeyById(strings.TrimPrefix(binding.Subject, services.ApiKeySubject("")))
+			require.NotNil(t, ak, "binding %s names a key that exists", binding.Id)
+			assert.Equal(t, orgId, ak.OrganizationId)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package servicestest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunVariableHistoryProviderSuite checks the behaviour of services.VariableHistoryProvider
+func RunVariableHistoryProviderSuite(t *testing.T, factory Factory) {
+	start := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// record stores a snapshot of the given variables the given number of minutes after start
+	record := func(t *testing.T, p *services.Providers, orgId string, nsId string, minutes int, vars map[string]string) {
+		snapshot := &services.VariableSnapshot{
+			OrganizationId: orgId,
+			NamespaceId:    nsId,
+			Time:           start.Add(time.Duration(minutes) * time.Minute),
+			Variables:      vars,
+		}
+		if nsId != "" {
+			snapshot.Name = "ns-" + nsId
+			snapshot.ParentId = "parent"
+			snapshot.SchemaId = "schema"
+			snapshot.SchemaVersion = "latest"
+			snapshot.ResolvedSchemaVersion = &services.SchemaVersion{
+				Id:        2,
+				Published: true,
+				SchemaId:  "schema",
+				Resources: map[string]string{"vm": "vm-{env}"},
+				Revision:  3,
+			}
+		}
+		require.NoError(t, p.History.RecordSnapshot(snapshot))
+	}
+
+	t.Run("SnapshotAt", func(t *testing.T) {
+		p := factory(t)
+		orgId := uniqueName("history")
+
+		record(t, p, orgId, "", 0, map[string]string{"company": "acme"})
+		record(t, p, orgId, "", 10, map[string]string{"company": "acme-corp"})
+		record(t, p, orgId, "ns-1", 5, map[string]string{"env": "prod"})
+
+		snapshot, err := p.History.SnapshotAt(orgId, "", start.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Nil(t, snapshot, "nothing was recorded before the first snapshot")
+
+		snapshot, err = p.History.SnapshotAt(orgId, "", start)
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		assert.Equal(t, map[string]string{"company": "acme"}, snapshot.Variables)
+
+		snapshot, err = p.History.SnapshotAt(orgId, "", start.Add(9*time.Minute))
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		assert.Equal(t, map[string]string{"company": "acme"}, snapshot.Variables)
+
+		snapshot, err = p.History.SnapshotAt(orgId, "", start.Add(time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		assert.Equal(t, map[string]string{"company": "acme-corp"}, snapshot.Variables)
+		assert.True(t, start.Add(10*time.Minute).Equal(snapshot.Time))
+		assert.Nil(t, snapshot.ResolvedSchemaVersion)
+
+		snapshot, err = p.History.SnapshotAt(orgId, "ns-1", start.Add(time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		assert.Equal(t, orgId, snapshot.OrganizationId)
+		assert.Equal(t, "ns-1", snapshot.NamespaceId)
+		assert.Equal(t, "ns-ns-1", snapshot.Name)
+		assert.Equal(t, "parent", snapshot.ParentId)
+		assert.Equal(t, "schema", snapshot.SchemaId)
+		assert.Equal(t, "latest", snapshot.SchemaVersion)
+		require.NotNil(t, snapshot.ResolvedSchemaVersion)
+		assert.Equal(t, 2, snapshot.ResolvedSchemaVersion.Id)
+		assert.Equal(t, 3, snapshot.ResolvedSchemaVersion.Revision)
+		assert.Equal(t, map[string]string{"vm": "vm-{env}"}, snapshot.ResolvedSchemaVersion.Resources)
+		assert.Equal(t, map[string]string{"env": "prod"}, snapshot.Variables)
+
+		snapshot, err = p.History.SnapshotAt(uniqueName("history"), "", start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Nil(t, snapshot)
+	})
+
+	t.Run("SameTimeKeepsRecordedOrder", func(t *testing.T) {
+		p := factory(t)
+		orgId := uniqueName("history")
+
+		record(t, p, orgId, "ns-1", 0, map[string]string{"env": "first"})
+		record(t, p, orgId, "ns-1", 0, map[string]string{"env": "second"})
+
+		snapshot, err := p.History.SnapshotAt(orgId, "ns-1", start)
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		assert.Equal(t, "second", snapshot.Variables["env"])
+	})
+
+	t.Run("ListNewestFirst", func(t *testing.T) {
+		p := factory(t)
+		orgId := uniqueName("history")
+
+		record(t, p, orgId, "ns-1", 0, map[string]string{"env": "dev"})
+		record(t, p, orgId, "ns-1", 1, map[string]string{"env": "test"})
+		record(t, p, orgId, "ns-1", 2, map[string]string{"env": "prod"})
+		record(t, p, orgId, "ns-2", 3, map[string]string{"env": "other"})
+		record(t, p, orgId, "", 4, map[string]string{"company": "acme"})
+
+		snapshots, err := p.History.ListSnapshots(orgId, "ns-1")
+		require.NoError(t, err)
+		var values []string
+		for _, snapshot := range snapshots {
+			values = append(values, snapshot.Variables["env"])
+		}
+		assert.Equal(t, []string{"prod", "test", "dev"}, values)
+
+		snapshots, err = p.History.ListSnapshots(orgId, "")
+		require.NoError(t, err)
+		require.Len(t, snapshots, 1)
+		assert.Equal(t, "acme", snapshots[0].Variables["company"])
+
+		snapshots, err = p.History.ListSnapshots(orgId, "ns-3")
+		require.NoError(t, err)
+		assert.Empty(t, snapshots)
+	})
+}
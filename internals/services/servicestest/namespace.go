@@ -0,0 +1,376 @@
+package servicestest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunNamespaceProviderSuite checks the behaviour of services.NamespaceServiceProvider
+func RunNamespaceProviderSuite(t *testing.T, factory Factory) {
+	// Each test gets a fresh organization with a schema to pin namespaces to
+	setup := func(t *testing.T) (*services.Providers, *services.Organization, *services.Schema) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		return p, org, newSchema(t, p, org.Id)
+	}
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		p, org, schema := setup(t)
+		other := newOrganization(t, p)
+		otherSchema := newSchema(t, p, other.Id)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", map[string]string{"env": "prod"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, ns.Id)
+
+		found, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, ns, found)
+		assert.True(t, p.Namespaces.ExistsByName(org.Id, "prod"))
+		assert.False(t, p.Namespaces.ExistsByName(other.Id, "prod"))
+
+		vars, err := p.Namespaces.GetVariablesAsMap(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "prod"}, vars)
+
+		_, err = p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		assert.Equal(t, services.ErrNamespaceAlreadyExists, err)
+		_, err = p.Namespaces.CreateNamespace(other.Id, "prod", "", otherSchema.Id, "latest", nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		p, org, schema := setup(t)
+		other := newOrganization(t, p)
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", map[string]string{"env": "prod"})
+		require.NoError(t, err)
+
+		for _, nsId := range []string{uuid.NewString(), ns.Id} {
+			_, err = p.Namespaces.GetNamespaceById(other.Id, nsId)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.GetNamespaceAncestors(other.Id, nsId)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.GetVariablesAsMap(other.Id, nsId)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			assert.Equal(t, services.ErrNamespaceNotFound, updateNamespace(p, other.Id, nsId, "prod", "", "1"))
+			assert.Equal(t, services.ErrNamespaceNotFound, p.Namespaces.DeleteNamespace(other.Id, nsId, 0))
+			_, err = p.Namespaces.LockNamespace(other.Id, nsId, services.NamespaceLock{Reason: "test"})
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.UnlockNamespace(other.Id, nsId)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.CreateNamespaceVariable(other.Id, nsId, "region", "uks")
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.ReplaceNamespaceVariables(other.Id, nsId, nil, 0)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+			_, err = p.Namespaces.PatchNamespaceVariables(other.Id, nsId, nil, nil, 0)
+			assert.Equal(t, services.ErrNamespaceNotFound, err)
+
+			vars, err := p.Namespaces.ListNamespaceVars(other.Id, nsId)
+			assert.NoError(t, err)
+			assert.Empty(t, vars)
+			_, err = p.Namespaces.GetNamespaceVariable(other.Id, nsId, "env")
+			assert.Equal(t, services.ErrNamespaceVarNotFound, err)
+			assert.False(t, p.Namespaces.NamespaceVariableExists(other.Id, nsId, "env"))
+		}
+
+		_, err = p.Namespaces.CreateNamespace(other.Id, "child", ns.Id, schema.Id, "1", nil)
+		assert.Equal(t, services.ErrNamespaceNotFound, err)
+	})
+
+	t.Run("ListIsOrderedAndIsolated", func(t *testing.T) {
+		p, org, schema := setup(t)
+		other := newOrganization(t, p)
+
+		for _, name := range []string{"b", "c", "a"} {
+			_, err := p.Namespaces.CreateNamespace(org.Id, name, "", schema.Id, "1", nil)
+			require.NoError(t, err)
+		}
+
+		nsList, err := p.Namespaces.ListNamespaces(org.Id)
+		require.NoError(t, err)
+		var names []string
+		for _, ns := range nsList {
+			names = append(names, ns.Name)
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, names)
+
+		nsList, err = p.Namespaces.ListNamespaces(other.Id)
+		require.NoError(t, err)
+		assert.Empty(t, nsList)
+	})
+
+	t.Run("Hierarchy", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		root, err := p.Namespaces.CreateNamespace(org.Id, "root", "", schema.Id, "1", map[string]string{"env": "dev", "team": "core"})
+		require.NoError(t, err)
+		b, err := p.Namespaces.CreateNamespace(org.Id, "b", root.Id, schema.Id, "1", nil)
+		require.NoError(t, err)
+		a, err := p.Namespaces.CreateNamespace(org.Id, "a", root.Id, schema.Id, "1", map[string]string{"env": "prod"})
+		require.NoError(t, err)
+		leaf, err := p.Namespaces.CreateNamespace(org.Id, "leaf", a.Id, schema.Id, "1", map[string]string{"region": "uks"})
+		require.NoError(t, err)
+
+		children, err := p.Namespaces.ListChildNamespaces(org.Id, root.Id)
+		require.NoError(t, err)
+		require.Len(t, children, 2)
+		assert.Equal(t, a.Id, children[0].Id)
+		assert.Equal(t, b.Id, children[1].Id)
+
+		children, err = p.Namespaces.ListChildNamespaces(org.Id, leaf.Id)
+		require.NoError(t, err)
+		assert.Empty(t, children)
+
+		chain, err := p.Namespaces.GetNamespaceAncestors(org.Id, leaf.Id)
+		require.NoError(t, err)
+		var ids []string
+		for _, ns := range chain {
+			ids = append(ids, ns.Id)
+		}
+		assert.Equal(t, []string{root.Id, a.Id, leaf.Id}, ids)
+
+		vars, err := p.Namespaces.GetVariablesAsMap(org.Id, leaf.Id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "prod", "team": "core", "region": "uks"}, vars)
+
+		own, err := p.Namespaces.ListNamespaceVars(org.Id, leaf.Id)
+		require.NoError(t, err)
+		require.Len(t, own, 1)
+		assert.Equal(t, "region", own[0].Key)
+
+		assert.Equal(t, services.ErrNamespaceCycle, updateNamespace(p, org.Id, root.Id, "root", leaf.Id, "1"))
+		assert.Equal(t, services.ErrNamespaceCycle, updateNamespace(p, org.Id, root.Id, "root", root.Id, "1"))
+		assert.Equal(t, services.ErrNamespaceNotFound, updateNamespace(p, org.Id, leaf.Id, "leaf", uuid.NewString(), "1"))
+		_, err = p.Namespaces.CreateNamespace(org.Id, "orphan", uuid.NewString(), schema.Id, "1", nil)
+		assert.Equal(t, services.ErrNamespaceNotFound, err)
+
+		assert.Equal(t, services.ErrNamespaceHasChildren, p.Namespaces.DeleteNamespace(org.Id, root.Id, 0))
+
+		require.NoError(t, updateNamespace(p, org.Id, leaf.Id, "leaf", b.Id, "1"))
+		vars, err = p.Namespaces.GetVariablesAsMap(org.Id, leaf.Id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "dev", "team": "core", "region": "uks"}, vars)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+		_, err = p.Namespaces.CreateNamespace(org.Id, "dev", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+
+		require.NoError(t, updateNamespace(p, org.Id, ns.Id, "production", "", "latest"))
+		found, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "production", found.Name)
+		assert.Equal(t, "latest", found.SchemaVersion)
+		assert.Equal(t, schema.Id, found.SchemaId)
+		assert.False(t, p.Namespaces.ExistsByName(org.Id, "prod"))
+
+		assert.Equal(t, services.ErrNamespaceAlreadyExists, updateNamespace(p, org.Id, ns.Id, "dev", "", "latest"))
+	})
+
+	t.Run("Pins", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		_, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "2", nil)
+		assert.Equal(t, services.ErrSchemaVersionNotFound, err)
+		_, err = p.Namespaces.CreateNamespace(org.Id, "prod", "", uuid.NewString(), "latest", nil)
+		assert.Equal(t, services.ErrSchemaNotFound, err)
+		_, err = p.Namespaces.CreateNamespace(uuid.NewString(), "prod", "", "", "", nil)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+		assert.False(t, p.Namespaces.ExistsByName(org.Id, "prod"))
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, services.ErrSchemaVersionNotFound, updateNamespace(p, org.Id, ns.Id, "prod", "", "3"))
+		found, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "1", found.SchemaVersion)
+	})
+
+	t.Run("Revisions", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ns.Revision)
+
+		updated, err := p.Namespaces.UpdateNamespace(org.Id, ns.Id, "production", "", "1", ns.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.Revision)
+		assert.Equal(t, "production", updated.Name)
+		found, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, 2, found.Revision)
+
+		_, err = p.Namespaces.UpdateNamespace(org.Id, ns.Id, "staging", "", "1", ns.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		found, err = p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "production", found.Name)
+
+		locked, err := p.Namespaces.LockNamespace(org.Id, ns.Id, services.NamespaceLock{Reason: "release"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, locked.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, p.Namespaces.DeleteNamespace(org.Id, ns.Id, updated.Revision))
+
+		require.NoError(t, p.Namespaces.DeleteNamespace(org.Id, ns.Id, locked.Revision))
+		assert.Equal(t, services.ErrNamespaceNotFound, p.Namespaces.DeleteNamespace(org.Id, ns.Id, locked.Revision))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", map[string]string{"env": "prod"})
+		require.NoError(t, err)
+
+		require.NoError(t, p.Namespaces.DeleteNamespace(org.Id, ns.Id, 0))
+		_, err = p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		assert.Equal(t, services.ErrNamespaceNotFound, err)
+		assert.False(t, p.Namespaces.ExistsByName(org.Id, "prod"))
+		vars, err := p.Namespaces.ListNamespaceVars(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Empty(t, vars)
+		assert.Equal(t, services.ErrNamespaceNotFound, p.Namespaces.DeleteNamespace(org.Id, ns.Id, 0))
+	})
+
+	t.Run("Locks", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+
+		lockedAt := time.Now().UTC().Truncate(time.Second)
+		locked, err := p.Namespaces.LockNamespace(org.Id, ns.Id, services.NamespaceLock{
+			LockedBy: "apikey:test",
+			Reason:   "release",
+			LockedAt: lockedAt,
+			Expires:  lockedAt.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.NotNil(t, locked.Lock)
+		assert.Equal(t, "release", locked.Lock.Reason)
+
+		found, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		require.NotNil(t, found.Lock)
+		assert.Equal(t, "apikey:test", found.Lock.LockedBy)
+		assert.True(t, lockedAt.Equal(found.Lock.LockedAt))
+		assert.True(t, lockedAt.Add(time.Hour).Equal(found.Lock.Expires))
+
+		unlocked, err := p.Namespaces.UnlockNamespace(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Nil(t, unlocked.Lock)
+		found, err = p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Nil(t, found.Lock)
+	})
+
+	t.Run("Variables", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+		sibling, err := p.Namespaces.CreateNamespace(org.Id, "dev", "", schema.Id, "1", map[string]string{"env": "dev"})
+		require.NoError(t, err)
+
+		for _, key := range []string{"region", "env", "team"} {
+			created, err := p.Namespaces.CreateNamespaceVariable(org.Id, ns.Id, key, key+"-value")
+			require.NoError(t, err)
+			assert.Equal(t, key, created.Key)
+			assert.Equal(t, ns.Id, created.NamespaceId)
+		}
+		_, err = p.Namespaces.CreateNamespaceVariable(org.Id, ns.Id, "env", "again")
+		assert.Equal(t, services.ErrNamespaceVarExists, err)
+
+		vars, err := p.Namespaces.ListNamespaceVars(org.Id, ns.Id)
+		require.NoError(t, err)
+		var keys []string
+		for _, nsVar := range vars {
+			assert.Equal(t, org.Id, nsVar.OrgId)
+			assert.Equal(t, ns.Id, nsVar.NamespaceId)
+			keys = append(keys, nsVar.Key)
+		}
+		assert.Equal(t, []string{"env", "region", "team"}, keys)
+
+		found, err := p.Namespaces.GetNamespaceVariable(org.Id, ns.Id, "env")
+		require.NoError(t, err)
+		assert.Equal(t, "env-value", found.Value)
+		assert.True(t, p.Namespaces.NamespaceVariableExists(org.Id, ns.Id, "env"))
+
+		updated, err := p.Namespaces.UpdateNamespaceVariable(org.Id, ns.Id, "env", "prod")
+		require.NoError(t, err)
+		assert.Equal(t, "prod", updated.Value)
+		found, err = p.Namespaces.GetNamespaceVariable(org.Id, ns.Id, "env")
+		require.NoError(t, err)
+		assert.Equal(t, "prod", found.Value)
+
+		found, err = p.Namespaces.GetNamespaceVariable(org.Id, sibling.Id, "env")
+		require.NoError(t, err)
+		assert.Equal(t, "dev", found.Value)
+
+		require.NoError(t, p.Namespaces.DeleteNamespaceVariable(org.Id, ns.Id, "env"))
+		assert.False(t, p.Namespaces.NamespaceVariableExists(org.Id, ns.Id, "env"))
+		assert.True(t, p.Namespaces.NamespaceVariableExists(org.Id, sibling.Id, "env"))
+
+		_, err = p.Namespaces.GetNamespaceVariable(org.Id, ns.Id, "env")
+		assert.Equal(t, services.ErrNamespaceVarNotFound, err)
+		_, err = p.Namespaces.UpdateNamespaceVariable(org.Id, ns.Id, "env", "prod")
+		assert.Equal(t, services.ErrNamespaceVarNotFound, err)
+		assert.Equal(t, services.ErrNamespaceVarNotFound, p.Namespaces.DeleteNamespaceVariable(org.Id, ns.Id, "env"))
+	})
+
+	t.Run("BulkVariables", func(t *testing.T) {
+		p, org, schema := setup(t)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", map[string]string{"env": "prod", "team": "core", "old": "x"})
+		require.NoError(t, err)
+
+		summary, err := p.Namespaces.ReplaceNamespaceVariables(org.Id, ns.Id, map[string]string{"env": "prod", "team": "platform", "region": "uks"}, ns.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, &services.VariableChangeSummary{
+			Created:   []string{"region"},
+			Updated:   []string{"team"},
+			Deleted:   []string{"old"},
+			Unchanged: []string{"env"},
+			Revision:  ns.Revision + 1,
+		}, summary)
+
+		summary, err = p.Namespaces.PatchNamespaceVariables(org.Id, ns.Id, map[string]string{"env": "live", "tier": "1"}, []string{"region"}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, &services.VariableChangeSummary{
+			Created:   []string{"tier"},
+			Updated:   []string{"env"},
+			Deleted:   []string{"region"},
+			Unchanged: []string{"team"},
+			Revision:  ns.Revision + 2,
+		}, summary)
+
+		// A change against a revision that has since moved on is refused
+		_, err = p.Namespaces.ReplaceNamespaceVariables(org.Id, ns.Id, map[string]string{}, ns.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		_, err = p.Namespaces.PatchNamespaceVariables(org.Id, ns.Id, nil, []string{"env"}, ns.Revision+1)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+
+		vars, err := p.Namespaces.GetVariablesAsMap(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "live", "team": "platform", "tier": "1"}, vars)
+
+		_, err = p.Namespaces.PatchNamespaceVariables(org.Id, ns.Id, map[string]string{"env": "dev"}, []string{"env"}, 0)
+		assert.Equal(t, services.ErrInvalidVariablePatch, err)
+		vars, err = p.Namespaces.GetVariablesAsMap(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "live", vars["env"])
+
+		got, err := p.Namespaces.GetNamespaceById(org.Id, ns.Id)
+		require.NoError(t, err)
+		assert.Equal(t, ns.Revision+2, got.Revision)
+	})
+}
@@ -0,0 +1,332 @@
+package servicestest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunOrganizationProviderSuite checks the behaviour of services.OrganizationServiceProvider
+func RunOrganizationProviderSuite(t *testing.T, factory Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		require.NotNil(t, found)
+		assert.Equal(t, org.Name, found.Name)
+		assert.Empty(t, found.OrgVars)
+		assert.True(t, p.Organizations.ExistsById(org.Id))
+		assert.True(t, p.Organizations.ExistsByName(org.Name))
+
+		_, err = p.Organizations.NewOrganization(org.Name)
+		assert.Equal(t, services.ErrOrganizationExists, err)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		p := factory(t)
+		missing := uuid.NewString()
+
+		found, err := p.Organizations.GetOrganizationById(missing)
+		assert.NoError(t, err)
+		assert.Nil(t, found)
+		assert.False(t, p.Organizations.ExistsById(missing))
+		assert.False(t, p.Organizations.ExistsByName(uniqueName("missing")))
+
+		_, err = p.Organizations.UpdateOrganization(missing, "name", nil, 0)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+		_, err = p.Organizations.DeleteOrganization(missing, services.OrganizationDeletion{}, 0)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+		_, err = p.Organizations.RestoreOrganization(missing, 0)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+		assert.Equal(t, services.ErrOrganizationNotFound, p.Organizations.PurgeOrganization(missing))
+
+		org, err := p.Organizations.SetFreezeWindows(missing, nil, 0)
+		assert.NoError(t, err)
+		assert.Nil(t, org)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		newName := uniqueName("renamed")
+		updated, err := p.Organizations.UpdateOrganization(org.Id, newName, map[string]string{"company": "acme"}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, newName, updated.Name)
+
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		assert.Equal(t, newName, found.Name)
+		assert.Equal(t, map[string]string{"company": "acme"}, found.OrgVars)
+
+		_, err = p.Organizations.UpdateOrganization(org.Id, other.Name, nil, 0)
+		assert.Equal(t, services.ErrOrganizationExists, err)
+	})
+
+	t.Run("Revisions", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		assert.Equal(t, 1, org.Revision)
+
+		updated, err := p.Organizations.UpdateOrganization(org.Id, org.Name, map[string]string{"company": "acme"}, org.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.Revision)
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		assert.Equal(t, 2, found.Revision)
+
+		_, err = p.Organizations.UpdateOrganization(org.Id, org.Name, nil, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		_, err = p.Organizations.SetFreezeWindows(org.Id, nil, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		_, err = p.Organizations.SuspendOrganization(org.Id, services.OrganizationSuspension{}, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		_, err = p.Organizations.DeleteOrganization(org.Id, services.OrganizationDeletion{}, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		found, err = p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"company": "acme"}, found.OrgVars)
+
+		updated, err = p.Organizations.SetFreezeWindows(org.Id, nil, updated.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, 3, updated.Revision)
+
+		_, err = p.Organizations.UpdateOrganization(uuid.NewString(), org.Name, nil, updated.Revision)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+	})
+
+	t.Run("DeleteAndRestore", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		deletedAt := time.Now().UTC().Truncate(time.Second)
+		deleted, err := p.Organizations.DeleteOrganization(org.Id, services.OrganizationDeletion{
+			DeletedBy:  "admin",
+			DeletedAt:  deletedAt,
+			PurgeAfter: deletedAt.Add(time.Hour),
+		}, org.Revision)
+		require.NoError(t, err)
+		require.NotNil(t, deleted.Deletion)
+		assert.Equal(t, 2, deleted.Revision)
+
+		// A deleted organization is kept, and keeps its name, until it is purged
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		require.NotNil(t, found.Deletion)
+		assert.Equal(t, "admin", found.Deletion.DeletedBy)
+		assert.True(t, deletedAt.Equal(found.Deletion.DeletedAt))
+		assert.True(t, deletedAt.Add(time.Hour).Equal(found.Deletion.PurgeAfter))
+		assert.True(t, p.Organizations.ExistsByName(org.Name))
+
+		_, err = p.Organizations.RestoreOrganization(org.Id, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		restored, err := p.Organizations.RestoreOrganization(org.Id, deleted.Revision)
+		require.NoError(t, err)
+		assert.Nil(t, restored.Deletion)
+		found, err = p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		assert.Nil(t, found.Deletion)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		// Give both organizations one of everything
+		keys := map[string]*services.ApiKey{}
+		namespaces := map[string]*services.Namespace{}
+		schemas := map[string]*services.Schema{}
+		for _, o := range []*services.Organization{org, other} {
+			schema, err := p.Schemas.CreateSchema(o.Id, uniqueName("schema"))
+			require.NoError(t, err)
+			_, err = p.Schemas.CreateSchemaVersion(o.Id, schema.Id, map[string]string{"vm": "vm-{env}"}, true)
+			require.NoError(t, err)
+			ns, err := p.Namespaces.CreateNamespace(o.Id, "prod", "", schema.Id, "2", map[string]string{"env": "prod"})
+			require.NoError(t, err)
+			_, err = p.Namespaces.CreateNamespace(o.Id, "payments", ns.Id, schema.Id, "latest", map[string]string{"team": "payments"})
+			require.NoError(t, err)
+			_, err = p.Organizations.CreateNamespaceTemplate(o.Id, "service", schema.Id, "latest", nil)
+			require.NoError(t, err)
+			ak, err := p.ApiKeys.GenerateNewApiKey(o.Id, "admin", time.Time{}, nil)
+			require.NoError(t, err)
+			binding, err := services.NewRoleBinding(o.Id, services.ApiKeySubject(ak.Id), services.RoleOrgAdmin, "", "")
+			require.NoError(t, err)
+			require.NoError(t, p.RoleBindings.CreateRoleBinding(binding))
+			require.NoError(t, p.History.RecordSnapshot(services.NewOrganizationSnapshot(o)))
+			require.NoError(t, p.Audit.RecordEvent(services.NewAuditEvent(services.AuditEvent{
+				OrganizationId: o.Id,
+				Action:         services.AuditActionCreate,
+				ResourceType:   services.AuditResourceOrganization,
+				ResourceId:     o.Id,
+			})))
+			keys[o.Id], namespaces[o.Id], schemas[o.Id] = ak, ns, schema
+		}
+
+		require.NoError(t, p.Organizations.PurgeOrganization(org.Id))
+		assert.Equal(t, services.ErrOrganizationNotFound, p.Organizations.PurgeOrganization(org.Id))
+
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		assert.NoError(t, err)
+		assert.Nil(t, found)
+		assert.False(t, p.Organizations.ExistsByName(org.Name))
+
+		for _, o := range []*services.Organization{org, other} {
+			purged := o.Id == org.Id
+			nsList, err := p.Namespaces.ListNamespaces(o.Id)
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(nsList) == 0, "namespaces of %s", o.Name)
+			vars, err := p.Namespaces.ListNamespaceVars(o.Id, namespaces[o.Id].Id)
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(vars) == 0, "variables of %s", o.Name)
+			schemaList, err := p.Schemas.ListSchemaInOrganization(o.Id)
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(schemaList) == 0, "schemas of %s", o.Name)
+			versions, err := p.Schemas.ListSchemaVersions(o.Id, schemas[o.Id].Id)
+			assert.Equal(t, purged, err != nil || len(versions) == 0, "schema versions of %s", o.Name)
+			templates, err := p.Organizations.ListNamespaceTemplates(o.Id)
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(templates) == 0, "templates of %s", o.Name)
+			assert.Equal(t, purged, p.ApiKeys.GetKeyById(keys[o.Id].Id) == nil, "keys of %s", o.Name)
+			bindings, err := p.RoleBindings.ListRoleBindings(o.Id)
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(bindings) == 0, "role bindings of %s", o.Name)
+			snapshots, err := p.History.ListSnapshots(o.Id, "")
+			require.NoError(t, err)
+			assert.Equal(t, purged, len(snapshots) == 0, "variable history of %s", o.Name)
+
+			// The audit log outlives the organization
+			events, err := p.Audit.ListEvents(o.Id, services.AuditFilter{})
+			require.NoError(t, err)
+			assert.Len(t, events, 1, "audit log of %s", o.Name)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		p := factory(t)
+		b := newOrganization(t, p)
+		a := newOrganization(t, p)
+
+		orgs, err := p.Organizations.ListOrganizations()
+		require.NoError(t, err)
+		// Other tests may share the store, so only the order of these two is checked
+		var names []string
+		for _, org := range orgs {
+			if org.Id == a.Id || org.Id == b.Id {
+				names = append(names, org.Name)
+			}
+		}
+		expected := []string{a.Name, b.Name}
+		if b.Name < a.Name {
+			expected = []string{b.Name, a.Name}
+		}
+		assert.Equal(t, expected, names)
+	})
+
+	t.Run("Suspend", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		since := time.Now().UTC().Truncate(time.Second)
+		updated, err := p.Organizations.SuspendOrganization(org.Id, services.OrganizationSuspension{
+			SuspendedBy: "admin",
+			Reason:      "unpaid",
+			SuspendedAt: since,
+		}, org.Revision)
+		require.NoError(t, err)
+		require.NotNil(t, updated.Suspension)
+		assert.Equal(t, 2, updated.Revision)
+
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		require.NotNil(t, found.Suspension)
+		assert.Equal(t, "admin", found.Suspension.SuspendedBy)
+		assert.Equal(t, "unpaid", found.Suspension.Reason)
+		assert.True(t, since.Equal(found.Suspension.SuspendedAt))
+
+		_, err = p.Organizations.ReactivateOrganization(org.Id, org.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		updated, err = p.Organizations.ReactivateOrganization(org.Id, updated.Revision)
+		require.NoError(t, err)
+		assert.Nil(t, updated.Suspension)
+		found, err = p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		assert.Nil(t, found.Suspension)
+
+		missing := uuid.NewString()
+		_, err = p.Organizations.SuspendOrganization(missing, services.OrganizationSuspension{}, 0)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+		_, err = p.Organizations.ReactivateOrganization(missing, 0)
+		assert.Equal(t, services.ErrOrganizationNotFound, err)
+	})
+
+	t.Run("FreezeWindows", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		start := time.Now().UTC().Truncate(time.Second)
+		windows := []services.FreezeWindow{{
+			Name:   "release",
+			Reason: "quarter end",
+			Start:  start,
+			End:    start.Add(time.Hour),
+		}}
+		updated, err := p.Organizations.SetFreezeWindows(org.Id, windows, 0)
+		require.NoError(t, err)
+		require.Len(t, updated.FreezeWindows, 1)
+
+		found, err := p.Organizations.GetOrganizationById(org.Id)
+		require.NoError(t, err)
+		require.Len(t, found.FreezeWindows, 1)
+		assert.Equal(t, "release", found.FreezeWindows[0].Name)
+		assert.True(t, start.Equal(found.FreezeWindows[0].Start))
+		assert.True(t, start.Add(time.Hour).Equal(found.FreezeWindows[0].End))
+
+		updated, err = p.Organizations.SetFreezeWindows(org.Id, nil, 0)
+		require.NoError(t, err)
+		assert.Empty(t, updated.FreezeWindows)
+	})
+
+	t.Run("Templates", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		b, err := p.Organizations.CreateNamespaceTemplate(org.Id, "b", "schema", "1", map[string]string{"env": "prod"})
+		require.NoError(t, err)
+		a, err := p.Organizations.CreateNamespaceTemplate(org.Id, "a", "schema", "latest", nil)
+		require.NoError(t, err)
+
+		_, err = p.Organizations.CreateNamespaceTemplate(org.Id, "b", "schema", "1", nil)
+		assert.Equal(t, services.ErrTemplateAlreadyExists, err)
+		_, err = p.Organizations.CreateNamespaceTemplate(other.Id, "b", "schema", "1", nil)
+		assert.NoError(t, err)
+
+		templates, err := p.Organizations.ListNamespaceTemplates(org.Id)
+		require.NoError(t, err)
+		require.Len(t, templates, 2)
+		assert.Equal(t, a.Id, templates[0].Id)
+		assert.Equal(t, b.Id, templates[1].Id)
+
+		found, err := p.Organizations.GetNamespaceTemplate(org.Id, b.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "1", found.SchemaVersion)
+		assert.Equal(t, map[string]string{"env": "prod"}, found.Variables)
+
+		_, err = p.Organizations.GetNamespaceTemplate(other.Id, b.Id)
+		assert.Equal(t, services.ErrTemplateNotFound, err)
+		assert.Equal(t, services.ErrTemplateNotFound, p.Organizations.DeleteNamespaceTemplate(other.Id, b.Id))
+
+		require.NoError(t, p.Organizations.DeleteNamespaceTemplate(org.Id, b.Id))
+		_, err = p.Organizations.GetNamespaceTemplate(org.Id, b.Id)
+		assert.Equal(t, services.ErrTemplateNotFound, err)
+		assert.Equal(t, services.ErrTemplateNotFound, p.Organizations.DeleteNamespaceTemplate(org.Id, b.Id))
+	})
+}
@@ -0,0 +1,110 @@
+package servicestest
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunRoleBindingProviderSuite checks the behaviour of services.RoleBindingProvider
+func RunRoleBindingProviderSuite(t *testing.T, factory Factory) {
+	bind := func(t *testing.T, p *services.Providers, orgId string, subject string, role string, resourceType string, resourceId string) *services.RoleBinding {
+		binding, err := services.NewRoleBinding(orgId, subject, role, resourceType, resourceId)
+		require.NoError(t, err)
+		require.NoError(t, p.RoleBindings.CreateRoleBinding(binding))
+		return binding
+	}
+
+	t.Run("CreateAndList", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		admin := bind(t, p, org.Id, "apikey:1", services.RoleOrgAdmin, "", "")
+		owner := bind(t, p, org.Id, "user:alice", services.RoleNamespaceOwner, services.RoleBindingResourceNamespace, "ns-1")
+		resolver := bind(t, p, org.Id, "user:alice", services.RoleResolver, services.RoleBindingResourceSchema, "schema-1")
+		bind(t, p, other.Id, "user:alice", services.RoleOrgAdmin, "", "")
+
+		bindings, err := p.RoleBindings.ListRoleBindings(org.Id)
+		require.NoError(t, err)
+		expected := []*services.RoleBinding{admin, owner, resolver}
+		sort.Slice(expected, func(i, j int) bool {
+			return expected[i].Id < expected[j].Id
+		})
+		assert.Equal(t, expected, bindings)
+
+		bindings, err = p.RoleBindings.ListSubjectRoleBindings(org.Id, "user:alice")
+		require.NoError(t, err)
+		require.Len(t, bindings, 2)
+		for _, b := range bindings {
+			assert.Equal(t, "user:alice", b.Subject)
+			assert.Equal(t, org.Id, b.OrganizationId)
+		}
+
+		bindings, err = p.RoleBindings.ListSubjectRoleBindings(org.Id, "user:nobody")
+		require.NoError(t, err)
+		assert.Empty(t, bindings)
+	})
+
+	t.Run("DuplicateIsRejected", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+
+		bind(t, p, org.Id, "user:bob", services.RoleResolver, services.RoleBindingResourceNamespace, "ns-1")
+
+		again, err := services.NewRoleBinding(org.Id, "user:bob", services.RoleResolver, services.RoleBindingResourceNamespace, "ns-1")
+		require.NoError(t, err)
+		assert.Equal(t, services.ErrRoleBindingExists, p.RoleBindings.CreateRoleBinding(again))
+
+		// The same role on another resource is a different binding
+		bind(t, p, org.Id, "user:bob", services.RoleResolver, services.RoleBindingResourceNamespace, "ns-2")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		binding := bind(t, p, org.Id, "user:carol", services.RoleSchemaAuthor, "", "")
+		found, err := p.RoleBindings.GetRoleBinding(org.Id, binding.Id)
+		require.NoError(t, err)
+		assert.Equal(t, binding, found)
+		_, err = p.RoleBindings.GetRoleBinding(other.Id, binding.Id)
+		assert.Equal(t, services.ErrRoleBindingNotFound, err)
+		assert.Equal(t, services.ErrRoleBindingNotFound, p.RoleBindings.DeleteRoleBinding(other.Id, binding.Id))
+
+		require.NoError(t, p.RoleBindings.DeleteRoleBinding(org.Id, binding.Id))
+		assert.Equal(t, services.ErrRoleBindingNotFound, p.RoleBindings.DeleteRoleBinding(org.Id, binding.Id))
+
+		_, err = p.RoleBindings.GetRoleBinding(org.Id, binding.Id)
+		assert.Equal(t, services.ErrRoleBindingNotFound, err)
+
+		bindings, err := p.RoleBindings.ListRoleBindings(org.Id)
+		require.NoError(t, err)
+		assert.Empty(t, bindings)
+	})
+
+	t.Run("DeleteSubject", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		bind(t, p, org.Id, "apikey:2", services.RoleResolver, "", "")
+		bind(t, p, org.Id, "apikey:2", services.RoleSchemaAuthor, services.RoleBindingResourceSchema, "schema-1")
+		kept := bind(t, p, org.Id, "apikey:3", services.RoleResolver, "", "")
+		elsewhere := bind(t, p, other.Id, "apikey:2", services.RoleResolver, "", "")
+
+		require.NoError(t, p.RoleBindings.DeleteSubjectRoleBindings(org.Id, "apikey:2"))
+
+		bindings, err := p.RoleBindings.ListRoleBindings(org.Id)
+		require.NoError(t, err)
+		assert.Equal(t, []*services.RoleBinding{kept}, bindings)
+
+		bindings, err = p.RoleBindings.ListRoleBindings(other.Id)
+		require.NoError(t, err)
+		assert.Equal(t, []*services.RoleBinding{elsewhere}, bindings)
+	})
+}
@@ -0,0 +1,205 @@
+package servicestest
+
+import (
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunSchemaProviderSuite checks the behaviour of services.SchemaServiceProvider
+func RunSchemaProviderSuite(t *testing.T, factory Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		schema := newSchema(t, p, org.Id)
+		found, err := p.Schemas.GetSchemaById(org.Id, schema.Id)
+		require.NoError(t, err)
+		assert.Equal(t, schema, found)
+
+		sv, err := p.Schemas.GetSchemaVersion(org.Id, schema.Id, "latest")
+		require.NoError(t, err)
+		assert.Equal(t, 1, sv.Id)
+		assert.False(t, sv.Published)
+		assert.Empty(t, sv.Resources)
+
+		_, err = p.Schemas.CreateSchema(org.Id, schema.Name)
+		assert.Equal(t, services.ErrSchemaAlreadyExists, err)
+		_, err = p.Schemas.CreateSchema(other.Id, schema.Name)
+		assert.NoError(t, err)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+
+		for _, schemaId := range []string{uuid.NewString(), schema.Id} {
+			found, err := p.Schemas.GetSchemaById(other.Id, schemaId)
+			assert.NoError(t, err)
+			assert.Nil(t, found)
+
+			_, err = p.Schemas.ListSchemaVersions(other.Id, schemaId)
+			assert.Equal(t, services.ErrSchemaNotFound, err)
+			_, err = p.Schemas.GetSchemaVersion(other.Id, schemaId, "latest")
+			assert.Equal(t, services.ErrSchemaNotFound, err)
+			_, err = p.Schemas.CreateSchemaVersion(other.Id, schemaId, nil, false)
+			assert.Equal(t, services.ErrSchemaNotFound, err)
+			_, err = p.Schemas.UpdateSchemaVersion(other.Id, schemaId, "1", nil, false, 0)
+			assert.Equal(t, services.ErrSchemaNotFound, err)
+			assert.Equal(t, services.ErrSchemaNotFound, updateSchema(p, services.Schema{Id: schemaId, OrganizationId: other.Id, Name: "x"}))
+			assert.Equal(t, services.ErrSchemaNotFound, p.Schemas.DeleteSchema(other.Id, schemaId, 0))
+		}
+	})
+
+	t.Run("ListIsOrderedAndIsolated", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		other := newOrganization(t, p)
+
+		for _, name := range []string{"b", "c", "a"} {
+			_, err := p.Schemas.CreateSchema(org.Id, name)
+			require.NoError(t, err)
+		}
+		newSchema(t, p, other.Id)
+
+		schemas, err := p.Schemas.ListSchemaInOrganization(org.Id)
+		require.NoError(t, err)
+		var names []string
+		for _, schema := range schemas {
+			assert.Equal(t, org.Id, schema.OrganizationId)
+			names = append(names, schema.Name)
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, names)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+		taken := newSchema(t, p, org.Id)
+
+		schema.Name = uniqueName("renamed")
+		require.NoError(t, updateSchema(p, *schema))
+		found, err := p.Schemas.GetSchemaById(org.Id, schema.Id)
+		require.NoError(t, err)
+		assert.Equal(t, schema.Name, found.Name)
+
+		found.Name = taken.Name
+		assert.Equal(t, services.ErrSchemaAlreadyExists, updateSchema(p, *found))
+	})
+
+	t.Run("Revisions", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+		assert.Equal(t, 1, schema.Revision)
+
+		renamed := *schema
+		renamed.Name = uniqueName("renamed")
+		updated, err := p.Schemas.UpdateSchema(renamed)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.Revision)
+		assert.Equal(t, renamed.Name, updated.Name)
+		found, err := p.Schemas.GetSchemaById(org.Id, schema.Id)
+		require.NoError(t, err)
+		assert.Equal(t, 2, found.Revision)
+
+		assert.Equal(t, services.ErrRevisionMismatch, updateSchema(p, renamed))
+		assert.Equal(t, services.ErrRevisionMismatch, p.Schemas.DeleteSchema(org.Id, schema.Id, schema.Revision))
+
+		sv, err := p.Schemas.GetSchemaVersion(org.Id, schema.Id, "1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, sv.Revision)
+		updatedVersion, err := p.Schemas.UpdateSchemaVersion(org.Id, schema.Id, "1", map[string]string{"vm": "vm-{env}"}, false, sv.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updatedVersion.Revision)
+		_, err = p.Schemas.UpdateSchemaVersion(org.Id, schema.Id, "1", nil, false, sv.Revision)
+		assert.Equal(t, services.ErrRevisionMismatch, err)
+		sv, err = p.Schemas.GetSchemaVersion(org.Id, schema.Id, "1")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"vm": "vm-{env}"}, sv.Resources)
+
+		require.NoError(t, p.Schemas.DeleteSchema(org.Id, schema.Id, updated.Revision))
+		assert.Equal(t, services.ErrSchemaNotFound, p.Schemas.DeleteSchema(org.Id, schema.Id, updated.Revision))
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+
+		v2, err := p.Schemas.CreateSchemaVersion(org.Id, schema.Id, map[string]string{"vm": "vm-{env}"}, true)
+		require.NoError(t, err)
+		assert.Equal(t, 2, v2.Id)
+		v3, err := p.Schemas.CreateSchemaVersion(org.Id, schema.Id, map[string]string{"vm": "vm-{env}-{index}"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, v3.Id)
+
+		versions, err := p.Schemas.ListSchemaVersions(org.Id, schema.Id)
+		require.NoError(t, err)
+		var ids []int
+		for _, sv := range versions {
+			ids = append(ids, sv.Id)
+		}
+		assert.Equal(t, []int{1, 2, 3}, ids)
+
+		latest, err := p.Schemas.GetSchemaVersion(org.Id, schema.Id, "latest")
+		require.NoError(t, err)
+		assert.Equal(t, 3, latest.Id)
+		assert.Equal(t, map[string]string{"vm": "vm-{env}-{index}"}, latest.Resources)
+
+		found, err := p.Schemas.GetSchemaVersion(org.Id, schema.Id, "2")
+		require.NoError(t, err)
+		assert.True(t, found.Published)
+		assert.Equal(t, map[string]string{"vm": "vm-{env}"}, found.Resources)
+
+		for _, versionId := range []string{"99", "0", "first"} {
+			_, err = p.Schemas.GetSchemaVersion(org.Id, schema.Id, versionId)
+			assert.Equal(t, services.ErrSchemaVersionNotFound, err, versionId)
+		}
+
+		updated, err := p.Schemas.UpdateSchemaVersion(org.Id, schema.Id, "2", map[string]string{"vm": "vm-{region}"}, false, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.Id)
+		found, err = p.Schemas.GetSchemaVersion(org.Id, schema.Id, "2")
+		require.NoError(t, err)
+		assert.False(t, found.Published)
+		assert.Equal(t, map[string]string{"vm": "vm-{region}"}, found.Resources)
+
+		_, err = p.Schemas.UpdateSchemaVersion(org.Id, schema.Id, "99", nil, false, 0)
+		assert.Equal(t, services.ErrSchemaVersionNotFound, err)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+
+		require.NoError(t, p.Schemas.DeleteSchema(org.Id, schema.Id, 0))
+		found, err := p.Schemas.GetSchemaById(org.Id, schema.Id)
+		assert.NoError(t, err)
+		assert.Nil(t, found)
+		_, err = p.Schemas.ListSchemaVersions(org.Id, schema.Id)
+		assert.Equal(t, services.ErrSchemaNotFound, err)
+		assert.Equal(t, services.ErrSchemaNotFound, p.Schemas.DeleteSchema(org.Id, schema.Id, 0))
+	})
+
+	t.Run("DeleteInUse", func(t *testing.T) {
+		p := factory(t)
+		org := newOrganization(t, p)
+		schema := newSchema(t, p, org.Id)
+
+		ns, err := p.Namespaces.CreateNamespace(org.Id, "prod", "", schema.Id, "1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, services.ErrSchemaInUse, p.Schemas.DeleteSchema(org.Id, schema.Id, 0))
+
+		require.NoError(t, p.Namespaces.DeleteNamespace(org.Id, ns.Id, 0))
+		assert.NoError(t, p.Schemas.DeleteSchema(org.Id, schema.Id, 0))
+	})
+}
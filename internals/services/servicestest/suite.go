@@ -0,0 +1,61 @@
+// Package servicestest is a conformance suite for the provider interfaces in services.
+// Every storage backend runs it to prove it behaves the same as the others.
+package servicestest
+
+import (
+	"testing"
+
+	"github.com/MrWestbury/terraxen-naming-service/internals/services"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns the providers of the backend under test. The suites only look at data
+// they create themselves, so a factory may hand out providers over a shared database.
+type Factory func(t *testing.T) *services.Providers
+
+// RunProvidersSuite runs the suite of every provider interface
+func RunProvidersSuite(t *testing.T, factory Factory) {
+	t.Run("ApiKeys", func(t *testing.T) { RunApiKeyProviderSuite(t, factory) })
+	t.Run("Organizations", func(t *testing.T) { RunOrganizationProviderSuite(t, factory) })
+	t.Run("Schemas", func(t *testing.T) { RunSchemaProviderSuite(t, factory) })
+	t.Run("Namespaces", func(t *testing.T) { RunNamespaceProviderSuite(t, factory) })
+	t.Run("Audit", func(t *testing.T) { RunAuditProviderSuite(t, factory) })
+	t.Run("VariableHistory", func(t *testing.T) { RunVariableHistoryProviderSuite(t, factory) })
+	t.Run("RoleBindings", func(t *testing.T) { RunRoleBindingProviderSuite(t, factory) })
+	t.Run("Bootstrap", func(t *testing.T) { RunBootstrapSuite(t, factory) })
+}
+
+// uniqueName returns a name that no other test run will use
+func uniqueName(prefix string) string {
+	return prefix + "-" + uuid.NewString()
+}
+
+// newOrganization creates an organization that is purged again when the test ends
+func newOrganization(t *testing.T, p *services.Providers) *services.Organization {
+	org, err := p.Organizations.NewOrganization(uniqueName("servicestest"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		p.Organizations.PurgeOrganization(org.Id)
+	})
+	return org
+}
+
+// newSchema creates a schema with a single, empty version in the organization
+func newSchema(t *testing.T, p *services.Providers, orgId string) *services.Schema {
+	schema, err := p.Schemas.CreateSchema(orgId, uniqueName("schema"))
+	require.NoError(t, err)
+	return schema
+}
+
+// updateNamespace updates a namespace without checking its revision
+func updateNamespace(p *services.Providers, orgId string, nsId string, name string, parentId string, schemaVersion string) error {
+	_, err := p.Namespaces.UpdateNamespace(orgId, nsId, name, parentId, schemaVersion, 0)
+	return err
+}
+
+// updateSchema updates a schema at the revision it carries
+func updateSchema(p *services.Providers, schema services.Schema) error {
+	_, err := p.Schemas.UpdateSchema(schema)
+	return err
+}
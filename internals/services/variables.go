@@ -0,0 +1,65 @@
+package services
+
+import "sort"
+
+// VariableChangeSummary lists the variable keys affected by a bulk change
+type VariableChangeSummary struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged []string `json:"unchanged"`
+	// Revision of the namespace after the change, sent back as the ETag
+	Revision int `json:"-"`
+}
+
+// DiffVariables works out the changes needed to turn the current variables into the desired ones
+func DiffVariables(current map[string]string, desired map[string]string) *VariableChangeSummary {
+	summary := &VariableChangeSummary{
+		Created:   []string{},
+		Updated:   []string{},
+		Deleted:   []string{},
+		Unchanged: []string{},
+	}
+
+	for k, v := range desired {
+		oldValue, found := current[k]
+		switch {
+		case !found:
+			summary.Created = append(summary.Created, k)
+		case oldValue != v:
+			summary.Updated = append(summary.Updated, k)
+		default:
+			summary.Unchanged = append(summary.Unchanged, k)
+		}
+	}
+	for k := range current {
+		if _, found := desired[k]; !found {
+			summary.Deleted = append(summary.Deleted, k)
+		}
+	}
+
+	sort.Strings(summary.Created)
+	sort.Strings(summary.Updated)
+	sort.Strings(summary.Deleted)
+	sort.Strings(summary.Unchanged)
+	return summary
+}
+
+// ApplyVariablePatch returns the variables that result from upserting and deleting keys in current
+func ApplyVariablePatch(current map[string]string, upserts map[string]string, deletes []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for k, v := range current {
+		result[k] = v
+	}
+
+	for _, k := range deletes {
+		if _, found := upserts[k]; found {
+			return nil, ErrInvalidVariablePatch
+		}
+		delete(result, k)
+	}
+	for k, v := range upserts {
+		result[k] = v
+	}
+	return result, nil
+}
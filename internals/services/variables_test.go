@@ -0,0 +1,30 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffVariables(t *testing.T) {
+	current := map[string]string{"env": "dev", "team": "core", "region": "uks"}
+	desired := map[string]string{"env": "prod", "team": "core", "owner": "adam"}
+
+	summary := DiffVariables(current, desired)
+	assert.Equal(t, []string{"owner"}, summary.Created)
+	assert.Equal(t, []string{"env"}, summary.Updated)
+	assert.Equal(t, []string{"region"}, summary.Deleted)
+	assert.Equal(t, []string{"team"}, summary.Unchanged)
+}
+
+func TestApplyVariablePatch(t *testing.T) {
+	current := map[string]string{"env": "dev", "team": "core"}
+
+	result, err := ApplyVariablePatch(current, map[string]string{"env": "prod"}, []string{"team", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, result)
+	assert.Equal(t, "dev", current["env"])
+
+	_, err = ApplyVariablePatch(current, map[string]string{"env": "prod"}, []string{"env"})
+	assert.Equal(t, ErrInvalidVariablePatch, err)
+}